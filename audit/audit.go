@@ -0,0 +1,133 @@
+// Package audit is the optional SQLite audit store of transitions, which
+// survives restarts unlike the in-memory history.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/flashbots/go-bob-firewall/audit/migrations"
+	"github.com/jmoiron/sqlx"
+	migrate "github.com/rubenv/sql-migrate"
+	_ "modernc.org/sqlite" // Pure Go, so the binary stays static
+)
+
+// Record is a transition outcome in the audit store.
+type Record struct {
+	ID          int64             `json:"id"`
+	Time        time.Time         `json:"time"`
+	To          string            `json:"to"`
+	Result      string            `json:"result"`
+	Mode        string            `json:"mode"`
+	RequestedBy string            `json:"requested_by"`
+	Initiator   string            `json:"initiator"`
+	Generation  uint64            `json:"generation"`
+	Completion  string            `json:"completion,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+}
+
+// row is a Record as stored, with the time in Unix nanoseconds and the labels
+// as JSON.
+type row struct {
+	ID          int64  `db:"id"`
+	Time        int64  `db:"time"`
+	To          string `db:"to_mode"`
+	Result      string `db:"result"`
+	Mode        string `db:"mode"`
+	RequestedBy string `db:"requested_by"`
+	Initiator   string `db:"initiator"`
+	Generation  uint64 `db:"generation"`
+	Completion  string `db:"completion"`
+	Labels      string `db:"labels"`
+}
+
+// Store is an audit store in a SQLite database file. Records older than the
+// retention are removed whenever a record is added.
+type Store struct {
+	db        *sqlx.DB
+	retention time.Duration // Records are kept forever if zero
+}
+
+// Open opens the audit store at path, creating it if needed, and applies the
+// pending migrations.
+func Open(path string, retention time.Duration) (*Store, error) {
+	db, err := sqlx.Connect("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite serializes writes anyway
+	db.SetMaxOpenConns(1)
+
+	// Not migrate.SetTable, which would change the table of the database
+	// package as well
+	ms := migrate.MigrationSet{TableName: migrations.TableMigrations}
+	if _, err := ms.Exec(db.DB, "sqlite3", migrations.Migrations, migrate.Up); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db, retention: retention}, nil
+}
+
+// Add records a transition outcome and removes the expired records.
+func (s *Store) Add(ctx context.Context, rec Record) error {
+	labels, err := json.Marshal(rec.Labels)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.NamedExecContext(ctx, `
+		INSERT INTO transitions (time, to_mode, result, mode, requested_by, initiator, generation, completion, labels)
+		VALUES (:time, :to_mode, :result, :mode, :requested_by, :initiator, :generation, :completion, :labels)`,
+		row{
+			Time:        rec.Time.UnixNano(),
+			To:          rec.To,
+			Result:      rec.Result,
+			Mode:        rec.Mode,
+			RequestedBy: rec.RequestedBy,
+			Initiator:   rec.Initiator,
+			Generation:  rec.Generation,
+			Completion:  rec.Completion,
+			Labels:      string(labels),
+		})
+	if err != nil {
+		return err
+	}
+
+	if s.retention > 0 {
+		_, err = s.db.ExecContext(ctx, `DELETE FROM transitions WHERE time < ?`, rec.Time.Add(-s.retention).UnixNano())
+	}
+	return err
+}
+
+// Query returns up to limit records at or after since, oldest first.
+func (s *Store) Query(ctx context.Context, since time.Time, limit int) ([]Record, error) {
+	var rows []row
+	err := s.db.SelectContext(ctx, &rows, `SELECT * FROM transitions WHERE time >= ? ORDER BY time, id LIMIT ?`, since.UnixNano(), limit)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]Record, 0, len(rows))
+	for _, r := range rows {
+		rec := Record{
+			ID:          r.ID,
+			Time:        time.Unix(0, r.Time).UTC(),
+			To:          r.To,
+			Result:      r.Result,
+			Mode:        r.Mode,
+			RequestedBy: r.RequestedBy,
+			Initiator:   r.Initiator,
+			Generation:  r.Generation,
+			Completion:  r.Completion,
+		}
+		if err := json.Unmarshal([]byte(r.Labels), &rec.Labels); err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
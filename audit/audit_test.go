@@ -0,0 +1,75 @@
+package audit
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "audit.db")
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	s, err := Open(path, time.Hour)
+	require.NoError(t, err)
+	for i, to := range []string{"production", "maintenance", "production"} {
+		require.NoError(t, s.Add(ctx, Record{
+			Time:        start.Add(time.Duration(i) * time.Minute),
+			To:          to,
+			Result:      "completed",
+			Mode:        to,
+			RequestedBy: "alice",
+			Initiator:   "manual",
+			Generation:  uint64(i + 1),
+			Labels:      map[string]string{"rack": "a1"},
+		}))
+	}
+
+	records, err := s.Query(ctx, time.Time{}, 10)
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	require.Equal(t, Record{
+		ID:          1,
+		Time:        start,
+		To:          "production",
+		Result:      "completed",
+		Mode:        "production",
+		RequestedBy: "alice",
+		Initiator:   "manual",
+		Generation:  1,
+		Labels:      map[string]string{"rack": "a1"},
+	}, records[0])
+
+	records, err = s.Query(ctx, start.Add(time.Minute), 1)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.Equal(t, "maintenance", records[0].To)
+	require.NoError(t, s.Close())
+
+	// The records survive reopening, and expire after the retention
+	s, err = Open(path, time.Hour)
+	require.NoError(t, err)
+	defer s.Close()
+	require.NoError(t, s.Add(ctx, Record{Time: start.Add(time.Hour + time.Minute), To: "maintenance", Result: "reverted"}))
+	records, err = s.Query(ctx, time.Time{}, 10)
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	require.Equal(t, []uint64{2, 3, 0}, []uint64{records[0].Generation, records[1].Generation, records[2].Generation})
+	require.Nil(t, records[2].Labels)
+}
+
+func TestStoreMigrations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.db")
+	for range 2 {
+		s, err := Open(path, 0)
+		require.NoError(t, err)
+		var applied int
+		require.NoError(t, s.db.Get(&applied, `SELECT COUNT(*) FROM migrations`))
+		require.Equal(t, 1, applied)
+		require.NoError(t, s.Close())
+	}
+}
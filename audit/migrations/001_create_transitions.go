@@ -0,0 +1,29 @@
+package migrations
+
+import (
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+var Migration001CreateTransitions = &migrate.Migration{
+	Id: "001-create-transitions",
+	Up: []string{`
+		CREATE TABLE IF NOT EXISTS transitions (
+			id           INTEGER PRIMARY KEY AUTOINCREMENT,
+			time         INTEGER NOT NULL,
+			to_mode      TEXT NOT NULL,
+			result       TEXT NOT NULL,
+			mode         TEXT NOT NULL,
+			requested_by TEXT NOT NULL,
+			initiator    TEXT NOT NULL,
+			generation   INTEGER NOT NULL,
+			completion   TEXT NOT NULL,
+			labels       TEXT NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS transitions_time ON transitions (time);
+	`},
+	Down: []string{`
+		DROP TABLE IF EXISTS transitions;
+	`},
+	DisableTransactionUp:   false,
+	DisableTransactionDown: false,
+}
@@ -0,0 +1,15 @@
+// Package migrations contains the migrations of the audit store
+package migrations
+
+import (
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+// TableMigrations records the applied migrations in the audit store.
+const TableMigrations = "migrations"
+
+var Migrations = migrate.MemoryMigrationSource{
+	Migrations: []*migrate.Migration{
+		Migration001CreateTransitions,
+	},
+}
@@ -0,0 +1,116 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const DefaultTimeout = 10 * time.Second
+
+// InitiatorHeader declares what initiated a transition request, e.g.
+// "scheduled" for a cron job or "cascade" for an ordered drain. The server
+// counts transitions by initiator and treats unknown values as "manual".
+const InitiatorHeader = "X-Firewall-Initiator"
+
+// Client calls the firewall HTTP API of a single node.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	initiator  string // Optional - sent as InitiatorHeader
+	token      string // Optional - sent as bearer token
+}
+
+// New returns a client for the API at baseURL, e.g. http://10.0.0.2:8080.
+func New(baseURL string) *Client {
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: DefaultTimeout},
+	}
+}
+
+// WithInitiator returns a copy of the client declaring the given initiator of
+// its transitions.
+func (c *Client) WithInitiator(initiator string) *Client {
+	cp := *c
+	cp.initiator = initiator
+	return &cp
+}
+
+// WithToken returns a copy of the client authenticating with the given bearer
+// token, for servers started with an auth token.
+func (c *Client) WithToken(token string) *Client {
+	cp := *c
+	cp.token = token
+	return &cp
+}
+
+// APIError is returned if the API responds with an error status. Code is the
+// rejection code of rejected transitions, e.g. "cooldown", and Reason the
+// failure reason, e.g. "APPLY_FAILED".
+type APIError struct {
+	StatusCode int
+	Message    string
+	Code       string // Optional
+	Reason     string // Optional
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("firewall API error %d: %s", e.StatusCode, e.Message)
+}
+
+// IsBrokenConnection reports whether err is a connection dropped by the peer
+// in the middle of a request or response, e.g. a broken pipe. The request may
+// or may not have been processed, so it's worth retrying if that's safe.
+func IsBrokenConnection(err error) bool {
+	return errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// Transition starts the transition to the given mode, maintenance or
+// production.
+func (c *Client) Transition(ctx context.Context, mode string) error {
+	body, err := json.Marshal(map[string]string{"mode": mode})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/firewall/transition", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.initiator != "" {
+		req.Header.Set(InitiatorHeader, c.initiator)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		apiErr := &APIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+		var rejection struct {
+			Error  string `json:"error"`
+			Code   string `json:"code"`
+			Reason string `json:"reason"`
+		}
+		if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") && json.Unmarshal(msg, &rejection) == nil {
+			apiErr.Message, apiErr.Code, apiErr.Reason = rejection.Error, rejection.Code, rejection.Reason
+		}
+		return apiErr
+	}
+	return nil
+}
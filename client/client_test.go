@@ -0,0 +1,78 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransition(t *testing.T) {
+	var got map[string]string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, "/firewall/transition", r.URL.Path)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		switch got["mode"] {
+		case "maintenance":
+		case "production":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error":"minimum dwell time not elapsed","code":"cooldown","reason":"COOLDOWN_ACTIVE"}`))
+		default:
+			http.Error(w, "invalid transition", http.StatusBadRequest)
+		}
+	}))
+	defer ts.Close()
+
+	c := New(ts.URL + "/")
+	require.NoError(t, c.Transition(context.Background(), "maintenance"))
+	require.Equal(t, map[string]string{"mode": "maintenance"}, got)
+
+	err := c.Transition(context.Background(), "nope")
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	require.Equal(t, "invalid transition", apiErr.Message)
+	require.Empty(t, apiErr.Code)
+
+	// Rejections carry a code
+	err = c.Transition(context.Background(), "production")
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, http.StatusTooManyRequests, apiErr.StatusCode)
+	require.Equal(t, "minimum dwell time not elapsed", apiErr.Message)
+	require.Equal(t, "cooldown", apiErr.Code)
+	require.Equal(t, "COOLDOWN_ACTIVE", apiErr.Reason)
+}
+
+func TestTransitionToken(t *testing.T) {
+	var got []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get("Authorization"))
+	}))
+	defer ts.Close()
+
+	c := New(ts.URL)
+	require.NoError(t, c.Transition(context.Background(), "maintenance"))
+	require.NoError(t, c.WithToken("secret").Transition(context.Background(), "maintenance"))
+	require.Equal(t, []string{"", "Bearer secret"}, got)
+}
+
+func TestTransitionBrokenConnection(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, err := http.NewResponseController(w).Hijack()
+		require.NoError(t, err)
+		_, _ = buf.WriteString("HTTP/1.1 200 OK\r\nContent-Type: application/json\r\n")
+		_ = buf.Flush()
+		conn.Close()
+	}))
+	defer ts.Close()
+
+	err := New(ts.URL).Transition(context.Background(), "maintenance")
+	require.Error(t, err)
+	require.True(t, IsBrokenConnection(err), err)
+	require.False(t, IsBrokenConnection(&APIError{StatusCode: http.StatusConflict}))
+}
@@ -0,0 +1,82 @@
+// Package client contains helpers for consumers of the firewall HTTP API.
+package client
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StatusSignatureHeader carries the signature of a JSON status response, if
+// the server is configured with a signing key. StatusTimestampHeader carries
+// the signing time in Unix seconds, which is signed along with the body so
+// old responses can't be replayed.
+const (
+	StatusSignatureHeader = "X-Firewall-Signature"
+	StatusTimestampHeader = "X-Firewall-Signature-Timestamp"
+)
+
+// DefaultMaxSignatureSkew is the maximum difference between the signing time
+// and the local time accepted by VerifyStatus if no other is given.
+const DefaultMaxSignatureSkew = 5 * time.Minute
+
+const signaturePrefix = "sha256="
+
+var (
+	ErrMissingSignature = errors.New("missing status signature")
+	ErrInvalidSignature = errors.New("invalid status signature")
+	ErrStaleSignature   = errors.New("status signature timestamp outside the allowed skew")
+)
+
+// SignStatus returns the signature of a status response body signed at the
+// given time, in the form `sha256=<hex encoded HMAC-SHA256>`, and the
+// timestamp to send in the StatusTimestampHeader.
+func SignStatus(key, body []byte, at time.Time) (signature, timestamp string) {
+	timestamp = strconv.FormatInt(at.Unix(), 10)
+	return signaturePrefix + hex.EncodeToString(statusMAC(key, body, timestamp)), timestamp
+}
+
+func statusMAC(key, body []byte, timestamp string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// VerifyStatus checks the signature and timestamp of a status response body,
+// as received in the StatusSignatureHeader and StatusTimestampHeader. The body
+// must be passed exactly as received. Signatures made more than maxSkew
+// before or after now are rejected, DefaultMaxSignatureSkew is used if zero.
+func VerifyStatus(key, body []byte, timestamp, signature string, maxSkew time.Duration) error {
+	if signature == "" || timestamp == "" {
+		return ErrMissingSignature
+	}
+	encoded, ok := strings.CutPrefix(signature, signaturePrefix)
+	if !ok {
+		return ErrInvalidSignature
+	}
+	sum, err := hex.DecodeString(encoded)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal(sum, statusMAC(key, body, timestamp)) {
+		return ErrInvalidSignature
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if maxSkew == 0 {
+		maxSkew = DefaultMaxSignatureSkew
+	}
+	if skew := time.Since(time.Unix(unix, 0)).Abs(); skew > maxSkew {
+		return ErrStaleSignature
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusSignature(t *testing.T) {
+	key := []byte("secret")
+	body := []byte(`{"mode":"production"}`)
+	sig, ts := SignStatus(key, body, time.Now())
+
+	require.NoError(t, VerifyStatus(key, body, ts, sig, 0))
+	require.ErrorIs(t, VerifyStatus([]byte("other"), body, ts, sig, 0), ErrInvalidSignature)
+	require.ErrorIs(t, VerifyStatus(key, []byte(`{"mode":"maintenance"}`), ts, sig, 0), ErrInvalidSignature)
+	require.ErrorIs(t, VerifyStatus(key, body, ts, "sha256=zz", 0), ErrInvalidSignature)
+	require.ErrorIs(t, VerifyStatus(key, body, ts, sig[len("sha256="):], 0), ErrInvalidSignature)
+	require.ErrorIs(t, VerifyStatus(key, body, ts, "", 0), ErrMissingSignature)
+	require.ErrorIs(t, VerifyStatus(key, body, "", sig, 0), ErrMissingSignature)
+
+	// The timestamp is signed too
+	other, _ := SignStatus(key, body, time.Now().Add(-time.Minute))
+	require.ErrorIs(t, VerifyStatus(key, body, ts, other, 0), ErrInvalidSignature)
+}
+
+func TestStatusSignatureSkew(t *testing.T) {
+	key := []byte("secret")
+	body := []byte(`{"mode":"production"}`)
+
+	sig, ts := SignStatus(key, body, time.Now().Add(-time.Minute))
+	require.NoError(t, VerifyStatus(key, body, ts, sig, 0))
+	require.ErrorIs(t, VerifyStatus(key, body, ts, sig, 30*time.Second), ErrStaleSignature)
+
+	sig, ts = SignStatus(key, body, time.Now().Add(-time.Hour))
+	require.ErrorIs(t, VerifyStatus(key, body, ts, sig, 0), ErrStaleSignature)
+
+	// Clocks may be ahead as well
+	sig, ts = SignStatus(key, body, time.Now().Add(time.Hour))
+	require.ErrorIs(t, VerifyStatus(key, body, ts, sig, 0), ErrStaleSignature)
+}
@@ -1,14 +1,23 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/flashbots/go-bob-firewall/common"
 	"github.com/flashbots/go-bob-firewall/httpserver"
+	"github.com/flashbots/go-bob-firewall/metrics"
 	"github.com/google/uuid"
 	"github.com/urfave/cli/v2" // imports as package "cli"
 )
@@ -39,21 +48,378 @@ var flags []cli.Flag = []cli.Flag{
 		Value: false,
 		Usage: "generate a uuid and add to all log messages",
 	},
+	&cli.StringFlag{
+		Name:  "log-file",
+		Value: "",
+		Usage: "file to write logs to instead of stdout, re-opened on SIGHUP",
+	},
 	&cli.StringFlag{
 		Name:  "log-service",
 		Value: "your-project",
 		Usage: "add 'service' tag to logs",
 	},
+	&cli.StringFlag{
+		Name:  "log-dedup-interval",
+		Value: "0s",
+		Usage: "collapse identical warnings and errors repeated within this interval into a count (0 to log every message)",
+	},
 	&cli.BoolFlag{
 		Name:  "pprof",
 		Value: false,
 		Usage: "enable pprof debug endpoint",
 	},
+	&cli.BoolFlag{
+		Name:  "debug",
+		Value: false,
+		Usage: "enable debug endpoints, e.g. /firewall/routes",
+	},
 	&cli.Int64Flag{
 		Name:  "drain-seconds",
 		Value: 45,
 		Usage: "seconds to wait in drain HTTP request",
 	},
+	&cli.StringFlag{
+		Name:  "transition-duration",
+		Value: "5m",
+		Usage: "how long to drain connections before applying maintenance rules (0 applies them immediately)",
+	},
+	&cli.StringFlag{
+		Name:  "transition-wait-timeout",
+		Value: httpserver.DefaultTransitionWaitTimeout.String(),
+		Usage: "how long /firewall/maintenance?wait=true waits for the transition to complete",
+	},
+	&cli.StringFlag{
+		Name:  "maintenance-lease",
+		Value: "0s",
+		Usage: "return to production unless maintenance is renewed within this duration (0 disables leases)",
+	},
+	&cli.StringFlag{
+		Name:  "config-check-interval",
+		Value: "0s",
+		Usage: "how often to check the config of the current mode with nft -c, not ready while invalid (0 disables the check)",
+	},
+	&cli.StringFlag{
+		Name:  "probation-window",
+		Value: "0s",
+		Usage: "how long production restored on startup is on probation (0 disables probation)",
+	},
+	&cli.StringFlag{
+		Name:  "probation-self-test",
+		Value: "",
+		Usage: "command run during probation, a failure reverts to maintenance",
+	},
+	&cli.StringFlag{
+		Name:  "probation-check-interval",
+		Value: httpserver.DefaultProbationCheckInterval.String(),
+		Usage: "how often to run the self-test during probation",
+	},
+	&cli.StringFlag{
+		Name:  "idempotency-key-ttl",
+		Value: "0s",
+		Usage: "how long transition results are replayed to retries with the same Idempotency-Key header (0 ignores the header)",
+	},
+	&cli.StringFlag{
+		Name:  "production-probe",
+		Value: "",
+		Usage: "command run after every transition to production to confirm the host is serving (empty disables the probe)",
+	},
+	&cli.StringFlag{
+		Name:  "production-probe-url",
+		Value: "",
+		Usage: "URL requested after every transition to production instead of the probe command, must respond with a 2xx status",
+	},
+	&cli.StringFlag{
+		Name:  "production-probe-window",
+		Value: "0s",
+		Usage: "poll the production probe until it passes within this window (0 runs it once)",
+	},
+	&cli.StringFlag{
+		Name:  "production-probe-interval",
+		Value: httpserver.DefaultProductionProbeInterval.String(),
+		Usage: "how often to poll the production probe during its window",
+	},
+	&cli.StringFlag{
+		Name:  "production-probe-timeout",
+		Value: httpserver.DefaultProductionProbeTimeout.String(),
+		Usage: "maximum duration of a production probe run",
+	},
+	&cli.BoolFlag{
+		Name:  "revert-on-probe-failure",
+		Value: false,
+		Usage: "transition back to maintenance if the production probe fails",
+	},
+	&cli.StringSliceFlag{
+		Name:  "pre-apply-hook",
+		Usage: "command run before applying the rules of a mode as 'mode=command', e.g. 'production=/usr/local/bin/notify-lb up', can be repeated",
+	},
+	&cli.StringSliceFlag{
+		Name:  "post-apply-hook",
+		Usage: "command run after applying the rules of a mode as 'mode=command', can be repeated",
+	},
+	&cli.StringFlag{
+		Name:  "hook-timeout",
+		Value: httpserver.DefaultHookTimeout.String(),
+		Usage: "maximum duration of a pre-apply or post-apply hook",
+	},
+	&cli.BoolFlag{
+		Name:  "abort-on-pre-hook-failure",
+		Value: false,
+		Usage: "abort the apply, and with it the transition, if the pre-apply hook fails",
+	},
+	&cli.StringFlag{
+		Name:  "snapshot-dir",
+		Value: "",
+		Usage: "save the live ruleset to a timestamped file in this directory before every apply (empty disables snapshots)",
+	},
+	&cli.IntFlag{
+		Name:  "snapshot-retention",
+		Value: httpserver.DefaultSnapshotRetention,
+		Usage: "number of ruleset snapshots to keep",
+	},
+	&cli.StringFlag{
+		Name:  "audit-db",
+		Value: "",
+		Usage: "SQLite database recording every transition, queryable with /firewall/audit (empty disables the audit store)",
+	},
+	&cli.StringFlag{
+		Name:  "audit-retention",
+		Value: httpserver.DefaultAuditRetention.String(),
+		Usage: "how long transitions are kept in the audit store",
+	},
+	&cli.StringFlag{
+		Name:  "agent-socket",
+		Value: "",
+		Usage: "apply rulesets through the privileged agent listening on this Unix socket instead of running nft",
+	},
+	&cli.StringFlag{
+		Name:  "agent-timeout",
+		Value: httpserver.DefaultAgentTimeout.String(),
+		Usage: "maximum duration of an apply through the agent",
+	},
+	&cli.BoolFlag{
+		Name:  "redirect-trailing-slash",
+		Value: false,
+		Usage: "redirect paths with a trailing slash to the path without it",
+	},
+	&cli.BoolFlag{
+		Name:  "case-insensitive-paths",
+		Value: false,
+		Usage: "match routes regardless of the case of the path",
+	},
+	&cli.StringFlag{
+		Name:  "status-timeout",
+		Value: httpserver.DefaultStatusTimeout.String(),
+		Usage: "how long status requests wait for a lock held by a slow apply before responding with 503",
+	},
+	&cli.BoolFlag{
+		Name:  "strict-content-negotiation",
+		Value: false,
+		Usage: "respond with 406 if no supported content type is acceptable, instead of falling back to plain text",
+	},
+	&cli.BoolFlag{
+		Name:  "reject-while-not-ready",
+		Value: false,
+		Usage: "respond with 503 to all requests except health checks while not ready",
+	},
+	&cli.BoolFlag{
+		Name:  "watch-rulesets",
+		Value: false,
+		Usage: "re-apply the ruleset of the current mode when its file changes",
+	},
+	&cli.StringFlag{
+		Name:  "watch-debounce",
+		Value: "1s",
+		Usage: "how long ruleset file changes must settle before re-applying",
+	},
+	&cli.StringFlag{
+		Name:  "drain-poll-interval",
+		Value: "0s",
+		Usage: "complete the maintenance transition early once connections drained, checked this often (0 disables)",
+	},
+	&cli.IntFlag{
+		Name:  "drain-threshold",
+		Value: 0,
+		Usage: "number of tracked connections at or below which the drain is complete",
+	},
+	&cli.StringFlag{
+		Name:  "quiet-period",
+		Value: "0s",
+		Usage: "reject transition requests with 503 for this long after startup (0 disables)",
+	},
+	&cli.StringFlag{
+		Name:  "heartbeat-timeout",
+		Value: "0s",
+		Usage: "force maintenance unless POST /firewall/heartbeat is called at least this often (0 disables)",
+	},
+	&cli.StringFlag{
+		Name:  "startup-warmup",
+		Value: "0s",
+		Usage: "how long to report not-ready on /readyz after startup",
+	},
+	&cli.StringFlag{
+		Name:  "auth-tokens-file",
+		Value: "",
+		Usage: "JSON file mapping bearer tokens required for control endpoints to the modes they may trigger, e.g. {\"token\": [\"maintenance\"]} (an empty list allows all)",
+	},
+	&cli.StringFlag{
+		Name:  "auth-token-file",
+		Value: "",
+		Usage: "file with a bearer token required for control endpoints, allowed to trigger all modes",
+	},
+	&cli.BoolFlag{
+		Name:  "protect-status",
+		Value: false,
+		Usage: "require an auth token for /firewall/status too",
+	},
+	&cli.StringFlag{
+		Name:  "identity-header",
+		Value: "",
+		Usage: "header with the authenticated user set by a reverse proxy, e.g. X-Forwarded-User",
+	},
+	&cli.StringSliceFlag{
+		Name:  "trusted-proxy",
+		Usage: "CIDR of a reverse proxy trusted to set the identity header, can be repeated",
+	},
+	&cli.StringFlag{
+		Name:  "maintenance-config",
+		Value: httpserver.DefaultConfigPaths[httpserver.Maintenance],
+		Usage: "ruleset applied in maintenance mode (.conf/.nft script or .json)",
+	},
+	&cli.StringFlag{
+		Name:  "production-config",
+		Value: httpserver.DefaultConfigPaths[httpserver.Production],
+		Usage: "ruleset applied in production mode (.conf/.nft script or .json)",
+	},
+	&cli.StringFlag{
+		Name:  "transition-config",
+		Value: httpserver.DefaultConfigPaths[httpserver.TransitionToMaintenance],
+		Usage: "ruleset added while transitioning to maintenance (.conf/.nft script or .json)",
+	},
+	&cli.StringFlag{
+		Name:  "lockdown-config",
+		Value: httpserver.DefaultConfigPaths[httpserver.Lockdown],
+		Usage: "ruleset applied in lockdown, denying all but management traffic (.conf/.nft script or .json)",
+	},
+	&cli.StringFlag{
+		Name:  "nft-binary",
+		Value: httpserver.DefaultNFTBinary,
+		Usage: "path of the nft binary",
+	},
+	&cli.BoolFlag{
+		Name:  "require-config-files",
+		Value: false,
+		Usage: "fail on startup if nft or the ruleset of any mode doesn't exist",
+	},
+	&cli.StringFlag{
+		Name:  "min-dwell-maintenance",
+		Value: "0s",
+		Usage: "minimum time in maintenance before transitioning to production",
+	},
+	&cli.StringFlag{
+		Name:  "min-dwell-production",
+		Value: "0s",
+		Usage: "minimum time in production before transitioning to maintenance",
+	},
+	&cli.StringSliceFlag{
+		Name:  "transition-cooldown",
+		Usage: "minimum time in a mode before transitioning to another as 'from->to=duration', e.g. 'maintenance->production=10m', can be repeated",
+	},
+	&cli.IntFlag{
+		Name:  "fatal-exit-code",
+		Value: 0,
+		Usage: "exit code if a failed transition can't be reverted (panics if 0)",
+	},
+	&cli.StringFlag{
+		Name:  "downstream-url",
+		Value: "",
+		Usage: "API of the next controller in an ordered drain, told to start its maintenance transition once this one completed",
+	},
+	&cli.StringFlag{
+		Name:  "downstream-token-file",
+		Value: "",
+		Usage: "file with the bearer token of the downstream controller",
+	},
+	&cli.StringSliceFlag{
+		Name:  "read-allowed-cidr",
+		Usage: "CIDR allowed to access read-only endpoints, e.g. status and health (all if unset), can be repeated",
+	},
+	&cli.StringSliceFlag{
+		Name:  "control-allowed-cidr",
+		Usage: "CIDR allowed to access control endpoints, e.g. transitions (all if unset), can be repeated",
+	},
+	&cli.StringSliceFlag{
+		Name:  "label",
+		Usage: "metadata of the node as 'key=value', e.g. 'rack=a1', included in the status and transition outcomes, can be repeated",
+	},
+	&cli.StringFlag{
+		Name:  "nft-workdir",
+		Value: "",
+		Usage: "working directory of nft, which relative includes are resolved from (defaults to the directory of each ruleset)",
+	},
+	&cli.StringSliceFlag{
+		Name:  "response-header",
+		Usage: "header set on every response as 'Name: value' (an empty value removes a default header), can be repeated",
+	},
+	&cli.StringFlag{
+		Name:  "state-file",
+		Value: "",
+		Usage: "file to persist the firewall state across restarts",
+	},
+	&cli.StringFlag{
+		Name:  "outcome-log-file",
+		Value: "",
+		Usage: "file to append one JSON line per transition outcome to",
+	},
+	&cli.StringFlag{
+		Name:  "syslog-facility",
+		Value: "",
+		Usage: "send transition outcomes to the local syslog with this facility, e.g. daemon or local0 (disabled if empty)",
+	},
+	&cli.StringFlag{
+		Name:  "syslog-tag",
+		Value: httpserver.DefaultSyslogTag,
+		Usage: "syslog tag of transition outcomes",
+	},
+	&cli.StringFlag{
+		Name:  "status-signing-key-file",
+		Value: "",
+		Usage: "file with a key to sign JSON status responses with HMAC-SHA256",
+	},
+	&cli.StringSliceFlag{
+		Name:  "experimental-feature",
+		Usage: "enable an experimental feature, can be repeated",
+	},
+	&cli.BoolFlag{
+		Name:  "apply-on-startup",
+		Value: false,
+		Usage: "apply the rules of the persisted mode (or maintenance) on startup",
+	},
+	&cli.IntFlag{
+		Name:  "startup-apply-retries",
+		Value: httpserver.DefaultStartupApplyRetries,
+		Usage: "how often to retry a failed startup apply before giving up (-1 disables retries)",
+	},
+	&cli.StringFlag{
+		Name:  "startup-apply-backoff",
+		Value: httpserver.DefaultStartupApplyBackoff.String(),
+		Usage: "delay before the first startup apply retry, doubled for every further retry",
+	},
+	&cli.BoolFlag{
+		Name:    "reject-transitions-on-drift",
+		Value:   false,
+		Usage:   "reject transitions while the live ruleset differs from the one recorded after the last apply",
+		EnvVars: []string{"REJECT_TRANSITIONS_ON_DRIFT"},
+	},
+	&cli.BoolFlag{
+		Name:  "coalesce-transitions",
+		Value: false,
+		Usage: "let identical concurrent transition requests share a single transition",
+	},
+	&cli.BoolFlag{
+		Name:  "maintenance-on-shutdown",
+		Value: false,
+		Usage: "transition to maintenance mode when shutting down",
+	},
 }
 
 func main() {
@@ -68,19 +434,214 @@ func main() {
 			logUID := cCtx.Bool("log-uid")
 			logService := cCtx.String("log-service")
 			drainDuration := time.Duration(cCtx.Int64("drain-seconds")) * time.Second
+			maintenanceOnShutdown := cCtx.Bool("maintenance-on-shutdown")
+			stateFile := cCtx.String("state-file")
+			var statusSigningKey []byte
+			if path := cCtx.String("status-signing-key-file"); path != "" {
+				key, err := os.ReadFile(path)
+				if err != nil {
+					return err
+				}
+				statusSigningKey = bytes.TrimSpace(key)
+			}
+			experimentalFeatures := make(map[string]bool)
+			for _, feature := range cCtx.StringSlice("experimental-feature") {
+				experimentalFeatures[feature] = true
+			}
+			transitionDuration, err := common.ParseDuration("transition-duration", cCtx.String("transition-duration"), common.DurationBounds{AllowZero: true})
+			if err != nil {
+				return err
+			}
+			labels := make(map[string]string)
+			for _, label := range cCtx.StringSlice("label") {
+				key, value, ok := strings.Cut(label, "=")
+				if !ok || key == "" {
+					return fmt.Errorf("invalid label %q: expected 'key=value'", label)
+				}
+				labels[key] = value
+			}
+			hooks := make(map[string]map[httpserver.FirewallMode][]string)
+			for _, name := range []string{"pre-apply-hook", "post-apply-hook"} {
+				hooks[name] = make(map[httpserver.FirewallMode][]string)
+				for _, hook := range cCtx.StringSlice(name) {
+					mode, cmd, _ := strings.Cut(hook, "=")
+					fm, err := httpserver.ParseFirewallMode(mode)
+					if err != nil || len(strings.Fields(cmd)) == 0 {
+						return fmt.Errorf("invalid %s %q: expected 'mode=command'", name, hook)
+					}
+					hooks[name][fm] = strings.Fields(cmd)
+				}
+			}
+			var authTokens map[string][]string
+			if path := cCtx.String("auth-tokens-file"); path != "" {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					return fmt.Errorf("could not read auth tokens: %w", err)
+				}
+				if err := json.Unmarshal(data, &authTokens); err != nil {
+					return fmt.Errorf("invalid auth tokens file %s: %w", path, err)
+				}
+			}
+			var authToken string
+			if path := cCtx.String("auth-token-file"); path != "" {
+				token, err := os.ReadFile(path)
+				if err != nil {
+					return fmt.Errorf("could not read auth token: %w", err)
+				}
+				authToken = string(bytes.TrimSpace(token))
+			}
+			var downstreamToken string
+			if path := cCtx.String("downstream-token-file"); path != "" {
+				token, err := os.ReadFile(path)
+				if err != nil {
+					return fmt.Errorf("could not read downstream token: %w", err)
+				}
+				downstreamToken = string(bytes.TrimSpace(token))
+			}
+			responseHeaders := make(map[string]string)
+			for _, header := range cCtx.StringSlice("response-header") {
+				name, value, ok := strings.Cut(header, ":")
+				if !ok {
+					return fmt.Errorf("invalid response header %q: expected 'Name: value'", header)
+				}
+				responseHeaders[strings.TrimSpace(name)] = strings.TrimSpace(value)
+			}
+			startupApplyBackoff, err := common.ParseDuration("startup-apply-backoff", cCtx.String("startup-apply-backoff"), common.DurationBounds{})
+			if err != nil {
+				return err
+			}
+			maintenanceLease, err := common.ParseDuration("maintenance-lease", cCtx.String("maintenance-lease"), common.DurationBounds{AllowZero: true})
+			if err != nil {
+				return err
+			}
+			configCheckInterval, err := common.ParseDuration("config-check-interval", cCtx.String("config-check-interval"), common.DurationBounds{AllowZero: true})
+			if err != nil {
+				return err
+			}
+			probationWindow, err := common.ParseDuration("probation-window", cCtx.String("probation-window"), common.DurationBounds{AllowZero: true})
+			if err != nil {
+				return err
+			}
+			probationCheckInterval, err := common.ParseDuration("probation-check-interval", cCtx.String("probation-check-interval"), common.DurationBounds{})
+			if err != nil {
+				return err
+			}
+			idempotencyKeyTTL, err := common.ParseDuration("idempotency-key-ttl", cCtx.String("idempotency-key-ttl"), common.DurationBounds{AllowZero: true})
+			if err != nil {
+				return err
+			}
+			minDwell := make(map[httpserver.FirewallMode]time.Duration)
+			for _, fm := range []httpserver.FirewallMode{httpserver.Maintenance, httpserver.Production} {
+				name := "min-dwell-" + fm.String()
+				minDwell[fm], err = common.ParseDuration(name, cCtx.String(name), common.DurationBounds{AllowZero: true})
+				if err != nil {
+					return err
+				}
+			}
+			cooldowns := make(map[httpserver.ModePair]time.Duration)
+			for _, cooldown := range cCtx.StringSlice("transition-cooldown") {
+				p, d, _ := strings.Cut(cooldown, "=")
+				pair, err := httpserver.ParseModePair(p)
+				if err != nil {
+					return fmt.Errorf("invalid transition-cooldown %q: %w", cooldown, err)
+				}
+				cooldowns[pair], err = common.ParseDuration("transition-cooldown "+p, d, common.DurationBounds{AllowZero: true})
+				if err != nil {
+					return err
+				}
+			}
+			watchDebounce, err := common.ParseDuration("watch-debounce", cCtx.String("watch-debounce"), common.DurationBounds{})
+			if err != nil {
+				return err
+			}
+			drainPollInterval, err := common.ParseDuration("drain-poll-interval", cCtx.String("drain-poll-interval"), common.DurationBounds{AllowZero: true})
+			if err != nil {
+				return err
+			}
+			quietPeriod, err := common.ParseDuration("quiet-period", cCtx.String("quiet-period"), common.DurationBounds{AllowZero: true})
+			if err != nil {
+				return err
+			}
+			heartbeatTimeout, err := common.ParseDuration("heartbeat-timeout", cCtx.String("heartbeat-timeout"), common.DurationBounds{AllowZero: true})
+			if err != nil {
+				return err
+			}
+			startupWarmup, err := common.ParseDuration("startup-warmup", cCtx.String("startup-warmup"), common.DurationBounds{AllowZero: true})
+			if err != nil {
+				return err
+			}
+			productionProbeTimeout, err := common.ParseDuration("production-probe-timeout", cCtx.String("production-probe-timeout"), common.DurationBounds{})
+			if err != nil {
+				return err
+			}
+			productionProbeWindow, err := common.ParseDuration("production-probe-window", cCtx.String("production-probe-window"), common.DurationBounds{AllowZero: true})
+			if err != nil {
+				return err
+			}
+			productionProbeInterval, err := common.ParseDuration("production-probe-interval", cCtx.String("production-probe-interval"), common.DurationBounds{})
+			if err != nil {
+				return err
+			}
+			agentTimeout, err := common.ParseDuration("agent-timeout", cCtx.String("agent-timeout"), common.DurationBounds{})
+			if err != nil {
+				return err
+			}
+			auditRetention, err := common.ParseDuration("audit-retention", cCtx.String("audit-retention"), common.DurationBounds{})
+			if err != nil {
+				return err
+			}
+			hookTimeout, err := common.ParseDuration("hook-timeout", cCtx.String("hook-timeout"), common.DurationBounds{})
+			if err != nil {
+				return err
+			}
+			transitionWaitTimeout, err := common.ParseDuration("transition-wait-timeout", cCtx.String("transition-wait-timeout"), common.DurationBounds{})
+			if err != nil {
+				return err
+			}
+			statusTimeout, err := common.ParseDuration("status-timeout", cCtx.String("status-timeout"), common.DurationBounds{})
+			if err != nil {
+				return err
+			}
+			logDedupInterval, err := common.ParseDuration("log-dedup-interval", cCtx.String("log-dedup-interval"), common.DurationBounds{AllowZero: true})
+			if err != nil {
+				return err
+			}
+
+			// Everything to be re-opened or reloaded on SIGHUP
+			var reloaders []func() error
+
+			var logOutput io.Writer
+			if logFile := cCtx.String("log-file"); logFile != "" {
+				f, err := common.OpenReopenableFile(logFile)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				logOutput = f
+				reloaders = append(reloaders, f.Reopen)
+			}
 
 			log := common.SetupLogger(&common.LoggingOpts{
 				Debug:   logDebug,
 				JSON:    logJSON,
 				Service: logService,
 				Version: common.Version,
+				Output:  logOutput,
+
+				DedupInterval: logDedupInterval,
 			})
+			defer common.CloseLogger(log)
 
 			if logUID {
 				id := uuid.Must(uuid.NewRandom())
 				log = log.With("uid", id.String())
 			}
 
+			metricsSrv, err := metrics.New(common.PackageName, cCtx.String("metrics-addr"))
+			if err != nil {
+				return err
+			}
+
 			cfg := &httpserver.HTTPServerConfig{
 				ListenAddr: listenAddr,
 				Log:        log,
@@ -89,6 +650,91 @@ func main() {
 				GracefulShutdownDuration: 30 * time.Second,
 				ReadTimeout:              60 * time.Second,
 				WriteTimeout:             30 * time.Second,
+				IdleTimeout:              httpserver.DefaultIdleTimeout,
+				ReadHeaderTimeout:        httpserver.DefaultReadHeaderTimeout,
+				MaxHeaderBytes:           httpserver.DefaultMaxHeaderBytes,
+				TCPKeepAlive:             httpserver.DefaultTCPKeepAlive,
+				StartupWarmupDuration:    startupWarmup,
+				RejectWhileNotReady:      cCtx.Bool("reject-while-not-ready"),
+				RedirectTrailingSlash:    cCtx.Bool("redirect-trailing-slash"),
+				CaseInsensitivePaths:     cCtx.Bool("case-insensitive-paths"),
+				ResponseHeaders:          responseHeaders,
+				EnablePprof:              cCtx.Bool("pprof"),
+				Debug:                    cCtx.Bool("debug"),
+
+				IdentityHeader: cCtx.String("identity-header"),
+				TrustedProxies: cCtx.StringSlice("trusted-proxy"),
+
+				ReadAllowedCIDRs:    cCtx.StringSlice("read-allowed-cidr"),
+				ControlAllowedCIDRs: cCtx.StringSlice("control-allowed-cidr"),
+				AuthTokens:          authTokens,
+				AuthToken:           authToken,
+				ProtectStatus:       cCtx.Bool("protect-status"),
+
+				Firewall: httpserver.FirewallConfig{
+					TransitionDuration:      transitionDuration,
+					ImmediateTransition:     transitionDuration == 0,
+					ModeDurationsRollover:   24 * time.Hour,
+					MaintenanceOnShutdown:   maintenanceOnShutdown,
+					ExperimentalFeatures:    experimentalFeatures,
+					StateFile:               stateFile,
+					StatusSigningKey:        statusSigningKey,
+					OutcomeLogFile:          cCtx.String("outcome-log-file"),
+					SyslogFacility:          cCtx.String("syslog-facility"),
+					SyslogTag:               cCtx.String("syslog-tag"),
+					Labels:                  labels,
+					MetricsRegisterer:       metricsSrv.Registerer(),
+					DownstreamURL:           cCtx.String("downstream-url"),
+					DownstreamToken:         downstreamToken,
+					FatalExitCode:           cCtx.Int("fatal-exit-code"),
+					MinDwell:                minDwell,
+					TransitionCooldowns:     cooldowns,
+					WorkDir:                 cCtx.String("nft-workdir"),
+					HeartbeatTimeout:        heartbeatTimeout,
+					WatchRulesets:           cCtx.Bool("watch-rulesets"),
+					WatchDebounce:           watchDebounce,
+					QuietPeriod:             quietPeriod,
+					DrainPollInterval:       drainPollInterval,
+					DrainThreshold:          cCtx.Int("drain-threshold"),
+					ApplyOnStartup:          cCtx.Bool("apply-on-startup"),
+					StartupApplyRetries:     cCtx.Int("startup-apply-retries"),
+					StartupApplyBackoff:     startupApplyBackoff,
+					CoalesceTransitions:     cCtx.Bool("coalesce-transitions"),
+					MaintenanceLeaseTTL:     maintenanceLease,
+					ConfigCheckInterval:     configCheckInterval,
+					ProbationWindow:         probationWindow,
+					ProbationSelfTest:       strings.Fields(cCtx.String("probation-self-test")),
+					ProbationCheckInterval:  probationCheckInterval,
+					IdempotencyKeyTTL:       idempotencyKeyTTL,
+					ProductionProbe:         strings.Fields(cCtx.String("production-probe")),
+					ProductionProbeURL:      cCtx.String("production-probe-url"),
+					ProductionProbeTimeout:  productionProbeTimeout,
+					ProductionProbeWindow:   productionProbeWindow,
+					ProductionProbeInterval: productionProbeInterval,
+					RevertOnProbeFailure:    cCtx.Bool("revert-on-probe-failure"),
+					AgentSocket:             cCtx.String("agent-socket"),
+					AgentTimeout:            agentTimeout,
+					PreApplyHooks:           hooks["pre-apply-hook"],
+					PostApplyHooks:          hooks["post-apply-hook"],
+					HookTimeout:             hookTimeout,
+					AbortOnPreHookFailure:   cCtx.Bool("abort-on-pre-hook-failure"),
+					SnapshotDir:             cCtx.String("snapshot-dir"),
+					SnapshotRetention:       cCtx.Int("snapshot-retention"),
+					AuditDB:                 cCtx.String("audit-db"),
+					AuditRetention:          auditRetention,
+					ConfigPaths: map[httpserver.FirewallMode]string{
+						httpserver.Maintenance:             cCtx.String("maintenance-config"),
+						httpserver.Production:              cCtx.String("production-config"),
+						httpserver.TransitionToMaintenance: cCtx.String("transition-config"),
+						httpserver.Lockdown:                cCtx.String("lockdown-config"),
+					},
+					NFTBinary:                cCtx.String("nft-binary"),
+					RequireConfigFiles:       cCtx.Bool("require-config-files"),
+					RejectTransitionsOnDrift: cCtx.Bool("reject-transitions-on-drift"),
+					StrictContentNegotiation: cCtx.Bool("strict-content-negotiation"),
+					StatusTimeout:            statusTimeout,
+					TransitionWaitTimeout:    transitionWaitTimeout,
+				},
 			}
 
 			srv, err := httpserver.New(cfg)
@@ -97,13 +743,39 @@ func main() {
 				return err
 			}
 
+			stopReload := common.OnSignal(func() {
+				for _, reload := range reloaders {
+					if err := reload(); err != nil {
+						log.Error("reload on SIGHUP failed", "err", err)
+					}
+				}
+			}, syscall.SIGHUP)
+			defer stopReload()
+
+			// Go only fails writes to a broken pipe with EPIPE on other
+			// descriptors, while on stdout and stderr it's killed by SIGPIPE.
+			// The logs go there, so a log collector which died mustn't take
+			// the firewall down with it
+			signal.Ignore(syscall.SIGPIPE)
+
 			exit := make(chan os.Signal, 1)
 			signal.Notify(exit, os.Interrupt, syscall.SIGTERM)
 			srv.RunInBackground()
-			<-exit
+			go func() {
+				log.Info("Starting metrics server", "listenAddress", cCtx.String("metrics-addr"))
+				if err := metricsSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					log.Error("metrics server failed", "err", err)
+				}
+			}()
+			sig := <-exit
 
 			// Shutdown server once termination signal is received
-			srv.Shutdown()
+			srv.Shutdown(httpserver.ShutdownSignal(sig))
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := metricsSrv.Shutdown(ctx); err != nil {
+				log.Error("metrics server shutdown failed", "err", err)
+			}
 			return nil
 		},
 	}
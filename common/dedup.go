@@ -0,0 +1,164 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxDedupEntries bounds the remembered messages, expired ones are dropped
+// beyond it.
+const maxDedupEntries = 1024
+
+// dedupHandler collapses repeated identical warnings and errors, e.g. of an
+// apply failing again and again: the first occurrence is logged, further
+// ones within the interval are only counted. Once the interval passed, the
+// message is logged again with the count of the collapsed ones as
+// `repeated`, by the next occurrence or, if there is none, by the periodic
+// flush. Close flushes the pending counts right away.
+type dedupHandler struct {
+	next     slog.Handler
+	interval time.Duration
+	now      func() time.Time
+	prefix   string // Attrs and groups added to the handler, part of the key
+
+	state *dedupState // Shared by handlers derived with WithAttrs and WithGroup
+}
+
+type dedupState struct {
+	mu      sync.Mutex
+	entries map[string]*dedupEntry
+
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+type dedupEntry struct {
+	logged    time.Time
+	collapsed int
+
+	// The last collapsed record and the handler it was logged with, to
+	// report the count if the message isn't repeated after the interval
+	record  slog.Record
+	handler slog.Handler
+}
+
+// newDedupHandler creates the handler and starts flushing the counts of
+// collapsed messages every interval, until it's closed.
+func newDedupHandler(next slog.Handler, interval time.Duration) *dedupHandler {
+	h := &dedupHandler{
+		next:     next,
+		interval: interval,
+		now:      time.Now,
+		state:    &dedupState{entries: make(map[string]*dedupEntry), stop: make(chan struct{})},
+	}
+	go h.flushPeriodically()
+	return h
+}
+
+func (h *dedupHandler) flushPeriodically() {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.state.stop:
+			return
+		case <-ticker.C:
+			h.flush(false)
+		}
+	}
+}
+
+// flush logs the collapsed messages not logged for the interval with their
+// count, or all of them if force is set.
+func (h *dedupHandler) flush(force bool) {
+	now := h.now()
+	var pending []*dedupEntry
+	h.state.mu.Lock()
+	for _, e := range h.state.entries {
+		if e.collapsed > 0 && (force || now.Sub(e.logged) >= h.interval) {
+			r := e.record.Clone()
+			r.Time = now
+			r.AddAttrs(slog.Int("repeated", e.collapsed))
+			pending = append(pending, &dedupEntry{record: r, handler: e.handler})
+			e.logged, e.collapsed = now, 0
+		}
+	}
+	h.state.mu.Unlock()
+
+	for _, e := range pending {
+		_ = e.handler.Handle(context.Background(), e.record)
+	}
+}
+
+// Close stops the periodic flush and logs the pending counts.
+func (h *dedupHandler) Close() error {
+	h.state.closeOnce.Do(func() {
+		close(h.state.stop)
+		h.flush(true)
+	})
+	return nil
+}
+
+func (h *dedupHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *dedupHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level < slog.LevelWarn {
+		return h.next.Handle(ctx, r)
+	}
+
+	var key strings.Builder
+	fmt.Fprintf(&key, "%s|%s|%s", h.prefix, r.Level, r.Message)
+	r.Attrs(func(a slog.Attr) bool {
+		fmt.Fprintf(&key, "|%s", a)
+		return true
+	})
+
+	now := h.now()
+	h.state.mu.Lock()
+	entry, ok := h.state.entries[key.String()]
+	if ok && now.Sub(entry.logged) < h.interval {
+		entry.collapsed++
+		entry.record, entry.handler = r.Clone(), h.next
+		h.state.mu.Unlock()
+		return nil
+	}
+	collapsed := 0
+	if ok {
+		collapsed = entry.collapsed
+	}
+	h.state.entries[key.String()] = &dedupEntry{logged: now}
+	if len(h.state.entries) > maxDedupEntries {
+		for k, e := range h.state.entries {
+			if now.Sub(e.logged) >= h.interval && e.collapsed == 0 {
+				delete(h.state.entries, k)
+			}
+		}
+	}
+	h.state.mu.Unlock()
+
+	if collapsed > 0 {
+		r = r.Clone()
+		r.AddAttrs(slog.Int("repeated", collapsed))
+	}
+	return h.next.Handle(ctx, r)
+}
+
+func (h *dedupHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	c.next = h.next.WithAttrs(attrs)
+	c.prefix = fmt.Sprintf("%s%v", h.prefix, attrs)
+	return &c
+}
+
+func (h *dedupHandler) WithGroup(name string) slog.Handler {
+	c := *h
+	c.next = h.next.WithGroup(name)
+	c.prefix = h.prefix + "." + name
+	return &c
+}
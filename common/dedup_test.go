@@ -0,0 +1,108 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDedupHandlerCollapsesRepeatedErrors(t *testing.T) {
+	var buf bytes.Buffer
+	now := time.Now()
+	handler := newDedupHandler(slog.NewTextHandler(&buf, nil), time.Minute)
+	t.Cleanup(func() { handler.Close() })
+	handler.now = func() time.Time { return now }
+	log := slog.New(handler).With("service", "test")
+
+	lines := func() []string {
+		return strings.Split(strings.TrimSpace(buf.String()), "\n")
+	}
+
+	for range 10 {
+		log.Error("failed to apply", "err", errors.New("nft: exit status 1"))
+	}
+	log.Error("failed to apply", "err", errors.New("other"))
+	log.Info("status", "mode", "maintenance")
+	log.Info("status", "mode", "maintenance")
+	require.Len(t, lines(), 4)
+	require.NotContains(t, buf.String(), "repeated=")
+
+	now = now.Add(time.Minute)
+	log.Error("failed to apply", "err", errors.New("nft: exit status 1"))
+	require.Len(t, lines(), 5)
+	require.Contains(t, lines()[4], "repeated=9")
+
+	now = now.Add(time.Minute)
+	log.Error("failed to apply", "err", errors.New("nft: exit status 1"))
+	require.Len(t, lines(), 6)
+	require.NotContains(t, lines()[5], "repeated=")
+}
+
+func TestDedupHandlerFlushesAfterErrorsStop(t *testing.T) {
+	var buf bytes.Buffer
+	now := time.Now()
+	handler := newDedupHandler(slog.NewTextHandler(&buf, nil), time.Minute)
+	handler.now = func() time.Time { return now }
+	log := slog.New(handler).With("service", "test")
+
+	lines := func() []string {
+		return strings.Split(strings.TrimSpace(buf.String()), "\n")
+	}
+
+	for range 3 {
+		log.Error("failed to apply", "err", errors.New("nft: exit status 1"))
+	}
+	handler.flush(false)
+	require.Len(t, lines(), 1)
+
+	// The count is reported once the interval passed, without another error
+	now = now.Add(time.Minute)
+	handler.flush(false)
+	require.Len(t, lines(), 2)
+	require.Contains(t, lines()[1], `msg="failed to apply" service=test err="nft: exit status 1" repeated=2`)
+	handler.flush(false)
+	require.Len(t, lines(), 2)
+
+	// Close reports the pending counts before the interval passed
+	log.Error("failed to apply", "err", errors.New("nft: exit status 1"))
+	require.Len(t, lines(), 2)
+	require.NoError(t, handler.Close())
+	require.Len(t, lines(), 3)
+	require.Contains(t, lines()[2], "repeated=1")
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestDedupHandlerPeriodicFlush(t *testing.T) {
+	var buf syncBuffer
+	log := SetupLogger(&LoggingOpts{Output: &buf, DedupInterval: 10 * time.Millisecond})
+	t.Cleanup(func() { CloseLogger(log) })
+
+	log.Warn("drift detected")
+	log.Warn("drift detected")
+	require.Eventually(t, func() bool {
+		return strings.Contains(buf.String(), "repeated=1")
+	}, time.Second, time.Millisecond)
+}
@@ -0,0 +1,35 @@
+package common
+
+import (
+	"fmt"
+	"time"
+)
+
+// DurationBounds restricts the values accepted by ParseDuration. Negative
+// durations are always rejected.
+type DurationBounds struct {
+	AllowZero bool
+	Min       time.Duration // Optional - no lower bound beyond zero if unset
+	Max       time.Duration // Optional - no upper bound if unset
+}
+
+// ParseDuration parses a human readable duration such as "90s" or "5m" for
+// the config option with the given name, and checks it against the bounds.
+func ParseDuration(name, value string, bounds DurationBounds) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: expected a duration like 30s or 5m", name, value)
+	}
+
+	switch {
+	case d < 0:
+		return 0, fmt.Errorf("invalid %s %q: must not be negative", name, value)
+	case d == 0 && !bounds.AllowZero:
+		return 0, fmt.Errorf("invalid %s %q: must be greater than zero", name, value)
+	case d != 0 && bounds.Min > 0 && d < bounds.Min:
+		return 0, fmt.Errorf("invalid %s %q: must be at least %s", name, value, bounds.Min)
+	case bounds.Max > 0 && d > bounds.Max:
+		return 0, fmt.Errorf("invalid %s %q: must be at most %s", name, value, bounds.Max)
+	}
+	return d, nil
+}
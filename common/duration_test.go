@@ -0,0 +1,40 @@
+package common
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		value   string
+		bounds  DurationBounds
+		want    time.Duration
+		wantErr string
+	}{
+		{value: "5m", want: 5 * time.Minute},
+		{value: "1h30m", want: 90 * time.Minute},
+		{value: "0s", bounds: DurationBounds{AllowZero: true}, want: 0},
+		{value: "0s", wantErr: "must be greater than zero"},
+		{value: "-5s", wantErr: "must not be negative"},
+		{value: "-5s", bounds: DurationBounds{AllowZero: true}, wantErr: "must not be negative"},
+		{value: "5", wantErr: "expected a duration"},
+		{value: "five minutes", wantErr: "expected a duration"},
+		{value: "", wantErr: "expected a duration"},
+		{value: "500ms", bounds: DurationBounds{Min: time.Second}, wantErr: "must be at least 1s"},
+		{value: "2h", bounds: DurationBounds{Max: time.Hour}, wantErr: "must be at most 1h0m0s"},
+		{value: "0s", bounds: DurationBounds{AllowZero: true, Min: time.Second}, want: 0},
+	}
+	for _, tt := range tests {
+		d, err := ParseDuration("transition-duration", tt.value, tt.bounds)
+		if tt.wantErr != "" {
+			require.ErrorContains(t, err, tt.wantErr, tt.value)
+			require.ErrorContains(t, err, "transition-duration", tt.value)
+			continue
+		}
+		require.NoError(t, err, tt.value)
+		require.Equal(t, tt.want, d, tt.value)
+	}
+}
@@ -0,0 +1,75 @@
+package common
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+)
+
+// ReopenableFile is an append-only file which can be re-opened at the same
+// path, e.g. after it was moved away by logrotate.
+type ReopenableFile struct {
+	path string
+
+	mu sync.Mutex
+	f  *os.File
+}
+
+func OpenReopenableFile(path string) (*ReopenableFile, error) {
+	f := &ReopenableFile{path: path}
+	if err := f.Reopen(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *ReopenableFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.f.Write(p)
+}
+
+// Reopen closes the current file and opens the path again, creating the file
+// if it doesn't exist.
+func (f *ReopenableFile) Reopen() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.f != nil {
+		f.f.Close()
+	}
+	f.f = file
+	return nil
+}
+
+func (f *ReopenableFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.f.Close()
+}
+
+// OnSignal calls fn every time one of the signals is received, until the
+// returned function is called.
+func OnSignal(fn func(), sigs ...os.Signal) (stop func()) {
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, sigs...)
+	go func() {
+		for {
+			select {
+			case <-ch:
+				fn()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
@@ -0,0 +1,44 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReopenableFileOnSignal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.log")
+	f, err := OpenReopenableFile(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	stop := OnSignal(func() { require.NoError(t, f.Reopen()) }, syscall.SIGHUP)
+	defer stop()
+
+	_, err = f.Write([]byte("before\n"))
+	require.NoError(t, err)
+
+	// Rotate the file, like logrotate does
+	require.NoError(t, os.Rename(path, path+".1"))
+	p, err := os.FindProcess(os.Getpid())
+	require.NoError(t, err)
+	require.NoError(t, p.Signal(syscall.SIGHUP))
+
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}, time.Second, time.Millisecond)
+	_, err = f.Write([]byte("after\n"))
+	require.NoError(t, err)
+
+	rotated, err := os.ReadFile(path + ".1")
+	require.NoError(t, err)
+	require.Equal(t, "before\n", string(rotated))
+	current, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "after\n", string(current))
+}
@@ -2,8 +2,10 @@
 package common
 
 import (
+	"io"
 	"log/slog"
 	"os"
+	"time"
 )
 
 type LoggingOpts struct {
@@ -11,6 +13,22 @@ type LoggingOpts struct {
 	JSON    bool
 	Service string
 	Version string
+
+	// Output is where logs are written to. Optional - stdout if nil.
+	Output io.Writer
+
+	// DedupInterval collapses identical warnings and errors repeated within
+	// it, reporting their count once it passed. Optional - every message is
+	// logged if zero.
+	DedupInterval time.Duration
+}
+
+// CloseLogger logs what the logger held back, such as the counts of
+// collapsed messages. The logger must not be used afterwards.
+func CloseLogger(log *slog.Logger) {
+	if c, ok := log.Handler().(io.Closer); ok {
+		c.Close()
+	}
 }
 
 func SetupLogger(opts *LoggingOpts) (log *slog.Logger) {
@@ -19,11 +37,21 @@ func SetupLogger(opts *LoggingOpts) (log *slog.Logger) {
 		logLevel = slog.LevelDebug
 	}
 
+	output := opts.Output
+	if output == nil {
+		output = os.Stdout
+	}
+
+	var handler slog.Handler
 	if opts.JSON {
-		log = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: logLevel}))
+		handler = slog.NewJSONHandler(output, &slog.HandlerOptions{Level: logLevel})
 	} else {
-		log = slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: logLevel}))
+		handler = slog.NewTextHandler(output, &slog.HandlerOptions{Level: logLevel})
+	}
+	if opts.DedupInterval > 0 {
+		handler = newDedupHandler(handler, opts.DedupInterval)
 	}
+	log = slog.New(handler)
 
 	if opts.Service != "" {
 		log = log.With("service", opts.Service)
@@ -0,0 +1,39 @@
+package httpserver
+
+import (
+	"cmp"
+	"net/http"
+)
+
+// handleAbort aborts the transition to maintenance while it's draining,
+// stopping its timer before the maintenance rules are applied, and restores
+// production.
+func (h *FirewallHandler) handleAbort(w http.ResponseWriter, r *http.Request) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.mode != TransitionToMaintenance {
+		http.Error(w, "no transition in progress", http.StatusConflict)
+		return
+	}
+	if !h.stopTransitionTimer() {
+		http.Error(w, "maintenance transition is completing, retry", http.StatusConflict)
+		return
+	}
+
+	requestedBy := requestedBy(r.Context())
+	h.log.Warn("aborting the transition to maintenance", "requested_by", requestedBy)
+	h.transitionRequestedBy = requestedBy
+	h.transitionInitiator = cmp.Or(requestInitiator(r.Context()), initiatorManual)
+	if err := h.revertNFTables(Production); err != nil {
+		// The transition rules are still in place, complete it right away
+		h.log.Error("could not abort the transition, completing it", "error", err)
+		h.finishTransition()
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error(), Reason: failureReason(err)})
+		return
+	}
+	close(h.transitionDone)
+	h.setMode(Production)
+	h.recordTransition(Maintenance, resultAborted)
+	w.WriteHeader(http.StatusOK)
+}
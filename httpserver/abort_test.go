@@ -0,0 +1,61 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAbortTransition(t *testing.T) {
+	abort := func(h *FirewallHandler) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		h.handleAbort(rr, httptest.NewRequest(http.MethodPost, "/firewall/abort", nil))
+		return rr
+	}
+	startTransition := func(t *testing.T, duration time.Duration) *FirewallHandler {
+		t.Helper()
+		h := newTestHandler(t, FirewallConfig{TransitionDuration: duration}, nil)
+		t.Cleanup(h.Close)
+		h.mode = Production
+		rr := httptest.NewRecorder()
+		h.handleMaintenance(rr, httptest.NewRequest(http.MethodPost, "/firewall/maintenance", nil))
+		require.Equal(t, http.StatusAccepted, rr.Code)
+		return h
+	}
+
+	t.Run("aborted", func(t *testing.T) {
+		h := startTransition(t, 50*time.Millisecond)
+
+		require.Equal(t, http.StatusOK, abort(h).Code)
+		require.Equal(t, "production", getStatusJSON(t, h).Mode)
+
+		// The maintenance rules are never applied
+		time.Sleep(100 * time.Millisecond)
+		require.Equal(t, "production", getStatusJSON(t, h).Mode)
+		require.Equal(t, []string{
+			"/usr/sbin/nft --echo --handle -f /etc/nftables-transition.conf",
+			"/usr/sbin/nft -f /etc/nftables-production.conf",
+		}, testRunner(h).Calls())
+		h.lock.Lock()
+		defer h.lock.Unlock()
+		require.Equal(t, resultAborted, h.history[len(h.history)-1].Result)
+		require.Nil(t, h.transitionToMaintenanceStart)
+	})
+
+	t.Run("not transitioning", func(t *testing.T) {
+		h := newTestHandler(t, FirewallConfig{}, nil)
+		require.Equal(t, http.StatusConflict, abort(h).Code)
+		require.Equal(t, "maintenance", getStatusJSON(t, h).Mode)
+	})
+
+	t.Run("production apply failing", func(t *testing.T) {
+		h := startTransition(t, time.Hour)
+		testRunner(h).Fail("/etc/nftables-production.conf", errFake)
+
+		require.Equal(t, http.StatusInternalServerError, abort(h).Code)
+		require.Equal(t, "maintenance", getStatusJSON(t, h).Mode)
+	})
+}
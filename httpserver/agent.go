@@ -0,0 +1,93 @@
+package httpserver
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+const DefaultAgentTimeout = 30 * time.Second
+
+var ErrAgent = errors.New("agent failed to apply the ruleset")
+
+// AgentRequest is sent to the agent to apply the ruleset of a mode.
+//
+// The protocol is one request and one response per connection to the Unix
+// socket of the agent, each a single line of JSON. The agent applies the
+// ruleset of Mode; when leaving transition_to_maintenance, it is responsible
+// for removing the rules it added for the transition. The controller closes
+// the connection if there is no response within the agent timeout.
+type AgentRequest struct {
+	Mode        string `json:"mode"`
+	CurrentMode string `json:"current_mode"`
+}
+
+// AgentResponse is the agent's reply to an AgentRequest. Error is empty if
+// the ruleset was applied. Output is the output of the apply, e.g. of nft,
+// and is logged by the controller.
+type AgentResponse struct {
+	Output string `json:"output,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// agentBackend applies rulesets through a privileged agent listening on a
+// Unix socket, so the controller itself needs no firewall privileges.
+type agentBackend struct {
+	socket  string
+	timeout time.Duration
+}
+
+func (agentBackend) Name() string {
+	return "agent"
+}
+
+// Validate connects to the socket of the agent, without sending a request.
+func (b agentBackend) Validate(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, b.timeout)
+	defer cancel()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", b.socket)
+	if err != nil {
+		return fmt.Errorf("could not connect to the agent: %w", err)
+	}
+	return conn.Close()
+}
+
+func (b agentBackend) Apply(ctx context.Context, from, to FirewallMode) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, b.timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", b.socket)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to the agent: %w", err)
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	if err := json.NewEncoder(conn).Encode(AgentRequest{Mode: to.String(), CurrentMode: from.String()}); err != nil {
+		return nil, fmt.Errorf("could not send the request to the agent: %w", err)
+	}
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return nil, fmt.Errorf("the agent did not respond within %s: %w", b.timeout, context.DeadlineExceeded)
+	} else if err != nil {
+		return nil, fmt.Errorf("could not read the response of the agent: %w", err)
+	}
+	var resp AgentResponse
+	if err := json.Unmarshal(line, &resp); err != nil {
+		return nil, fmt.Errorf("invalid response of the agent: %w", err)
+	}
+	if resp.Error != "" {
+		return []byte(resp.Output), fmt.Errorf("%w: %s", ErrAgent, resp.Error)
+	}
+	return []byte(resp.Output), nil
+}
@@ -0,0 +1,101 @@
+package httpserver
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAgent serves the agent protocol on a Unix socket, responding with
+// respond to every request.
+func fakeAgent(t *testing.T, respond func(req AgentRequest) *AgentResponse) (socket string, requests chan AgentRequest) {
+	t.Helper()
+	// Not in t.TempDir(), its path may exceed the limit of socket paths
+	dir, err := os.MkdirTemp("", "agent")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socket = filepath.Join(dir, "agent.sock")
+	l, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	requests = make(chan AgentRequest, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			var req AgentRequest
+			line, err := bufio.NewReader(conn).ReadBytes('\n')
+			if err == nil && json.Unmarshal(line, &req) == nil {
+				requests <- req
+				if resp := respond(req); resp != nil {
+					_ = json.NewEncoder(conn).Encode(resp)
+				} else {
+					// Hang until the controller gives up
+					_, _ = conn.Read(make([]byte, 1))
+				}
+			}
+			conn.Close()
+		}
+	}()
+	return socket, requests
+}
+
+func TestAgentBackend(t *testing.T) {
+	t.Run("applies through the agent", func(t *testing.T) {
+		socket, requests := fakeAgent(t, func(AgentRequest) *AgentResponse {
+			return &AgentResponse{Output: "applied"}
+		})
+		h := newTestHandler(t, FirewallConfig{AgentSocket: socket}, nil)
+
+		h.lock.Lock()
+		require.NoError(t, h.transitionToProduction("test"))
+		h.lock.Unlock()
+		require.Equal(t, AgentRequest{Mode: "production", CurrentMode: "maintenance"}, <-requests)
+		require.Equal(t, "production", getStatusJSON(t, h).Mode)
+		require.Empty(t, testRunner(h).Calls())
+	})
+
+	t.Run("failed apply is reverted", func(t *testing.T) {
+		socket, requests := fakeAgent(t, func(req AgentRequest) *AgentResponse {
+			if req.Mode == "transition_to_maintenance" {
+				return &AgentResponse{Output: "syntax error", Error: "exit status 1"}
+			}
+			return &AgentResponse{}
+		})
+		h := newTestHandler(t, FirewallConfig{AgentSocket: socket}, nil)
+		h.mode = Production
+
+		h.lock.Lock()
+		err := h.transitionToMaintenance("test")
+		h.lock.Unlock()
+		require.ErrorIs(t, err, ErrAgent)
+		require.Equal(t, ApplyFailed, failureReason(err))
+		require.Equal(t, "transition_to_maintenance", (<-requests).Mode)
+		require.Equal(t, "production", (<-requests).Mode)
+		require.Equal(t, "production", getStatusJSON(t, h).Mode)
+	})
+
+	t.Run("times out", func(t *testing.T) {
+		socket, _ := fakeAgent(t, func(AgentRequest) *AgentResponse { return nil })
+		b := agentBackend{socket: socket, timeout: 10 * time.Millisecond}
+		_, err := b.Apply(context.Background(), Maintenance, Production)
+		require.ErrorContains(t, err, "did not respond within 10ms")
+		require.Equal(t, failureTimeout, classifyApplyFailure(nil, err))
+	})
+
+	t.Run("agent not running", func(t *testing.T) {
+		b := agentBackend{socket: filepath.Join(t.TempDir(), "missing.sock"), timeout: time.Second}
+		_, err := b.Apply(context.Background(), Maintenance, Production)
+		require.ErrorContains(t, err, "could not connect to the agent")
+	})
+}
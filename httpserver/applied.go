@@ -0,0 +1,36 @@
+package httpserver
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// appliedRuleset is the ruleset last applied successfully for a mode, as read
+// from the config path right before the apply.
+type appliedRuleset struct {
+	content []byte
+	at      time.Time
+}
+
+// handleApplied returns the ruleset last applied for a mode, independent of
+// the config file which may have changed since.
+func (h *FirewallHandler) handleApplied(w http.ResponseWriter, r *http.Request) {
+	fm, err := ParseFirewallMode(r.URL.Query().Get("mode"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid mode %q", r.URL.Query().Get("mode")), http.StatusBadRequest)
+		return
+	}
+
+	h.lock.Lock()
+	applied, ok := h.appliedRulesets[fm]
+	h.lock.Unlock()
+	if !ok {
+		http.Error(w, fmt.Sprintf("no %s ruleset applied yet", fm), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Last-Modified", applied.at.UTC().Format(http.TimeFormat))
+	w.Write(applied.content)
+}
@@ -0,0 +1,53 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppliedRuleset(t *testing.T) {
+	dir := t.TempDir()
+	productionPath := filepath.Join(dir, "production.conf")
+	require.NoError(t, os.WriteFile(productionPath, []byte("table inet filter { }\n"), 0o600))
+	clock := newFakeClock()
+	h := newTestHandler(t, FirewallConfig{ConfigPaths: map[FirewallMode]string{Production: productionPath}}, clock)
+
+	get := func(mode string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		h.handleApplied(rr, httptest.NewRequest(http.MethodGet, "/firewall/applied?mode="+mode, nil))
+		return rr
+	}
+	require.Equal(t, http.StatusNotFound, get("production").Code)
+	require.Equal(t, http.StatusBadRequest, get("nope").Code)
+
+	h.lock.Lock()
+	require.NoError(t, h.transitionToProduction("test"))
+	h.lock.Unlock()
+
+	// The file changed since, the applied ruleset didn't
+	require.NoError(t, os.WriteFile(productionPath, []byte("table inet filter { chain input { } }\n"), 0o600))
+	rr := get("production")
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Equal(t, "table inet filter { }\n", rr.Body.String())
+	require.Equal(t, clock.Now().UTC().Format(http.TimeFormat), rr.Header().Get("Last-Modified"))
+
+	// The default maintenance config doesn't exist in tests, nothing is cached
+	require.Equal(t, http.StatusNotFound, get("maintenance").Code)
+}
+
+func TestAppliedRulesetIsControlGuarded(t *testing.T) {
+	cfg := newTestServerConfig()
+	cfg.ControlAllowedCIDRs = []string{"192.168.0.0/16"}
+	srv := newTestServer(t, cfg)
+
+	req := httptest.NewRequest(http.MethodGet, "/firewall/applied?mode=production", nil)
+	req.RemoteAddr = "10.1.2.3:4567"
+	rr := httptest.NewRecorder()
+	srv.getRouter().ServeHTTP(rr, req)
+	require.Equal(t, http.StatusForbidden, rr.Code)
+}
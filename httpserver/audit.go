@@ -0,0 +1,115 @@
+package httpserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/flashbots/go-bob-firewall/audit"
+)
+
+const (
+	DefaultAuditRetention = 90 * 24 * time.Hour
+
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+
+	// auditQueueSize bounds the records waiting to be written, beyond which
+	// they are dropped rather than blocking transitions.
+	auditQueueSize = 256
+)
+
+// AuditLog is the response of the audit endpoint.
+type AuditLog struct {
+	Entries []audit.Record `json:"entries"`
+}
+
+// startAuditWriter starts writing queued records to the audit store in the
+// background, so the SQLite inserts don't hold the lock. The queue is drained
+// when the handler is closed.
+func (h *FirewallHandler) startAuditWriter() {
+	h.auditQueue = make(chan audit.Record, auditQueueSize)
+	h.tasks.Go(func(ctx context.Context) {
+		for {
+			select {
+			case rec := <-h.auditQueue:
+				h.addAudit(rec)
+			case <-ctx.Done():
+				for {
+					select {
+					case rec := <-h.auditQueue:
+						h.addAudit(rec)
+					default:
+						return
+					}
+				}
+			}
+		}
+	})
+}
+
+func (h *FirewallHandler) addAudit(rec audit.Record) {
+	if err := h.audit.Add(context.Background(), rec); err != nil {
+		h.log.Error("could not write transition to the audit store", "path", h.config.AuditDB, "error", err)
+	}
+}
+
+// writeAudit queues the transition outcome for the audit store, if
+// configured. Must be called with the lock held.
+func (h *FirewallHandler) writeAudit(outcome TransitionOutcome) {
+	if h.audit == nil {
+		return
+	}
+	rec := audit.Record{
+		Time:        outcome.Time,
+		To:          outcome.To,
+		Result:      outcome.Result,
+		Mode:        outcome.Mode,
+		RequestedBy: outcome.RequestedBy,
+		Initiator:   h.transitionInitiator,
+		Generation:  outcome.Generation,
+		Completion:  outcome.Completion,
+		Labels:      outcome.Labels,
+	}
+	select {
+	case h.auditQueue <- rec:
+	default:
+		h.log.Error("audit queue full, dropping the transition", "path", h.config.AuditDB, "to", rec.To, "result", rec.Result)
+	}
+}
+
+// handleAudit returns the audited transitions since the `since` query
+// parameter (RFC 3339, all if missing), oldest first, up to `limit`.
+func (h *FirewallHandler) handleAudit(w http.ResponseWriter, r *http.Request) {
+	if h.audit == nil {
+		http.Error(w, "audit store is disabled", http.StatusConflict)
+		return
+	}
+
+	var since time.Time
+	if v := r.URL.Query().Get("since"); v != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, "invalid since parameter: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	limit := defaultAuditLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 || limit > maxAuditLimit {
+			http.Error(w, fmt.Sprintf("invalid limit parameter %q, expected 1 to %d", v, maxAuditLimit), http.StatusBadRequest)
+			return
+		}
+	}
+
+	entries, err := h.audit.Query(r.Context(), since, limit)
+	if err != nil {
+		h.log.Error("could not query the audit store", "error", err)
+		http.Error(w, "could not query the audit store", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, AuditLog{Entries: entries})
+}
@@ -0,0 +1,71 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAudit(t *testing.T) {
+	clock := newFakeClock()
+	h := newTestHandler(t, FirewallConfig{AuditDB: filepath.Join(t.TempDir(), "audit.db"), Labels: map[string]string{"rack": "a1"}}, clock)
+	defer h.Close()
+
+	get := func(query string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		h.handleAudit(rr, httptest.NewRequest(http.MethodGet, "/firewall/audit"+query, nil))
+		return rr
+	}
+	entries := func(query string) AuditLog {
+		rr := get(query)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var res AuditLog
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &res))
+		return res
+	}
+
+	require.Empty(t, entries("").Entries)
+
+	h.lock.Lock()
+	require.NoError(t, h.transitionToProduction("alice"))
+	clock.Advance(time.Minute)
+	testRunner(h).Fail("/etc/nftables-transition.conf", errFake)
+	require.Error(t, h.transitionToMaintenance("bob"))
+	h.lock.Unlock()
+
+	// Written in the background
+	require.Eventually(t, func() bool { return len(entries("").Entries) == 2 }, time.Second, time.Millisecond)
+	res := entries("")
+	first := res.Entries[0]
+	require.Equal(t, "production", first.To)
+	require.Equal(t, resultCompleted, first.Result)
+	require.Equal(t, "alice", first.RequestedBy)
+	require.Equal(t, initiatorManual, first.Initiator)
+	require.Equal(t, map[string]string{"rack": "a1"}, first.Labels)
+	require.True(t, clock.Now().Add(-time.Minute).Equal(first.Time))
+	require.Equal(t, resultReverted, res.Entries[1].Result)
+	require.Equal(t, "bob", res.Entries[1].RequestedBy)
+
+	res = entries("?since=" + clock.Now().Format(time.RFC3339))
+	require.Len(t, res.Entries, 1)
+	require.Equal(t, "bob", res.Entries[0].RequestedBy)
+	res = entries("?limit=1")
+	require.Len(t, res.Entries, 1)
+	require.Equal(t, "alice", res.Entries[0].RequestedBy)
+
+	require.Equal(t, http.StatusBadRequest, get("?since=yesterday").Code)
+	require.Equal(t, http.StatusBadRequest, get("?limit=0").Code)
+	require.Equal(t, http.StatusBadRequest, get("?limit=1001").Code)
+}
+
+func TestAuditDisabled(t *testing.T) {
+	h := newTestHandler(t, FirewallConfig{}, nil)
+	rr := httptest.NewRecorder()
+	h.handleAudit(rr, httptest.NewRequest(http.MethodGet, "/firewall/audit", nil))
+	require.Equal(t, http.StatusConflict, rr.Code)
+}
@@ -0,0 +1,131 @@
+package httpserver
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// tokenScopes are the modes a token may trigger. Lockdown covers the reset
+// too.
+var tokenScopes = []FirewallMode{Maintenance, Production, Lockdown}
+
+var ErrForbidden = errors.New("forbidden")
+
+type (
+	tokenScopeKey  struct{}
+	bearerTokenKey struct{}
+)
+
+// authToken is a configured bearer token with the modes it may trigger.
+type authToken struct {
+	token []byte
+	modes []string // All if empty
+}
+
+// parseAuthTokens validates the scopes of the configured tokens.
+func parseAuthTokens(tokens map[string][]string) ([]authToken, error) {
+	res := make([]authToken, 0, len(tokens))
+	for token, modes := range tokens {
+		if token == "" {
+			return nil, errors.New("invalid empty auth token")
+		}
+		for _, mode := range modes {
+			fm, err := ParseFirewallMode(mode)
+			if err != nil || !slices.Contains(tokenScopes, fm) {
+				return nil, fmt.Errorf("invalid auth token scope %q: expected maintenance, production or lockdown", mode)
+			}
+		}
+		res = append(res, authToken{token: []byte(token), modes: modes})
+	}
+	return res, nil
+}
+
+// scopeAllows reports whether the token of the request may trigger the given
+// mode. Requests without a token, i.e. if auth is disabled, may trigger all.
+func scopeAllows(ctx context.Context, fm FirewallMode) bool {
+	modes, ok := ctx.Value(tokenScopeKey{}).([]string)
+	return !ok || len(modes) == 0 || slices.Contains(modes, fm.String())
+}
+
+// requestToken returns the bearer token of the request, if it may trigger
+// the given mode. With auth disabled, requests may trigger all modes without
+// a token.
+func requestToken(ctx context.Context, fm FirewallMode) (string, bool) {
+	token, authEnabled := ctx.Value(bearerTokenKey{}).(string)
+	if !authEnabled {
+		return "", true
+	}
+	return token, token != "" && scopeAllows(ctx, fm)
+}
+
+// matchToken returns the configured token presented by the request, or nil.
+// Tokens are compared in constant time.
+func (srv *Server) matchToken(r *http.Request) *authToken {
+	presented, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	var match *authToken
+	for i := range srv.authTokens {
+		// Check every token, so the timing doesn't reveal which one matched
+		if subtle.ConstantTimeCompare([]byte(presented), srv.authTokens[i].token) == 1 && ok {
+			match = &srv.authTokens[i]
+		}
+	}
+	return match
+}
+
+// withToken stores the token and its scopes in the request context.
+func withToken(r *http.Request, token *authToken) *http.Request {
+	ctx := context.WithValue(r.Context(), bearerTokenKey{}, string(token.token))
+	return r.WithContext(context.WithValue(ctx, tokenScopeKey{}, token.modes))
+}
+
+// identifyToken stores a presented token like authenticate, but lets requests
+// without one through, for read endpoints which only offer more to
+// authenticated clients, see requestToken.
+func (srv *Server) identifyToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if match := srv.matchToken(r); match != nil {
+			r = withToken(r, match)
+		} else {
+			r = r.WithContext(context.WithValue(r.Context(), bearerTokenKey{}, ""))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authenticate requires a configured bearer token, responding with 401
+// otherwise. If scope is set, the token must be allowed to trigger it, else
+// the request is rejected with 403. The token and its scopes are stored in
+// the request context, for handlers taking the mode from the request, see
+// scopeAllows.
+func (srv *Server) authenticate(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			match := srv.matchToken(r)
+			if match == nil {
+				srv.log.Warn("rejecting unauthenticated request", "remote_addr", r.RemoteAddr, "path", r.URL.Path)
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			r = withToken(r, match)
+			if scope != "" {
+				fm, _ := ParseFirewallMode(scope)
+				if !scopeAllows(r.Context(), fm) {
+					writeForbiddenScope(w, fm)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func writeForbiddenScope(w http.ResponseWriter, fm FirewallMode) {
+	http.Error(w, fmt.Sprintf("forbidden: token may not trigger %s", fm), http.StatusForbidden)
+}
@@ -0,0 +1,138 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScopedAuthTokens(t *testing.T) {
+	cfg := newTestServerConfig()
+	cfg.AuthTokens = map[string][]string{
+		"drain-token": {"maintenance"},
+		"admin-token": nil,
+	}
+	cfg.Firewall.ExperimentalFeatures = map[string]bool{"batch": true}
+	srv := newTestServer(t, cfg)
+	router := srv.getRouter()
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := do(http.MethodPost, "/firewall/production", "", "")
+	require.Equal(t, http.StatusUnauthorized, rr.Code)
+	require.Equal(t, "Bearer", rr.Header().Get("WWW-Authenticate"))
+	require.Equal(t, http.StatusUnauthorized, do(http.MethodPost, "/firewall/production", "wrong", "").Code)
+
+	// The maintenance-only token may not restore production, by any route
+	require.Equal(t, http.StatusForbidden, do(http.MethodPost, "/firewall/production", "drain-token", "").Code)
+	require.Equal(t, http.StatusForbidden, do(http.MethodPost, "/firewall/transition", "drain-token", `{"mode":"production"}`).Code)
+	require.Equal(t, http.StatusForbidden, do(http.MethodPost, "/firewall/lockdown", "drain-token", "").Code)
+	rr = do(http.MethodPost, "/firewall/batch", "drain-token", `{"operations":[{"op":"transition","mode":"production"}]}`)
+	require.Equal(t, http.StatusMultiStatus, rr.Code)
+	require.Contains(t, rr.Body.String(), "forbidden")
+	require.Equal(t, Maintenance, srv.handler.mode)
+
+	require.Equal(t, http.StatusOK, do(http.MethodPost, "/firewall/production", "admin-token", "").Code)
+	require.Equal(t, Production, srv.handler.mode)
+	require.Equal(t, http.StatusOK, do(http.MethodPost, "/firewall/maintenance", "drain-token", "").Code)
+
+	// Read endpoints don't require a token
+	require.Equal(t, http.StatusOK, do(http.MethodGet, "/firewall/status", "", "").Code)
+}
+
+func TestInvalidAuthTokenScope(t *testing.T) {
+	cfg := newTestServerConfig()
+	cfg.AuthTokens = map[string][]string{"token": {"transition_to_maintenance"}}
+	_, err := New(cfg)
+	require.ErrorContains(t, err, "invalid auth token scope")
+}
+
+func TestAuthToken(t *testing.T) {
+	serve := func(router http.Handler, method, path, token string) int {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	t.Run("transitions", func(t *testing.T) {
+		cfg := newTestServerConfig()
+		cfg.AuthToken = "secret"
+		srv := newTestServer(t, cfg)
+		router := srv.getRouter()
+
+		require.Equal(t, http.StatusUnauthorized, serve(router, http.MethodPost, "/firewall/production", ""))
+		require.Equal(t, http.StatusUnauthorized, serve(router, http.MethodPost, "/firewall/production", "wrong"))
+		require.Equal(t, Maintenance, srv.handler.mode)
+		require.Equal(t, http.StatusOK, serve(router, http.MethodPost, "/firewall/production", "secret"))
+		require.Equal(t, http.StatusOK, serve(router, http.MethodPost, "/firewall/maintenance", "secret"))
+		require.Equal(t, http.StatusOK, serve(router, http.MethodGet, "/firewall/status", ""))
+		require.Equal(t, http.StatusUnauthorized, serve(router, http.MethodPost, "/firewall/validate", ""))
+	})
+
+	t.Run("protected status", func(t *testing.T) {
+		cfg := newTestServerConfig()
+		cfg.AuthToken = "secret"
+		cfg.ProtectStatus = true
+		router := newTestServer(t, cfg).getRouter()
+
+		require.Equal(t, http.StatusUnauthorized, serve(router, http.MethodGet, "/firewall/status", ""))
+		require.Equal(t, http.StatusUnauthorized, serve(router, http.MethodHead, "/firewall/status", "wrong"))
+		require.Equal(t, http.StatusOK, serve(router, http.MethodGet, "/firewall/status", "secret"))
+		require.Equal(t, http.StatusOK, serve(router, http.MethodGet, "/livez", ""))
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		cfg := newTestServerConfig()
+		cfg.ProtectStatus = true
+		router := newTestServer(t, cfg).getRouter()
+
+		require.Equal(t, http.StatusOK, serve(router, http.MethodGet, "/firewall/status", ""))
+		require.Equal(t, http.StatusOK, serve(router, http.MethodPost, "/firewall/production", ""))
+	})
+
+	t.Run("also scoped", func(t *testing.T) {
+		cfg := newTestServerConfig()
+		cfg.AuthToken = "secret"
+		cfg.AuthTokens = map[string][]string{"secret": {"maintenance"}}
+		_, err := New(cfg)
+		require.Error(t, err)
+	})
+}
+
+func TestPprofGuarded(t *testing.T) {
+	serve := func(router http.Handler, remoteAddr, token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil)
+		req.RemoteAddr = remoteAddr
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	cfg := newTestServerConfig()
+	cfg.EnablePprof = true
+	cfg.AuthToken = "secret"
+	cfg.ControlAllowedCIDRs = []string{"192.168.0.0/16"}
+	router := newTestServer(t, cfg).getRouter()
+
+	require.Equal(t, http.StatusForbidden, serve(router, "10.1.2.3:4567", "secret"))
+	require.Equal(t, http.StatusUnauthorized, serve(router, "192.168.1.1:4567", ""))
+	require.Equal(t, http.StatusOK, serve(router, "192.168.1.1:4567", "secret"))
+}
@@ -0,0 +1,119 @@
+package httpserver
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// Backend applies the rulesets of the firewall modes.
+type Backend interface {
+	// Name identifies the backend, e.g. in the effective config.
+	Name() string
+
+	// Apply applies the ruleset of mode `to`, leaving mode `from`, and
+	// returns the output. Backends other than nft must remove the rules of
+	// TransitionToMaintenance themselves when the transition ends, as the
+	// agent does.
+	Apply(ctx context.Context, from, to FirewallMode) ([]byte, error)
+
+	// Validate checks that the backend is usable on this host, e.g. that
+	// its binary is installed, without changing the firewall.
+	Validate(ctx context.Context) error
+}
+
+// BackendStatus is the result of validating a backend on startup.
+type BackendStatus struct {
+	Name      string `json:"name"`
+	Selected  bool   `json:"selected"`
+	Available bool   `json:"available"`
+	Error     string `json:"error,omitempty"`
+}
+
+// nftBackend applies rulesets by running nft directly, which requires the
+// controller to have the privileges to change the firewall.
+type nftBackend struct {
+	h *FirewallHandler
+}
+
+func (nftBackend) Name() string {
+	return "nft"
+}
+
+func (b nftBackend) Apply(ctx context.Context, _, to FirewallMode) ([]byte, error) {
+	ctx = withWorkDir(ctx, b.h.rulesets[to].workDir(b.h.config.WorkDir))
+	return b.h.runner.Run(ctx, b.h.config.NFTBinary, b.h.applyArgs(to)...)
+}
+
+// Validate lists the tables, which fails if nft is missing or lacks the
+// privileges.
+func (b nftBackend) Validate(ctx context.Context) error {
+	if output, err := b.h.runner.Run(ctx, b.h.config.NFTBinary, "list", "tables"); err != nil {
+		return fmt.Errorf("%w: %s", err, bytes.TrimSpace(output))
+	}
+	return nil
+}
+
+// ruleRemover is implemented by backends through which the transition
+// rules are deleted by the handles echoed when they were applied.
+type ruleRemover interface {
+	// tableHandles returns the handles of the tables, keyed by family and
+	// name.
+	tableHandles(ctx context.Context) (map[string]uint64, error)
+	deleteRule(ctx context.Context, rh ruleHandle) ([]byte, error)
+}
+
+func (b nftBackend) tableHandles(ctx context.Context) (map[string]uint64, error) {
+	output, err := b.h.runner.Run(ctx, b.h.config.NFTBinary, "--handle", "list", "tables")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, bytes.TrimSpace(output))
+	}
+	return parseTableHandles(output), nil
+}
+
+func (b nftBackend) deleteRule(ctx context.Context, rh ruleHandle) ([]byte, error) {
+	return b.h.runner.Run(ctx, b.h.config.NFTBinary,
+		"delete", "rule", rh.Family, rh.Table, rh.Chain, "handle", strconv.FormatUint(rh.Handle, 10))
+}
+
+// candidateBackends returns the backends which could be used on this host:
+// nft, and the agent if its socket is configured. A configured backend is the
+// only candidate.
+func (h *FirewallHandler) candidateBackends() []Backend {
+	if h.config.Backend != nil {
+		return []Backend{h.config.Backend}
+	}
+	backends := []Backend{nftBackend{h: h}}
+	if h.config.AgentSocket != "" {
+		backends = append(backends, agentBackend{socket: h.config.AgentSocket, timeout: h.config.AgentTimeout})
+	}
+	return backends
+}
+
+// validateBackends validates the candidate backends, so an unusable
+// selected backend is reported by /readyz right away instead of failing the
+// first apply. Called on startup.
+func (h *FirewallHandler) validateBackends(ctx context.Context) {
+	var statuses []BackendStatus
+	var selectedErr error
+	for _, b := range h.candidateBackends() {
+		status := BackendStatus{Name: b.Name(), Selected: b.Name() == h.backend.Name(), Available: true}
+		if err := b.Validate(ctx); err != nil {
+			status.Available = false
+			status.Error = err.Error()
+			if status.Selected {
+				selectedErr = fmt.Errorf("backend %s unavailable: %w", b.Name(), err)
+				h.log.Error("the selected backend is unavailable", "backend", b.Name(), "error", err)
+			} else {
+				h.log.Info("backend unavailable", "backend", b.Name(), "error", err)
+			}
+		}
+		statuses = append(statuses, status)
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.backendStatuses = statuses
+	h.backendErr = selectedErr
+}
@@ -0,0 +1,148 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateBackends(t *testing.T) {
+	// check initializes the server and returns the readyz response and the
+	// backends of the effective config
+	check := func(t *testing.T, srv *Server) (*httptest.ResponseRecorder, []BackendStatus) {
+		t.Helper()
+		srv.readyAt = srv.now()
+		srv.handler.Initialize(context.Background())
+
+		readyz := httptest.NewRecorder()
+		srv.handleReadyz(readyz, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+		rr := httptest.NewRecorder()
+		srv.handler.handleConfig(rr, httptest.NewRequest(http.MethodGet, "/firewall/config", nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+		var cfg EffectiveConfig
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &cfg))
+		return readyz, cfg.Backends
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		srv := newTestServer(t, newTestServerConfig())
+		readyz, backends := check(t, srv)
+		require.Equal(t, http.StatusOK, readyz.Code)
+		require.Equal(t, []BackendStatus{{Name: "nft", Selected: true, Available: true}}, backends)
+		require.Contains(t, testRunner(srv.handler).Calls(), "/usr/sbin/nft list tables")
+	})
+
+	t.Run("selected unavailable", func(t *testing.T) {
+		cfg := newTestServerConfig()
+		cfg.Firewall.AgentSocket = filepath.Join(t.TempDir(), "agent.sock")
+		srv := newTestServer(t, cfg)
+		readyz, backends := check(t, srv)
+		require.Equal(t, http.StatusServiceUnavailable, readyz.Code)
+		require.Contains(t, readyz.Body.String(), "backend agent unavailable: could not connect to the agent")
+		require.Len(t, backends, 2)
+		require.Equal(t, BackendStatus{Name: "nft", Available: true}, backends[0])
+		require.Equal(t, "agent", backends[1].Name)
+		require.True(t, backends[1].Selected)
+		require.False(t, backends[1].Available)
+		require.Contains(t, backends[1].Error, "no such file or directory")
+	})
+
+	t.Run("other unavailable", func(t *testing.T) {
+		socket, _ := fakeAgent(t, func(AgentRequest) *AgentResponse { return &AgentResponse{} })
+		cfg := newTestServerConfig()
+		cfg.Firewall.AgentSocket = socket
+		srv := newTestServer(t, cfg)
+		testRunner(srv.handler).Fail("tables", errFake)
+		readyz, backends := check(t, srv)
+		require.Equal(t, http.StatusOK, readyz.Code)
+		require.Equal(t, []BackendStatus{
+			{Name: "nft", Available: false, Error: "fake error: fake failure"},
+			{Name: "agent", Selected: true, Available: true},
+		}, backends)
+	})
+}
+
+// fakeBackend records its applies as "from -> to", and fails those to the
+// modes registered in fail. Successful applies return output.
+type fakeBackend struct {
+	mu      sync.Mutex
+	applies []string
+	fail    map[FirewallMode]error
+	output  []byte
+}
+
+func (*fakeBackend) Name() string {
+	return "fake"
+}
+
+func (b *fakeBackend) Apply(_ context.Context, from, to FirewallMode) ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.applies = append(b.applies, from.String()+" -> "+to.String())
+	if err := b.fail[to]; err != nil {
+		return nil, err
+	}
+	return b.output, nil
+}
+
+func (*fakeBackend) Validate(context.Context) error {
+	return nil
+}
+
+func (b *fakeBackend) Applies() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.applies...)
+}
+
+func TestCustomBackend(t *testing.T) {
+	t.Run("transitions", func(t *testing.T) {
+		backend := &fakeBackend{fail: map[FirewallMode]error{Maintenance: errFake}}
+		h := newTestHandler(t, FirewallConfig{Backend: backend, TransitionDuration: 20 * time.Millisecond}, nil)
+		t.Cleanup(h.Close)
+
+		rr := httptest.NewRecorder()
+		h.handleProduction(rr, httptest.NewRequest(http.MethodPost, "/firewall/production", nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		// The maintenance rules fail once the transition ends, reverting to
+		// production
+		rr = httptest.NewRecorder()
+		h.handleMaintenance(rr, httptest.NewRequest(http.MethodPost, "/firewall/maintenance", nil))
+		require.Equal(t, http.StatusAccepted, rr.Code)
+		require.Eventually(t, func() bool {
+			return len(backend.Applies()) == 4
+		}, time.Second, time.Millisecond)
+		require.Equal(t, []string{
+			"maintenance -> production",
+			"production -> transition_to_maintenance",
+			"transition_to_maintenance -> maintenance",
+			"transition_to_maintenance -> production",
+		}, backend.Applies())
+		require.Equal(t, "production", getStatusJSON(t, h).Mode)
+		require.Empty(t, testRunner(h).Calls())
+	})
+
+	t.Run("validated", func(t *testing.T) {
+		cfg := newTestServerConfig()
+		cfg.Firewall.Backend = &fakeBackend{}
+		srv := newTestServer(t, cfg)
+		srv.handler.validateBackends(context.Background())
+		require.Equal(t, []BackendStatus{{Name: "fake", Selected: true, Available: true}}, srv.handler.backendStatuses)
+	})
+
+	t.Run("with agent", func(t *testing.T) {
+		_, err := NewFirewallHandler(slog.New(slog.NewTextHandler(io.Discard, nil)), FirewallConfig{Backend: &fakeBackend{}, AgentSocket: "/run/agent.sock"})
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,151 @@
+package httpserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+const maxBatchBodyBytes = 64 * 1024
+
+// BatchRequest is an ordered list of operations executed by the batch
+// endpoint.
+//
+// Batches are best-effort sequential, not atomic: operations run one after
+// another, but other requests may run in between, and operations that already
+// completed are not rolled back when a later one fails. Transitions are
+// guarded like single transition requests: the If-Match header of the batch
+// request applies to each of them, and each may set its own expected current
+// mode.
+type BatchRequest struct {
+	Operations      []BatchOperation `json:"operations"`
+	ContinueOnError bool             `json:"continue_on_error"`
+}
+
+// BatchOperation is a single operation of a batch. Supported operations are
+// `status`, `validate` (checks the config of `mode` without applying it) and
+// `transition` (to `mode`, either maintenance or production, only if the
+// current mode is `expected_current_mode` when set).
+type BatchOperation struct {
+	Op                  string `json:"op"`
+	Mode                string `json:"mode,omitempty"`
+	ExpectedCurrentMode string `json:"expected_current_mode,omitempty"`
+}
+
+type BatchOperationResult struct {
+	Op      string `json:"op"`
+	Mode    string `json:"mode,omitempty"`
+	OK      bool   `json:"ok"`
+	Skipped bool   `json:"skipped,omitempty"`
+	Error   string `json:"error,omitempty"`
+	// Code is set if the operation was a rejected transition, Reason if the
+	// failure has one
+	Code   RejectionCode `json:"code,omitempty"`
+	Reason FailureReason `json:"reason,omitempty"`
+}
+
+type BatchResponse struct {
+	Results []BatchOperationResult `json:"results"`
+	Mode    string                 `json:"mode"`
+}
+
+// handleBatch runs the operations of the JSON body. Like for the transition
+// endpoint, unknown fields and anything after the JSON object are rejected.
+func (h *FirewallHandler) handleBatch(w http.ResponseWriter, r *http.Request) {
+	var req BatchRequest
+	if err := decodeStrict(http.MaxBytesReader(w, r.Body, maxBatchBodyBytes), &req); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, "batch request too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "invalid batch request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.Operations) == 0 {
+		http.Error(w, "invalid batch request: no operations", http.StatusBadRequest)
+		return
+	}
+
+	resp := BatchResponse{Results: make([]BatchOperationResult, 0, len(req.Operations))}
+	failed := false
+	for _, op := range req.Operations {
+		res := BatchOperationResult{Op: op.Op, Mode: op.Mode}
+		if failed && !req.ContinueOnError {
+			res.Skipped = true
+			resp.Results = append(resp.Results, res)
+			continue
+		}
+
+		if err := h.runBatchOperation(r, op); err != nil {
+			h.log.Warn("batch operation failed", "op", op.Op, "mode", op.Mode, "error", err)
+			res.Error = err.Error()
+			if code, rejected := rejectionCode(err); rejected {
+				h.metrics.rejections.WithLabelValues(string(code)).Inc()
+				res.Code = code
+			}
+			res.Reason = failureReason(err)
+			failed = true
+		} else {
+			res.OK = true
+		}
+		if op.Op == "status" {
+			res.Mode = h.currentMode().String()
+		}
+		resp.Results = append(resp.Results, res)
+	}
+	resp.Mode = h.currentMode().String()
+
+	status := http.StatusOK
+	if failed {
+		status = http.StatusMultiStatus
+	}
+	writeJSON(w, status, resp)
+}
+
+// currentMode returns the mode, taking the lock.
+func (h *FirewallHandler) currentMode() FirewallMode {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.mode
+}
+
+// runBatchOperation executes a single batch operation. Must be called
+// without the lock held.
+func (h *FirewallHandler) runBatchOperation(r *http.Request, op BatchOperation) error {
+	switch op.Op {
+	case "status":
+		return nil
+	case "validate":
+		fm, err := ParseFirewallMode(op.Mode)
+		if err != nil {
+			return err
+		}
+		return h.validateNFTables(fm)
+	case "transition":
+		fm, err := ParseFirewallMode(op.Mode)
+		if err != nil {
+			return err
+		}
+		if !scopeAllows(r.Context(), fm) {
+			return fmt.Errorf("%w: token may not trigger %s", ErrForbidden, fm)
+		}
+		if op.ExpectedCurrentMode != "" {
+			expected, err := ParseFirewallMode(op.ExpectedCurrentMode)
+			if err != nil {
+				return fmt.Errorf("expected current mode: %w", err)
+			}
+			r = withExpectedMode(r, expected)
+		}
+		switch fm {
+		case Maintenance:
+			return h.startTransition(r, fm, h.transitionToMaintenance)
+		case Production:
+			return h.startTransition(r, fm, h.transitionToProduction)
+		default:
+			return fmt.Errorf("%w: cannot transition to %s", ErrInvalidTransition, fm)
+		}
+	default:
+		return fmt.Errorf("unknown batch operation %q", op.Op)
+	}
+}
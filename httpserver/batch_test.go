@@ -0,0 +1,144 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func doBatch(t *testing.T, h *FirewallHandler, body string) (int, BatchResponse) {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	h.handleBatch(rr, httptest.NewRequest(http.MethodPost, "/firewall/batch", strings.NewReader(body)))
+
+	var resp BatchResponse
+	if rr.Code == http.StatusOK || rr.Code == http.StatusMultiStatus {
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	}
+	return rr.Code, resp
+}
+
+func TestBatchSuccess(t *testing.T) {
+	h := newTestHandler(t, FirewallConfig{}, nil)
+
+	code, resp := doBatch(t, h, `{"operations": [
+		{"op": "validate", "mode": "production"},
+		{"op": "transition", "mode": "production"},
+		{"op": "status"}
+	]}`)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "production", resp.Mode)
+	require.Len(t, resp.Results, 3)
+	for _, res := range resp.Results {
+		require.True(t, res.OK, res)
+	}
+	require.Equal(t, "production", resp.Results[2].Mode)
+	require.Equal(t, []string{
+		"/usr/sbin/nft -c -f /etc/nftables-production.conf",
+		"/usr/sbin/nft -f /etc/nftables-production.conf",
+	}, testRunner(h).Calls())
+}
+
+func TestBatchStopsOnFirstFailure(t *testing.T) {
+	h := newTestHandler(t, FirewallConfig{}, nil)
+	testRunner(h).Fail("-c", errors.New("syntax error"))
+
+	code, resp := doBatch(t, h, `{"operations": [
+		{"op": "status"},
+		{"op": "validate", "mode": "production"},
+		{"op": "transition", "mode": "production"}
+	]}`)
+	require.Equal(t, http.StatusMultiStatus, code)
+	require.Equal(t, "maintenance", resp.Mode)
+	require.True(t, resp.Results[0].OK)
+	require.False(t, resp.Results[1].OK)
+	require.Contains(t, resp.Results[1].Error, "syntax error")
+	require.True(t, resp.Results[2].Skipped)
+	require.Len(t, testRunner(h).Calls(), 1)
+}
+
+func TestBatchContinueOnError(t *testing.T) {
+	h := newTestHandler(t, FirewallConfig{}, nil)
+
+	code, resp := doBatch(t, h, `{"continue_on_error": true, "operations": [
+		{"op": "transition", "mode": "production"},
+		{"op": "transition", "mode": "production"},
+		{"op": "validate", "mode": "maintenance"}
+	]}`)
+	require.Equal(t, http.StatusMultiStatus, code)
+	require.Equal(t, "production", resp.Mode)
+	require.True(t, resp.Results[0].OK)
+	require.False(t, resp.Results[1].OK)
+	require.Contains(t, resp.Results[1].Error, "not from maintenance mode")
+	require.True(t, resp.Results[2].OK)
+}
+
+func TestBatchInvalidRequest(t *testing.T) {
+	h := newTestHandler(t, FirewallConfig{}, nil)
+
+	code, _ := doBatch(t, h, `{"operations": []}`)
+	require.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = doBatch(t, h, `not json`)
+	require.Equal(t, http.StatusBadRequest, code)
+
+	// Typos are rejected rather than ignored
+	code, _ = doBatch(t, h, `{"operations": [{"op": "transition", "mode": "production", "expected_mode": "maintenance"}]}`)
+	require.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = doBatch(t, h, `{"operations": [{"op": "status"}]} {"operations": [{"op": "status"}]}`)
+	require.Equal(t, http.StatusBadRequest, code)
+
+	code, resp := doBatch(t, h, `{"operations": [{"op": "reboot"}]}`)
+	require.Equal(t, http.StatusMultiStatus, code)
+	require.Contains(t, resp.Results[0].Error, "unknown batch operation")
+
+	code, resp = doBatch(t, h, `{"operations": [{"op": "validate", "mode": "party"}]}`)
+	require.Equal(t, http.StatusMultiStatus, code)
+	require.Contains(t, resp.Results[0].Error, "unknown firewall mode")
+}
+
+func TestBatchTransitionPreconditions(t *testing.T) {
+	h := newTestHandler(t, FirewallConfig{}, nil)
+
+	code, resp := doBatch(t, h, `{"operations": [
+		{"op": "transition", "mode": "production", "expected_current_mode": "production"}
+	]}`)
+	require.Equal(t, http.StatusMultiStatus, code)
+	require.Equal(t, ModeMismatch, resp.Results[0].Code)
+	require.Equal(t, "maintenance", resp.Mode)
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/firewall/batch", strings.NewReader(`{"operations": [{"op": "transition", "mode": "production"}]}`))
+	req.Header.Set("If-Match", `"stale"`)
+	h.handleBatch(rr, req)
+	require.Equal(t, http.StatusMultiStatus, rr.Code)
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	require.Equal(t, PreconditionFailed, resp.Results[0].Code)
+	require.Equal(t, "maintenance", resp.Mode)
+	require.Empty(t, testRunner(h).Calls())
+}
+
+func TestBatchValidateWithoutLock(t *testing.T) {
+	h := newTestHandler(t, FirewallConfig{}, nil)
+	req := httptest.NewRequest(http.MethodPost, "/firewall/batch", nil)
+
+	// nft -c doesn't wait for e.g. a slow apply
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	done := make(chan error)
+	go func() { done <- h.runBatchOperation(req, BatchOperation{Op: "validate", Mode: "production"}) }()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("validate waited for the lock")
+	}
+	require.Contains(t, testRunner(h).Calls(), DefaultNFTBinary+" -c -f /etc/nftables-production.conf")
+}
@@ -0,0 +1,62 @@
+package httpserver
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/flashbots/go-bob-firewall/client"
+)
+
+const (
+	cascadeAttempts   = 3
+	cascadeRetryDelay = 100 * time.Millisecond
+)
+
+// cascade starts the maintenance transition of the downstream controller, if
+// configured, once this one completed. An unreachable or failing downstream
+// is logged and counted, it doesn't affect this controller. A connection
+// dropped by the downstream is retried. Must be called with the lock held.
+func (h *FirewallHandler) cascade() {
+	if h.downstream == nil {
+		return
+	}
+	log := h.log.With("downstream", h.config.DownstreamURL, "requested_by", h.transitionRequestedBy)
+	h.tasks.Go(func(ctx context.Context) {
+		ctx, cancel := context.WithTimeout(ctx, client.DefaultTimeout)
+		defer cancel()
+		if err := h.cascadeTransition(ctx, log); err != nil {
+			log.Error("could not cascade the maintenance transition", "error", err)
+			h.metrics.cascadeErrors.Inc()
+			return
+		}
+		log.Info("cascaded the maintenance transition")
+	})
+}
+
+// cascadeTransition requests the maintenance transition of the downstream,
+// retrying on broken connections. The dropped request may have started the
+// transition already, so a retry rejected as in progress is delivered.
+func (h *FirewallHandler) cascadeTransition(ctx context.Context, log *slog.Logger) error {
+	var err error
+	for attempt := 1; attempt <= cascadeAttempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(cascadeRetryDelay):
+			}
+		}
+		err = h.downstream.Transition(ctx, Maintenance.String())
+		var apiErr *client.APIError
+		if attempt > 1 && errors.As(err, &apiErr) && apiErr.Code == string(TransitionInProgress) {
+			return nil
+		}
+		if !client.IsBrokenConnection(err) || attempt == cascadeAttempts {
+			return err
+		}
+		log.Warn("downstream connection broken, retrying the cascade", "attempt", attempt, "error", err)
+	}
+	return err
+}
@@ -0,0 +1,108 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCascade(t *testing.T) {
+	downstream := newTestServer(t, newTestServerConfig())
+	downstream.handler.mode = Production
+	ts := httptest.NewServer(downstream.getRouter())
+	defer ts.Close()
+
+	cfg := newTestServerConfig()
+	cfg.Firewall.DownstreamURL = ts.URL
+	upstream := newTestServer(t, cfg)
+	upstream.handler.mode = Production
+	defer upstream.handler.Close()
+
+	rr := httptest.NewRecorder()
+	upstream.getRouter().ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/firewall/maintenance", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Equal(t, "maintenance", getStatusJSON(t, upstream.handler).Mode)
+
+	require.Eventually(t, func() bool {
+		return getStatusJSON(t, downstream.handler).Mode == "maintenance"
+	}, time.Second, 5*time.Millisecond)
+	require.Zero(t, testutil.ToFloat64(upstream.handler.metrics.cascadeErrors))
+	require.InDelta(t, 1, testutil.ToFloat64(downstream.handler.metrics.transitions.WithLabelValues("maintenance", resultCompleted, initiatorCascade)), 0)
+}
+
+func TestCascadeAuth(t *testing.T) {
+	downstreamCfg := newTestServerConfig()
+	downstreamCfg.AuthToken = "secret"
+	downstream := newTestServer(t, downstreamCfg)
+	downstream.handler.mode = Production
+	ts := httptest.NewServer(downstream.getRouter())
+	defer ts.Close()
+
+	cfg := newTestServerConfig()
+	cfg.Firewall.DownstreamURL = ts.URL
+	cfg.Firewall.DownstreamToken = "secret"
+	upstream := newTestServer(t, cfg)
+	upstream.handler.mode = Production
+	defer upstream.handler.Close()
+
+	rr := httptest.NewRecorder()
+	upstream.getRouter().ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/firewall/maintenance", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	require.Eventually(t, func() bool {
+		return getStatusJSON(t, downstream.handler).Mode == "maintenance"
+	}, time.Second, 5*time.Millisecond)
+	require.Zero(t, testutil.ToFloat64(upstream.handler.metrics.cascadeErrors))
+}
+
+func TestCascadeUnreachable(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	ts.Close()
+
+	h := newTestHandler(t, FirewallConfig{DownstreamURL: ts.URL}, nil)
+	h.mode = Production
+	h.lock.Lock()
+	require.NoError(t, h.transitionToMaintenance("test"))
+	h.lock.Unlock()
+
+	h.Close() // Waits for the cascade
+	require.Equal(t, "maintenance", getStatusJSON(t, h).Mode)
+	require.InDelta(t, 1, testutil.ToFloat64(h.metrics.cascadeErrors), 0)
+}
+
+func TestCascadeBrokenConnection(t *testing.T) {
+	downstream := newTestServer(t, newTestServerConfig())
+	downstream.handler.mode = Production
+	var dropped atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if dropped.Add(1) == 1 {
+			// Close the connection in the middle of the response
+			conn, buf, err := http.NewResponseController(w).Hijack()
+			require.NoError(t, err)
+			_, _ = buf.WriteString("HTTP/1.1 200 OK\r\nContent-Type: application/json\r\n")
+			_ = buf.Flush()
+			conn.Close()
+			return
+		}
+		downstream.getRouter().ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	h := newTestHandler(t, FirewallConfig{DownstreamURL: ts.URL}, nil)
+	h.mode = Production
+	h.lock.Lock()
+	require.NoError(t, h.transitionToMaintenance("test"))
+	h.lock.Unlock()
+
+	defer h.Close()
+	require.Eventually(t, func() bool {
+		return getStatusJSON(t, downstream.handler).Mode == "maintenance"
+	}, time.Second, 5*time.Millisecond)
+	require.EqualValues(t, 2, dropped.Load())
+	require.Zero(t, testutil.ToFloat64(h.metrics.cascadeErrors))
+}
@@ -0,0 +1,43 @@
+package httpserver
+
+import "sync"
+
+// coalescer collapses concurrent calls with the same key into a single call,
+// whose result is returned to all callers. Calls arriving after the result is
+// available start a new call.
+type coalescer struct {
+	mu       sync.Mutex
+	inflight map[string]*coalescedCall
+}
+
+type coalescedCall struct {
+	done chan struct{}
+	err  error
+}
+
+// Do runs f, unless a call with the same key is already in flight, in which
+// case it waits for that call and returns its result. shared reports whether
+// the result came from another caller's call.
+func (c *coalescer) Do(key string, f func() error) (shared bool, err error) {
+	c.mu.Lock()
+	if call, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		<-call.done
+		return true, call.err
+	}
+	if c.inflight == nil {
+		c.inflight = make(map[string]*coalescedCall)
+	}
+	call := &coalescedCall{done: make(chan struct{})}
+	c.inflight[key] = call
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.inflight, key)
+		c.mu.Unlock()
+		close(call.done)
+	}()
+	call.err = f()
+	return false, call.err
+}
@@ -0,0 +1,83 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoalesceTransitions(t *testing.T) {
+	run := func(t *testing.T, coalesce bool) []int {
+		t.Helper()
+		h := newTestHandler(t, FirewallConfig{CoalesceTransitions: coalesce}, nil)
+		testRunner(h).delay = 50 * time.Millisecond
+
+		const n = 5
+		codes := make([]int, n)
+		var wg sync.WaitGroup
+		for i := range n {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				rr := httptest.NewRecorder()
+				h.handleProduction(rr, httptest.NewRequest(http.MethodGet, "/firewall/production", nil))
+				codes[i] = rr.Code
+			}()
+			if i == 0 {
+				// Let the first request start applying
+				time.Sleep(10 * time.Millisecond)
+			}
+		}
+		wg.Wait()
+
+		require.Equal(t, []string{"/usr/sbin/nft -f /etc/nftables-production.conf"}, testRunner(h).Calls())
+		require.Equal(t, Production, h.mode)
+		return codes
+	}
+
+	t.Run("enabled", func(t *testing.T) {
+		codes := run(t, true)
+		require.Equal(t, []int{200, 200, 200, 200, 200}, codes)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		codes := run(t, false)
+		require.Equal(t, []int{200, 409, 409, 409, 409}, codes)
+	})
+}
+
+func TestCoalescerSharesErrors(t *testing.T) {
+	var c coalescer
+	start := make(chan struct{})
+	release := make(chan struct{})
+	go func() {
+		_, _ = c.Do("k", func() error {
+			close(start)
+			<-release
+			return errFake
+		})
+	}()
+	<-start
+
+	var shared bool
+	var err error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		shared, err = c.Do("k", func() error { return nil })
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	<-done
+	require.True(t, shared)
+	require.ErrorIs(t, err, errFake)
+
+	// A later call runs again
+	shared, err = c.Do("k", func() error { return nil })
+	require.False(t, shared)
+	require.NoError(t, err)
+}
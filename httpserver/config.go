@@ -0,0 +1,167 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+)
+
+// EffectiveConfig is the response of the config endpoint: the configuration
+// in effect, with defaults applied and secrets omitted.
+type EffectiveConfig struct {
+	TransitionDurationSeconds      float64             `json:"transition_duration_seconds"`
+	MaintenanceOnShutdown          bool                `json:"maintenance_on_shutdown"`
+	ModeDurationsRolloverSeconds   float64             `json:"mode_durations_rollover_seconds"`
+	ExperimentalFeatures           []string            `json:"experimental_features"`
+	RejectTransitionsOnDrift       bool                `json:"reject_transitions_on_drift"`
+	StateFile                      string              `json:"state_file,omitempty"`
+	StrictContentNegotiation       bool                `json:"strict_content_negotiation"`
+	StatusSigning                  bool                `json:"status_signing"`
+	ConfigPaths                    map[string]string   `json:"config_paths"`
+	NFTBinary                      string              `json:"nft_binary"`
+	OutcomeLogFile                 string              `json:"outcome_log_file,omitempty"`
+	SyslogFacility                 string              `json:"syslog_facility,omitempty"`
+	SyslogTag                      string              `json:"syslog_tag,omitempty"`
+	Labels                         map[string]string   `json:"labels,omitempty"`
+	DownstreamURL                  string              `json:"downstream_url,omitempty"`
+	FatalExitCode                  int                 `json:"fatal_exit_code"`
+	MinDwellSeconds                map[string]float64  `json:"min_dwell_seconds"`
+	TransitionCooldownSeconds      map[string]float64  `json:"transition_cooldown_seconds"`
+	WorkDir                        string              `json:"work_dir,omitempty"`
+	HeartbeatTimeoutSeconds        float64             `json:"heartbeat_timeout_seconds"`
+	WatchRulesets                  bool                `json:"watch_rulesets"`
+	WatchDebounceSeconds           float64             `json:"watch_debounce_seconds"`
+	QuietPeriodSeconds             float64             `json:"quiet_period_seconds"`
+	DrainPollIntervalSeconds       float64             `json:"drain_poll_interval_seconds"`
+	DrainThreshold                 int                 `json:"drain_threshold"`
+	StatusTimeoutSeconds           float64             `json:"status_timeout_seconds"`
+	ApplyOnStartup                 bool                `json:"apply_on_startup"`
+	StartupApplyRetries            int                 `json:"startup_apply_retries"`
+	StartupApplyBackoffSeconds     float64             `json:"startup_apply_backoff_seconds"`
+	CoalesceTransitions            bool                `json:"coalesce_transitions"`
+	TransitionWaitTimeoutSeconds   float64             `json:"transition_wait_timeout_seconds"`
+	MaintenanceLeaseTTLSeconds     float64             `json:"maintenance_lease_ttl_seconds"`
+	ConfigCheckIntervalSeconds     float64             `json:"config_check_interval_seconds"`
+	ProbationWindowSeconds         float64             `json:"probation_window_seconds"`
+	ProbationSelfTest              []string            `json:"probation_self_test"`
+	ProbationCheckIntervalSeconds  float64             `json:"probation_check_interval_seconds"`
+	IdempotencyKeyTTLSeconds       float64             `json:"idempotency_key_ttl_seconds"`
+	ProductionProbe                []string            `json:"production_probe"`
+	ProductionProbeURL             string              `json:"production_probe_url,omitempty"`
+	ProductionProbeTimeoutSeconds  float64             `json:"production_probe_timeout_seconds"`
+	ProductionProbeWindowSeconds   float64             `json:"production_probe_window_seconds"`
+	ProductionProbeIntervalSeconds float64             `json:"production_probe_interval_seconds"`
+	RevertOnProbeFailure           bool                `json:"revert_on_probe_failure"`
+	AgentSocket                    string              `json:"agent_socket,omitempty"`
+	AgentTimeoutSeconds            float64             `json:"agent_timeout_seconds"`
+	PreApplyHooks                  map[string][]string `json:"pre_apply_hooks"`
+	PostApplyHooks                 map[string][]string `json:"post_apply_hooks"`
+	HookTimeoutSeconds             float64             `json:"hook_timeout_seconds"`
+	AbortOnPreHookFailure          bool                `json:"abort_on_pre_hook_failure"`
+	SnapshotDir                    string              `json:"snapshot_dir,omitempty"`
+	SnapshotRetention              int                 `json:"snapshot_retention"`
+	AuditDB                        string              `json:"audit_db,omitempty"`
+	AuditRetentionSeconds          float64             `json:"audit_retention_seconds"`
+	ApplyConcurrency               int                 `json:"apply_concurrency"` // Shared across handlers, 0 if unlimited
+
+	Backends []BackendStatus `json:"backends"` // Validated on startup, empty before
+	Versions Versions        `json:"versions"`
+}
+
+func (h *FirewallHandler) effectiveConfig() EffectiveConfig {
+	c := h.config
+	features := []string{}
+	for name, enabled := range c.ExperimentalFeatures {
+		if enabled {
+			features = append(features, name)
+		}
+	}
+	slices.Sort(features)
+	paths := make(map[string]string, len(h.rulesets))
+	for fm, rs := range h.rulesets {
+		paths[fm.String()] = rs.path
+	}
+
+	return EffectiveConfig{
+		TransitionDurationSeconds:      c.TransitionDuration.Seconds(),
+		MaintenanceOnShutdown:          c.MaintenanceOnShutdown,
+		ModeDurationsRolloverSeconds:   c.ModeDurationsRollover.Seconds(),
+		ExperimentalFeatures:           features,
+		RejectTransitionsOnDrift:       c.RejectTransitionsOnDrift,
+		StateFile:                      c.StateFile,
+		StrictContentNegotiation:       c.StrictContentNegotiation,
+		StatusSigning:                  len(c.StatusSigningKey) > 0,
+		ConfigPaths:                    paths,
+		NFTBinary:                      c.NFTBinary,
+		OutcomeLogFile:                 c.OutcomeLogFile,
+		SyslogFacility:                 c.SyslogFacility,
+		SyslogTag:                      c.SyslogTag,
+		Labels:                         c.Labels,
+		DownstreamURL:                  redactURL(c.DownstreamURL),
+		FatalExitCode:                  c.FatalExitCode,
+		MinDwellSeconds:                durationsToSeconds(c.MinDwell),
+		TransitionCooldownSeconds:      cooldownsToSeconds(c.TransitionCooldowns),
+		WorkDir:                        c.WorkDir,
+		HeartbeatTimeoutSeconds:        c.HeartbeatTimeout.Seconds(),
+		WatchRulesets:                  c.WatchRulesets,
+		WatchDebounceSeconds:           c.WatchDebounce.Seconds(),
+		QuietPeriodSeconds:             c.QuietPeriod.Seconds(),
+		DrainPollIntervalSeconds:       c.DrainPollInterval.Seconds(),
+		DrainThreshold:                 c.DrainThreshold,
+		StatusTimeoutSeconds:           c.StatusTimeout.Seconds(),
+		ApplyOnStartup:                 c.ApplyOnStartup,
+		StartupApplyRetries:            max(c.StartupApplyRetries, 0),
+		StartupApplyBackoffSeconds:     c.StartupApplyBackoff.Seconds(),
+		CoalesceTransitions:            c.CoalesceTransitions,
+		TransitionWaitTimeoutSeconds:   c.TransitionWaitTimeout.Seconds(),
+		MaintenanceLeaseTTLSeconds:     c.MaintenanceLeaseTTL.Seconds(),
+		ConfigCheckIntervalSeconds:     c.ConfigCheckInterval.Seconds(),
+		ProbationWindowSeconds:         c.ProbationWindow.Seconds(),
+		ProbationSelfTest:              c.ProbationSelfTest,
+		ProbationCheckIntervalSeconds:  c.ProbationCheckInterval.Seconds(),
+		IdempotencyKeyTTLSeconds:       c.IdempotencyKeyTTL.Seconds(),
+		ProductionProbe:                c.ProductionProbe,
+		ProductionProbeURL:             redactURL(c.ProductionProbeURL),
+		ProductionProbeTimeoutSeconds:  c.ProductionProbeTimeout.Seconds(),
+		ProductionProbeWindowSeconds:   c.ProductionProbeWindow.Seconds(),
+		ProductionProbeIntervalSeconds: c.ProductionProbeInterval.Seconds(),
+		RevertOnProbeFailure:           c.RevertOnProbeFailure,
+		AgentSocket:                    c.AgentSocket,
+		AgentTimeoutSeconds:            c.AgentTimeout.Seconds(),
+		PreApplyHooks:                  hooksByName(c.PreApplyHooks),
+		PostApplyHooks:                 hooksByName(c.PostApplyHooks),
+		HookTimeoutSeconds:             c.HookTimeout.Seconds(),
+		AbortOnPreHookFailure:          c.AbortOnPreHookFailure,
+		SnapshotDir:                    c.SnapshotDir,
+		SnapshotRetention:              c.SnapshotRetention,
+		AuditDB:                        c.AuditDB,
+		AuditRetentionSeconds:          c.AuditRetention.Seconds(),
+		ApplyConcurrency:               c.ApplyLimiter.concurrency(),
+	}
+}
+
+// redactURL masks the password and query parameter values of a URL, which
+// may carry credentials.
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return "redacted"
+	}
+	if u.RawQuery != "" {
+		query := u.Query()
+		for name := range query {
+			query.Set(name, "xxxxx")
+		}
+		u.RawQuery = query.Encode()
+	}
+	return u.Redacted()
+}
+
+func (h *FirewallHandler) handleConfig(w http.ResponseWriter, r *http.Request) {
+	cfg := h.effectiveConfig()
+	h.lock.Lock()
+	cfg.Backends = h.backendStatuses
+	h.lock.Unlock()
+	cfg.Versions = h.cachedVersions(r.Context())
+	writeJSON(w, http.StatusOK, cfg)
+}
@@ -0,0 +1,50 @@
+package httpserver
+
+import (
+	"context"
+	"time"
+)
+
+// watchConfig periodically checks whether the config of the current mode
+// still parses, see checkConfig.
+func (h *FirewallHandler) watchConfig(ctx context.Context) {
+	ticker := time.NewTicker(h.config.ConfigCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.checkConfig(ctx)
+		}
+	}
+}
+
+// checkConfig runs `nft -c` against the config which would be applied next
+// for the current mode, and records the result. The lock is not held while
+// nft runs.
+func (h *FirewallHandler) checkConfig(ctx context.Context) {
+	h.lock.Lock()
+	fm := h.mode
+	switch fm {
+	case TransitionToMaintenance:
+		fm = Maintenance
+	case Initializing:
+		fm = h.initialMode
+	}
+	args := h.rulesets[fm].args("-c")
+	dir := h.rulesets[fm].workDir(h.config.WorkDir)
+	h.lock.Unlock()
+
+	output, err := h.runner.Run(withWorkDir(ctx, dir), h.config.NFTBinary, args...)
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	switch {
+	case err != nil && h.configCheckErr == nil:
+		h.log.Error("config became invalid", "mode", fm, "output", output, "error", err)
+	case err == nil && h.configCheckErr != nil:
+		h.log.Info("config is valid again", "mode", fm)
+	}
+	h.configCheckErr = err
+}
@@ -0,0 +1,55 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// crashRecord is persisted with the state if the process is about to exit
+// because of an unrecoverable error, so the next run and operator know the
+// mode at crash time.
+type crashRecord struct {
+	Time   time.Time `json:"time"`
+	Mode   string    `json:"mode"`
+	Reason string    `json:"reason"`
+}
+
+// crashLockTimeout bounds how long a crash waits for the lock to be
+// recorded.
+const crashLockTimeout = time.Second
+
+// crashGuard records the crash if the calling goroutine panics, and then
+// re-panics. Must be deferred directly, e.g. at the top of background tasks.
+func (h *FirewallHandler) crashGuard() {
+	v := recover()
+	if v == nil {
+		return
+	}
+	// The panic may have left the lock held, then the crash isn't recorded
+	// rather than touching the state without the lock
+	if !h.lock.lockTimeout(crashLockTimeout) {
+		h.log.Error("crashing, could not acquire the lock to record the state", "reason", v)
+		panic(v)
+	}
+	defer h.lock.Unlock()
+	h.recordCrash(fmt.Sprint(v))
+	panic(v)
+}
+
+// recordCrash persists the state with the crash and sends it to syslog, if
+// configured. Only the first crash is recorded. Must be called with the lock
+// held.
+func (h *FirewallHandler) recordCrash(reason string) {
+	if h.crash != nil {
+		return
+	}
+	h.crash = &crashRecord{Time: h.now().UTC(), Mode: h.mode.String(), Reason: reason}
+	h.log.Error("crashing, recording the last known state", "mode", h.mode, "reason", reason)
+	h.persistState()
+	if h.syslog != nil {
+		if msg, err := json.Marshal(h.crash); err == nil {
+			_ = h.syslog.Warning("crash: " + string(msg))
+		}
+	}
+}
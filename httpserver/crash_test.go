@@ -0,0 +1,73 @@
+package httpserver
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCrashGuard(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	clock := newFakeClock()
+	h := newTestHandler(t, FirewallConfig{StateFile: stateFile}, clock)
+	sink := &fakeSyslog{}
+	h.syslog = sink
+	h.lock.Lock()
+	require.NoError(t, h.transitionToProduction("test"))
+	h.lock.Unlock()
+
+	require.PanicsWithValue(t, "boom", func() {
+		defer h.crashGuard()
+		panic("boom")
+	})
+
+	state, err := loadState(stateFile)
+	require.NoError(t, err)
+	require.Equal(t, "production", state.Mode)
+	require.Equal(t, &crashRecord{Time: clock.Now().UTC(), Mode: "production", Reason: "boom"}, state.Crash)
+	require.Len(t, sink.messages, 2)
+	require.Contains(t, sink.messages[1], `warning: crash: {"time"`)
+
+	// The next run restores the mode as usual
+	h = newTestHandler(t, FirewallConfig{StateFile: stateFile, ApplyOnStartup: true}, nil)
+	require.Equal(t, Production, h.initialMode)
+}
+
+func TestCrashOnFatal(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	h := newTestHandler(t, FirewallConfig{StateFile: stateFile}, nil)
+	h.mode = Production
+	testRunner(h).Fail("/etc/nftables-transition.conf", errFake)
+	testRunner(h).Fail("/etc/nftables-production.conf", errFake)
+
+	require.Panics(t, func() {
+		h.lock.Lock()
+		defer h.lock.Unlock()
+		_ = h.transitionToMaintenance("test")
+	})
+
+	state, err := loadState(stateFile)
+	require.NoError(t, err)
+	require.NotNil(t, state.Crash)
+	require.Equal(t, errRevertTransitionFailed.Error(), state.Crash.Reason)
+}
+
+func TestCrashGuardLockHeld(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	h := newTestHandler(t, FirewallConfig{StateFile: stateFile}, nil)
+	h.lock.Lock()
+	require.NoError(t, h.transitionToProduction("test"))
+
+	// Left held, e.g. by the panicking goroutine
+	require.PanicsWithValue(t, "boom", func() {
+		defer h.crashGuard()
+		panic("boom")
+	})
+	require.Nil(t, h.crash)
+	h.lock.Unlock()
+
+	state, err := loadState(stateFile)
+	require.NoError(t, err)
+	require.Nil(t, state.Crash)
+}
@@ -0,0 +1,53 @@
+package httpserver
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// conntrackCountPath is read for the number of tracked connections, like
+// `conntrack -C`.
+var conntrackCountPath = "/proc/sys/net/netfilter/nf_conntrack_count"
+
+// Completions of maintenance transitions with early completion enabled, see
+// TransitionOutcome.Completion.
+const (
+	completionDrained  = "drained"   // Connections dropped to DrainThreshold before TransitionDuration elapsed
+	completionTimedOut = "timed_out" // TransitionDuration elapsed
+)
+
+func connectionCount() (int, error) {
+	data, err := os.ReadFile(conntrackCountPath)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+// drained reports whether the tracked connections dropped to DrainThreshold.
+// Unknown counts are not drained, the transition then completes after
+// TransitionDuration.
+func (h *FirewallHandler) drained() bool {
+	count, err := connectionCount()
+	if err != nil {
+		h.log.Warn("could not count the tracked connections", "path", conntrackCountPath, "error", err)
+		return false
+	}
+	return count <= h.config.DrainThreshold
+}
+
+// completeTransitionEarly completes the pending transition once connections
+// drained. Returns false if it's already completing.
+func (h *FirewallHandler) completeTransitionEarly() bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.mode != TransitionToMaintenance || !h.stopTransitionTimer() {
+		return false
+	}
+	h.log.Info("connections drained, completing maintenance transition early")
+	h.transitionCompletion = completionDrained
+	h.finishTransition()
+	return true
+}
@@ -0,0 +1,49 @@
+package httpserver
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDrainCompletesEarly(t *testing.T) {
+	countPath := filepath.Join(t.TempDir(), "nf_conntrack_count")
+	require.NoError(t, os.WriteFile(countPath, []byte("42\n"), 0o600))
+	prev := conntrackCountPath
+	conntrackCountPath = countPath
+	t.Cleanup(func() { conntrackCountPath = prev })
+
+	h := newTestHandler(t, FirewallConfig{
+		TransitionDuration: time.Hour,
+		DrainPollInterval:  5 * time.Millisecond,
+	}, nil)
+	t.Cleanup(h.Close)
+	h.mode = Production
+
+	h.lock.Lock()
+	require.NoError(t, h.transitionToMaintenance("test"))
+	done := h.transitionDone
+	h.lock.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+	h.lock.Lock()
+	require.Equal(t, TransitionToMaintenance, h.mode)
+	h.lock.Unlock()
+
+	require.NoError(t, os.WriteFile(countPath, []byte("0\n"), 0o600))
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("transition did not complete once connections drained")
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	require.Equal(t, Maintenance, h.mode)
+	last := h.history[len(h.history)-1]
+	require.Equal(t, resultCompleted, last.Result)
+	require.Equal(t, completionDrained, last.Completion)
+}
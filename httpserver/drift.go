@@ -0,0 +1,88 @@
+package httpserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var ErrDriftDetected = errors.New("live ruleset drifted from the last applied state")
+
+// rulesetHash returns the hash of the live ruleset. It's listed stateless
+// and terse (`nft -s -t list ruleset`), without counters, quotas and set
+// elements, which change with the traffic.
+func (h *FirewallHandler) rulesetHash() (string, error) {
+	output, err := h.runner.Run(context.Background(), h.config.NFTBinary, "-s", "-t", "list", "ruleset")
+	if err != nil {
+		return "", fmt.Errorf("could not list ruleset: %w: %s", err, output)
+	}
+	sum := sha256.Sum256(output)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// recordExpectedRuleset remembers the live ruleset right after an apply, as
+// the baseline for drift detection. Must be called with the lock held.
+func (h *FirewallHandler) recordExpectedRuleset() {
+	hash, err := h.rulesetHash()
+	if err != nil {
+		h.log.Warn("could not record ruleset for drift detection", "error", err)
+		h.expectedRuleset = ""
+		return
+	}
+	h.expectedRuleset = hash
+}
+
+// checkDrift compares the live ruleset against the one recorded after the
+// last apply. Nothing is reported before the first apply. Must be called
+// with the lock held.
+func (h *FirewallHandler) checkDrift() error {
+	return h.compareRuleset(h.expectedRuleset, h.mode)
+}
+
+// compareRuleset compares the live ruleset against the expected hash, as
+// recorded after the last apply of mode. It doesn't need the lock.
+func (h *FirewallHandler) compareRuleset(expected string, mode FirewallMode) error {
+	if expected == "" {
+		return nil
+	}
+
+	hash, err := h.rulesetHash()
+	if err != nil {
+		return err
+	}
+	if hash != expected {
+		return fmt.Errorf("%w (expected ruleset sha256 %s, found %s), re-apply the %s rules first", ErrDriftDetected, expected, hash, mode)
+	}
+	return nil
+}
+
+// guardDrift rejects transitions while the live ruleset is drifted, if
+// enabled. Must be called with the lock held.
+func (h *FirewallHandler) guardDrift() error {
+	if !h.config.RejectTransitionsOnDrift {
+		return nil
+	}
+	return h.checkDrift()
+}
+
+// handleReapply re-applies the rules of the current mode, e.g. to heal a
+// drifted ruleset.
+func (h *FirewallHandler) handleReapply(w http.ResponseWriter, r *http.Request) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.mode != Maintenance && h.mode != Production && h.mode != Lockdown {
+		http.Error(w, "cannot re-apply while in "+h.mode.String()+" mode", http.StatusConflict)
+		return
+	}
+
+	if err := h.applyNFTables(h.mode); err != nil {
+		http.Error(w, "could not re-apply "+h.mode.String()+" rules", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,83 @@
+package httpserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRejectTransitionOnDrift(t *testing.T) {
+	h := newTestHandler(t, FirewallConfig{RejectTransitionsOnDrift: true}, nil)
+	runner := testRunner(h)
+	runner.Output("ruleset", []byte("table inet filter { production }"))
+
+	rr := httptest.NewRecorder()
+	h.handleProduction(rr, httptest.NewRequest(http.MethodGet, "/firewall/production", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.NotEmpty(t, h.expectedRuleset)
+
+	// Someone modifies the ruleset behind our back
+	runner.Output("ruleset", []byte("table inet filter { tampered }"))
+
+	rr = httptest.NewRecorder()
+	h.handleMaintenance(rr, httptest.NewRequest(http.MethodGet, "/firewall/maintenance", nil))
+	require.Equal(t, http.StatusConflict, rr.Code)
+	require.Contains(t, rr.Body.String(), "drifted")
+	require.Contains(t, rr.Body.String(), h.expectedRuleset)
+	require.Equal(t, Production, h.mode)
+
+	// Re-applying the current mode establishes a new baseline
+	rr = httptest.NewRecorder()
+	h.handleReapply(rr, httptest.NewRequest(http.MethodPost, "/firewall/reapply", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	rr = httptest.NewRecorder()
+	h.handleMaintenance(rr, httptest.NewRequest(http.MethodGet, "/firewall/maintenance", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestDriftIgnoredByDefault(t *testing.T) {
+	h := newTestHandler(t, FirewallConfig{}, nil)
+
+	rr := httptest.NewRecorder()
+	h.handleProduction(rr, httptest.NewRequest(http.MethodGet, "/firewall/production", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Empty(t, h.expectedRuleset)
+	require.NotContains(t, testRunner(h).Calls(), "/usr/sbin/nft -s -t list ruleset")
+}
+
+// statefulRunner lists a ruleset with a counter, which increments on every
+// listing unless it's stateless.
+type statefulRunner struct {
+	*fakeRunner
+	packets int
+}
+
+func (r *statefulRunner) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	if !slices.Contains(args, "ruleset") {
+		return r.fakeRunner.Run(ctx, name, args...)
+	}
+	if slices.Contains(args, "-s") {
+		return []byte("table inet filter { chain input { counter } }"), nil
+	}
+	r.packets++
+	return []byte(fmt.Sprintf("table inet filter { chain input { counter packets %d bytes %d } }", r.packets, r.packets*64)), nil
+}
+
+func TestDriftIgnoresCounters(t *testing.T) {
+	h := newTestHandler(t, FirewallConfig{RejectTransitionsOnDrift: true}, nil)
+	h.runner = &statefulRunner{fakeRunner: newFakeRunner()}
+
+	rr := httptest.NewRecorder()
+	h.handleProduction(rr, httptest.NewRequest(http.MethodPost, "/firewall/production", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	require.NoError(t, h.checkDrift())
+}
@@ -0,0 +1,129 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// modeDurations accumulates the time spent in each firewall mode. Totals are
+// maintained incrementally on every mode change, and roll over into the
+// previous period once the configured rollover period has elapsed.
+type modeDurations struct {
+	rollover time.Duration // Optional - zero disables rollover
+
+	periodStart  time.Time
+	current      FirewallMode
+	currentSince time.Time
+	totals       map[FirewallMode]time.Duration
+	previous     *ModeDurationsPeriod
+}
+
+// ModeDurationsPeriod is the JSON representation of the time spent in each
+// mode during a single accounting period.
+type ModeDurationsPeriod struct {
+	Start     time.Time          `json:"start"`
+	End       time.Time          `json:"end"`
+	Durations map[string]float64 `json:"durations_seconds"`
+}
+
+// ModeDurations is the response of the mode-durations endpoint.
+type ModeDurations struct {
+	Current  ModeDurationsPeriod  `json:"current"`
+	Previous *ModeDurationsPeriod `json:"previous,omitempty"`
+}
+
+func newModeDurations(mode FirewallMode, now time.Time, rollover time.Duration) *modeDurations {
+	return &modeDurations{
+		rollover:     rollover,
+		periodStart:  now,
+		current:      mode,
+		currentSince: now,
+		totals:       make(map[FirewallMode]time.Duration),
+	}
+}
+
+// accrue adds the time spent in the current mode up to t.
+func (d *modeDurations) accrue(t time.Time) {
+	if t.After(d.currentSince) {
+		d.totals[d.current] += t.Sub(d.currentSince)
+		d.currentSince = t
+	}
+}
+
+// advance brings the totals up to now, closing any elapsed rollover periods.
+func (d *modeDurations) advance(now time.Time) {
+	for d.rollover > 0 && now.Sub(d.periodStart) >= d.rollover {
+		end := d.periodStart.Add(d.rollover)
+		d.accrue(end)
+		d.closePeriod(end)
+	}
+	d.accrue(now)
+}
+
+func (d *modeDurations) closePeriod(end time.Time) {
+	d.previous = &ModeDurationsPeriod{
+		Start:     d.periodStart,
+		End:       end,
+		Durations: durationsToSeconds(d.totals),
+	}
+	d.totals = make(map[FirewallMode]time.Duration)
+	d.periodStart = end
+}
+
+// setMode records a mode change at the given time.
+func (d *modeDurations) setMode(mode FirewallMode, now time.Time) {
+	d.advance(now)
+	d.current = mode
+}
+
+// reset closes the current period at the given time and starts a new one.
+func (d *modeDurations) reset(now time.Time) {
+	d.advance(now)
+	d.closePeriod(now)
+}
+
+func (d *modeDurations) snapshot(now time.Time) ModeDurations {
+	d.advance(now)
+	return ModeDurations{
+		Current: ModeDurationsPeriod{
+			Start:     d.periodStart,
+			End:       now,
+			Durations: durationsToSeconds(d.totals),
+		},
+		Previous: d.previous,
+	}
+}
+
+func durationsToSeconds(totals map[FirewallMode]time.Duration) map[string]float64 {
+	res := make(map[string]float64, len(totals))
+	for mode, d := range totals {
+		res[mode.String()] = d.Seconds()
+	}
+	return res
+}
+
+func (h *FirewallHandler) handleModeDurations(w http.ResponseWriter, r *http.Request) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	writeJSON(w, http.StatusOK, h.durations.snapshot(h.now()))
+}
+
+// handleModeDurationsReset closes the current accounting period early. The
+// closed period is returned as `previous`.
+func (h *FirewallHandler) handleModeDurationsReset(w http.ResponseWriter, r *http.Request) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.durations.reset(h.now())
+	h.log.Info("mode durations reset")
+
+	writeJSON(w, http.StatusOK, h.durations.snapshot(h.now()))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v) //nolint:errchkjson
+}
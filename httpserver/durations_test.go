@@ -0,0 +1,85 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestModeDurations(t *testing.T) {
+	clock := newFakeClock()
+	d := newModeDurations(Maintenance, clock.Now(), 0)
+
+	clock.Advance(10 * time.Minute)
+	d.setMode(Production, clock.Now())
+	clock.Advance(2 * time.Hour)
+	d.setMode(TransitionToMaintenance, clock.Now())
+	clock.Advance(5 * time.Minute)
+	d.setMode(Maintenance, clock.Now())
+	clock.Advance(20 * time.Minute)
+
+	snap := d.snapshot(clock.Now())
+	require.Nil(t, snap.Previous)
+	require.Equal(t, map[string]float64{
+		"maintenance":               (30 * time.Minute).Seconds(),
+		"production":                (2 * time.Hour).Seconds(),
+		"transition_to_maintenance": (5 * time.Minute).Seconds(),
+	}, snap.Current.Durations)
+}
+
+func TestModeDurationsRollover(t *testing.T) {
+	clock := newFakeClock()
+	start := clock.Now()
+	d := newModeDurations(Production, clock.Now(), 24*time.Hour)
+
+	clock.Advance(20 * time.Hour)
+	d.setMode(Maintenance, clock.Now())
+	clock.Advance(6 * time.Hour)
+
+	snap := d.snapshot(clock.Now())
+	require.NotNil(t, snap.Previous)
+	require.Equal(t, start, snap.Previous.Start)
+	require.Equal(t, start.Add(24*time.Hour), snap.Previous.End)
+	require.Equal(t, map[string]float64{
+		"production":  (20 * time.Hour).Seconds(),
+		"maintenance": (4 * time.Hour).Seconds(),
+	}, snap.Previous.Durations)
+	require.Equal(t, map[string]float64{
+		"maintenance": (2 * time.Hour).Seconds(),
+	}, snap.Current.Durations)
+}
+
+func TestModeDurationsEndpoint(t *testing.T) {
+	clock := newFakeClock()
+	h := newTestHandler(t, FirewallConfig{}, clock)
+
+	clock.Advance(time.Hour)
+	h.lock.Lock()
+	h.setMode(Production)
+	h.lock.Unlock()
+	clock.Advance(3 * time.Hour)
+
+	rr := httptest.NewRecorder()
+	h.handleModeDurations(rr, httptest.NewRequest(http.MethodGet, "/firewall/mode-durations", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var resp ModeDurations
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	require.InDelta(t, (time.Hour).Seconds(), resp.Current.Durations["maintenance"], 0)
+	require.InDelta(t, (3 * time.Hour).Seconds(), resp.Current.Durations["production"], 0)
+
+	// Reset closes the current period and starts counting from zero.
+	rr = httptest.NewRecorder()
+	h.handleModeDurationsReset(rr, httptest.NewRequest(http.MethodPost, "/firewall/mode-durations/reset", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	resp = ModeDurations{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	require.NotNil(t, resp.Previous)
+	require.InDelta(t, (3 * time.Hour).Seconds(), resp.Previous.Durations["production"], 0)
+	require.Empty(t, resp.Current.Durations)
+}
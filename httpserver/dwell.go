@@ -0,0 +1,121 @@
+package httpserver
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrDwellNotElapsed = errors.New("minimum dwell time not elapsed")
+
+// ModePair is a transition from one mode to another, e.g. maintenance to
+// production.
+type ModePair struct {
+	From FirewallMode
+	To   FirewallMode
+}
+
+// ParseModePair parses a pair as 'from->to', e.g. 'maintenance->production'.
+func ParseModePair(s string) (ModePair, error) {
+	from, to, ok := strings.Cut(s, "->")
+	if !ok {
+		return ModePair{}, fmt.Errorf("invalid mode pair %q: expected 'from->to'", s)
+	}
+	var pair ModePair
+	var err error
+	if pair.From, err = ParseFirewallMode(from); err != nil {
+		return ModePair{}, fmt.Errorf("invalid mode pair %q: %w", s, err)
+	}
+	if pair.To, err = ParseFirewallMode(to); err != nil {
+		return ModePair{}, fmt.Errorf("invalid mode pair %q: %w", s, err)
+	}
+	return pair, nil
+}
+
+func (p ModePair) String() string {
+	return p.From.String() + "->" + p.To.String()
+}
+
+// dwellError is returned if a transition is attempted before the minimum
+// dwell time of the current mode, or the cooldown of the transition, elapsed.
+type dwellError struct {
+	mode      FirewallMode
+	to        FirewallMode
+	remaining time.Duration
+}
+
+func (e *dwellError) Error() string {
+	return fmt.Sprintf("%s: %s for another %s before %s", ErrDwellNotElapsed, e.mode, e.remaining.Round(time.Second), e.to)
+}
+
+func (e *dwellError) Unwrap() error {
+	return ErrDwellNotElapsed
+}
+
+// retryAfter returns the remaining dwell time in whole seconds, rounded up.
+func (e *dwellError) retryAfter() string {
+	return strconv.Itoa(int(math.Ceil(e.remaining.Seconds())))
+}
+
+// dwellRemaining returns how long the current mode must still be kept before
+// transitioning to the given one, the longer of the minimum dwell time of the
+// mode and the cooldown of the transition. Must be called with the lock held.
+func (h *FirewallHandler) dwellRemaining(to FirewallMode) time.Duration {
+	minDwell := max(h.config.MinDwell[h.mode], h.config.TransitionCooldowns[ModePair{From: h.mode, To: to}])
+	if minDwell == 0 || h.modeSince.IsZero() {
+		return 0
+	}
+	return max(minDwell-h.now().Sub(h.modeSince), 0)
+}
+
+// checkDwell rejects transitioning to the given mode before the minimum dwell
+// time of the current mode, or the cooldown of the transition, elapsed. Must
+// be called with the lock held.
+func (h *FirewallHandler) checkDwell(to FirewallMode) error {
+	if remaining := h.dwellRemaining(to); remaining > 0 {
+		return &dwellError{mode: h.mode, to: to, remaining: remaining}
+	}
+	return nil
+}
+
+// CanTransition is the response of the can-transition endpoint.
+type CanTransition struct {
+	From                  string  `json:"from"`
+	To                    string  `json:"to"`
+	Allowed               bool    `json:"allowed"`
+	Reason                string  `json:"reason,omitempty"`
+	DwellRemainingSeconds float64 `json:"dwell_remaining_seconds"`
+}
+
+func (h *FirewallHandler) handleCanTransition(w http.ResponseWriter, r *http.Request) {
+	to, err := ParseFirewallMode(r.URL.Query().Get("to"))
+	if err != nil || (to != Maintenance && to != Production) {
+		http.Error(w, fmt.Sprintf("invalid target mode %q, expected maintenance or production", r.URL.Query().Get("to")), http.StatusBadRequest)
+		return
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	plan := h.planTransition(to)
+	writeJSON(w, http.StatusOK, CanTransition{
+		From:                  plan.From,
+		To:                    plan.To,
+		Allowed:               plan.Allowed,
+		Reason:                plan.Reason,
+		DwellRemainingSeconds: h.dwellRemaining(to).Seconds(),
+	})
+}
+
+// cooldownsToSeconds keys the cooldowns by pair, for the effective config.
+func cooldownsToSeconds(cooldowns map[ModePair]time.Duration) map[string]float64 {
+	res := make(map[string]float64, len(cooldowns))
+	for pair, d := range cooldowns {
+		res[pair.String()] = d.Seconds()
+	}
+	return res
+}
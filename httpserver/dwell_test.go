@@ -0,0 +1,119 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMinDwell(t *testing.T) {
+	clock := newFakeClock()
+	h := newTestHandler(t, FirewallConfig{MinDwell: map[FirewallMode]time.Duration{
+		Production:  time.Minute,
+		Maintenance: 10 * time.Second,
+	}}, clock)
+
+	canTransition := func(to string) CanTransition {
+		rr := httptest.NewRecorder()
+		h.handleCanTransition(rr, httptest.NewRequest(http.MethodGet, "/firewall/can-transition?to="+to, nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+		var res CanTransition
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &res))
+		return res
+	}
+
+	// No dwell before the first mode change of this process
+	require.True(t, canTransition("production").Allowed)
+	rr := httptest.NewRecorder()
+	h.handleProduction(rr, httptest.NewRequest(http.MethodGet, "/firewall/production", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	clock.Advance(30*time.Second + 500*time.Millisecond)
+	res := canTransition("maintenance")
+	require.False(t, res.Allowed)
+	require.Contains(t, res.Reason, "minimum dwell time not elapsed")
+	require.InDelta(t, 29.5, res.DwellRemainingSeconds, 0.001)
+
+	rr = httptest.NewRecorder()
+	h.handleMaintenance(rr, httptest.NewRequest(http.MethodGet, "/firewall/maintenance", nil))
+	require.Equal(t, http.StatusTooManyRequests, rr.Code)
+	require.Equal(t, "30", rr.Header().Get("Retry-After"))
+	require.Equal(t, "production", getStatusJSON(t, h).Mode)
+
+	clock.Advance(30 * time.Second)
+	require.True(t, canTransition("maintenance").Allowed)
+	h.lock.Lock()
+	require.NoError(t, h.transitionToMaintenance("test"))
+	// Maintenance has its own, shorter dwell
+	require.ErrorIs(t, h.transitionToProduction("test"), ErrDwellNotElapsed)
+	clock.Advance(10 * time.Second)
+	require.NoError(t, h.transitionToProduction("test"))
+	h.lock.Unlock()
+}
+
+func TestTransitionCooldowns(t *testing.T) {
+	cooldowns := map[ModePair]time.Duration{
+		{From: Maintenance, To: Production}: 10 * time.Minute,
+		{From: Production, To: Maintenance}: 30 * time.Second,
+	}
+	tests := []struct {
+		name       string
+		minDwell   map[FirewallMode]time.Duration
+		from       FirewallMode
+		to         FirewallMode
+		elapsed    time.Duration
+		wantStatus int
+		wantRetry  string
+	}{
+		{name: "maintenance to production", from: Maintenance, to: Production, elapsed: time.Minute, wantStatus: http.StatusTooManyRequests, wantRetry: "540"},
+		{name: "maintenance to production elapsed", from: Maintenance, to: Production, elapsed: 10 * time.Minute, wantStatus: http.StatusOK},
+		{name: "production to maintenance", from: Production, to: Maintenance, elapsed: 20 * time.Second, wantStatus: http.StatusTooManyRequests, wantRetry: "10"},
+		{name: "production to maintenance elapsed", from: Production, to: Maintenance, elapsed: time.Minute, wantStatus: http.StatusOK},
+		{
+			name: "longer min dwell wins", minDwell: map[FirewallMode]time.Duration{Production: time.Hour},
+			from: Production, to: Maintenance, elapsed: time.Minute, wantStatus: http.StatusTooManyRequests, wantRetry: "3540",
+		},
+		{
+			name: "longer cooldown wins", minDwell: map[FirewallMode]time.Duration{Maintenance: time.Minute},
+			from: Maintenance, to: Production, elapsed: 5 * time.Minute, wantStatus: http.StatusTooManyRequests, wantRetry: "300",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newFakeClock()
+			h := newTestHandler(t, FirewallConfig{MinDwell: tt.minDwell, TransitionCooldowns: cooldowns}, clock)
+			h.mode, h.modeSince = tt.from, clock.Now()
+			clock.Advance(tt.elapsed)
+
+			rr := httptest.NewRecorder()
+			transition := h.transitionToProduction
+			if tt.to == Maintenance {
+				transition = h.transitionToMaintenance
+			}
+			h.handleTransition(rr, httptest.NewRequest(http.MethodGet, "/", nil), tt.to, transition)
+			require.Equal(t, tt.wantStatus, rr.Code, rr.Body.String())
+			require.Equal(t, tt.wantRetry, rr.Header().Get("Retry-After"))
+			if tt.wantStatus == http.StatusTooManyRequests {
+				require.Contains(t, rr.Body.String(), "before "+tt.to.String())
+			}
+		})
+	}
+}
+
+func TestNegativeTransitionCooldown(t *testing.T) {
+	_, err := NewFirewallHandler(slog.New(slog.NewTextHandler(io.Discard, nil)), FirewallConfig{
+		TransitionCooldowns: map[ModePair]time.Duration{{From: Maintenance, To: Production}: -time.Second},
+	})
+	require.ErrorContains(t, err, "invalid negative cooldown -1s of maintenance->production")
+
+	_, err = NewFirewallHandler(slog.New(slog.NewTextHandler(io.Discard, nil)), FirewallConfig{
+		TransitionCooldowns: map[ModePair]time.Duration{{From: Lockdown, To: Maintenance}: time.Second},
+	})
+	require.ErrorContains(t, err, "invalid cooldown of lockdown->maintenance: only requestable transitions have cooldowns")
+}
@@ -0,0 +1,112 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// eventStreams tracks the open event streams, so they can be ended with a
+// terminal event on shutdown before the HTTP server stops.
+type eventStreams struct {
+	mu      sync.Mutex
+	wg      sync.WaitGroup
+	closing chan struct{} // Closed once shutdown began
+	closed  bool
+	reason  string // Of the shutdown, set before closing is closed
+}
+
+func newEventStreams() *eventStreams {
+	return &eventStreams{closing: make(chan struct{})}
+}
+
+// open registers a stream. It returns a channel closed on shutdown and a
+// function to call once the stream ended, or false if shutdown already began.
+func (s *eventStreams) open() (<-chan struct{}, func(), bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, nil, false
+	}
+	s.wg.Add(1)
+	return s.closing, s.wg.Done, true
+}
+
+// drain tells all streams to end with the shutdown reason and waits for them,
+// until the context is done.
+func (s *eventStreams) drain(ctx context.Context, reason string) error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		s.reason = reason
+		close(s.closing)
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// handleEvents streams a status snapshot on every mode change as
+// server-sent events, starting with the current status. On shutdown, a
+// terminal shutdown event is sent before the stream ends.
+func (srv *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	closing, done, ok := srv.streams.open()
+	if !ok {
+		srv.handler.reject(w, http.StatusServiceUnavailable, NotReady, errShuttingDown)
+		return
+	}
+	defer done()
+
+	rc := http.NewResponseController(w)
+	// The stream outlives the write timeout of regular responses
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	updates, unsubscribe := srv.handler.Subscribe()
+	defer unsubscribe()
+	srv.handler.lock.Lock()
+	status := srv.handler.status()
+	srv.handler.lock.Unlock()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+	send := func(event string, data any) bool {
+		payload, err := json.Marshal(data)
+		if err != nil {
+			return false
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+
+	if !send("status", status) {
+		return
+	}
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-closing:
+			send("shutdown", ErrorResponse{Error: fmt.Sprintf("%s: %s", errShuttingDown, srv.streams.reason)})
+			return
+		case status, ok := <-updates:
+			if !ok || !send("status", status) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package httpserver
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventsEndWithShutdownEvent(t *testing.T) {
+	cfg := newTestServerConfig()
+	cfg.GracefulShutdownDuration = 5 * time.Second
+	srv := newTestServer(t, cfg)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go srv.srv.Serve(ln) //nolint:errcheck
+
+	resp, err := http.Get("http://" + ln.Addr().String() + "/firewall/events")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	body := bufio.NewReader(resp.Body)
+	// next reads an event, returning its name and data
+	next := func() (string, string) {
+		t.Helper()
+		var event, data string
+		for {
+			line, err := body.ReadString('\n')
+			require.NoError(t, err)
+			line = strings.TrimSuffix(line, "\n")
+			switch {
+			case line == "":
+				return event, data
+			case strings.HasPrefix(line, "event: "):
+				event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}
+	status := func(data string) Status {
+		var s Status
+		require.NoError(t, json.Unmarshal([]byte(data), &s))
+		return s
+	}
+
+	event, data := next()
+	require.Equal(t, "status", event)
+	require.Equal(t, "maintenance", status(data).Mode)
+
+	srv.handler.lock.Lock()
+	require.NoError(t, srv.handler.transitionToProduction("test"))
+	srv.handler.lock.Unlock()
+	event, data = next()
+	require.Equal(t, "status", event)
+	require.Equal(t, "production", status(data).Mode)
+
+	done := make(chan struct{})
+	go func() {
+		srv.Shutdown(ShutdownExplicit)
+		close(done)
+	}()
+	event, data = next()
+	require.Equal(t, "shutdown", event)
+	require.JSONEq(t, `{"error":"shutting down: explicit"}`, data)
+	_, err = body.ReadByte()
+	require.ErrorIs(t, err, io.EOF)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("shutdown did not complete after the event stream ended")
+	}
+}
@@ -0,0 +1,97 @@
+package httpserver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+)
+
+// FailureReason is a stable, machine-readable code of a failed operation,
+// included in JSON error responses alongside the message.
+type FailureReason string
+
+const (
+	ApplyFailed      FailureReason = "APPLY_FAILED"      // nft failed to apply the rules, see the message
+	ValidationVetoed FailureReason = "VALIDATION_VETOED" // nft rejected the config when checking it
+	CooldownActive   FailureReason = "COOLDOWN_ACTIVE"   // The minimum dwell time of the current mode didn't elapse
+	HoldActive       FailureReason = "HOLD_ACTIVE"       // Reserved, nothing holds transitions yet
+	BackendMissing   FailureReason = "BACKEND_MISSING"   // The nft binary or the agent socket was not found
+	HookFailed       FailureReason = "HOOK_FAILED"       // The pre-apply hook failed, nothing was applied
+)
+
+var errValidationVetoed = errors.New("config check failed")
+
+// applyError is a failed nft apply with its classified reason.
+type applyError struct {
+	reason string // One of the failure* constants
+	err    error
+}
+
+func (e *applyError) Error() string {
+	return e.err.Error()
+}
+
+func (e *applyError) Unwrap() error {
+	return e.err
+}
+
+// failureReason returns the reason of a failed operation, or "" if there is
+// none.
+func failureReason(err error) FailureReason {
+	var applyErr *applyError
+	switch {
+	case errors.Is(err, ErrDwellNotElapsed):
+		return CooldownActive
+	case errors.Is(err, errValidationVetoed):
+		return ValidationVetoed
+	case errors.Is(err, ErrPreApplyHookFailed):
+		return HookFailed
+	case errors.As(err, &applyErr) && applyErr.reason == failureBinaryMissing:
+		return BackendMissing
+	case applyErr != nil, errors.Is(err, ErrTransitionFailed):
+		return ApplyFailed
+	}
+	return ""
+}
+
+// failedTransition wraps the apply error of a reverted transition.
+func failedTransition(err error) error {
+	return fmt.Errorf("%w: %w", ErrTransitionFailed, err)
+}
+
+// Reasons of failed applies, the values of the reason label of
+// firewall_apply_errors_total.
+const (
+	failureConfigParse      = "config_parse"
+	failureNFTLock          = "nft_lock"
+	failureBinaryMissing    = "binary_missing"
+	failureTimeout          = "timeout"
+	failurePermissionDenied = "permission_denied"
+	failureOther            = "other"
+)
+
+// classifyApplyFailure maps a failed nft invocation to one of a fixed set of
+// reasons, based on the error and nft's output.
+func classifyApplyFailure(output []byte, err error) string {
+	switch {
+	case errors.Is(err, exec.ErrNotFound), errors.Is(err, fs.ErrNotExist):
+		return failureBinaryMissing
+	case errors.Is(err, context.DeadlineExceeded):
+		return failureTimeout
+	case errors.Is(err, fs.ErrPermission),
+		bytes.Contains(output, []byte("Operation not permitted")),
+		bytes.Contains(output, []byte("Permission denied")):
+		return failurePermissionDenied
+	case bytes.Contains(output, []byte("resource busy")):
+		return failureNFTLock
+	case bytes.Contains(output, []byte("syntax error")),
+		bytes.Contains(output, []byte("Could not process rule")),
+		bytes.Contains(output, []byte("Could not open file")):
+		return failureConfigParse
+	default:
+		return failureOther
+	}
+}
@@ -0,0 +1,91 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyApplyFailure(t *testing.T) {
+	for _, tc := range []struct {
+		output string
+		err    error
+		reason string
+	}{
+		{"", &exec.Error{Name: "nft", Err: exec.ErrNotFound}, failureBinaryMissing},
+		{"", &fs.PathError{Op: "fork/exec", Path: "/usr/sbin/nft", Err: fs.ErrNotExist}, failureBinaryMissing},
+		{"", fmt.Errorf("apply: %w", context.DeadlineExceeded), failureTimeout},
+		{"", &fs.PathError{Op: "fork/exec", Path: "/usr/sbin/nft", Err: fs.ErrPermission}, failurePermissionDenied},
+		{"Error: Could not process rule: Operation not permitted", errFake, failurePermissionDenied},
+		{"netlink: Error: Could not process rule: Device or resource busy", errFake, failureNFTLock},
+		{"/etc/nftables-production.conf:3:5-9: Error: syntax error, unexpected accept", errFake, failureConfigParse},
+		{"Error: Could not open file \"/etc/nftables-production.conf\": No such file or directory", errFake, failureConfigParse},
+		{"something else", errFake, failureOther},
+	} {
+		require.Equal(t, tc.reason, classifyApplyFailure([]byte(tc.output), tc.err), tc.output)
+	}
+}
+
+func TestApplyErrorsMetric(t *testing.T) {
+	h := newTestHandler(t, FirewallConfig{}, nil)
+	testRunner(h).Fail("/etc/nftables-production.conf", errFake)
+
+	h.lock.Lock()
+	require.Error(t, h.applyNFTables(Production))
+	h.lock.Unlock()
+
+	// The fake runner outputs "fake failure"
+	require.InDelta(t, 1, testutil.ToFloat64(h.metrics.applyErrors.WithLabelValues("production", failureOther)), 0)
+}
+
+func TestFailureReasons(t *testing.T) {
+	transition := func(handle http.HandlerFunc) ErrorResponse {
+		rr := httptest.NewRecorder()
+		handle(rr, httptest.NewRequest(http.MethodGet, "/firewall/transition", nil))
+		require.NotEqual(t, http.StatusOK, rr.Code)
+		var resp ErrorResponse
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		require.NotEmpty(t, resp.Error)
+		return resp
+	}
+
+	t.Run("apply failed", func(t *testing.T) {
+		h := newTestHandler(t, FirewallConfig{}, nil)
+		h.mode = Production
+		testRunner(h).Fail("/etc/nftables-transition.conf", errFake)
+		require.Equal(t, ApplyFailed, transition(h.handleMaintenance).Reason)
+	})
+
+	t.Run("backend missing", func(t *testing.T) {
+		h := newTestHandler(t, FirewallConfig{}, nil)
+		h.mode = Production
+		testRunner(h).Fail("/etc/nftables-transition.conf", &exec.Error{Name: "nft", Err: exec.ErrNotFound})
+		require.Equal(t, BackendMissing, transition(h.handleMaintenance).Reason)
+	})
+
+	t.Run("cooldown active", func(t *testing.T) {
+		h := newTestHandler(t, FirewallConfig{MinDwell: map[FirewallMode]time.Duration{Maintenance: time.Hour}}, newFakeClock())
+		h.modeSince = h.now()
+		resp := transition(h.handleProduction)
+		require.Equal(t, CooldownActive, resp.Reason)
+		require.Equal(t, Cooldown, resp.Code)
+	})
+
+	t.Run("validation vetoed", func(t *testing.T) {
+		h := newTestHandler(t, FirewallConfig{}, nil)
+		testRunner(h).Fail("-c", errFake)
+		err := h.runBatchOperation(httptest.NewRequest(http.MethodPost, "/firewall/batch", nil), BatchOperation{Op: "validate", Mode: "production"})
+		require.Equal(t, ValidationVetoed, failureReason(err))
+	})
+
+	require.Empty(t, failureReason(ErrPreconditionFailed))
+}
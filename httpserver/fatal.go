@@ -0,0 +1,37 @@
+package httpserver
+
+import (
+	"errors"
+	"os"
+)
+
+var (
+	errRevertTransitionFailed  = errors.New("irrecoverable state - could not revert nftables transition")
+	errRevertMaintenanceFailed = errors.New("could not revert after failed transition attempt, refusing to continue")
+	errRevertProductionFailed  = errors.New("irrecoverable state")
+)
+
+// fatalPanic is the panic value of fatal, so recovering middleware can tell
+// it apart from a buggy handler and let it propagate.
+type fatalPanic struct{ err error }
+
+func (p fatalPanic) String() string { return p.err.Error() }
+
+// exitFunc exits the process, replaced in tests.
+var exitFunc = os.Exit
+
+// fatal handles a failure which leaves the rules in place unknown. The crash
+// is recorded and OnFatal called first, then the process exits with
+// FatalExitCode if configured, or else panics. Must be called with the lock
+// held.
+func (h *FirewallHandler) fatal(err error) {
+	h.log.Error("fatal firewall failure", "error", err, "exit_code", h.config.FatalExitCode)
+	h.recordCrash(err.Error())
+	if h.config.OnFatal != nil {
+		h.config.OnFatal(err)
+	}
+	if h.config.FatalExitCode != 0 {
+		exitFunc(h.config.FatalExitCode)
+	}
+	panic(fatalPanic{err})
+}
@@ -0,0 +1,38 @@
+package httpserver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFatal(t *testing.T) {
+	failRevert := func(h *FirewallHandler) {
+		h.mode = Production
+		testRunner(h).Fail("/etc/nftables-transition.conf", errFake)
+		testRunner(h).Fail("/etc/nftables-production.conf", errFake)
+		h.lock.Lock()
+		defer h.lock.Unlock()
+		_ = h.transitionToMaintenance("test")
+	}
+
+	t.Run("panics by default", func(t *testing.T) {
+		h := newTestHandler(t, FirewallConfig{}, nil)
+		require.PanicsWithValue(t, fatalPanic{errRevertTransitionFailed}, func() { failRevert(h) })
+	})
+
+	t.Run("exit code and callback", func(t *testing.T) {
+		defer func(exit func(int)) { exitFunc = exit }(exitFunc)
+		exitCode := 0
+		exitFunc = func(code int) { exitCode = code }
+
+		var fatalErr error
+		h := newTestHandler(t, FirewallConfig{
+			FatalExitCode: 3,
+			OnFatal:       func(err error) { fatalErr = err },
+		}, nil)
+		require.Panics(t, func() { failRevert(h) }) // Only reached as the exit function returned
+		require.ErrorIs(t, fatalErr, errRevertTransitionFailed)
+		require.Equal(t, 3, exitCode)
+	})
+}
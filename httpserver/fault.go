@@ -0,0 +1,57 @@
+package httpserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var errInjectedFault = errors.New("injected fault")
+
+// Fault types of the fault endpoint.
+const (
+	faultApplyFail  = "apply_fail"  // The next apply fails, the transition is reverted
+	faultTimeout    = "timeout"     // The next apply times out, the transition is reverted
+	faultRevertFail = "revert_fail" // The next apply and its revert fail, which is fatal
+)
+
+// injectedFault is a fault injected into the next applies.
+type injectedFault struct {
+	err     error
+	applies int // Number of applies which still fail
+}
+
+// handleFault injects a one-shot fault into the next apply, to exercise the
+// failure handling during drills.
+func (h *FirewallHandler) handleFault(w http.ResponseWriter, r *http.Request) {
+	typ := r.URL.Query().Get("type")
+	var fault injectedFault
+	switch typ {
+	case faultApplyFail:
+		fault = injectedFault{err: errInjectedFault, applies: 1}
+	case faultTimeout:
+		fault = injectedFault{err: fmt.Errorf("%w: %w", errInjectedFault, context.DeadlineExceeded), applies: 1}
+	case faultRevertFail:
+		fault = injectedFault{err: errInjectedFault, applies: 2}
+	default:
+		http.Error(w, fmt.Sprintf("invalid fault type %q: expected %s, %s or %s", typ, faultApplyFail, faultTimeout, faultRevertFail), http.StatusBadRequest)
+		return
+	}
+
+	h.lock.Lock()
+	h.fault = fault
+	h.lock.Unlock()
+	h.log.Warn("injected fault into the next apply", "type", typ, "requested_by", requestedBy(r.Context()))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// takeFault returns the error of an injected fault, if the next apply should
+// fail, and consumes it. Must be called with the lock held.
+func (h *FirewallHandler) takeFault() error {
+	if h.fault.applies == 0 {
+		return nil
+	}
+	h.fault.applies--
+	return h.fault.err
+}
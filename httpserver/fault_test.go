@@ -0,0 +1,68 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFault(t *testing.T) {
+	injectFault := func(t *testing.T, h *FirewallHandler, typ string) {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		h.handleFault(rr, httptest.NewRequest(http.MethodPost, "/firewall/fault?type="+typ, nil))
+		require.Equal(t, http.StatusNoContent, rr.Code)
+	}
+	transition := func(h *FirewallHandler) error {
+		h.lock.Lock()
+		defer h.lock.Unlock()
+		return h.transitionToMaintenance("test")
+	}
+
+	t.Run("apply_fail", func(t *testing.T) {
+		h := newTestHandler(t, FirewallConfig{}, nil)
+		h.mode = Production
+		injectFault(t, h, faultApplyFail)
+
+		require.ErrorIs(t, transition(h), ErrTransitionFailed)
+		require.Equal(t, "production", getStatusJSON(t, h).Mode)
+		require.InDelta(t, 1, testutil.ToFloat64(h.metrics.reverts.WithLabelValues("maintenance")), 0)
+		require.InDelta(t, 1, testutil.ToFloat64(h.metrics.applyErrors.WithLabelValues("transition_to_maintenance", failureOther)), 0)
+		// Only the revert was run
+		require.Equal(t, []string{"/usr/sbin/nft -f /etc/nftables-production.conf"}, testRunner(h).Calls())
+
+		// Consumed, the next transition succeeds
+		require.NoError(t, transition(h))
+		require.Equal(t, "maintenance", getStatusJSON(t, h).Mode)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		h := newTestHandler(t, FirewallConfig{}, nil)
+		h.mode = Production
+		injectFault(t, h, faultTimeout)
+
+		require.ErrorIs(t, transition(h), ErrTransitionFailed)
+		require.Equal(t, "production", getStatusJSON(t, h).Mode)
+		require.InDelta(t, 1, testutil.ToFloat64(h.metrics.applyErrors.WithLabelValues("transition_to_maintenance", failureTimeout)), 0)
+	})
+
+	t.Run("revert_fail", func(t *testing.T) {
+		h := newTestHandler(t, FirewallConfig{}, nil)
+		h.mode = Production
+		injectFault(t, h, faultRevertFail)
+
+		require.PanicsWithValue(t, fatalPanic{errRevertTransitionFailed}, func() { _ = transition(h) })
+		require.Empty(t, testRunner(h).Calls())
+	})
+
+	t.Run("invalid type", func(t *testing.T) {
+		h := newTestHandler(t, FirewallConfig{}, nil)
+		rr := httptest.NewRecorder()
+		h.handleFault(rr, httptest.NewRequest(http.MethodPost, "/firewall/fault?type=nope", nil))
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Zero(t, h.fault.applies)
+	})
+}
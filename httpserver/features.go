@@ -0,0 +1,30 @@
+package httpserver
+
+import "sort"
+
+// experimentalFeatures lists the features which can be enabled with
+// FirewallConfig.ExperimentalFeatures. They are off by default, and their
+// endpoints respond with 404 unless enabled.
+var experimentalFeatures = map[string]string{
+	"batch": "POST /firewall/batch to run a sequence of operations",
+}
+
+func (h *FirewallHandler) featureEnabled(name string) bool {
+	return h.config.ExperimentalFeatures[name]
+}
+
+// logUnknownFeatures warns about configured feature flags that don't exist,
+// which are most likely typos.
+func (h *FirewallHandler) logUnknownFeatures() {
+	names := make([]string, 0, len(h.config.ExperimentalFeatures))
+	for name := range h.config.ExperimentalFeatures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, ok := experimentalFeatures[name]; !ok {
+			h.log.Warn("ignoring unknown experimental feature", "feature", name)
+		}
+	}
+}
@@ -1,148 +1,1117 @@
 package httpserver
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
-	"os/exec"
-	"sync"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync/atomic"
 	"time"
+
+	"github.com/flashbots/go-bob-firewall/audit"
+	"github.com/flashbots/go-bob-firewall/client"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 type FirewallConfig struct {
+	// TransitionDuration is how long the transition rules are in place before
+	// maintenance is applied. Negative values are invalid. Optional -
+	// DefaultTransitionDuration is used if zero, unless ImmediateTransition
+	// is set.
 	TransitionDuration time.Duration
+
+	// ImmediateTransition applies maintenance right after the transition
+	// rules, within the request that started the transition, i.e. without
+	// draining. TransitionDuration must be zero then.
+	ImmediateTransition bool
+
+	// MaintenanceOnShutdown drives the node into maintenance when the server
+	// shuts down, bounded by the graceful shutdown duration.
+	MaintenanceOnShutdown bool
+
+	// ModeDurationsRollover is the length of a mode durations accounting
+	// period (e.g. 24h for daily totals). Zero disables rollover.
+	ModeDurationsRollover time.Duration
+
+	// ExperimentalFeatures enables experimental features by name, see
+	// experimentalFeatures for the list.
+	ExperimentalFeatures map[string]bool
+
+	// RejectTransitionsOnDrift rejects transitions while the live ruleset
+	// differs from the one recorded after the last apply.
+	RejectTransitionsOnDrift bool
+
+	// StateFile is where the mode and apply generation are persisted across
+	// restarts. Optional - nothing is persisted if empty.
+	StateFile string
+
+	// StrictContentNegotiation responds with 406 if none of the supported
+	// content types is acceptable, instead of falling back to plain text.
+	StrictContentNegotiation bool
+
+	// StatusSigningKey signs JSON status responses and the signing time with
+	// HMAC-SHA256, see client.VerifyStatus. Optional - responses are not
+	// signed if empty.
+	StatusSigningKey []byte
+
+	// ConfigPaths overrides the ruleset file of a mode. The extension selects
+	// the format: .conf and .nft are nft scripts, .json is nft JSON.
+	// Optional - DefaultConfigPaths are used for missing modes.
+	ConfigPaths map[FirewallMode]string
+
+	// NFTBinary is the absolute path of nft. Optional - DefaultNFTBinary is
+	// used if empty.
+	NFTBinary string
+
+	// RequireConfigFiles fails NewFirewallHandler if nft or the ruleset file
+	// of any mode doesn't exist, instead of the first apply.
+	RequireConfigFiles bool
+
+	// OutcomeLogFile receives one JSON line per completed, reverted, failed
+	// or aborted transition, for long-term retention. Rotation is left to
+	// external tooling. Optional - no outcome log if empty.
+	OutcomeLogFile string
+
+	// StatusTimeout bounds how long status requests wait for the lock, e.g.
+	// while a slow apply holds it, before responding with 503. Optional -
+	// DefaultStatusTimeout is used if zero.
+	StatusTimeout time.Duration
+
+	// ApplyOnStartup applies the rules of the persisted mode, or maintenance
+	// if there is none, when the server starts. Until that succeeds, the mode
+	// is Initializing and the server isn't ready.
+	ApplyOnStartup bool
+
+	// StartupApplyRetries is how often a failed startup apply is retried,
+	// e.g. if a table isn't available yet after boot, with exponential
+	// backoff starting at StartupApplyBackoff. Optional - defaults are used if
+	// zero, a negative number of retries disables them.
+	StartupApplyRetries int
+	StartupApplyBackoff time.Duration
+
+	// CoalesceTransitions collapses identical transition requests arriving
+	// while one is in flight into that transition, returning its result to
+	// all of them, instead of rejecting them once the mode has changed.
+	CoalesceTransitions bool
+
+	// TransitionWaitTimeout bounds how long `/firewall/maintenance?wait=true`
+	// waits for the transition to complete. Note that the server's
+	// WriteTimeout must be longer. Optional - DefaultTransitionWaitTimeout is
+	// used if zero.
+	TransitionWaitTimeout time.Duration
+
+	// MaintenanceLeaseTTL makes maintenance windows leases: once a transition
+	// to maintenance completed, the lease must be renewed within this
+	// duration, or the firewall returns to production. Optional - zero
+	// disables leases.
+	MaintenanceLeaseTTL time.Duration
+
+	// ConfigCheckInterval is how often the config of the current mode is
+	// checked with `nft -c`. While it's invalid, the server isn't ready.
+	// Optional - zero disables the check.
+	ConfigCheckInterval time.Duration
+
+	// ProbationWindow puts production restored by the startup apply on
+	// probation: during the window, ProbationSelfTest (a command and its
+	// arguments) runs every ProbationCheckInterval, and if it fails, the
+	// firewall transitions to maintenance. Optional - no probation if either
+	// is empty, DefaultProbationCheckInterval is used if zero.
+	ProbationWindow        time.Duration
+	ProbationSelfTest      []string
+	ProbationCheckInterval time.Duration
+
+	// IdempotencyKeyTTL is how long the result of a transition request with
+	// an Idempotency-Key header is replayed to retries with the same key.
+	// Expired keys are swept every IdempotencyKeyTTL. Optional - zero
+	// ignores the header.
+	IdempotencyKeyTTL time.Duration
+
+	// SyslogFacility sends transition outcomes to the local syslog with the
+	// given facility (e.g. daemon or local0) and SyslogTag. Ignored with a
+	// warning on platforms without syslog. Optional - disabled if empty,
+	// DefaultSyslogTag is used if the tag is empty.
+	SyslogFacility string
+	SyslogTag      string
+
+	// Labels is arbitrary metadata of the node, e.g. its rack, datacenter
+	// or role. Labels are included in the status, the history and the
+	// transition outcomes, and labels from MetricLabelKeys in all metrics.
+	// Optional.
+	Labels map[string]string
+
+	// MetricsRegisterer is where the Prometheus metrics are registered, e.g.
+	// the registry of the metrics server. Optional - the metrics only back
+	// the stats if nil.
+	MetricsRegisterer prometheus.Registerer
+
+	// DownstreamURL is the API of the next controller in an ordered drain.
+	// Once a maintenance transition completed, the downstream controller is
+	// told to start its own. Optional - no cascading if empty.
+	DownstreamURL string
+
+	// DownstreamToken is the bearer token sent to the downstream controller if
+	// it requires one. Optional.
+	DownstreamToken string
+
+	// FatalExitCode is the exit code of the process if a failed transition
+	// can't be reverted, so supervisors can tell this apart from a normal
+	// shutdown or a crash. OnFatal is called before, e.g. for cleanup by
+	// embedders. Optional - panics if zero, which also exits the process
+	// when raised by a request.
+	FatalExitCode int
+	OnFatal       func(err error)
+
+	// MinDwell is the minimum time to stay in a mode (maintenance or
+	// production) before the inverse transition is allowed. Earlier attempts
+	// are rejected with 429. Optional - no minimum for missing modes.
+	MinDwell map[FirewallMode]time.Duration
+
+	// TransitionCooldowns is the minimum time to stay in the From mode before
+	// transitioning to the To mode, e.g. a longer settle before maintenance
+	// to production. MinDwell applies as well, the longer one wins. Earlier
+	// attempts are rejected with 429. Only the requestable transitions,
+	// maintenance->production and production->maintenance, have cooldowns.
+	// Optional - no cooldown for missing pairs.
+	TransitionCooldowns map[ModePair]time.Duration
+
+	// WorkDir is the working directory of nft when applying or checking a
+	// ruleset, which relative includes are resolved from. Optional - the
+	// directory of the ruleset if empty.
+	WorkDir string
+
+	// HeartbeatTimeout enables a dead man's switch: unless POST
+	// /firewall/heartbeat is called at least this often, production is
+	// left for maintenance, assuming the orchestrator lost control. The first
+	// heartbeat is due this long after startup. Optional - disabled if zero.
+	HeartbeatTimeout time.Duration
+
+	// WatchRulesets re-applies the ruleset of the current mode when its file
+	// changes, once no further changes happened for WatchDebounce. Invalid
+	// rulesets are not applied. Optional - DefaultWatchDebounce is used if
+	// WatchDebounce is zero.
+	WatchRulesets bool
+	WatchDebounce time.Duration
+
+	// QuietPeriod rejects transition requests with 503 for this long after
+	// startup, so an orchestrator can't flip modes on an instance which didn't
+	// stabilize yet. Unlike the startup warm-up, status and health endpoints
+	// are not affected. Optional - disabled if zero.
+	QuietPeriod time.Duration
+
+	// DrainPollInterval enables completing the maintenance transition as soon
+	// as the tracked connections (the conntrack count) dropped to
+	// DrainThreshold, checked this often. TransitionDuration is the maximum
+	// then. Optional - the transition always takes TransitionDuration if zero.
+	DrainPollInterval time.Duration
+	DrainThreshold    int
+
+	// PreApplyHooks and PostApplyHooks are commands with their arguments, run
+	// before and after applying the rules of a mode, e.g. to notify the
+	// systems concerned by that mode. Each run is bounded by HookTimeout. A
+	// failing pre-apply hook aborts the apply if AbortOnPreHookFailure is set,
+	// except when reverting a failed transition. Other failures are only
+	// logged. Optional - no hooks for missing modes, DefaultHookTimeout is
+	// used if the timeout is zero.
+	PreApplyHooks         map[FirewallMode][]string
+	PostApplyHooks        map[FirewallMode][]string
+	HookTimeout           time.Duration
+	AbortOnPreHookFailure bool
+
+	// ProductionProbe is a command and its arguments, run after every
+	// transition to production to confirm the host is actually serving, e.g.
+	// curl of an internal endpoint. Alternatively, ProductionProbeURL is
+	// requested and must respond with a 2xx status. With
+	// ProductionProbeWindow, the probe is polled every
+	// ProductionProbeInterval until it passes within the window, e.g. while
+	// the app warms up. A failure is logged and counted, and with
+	// RevertOnProbeFailure, maintenance is entered again. Each run is bounded
+	// by ProductionProbeTimeout. Optional - no probe if both are empty, a
+	// single run if the window is zero, DefaultProductionProbeTimeout and
+	// DefaultProductionProbeInterval are used if zero.
+	ProductionProbe         []string
+	ProductionProbeURL      string
+	ProductionProbeTimeout  time.Duration
+	ProductionProbeWindow   time.Duration
+	ProductionProbeInterval time.Duration
+	RevertOnProbeFailure    bool
+
+	// AgentSocket applies rulesets through a privileged agent listening on
+	// this Unix socket instead of running nft, see AgentRequest for the
+	// protocol. An apply fails if the agent doesn't respond within
+	// AgentTimeout. Validation, drift detection and health checks still run
+	// nft directly. Optional - nft is run directly if empty,
+	// DefaultAgentTimeout is used if the timeout is zero.
+	AgentSocket  string
+	AgentTimeout time.Duration
+
+	// Backend applies the rulesets instead of nft or the agent, e.g. a fake
+	// in tests, or an embedding program's own implementation. Validation,
+	// drift detection and health checks still run nft directly. Optional -
+	// selected by AgentSocket if nil.
+	Backend Backend
+
+	// SnapshotDir receives the live ruleset (`nft list ruleset`) before
+	// every apply, as a timestamped file, so a prior ruleset can be restored
+	// manually. Only the SnapshotRetention most recent snapshots are kept.
+	// Optional - disabled if empty, DefaultSnapshotRetention is used if the
+	// retention is zero.
+	SnapshotDir       string
+	SnapshotRetention int
+
+	// AuditDB is a SQLite database recording every transition outcome, which
+	// survives restarts unlike the history, queryable with the audit
+	// endpoint. Records older than AuditRetention are removed. Optional -
+	// disabled if empty, DefaultAuditRetention is used if the retention is
+	// zero.
+	AuditDB        string
+	AuditRetention time.Duration
+
+	// ApplyLimiter bounds the concurrent applies across all the handlers
+	// sharing it, e.g. of several firewall zones in one process. Optional -
+	// unlimited if nil.
+	ApplyLimiter *ApplyLimiter
 }
 
+const (
+	DefaultTransitionDuration    = 5 * time.Minute
+	DefaultStatusTimeout         = 100 * time.Millisecond
+	DefaultTransitionWaitTimeout = 10 * time.Minute
+)
+
 type FirewallHandler struct {
 	log *slog.Logger
 
-	lock                         sync.Mutex
+	lock                         timedMutex
 	mode                         FirewallMode
-	transitionToMaintenanceStart *time.Time // Optional - possibly nil
+	transitionToMaintenanceStart *time.Time // Optional - nil unless transitioning to maintenance
+	durations                    *modeDurations
+	transitionHandles            []ruleHandle
+	transitionTimer              *time.Timer
+	transitionStop               chan struct{} // Closed when the timer is stopped early
+	transitionDone               chan struct{} // Closed once the current transition completed or reverted
+	lastApplyDurations           map[FirewallMode]time.Duration
+	expectedRuleset              string              // Hash of the live ruleset after the last apply, if drift detection is enabled
+	generation                   uint64              // Incremented on every successful apply
+	transitionRequestedBy        string              // Who requested the current or last transition
+	transitionInitiator          string              // What initiated the current or last transition, one of the initiator* constants
+	requestInitiator             string              // Declared by the transition request being handled, if any
+	backendStatuses              []BackendStatus     // Validated on startup
+	backendErr                   error               // Of the selected backend, if it failed validation
+	history                      []TransitionOutcome // Most recent transition outcomes, oldest first
+	initialMode                  FirewallMode        // Applied on startup, if configured
+	versions                     *Versions           // Detected on startup
+	degraded                     bool                // The startup apply failed for good
+	startupRetryAt               time.Time           // Of the next startup apply attempt, zero unless waiting for it
+	leaseExpiry                  time.Time           // Of the maintenance lease, zero if there is none
+	leaseWatched                 bool                // Whether watchLease was started
+	configCheckErr               error               // Of the last config check
+	probationUntil               time.Time           // End of the production probation, zero if there is none
+	fault                        injectedFault       // Injected into the next applies
+	crash                        *crashRecord        // Set once the process is crashing
+	modeSince                    time.Time           // When the current mode was entered, zero if before this process started
+	appliedRulesets              map[FirewallMode]appliedRuleset
+	heartbeatDeadline            time.Time // Of the dead man's switch, zero if disabled
+	lastApply                    applyResult
+	quietUntil                   time.Time // End of the startup quiet period, zero if disabled
+	transitionCompletion         string    // How the current maintenance transition completed, if early completion is enabled
 
-	config FirewallConfig
+	config      FirewallConfig
+	rulesets    map[FirewallMode]ruleset
+	outcomes    *outcomeLog  // Optional
+	audit       *audit.Store // Optional
+	auditQueue  chan audit.Record
+	syslog      syslogWriter   // Optional
+	downstream  *client.Client // Optional
+	coalescer   coalescer
+	idempotency idempotencyCache
+	health      healthCache
+	subscribers subscribers
+	tasks       *taskGroup
+	metrics     *firewallMetrics
+	backend     Backend
+	runner      CommandRunner
+	now         func() time.Time
+
+	lastReadiness atomic.Pointer[readiness] // Served by readyz while the lock is held
 }
 
-func NewFirewallHandler(log *slog.Logger, config FirewallConfig) *FirewallHandler {
-	return &FirewallHandler{
-		log:    log,
-		mode:   Maintenance,
-		config: config,
+func NewFirewallHandler(log *slog.Logger, config FirewallConfig) (*FirewallHandler, error) {
+	if config.TransitionDuration < 0 {
+		return nil, fmt.Errorf("invalid negative transition duration %s", config.TransitionDuration)
+	}
+	if config.ImmediateTransition && config.TransitionDuration != 0 {
+		return nil, errors.New("invalid transition duration: either immediate or a transition duration")
+	}
+	if !config.ImmediateTransition && config.TransitionDuration == 0 {
+		config.TransitionDuration = DefaultTransitionDuration
+	}
+	for pair, cooldown := range config.TransitionCooldowns {
+		if pair != (ModePair{From: Maintenance, To: Production}) && pair != (ModePair{From: Production, To: Maintenance}) {
+			return nil, fmt.Errorf("invalid cooldown of %s: only requestable transitions have cooldowns", pair)
+		}
+		if cooldown < 0 {
+			return nil, fmt.Errorf("invalid negative cooldown %s of %s", cooldown, pair)
+		}
+	}
+	if config.StatusTimeout == 0 {
+		config.StatusTimeout = DefaultStatusTimeout
+	}
+	if config.StartupApplyRetries == 0 {
+		config.StartupApplyRetries = DefaultStartupApplyRetries
+	}
+	if config.StartupApplyBackoff == 0 {
+		config.StartupApplyBackoff = DefaultStartupApplyBackoff
+	}
+	if config.ProbationCheckInterval == 0 {
+		config.ProbationCheckInterval = DefaultProbationCheckInterval
+	}
+	if config.ProductionProbeTimeout == 0 {
+		config.ProductionProbeTimeout = DefaultProductionProbeTimeout
+	}
+	if config.ProductionProbeInterval == 0 {
+		config.ProductionProbeInterval = DefaultProductionProbeInterval
+	}
+	if len(config.ProductionProbe) > 0 && config.ProductionProbeURL != "" {
+		return nil, errors.New("invalid production probe: either a command or a URL")
+	}
+	if config.HookTimeout == 0 {
+		config.HookTimeout = DefaultHookTimeout
+	}
+	if config.AgentTimeout == 0 {
+		config.AgentTimeout = DefaultAgentTimeout
+	}
+	if config.Backend != nil && config.AgentSocket != "" {
+		return nil, errors.New("invalid backend: either a backend or an agent socket")
+	}
+	if config.SnapshotRetention < 0 {
+		return nil, fmt.Errorf("invalid negative snapshot retention %d", config.SnapshotRetention)
+	}
+	if config.SnapshotRetention == 0 {
+		config.SnapshotRetention = DefaultSnapshotRetention
+	}
+	if config.SnapshotDir != "" {
+		if err := os.MkdirAll(config.SnapshotDir, 0o700); err != nil {
+			return nil, fmt.Errorf("could not create the snapshot directory: %w", err)
+		}
+	}
+	if config.WatchDebounce == 0 {
+		config.WatchDebounce = DefaultWatchDebounce
+	}
+	if config.SyslogTag == "" {
+		config.SyslogTag = DefaultSyslogTag
 	}
+	if config.TransitionWaitTimeout == 0 {
+		config.TransitionWaitTimeout = DefaultTransitionWaitTimeout
+	}
+	if config.AuditRetention == 0 {
+		config.AuditRetention = DefaultAuditRetention
+	}
+	if config.NFTBinary == "" {
+		config.NFTBinary = DefaultNFTBinary
+	}
+	if !filepath.IsAbs(config.NFTBinary) {
+		return nil, fmt.Errorf("invalid nft binary: %s is not an absolute path", config.NFTBinary)
+	}
+	rulesets, err := newRulesets(config.ConfigPaths)
+	if err != nil {
+		return nil, err
+	}
+	if config.RequireConfigFiles {
+		if err := requireFiles(config.NFTBinary, rulesets); err != nil {
+			return nil, err
+		}
+	}
+
+	mode := Maintenance
+	if config.ApplyOnStartup {
+		mode = Initializing
+	}
+	h := &FirewallHandler{
+		log:         log,
+		mode:        mode,
+		initialMode: Maintenance,
+		durations:   newModeDurations(mode, time.Now(), config.ModeDurationsRollover),
+
+		lastApplyDurations: make(map[FirewallMode]time.Duration),
+		appliedRulesets:    make(map[FirewallMode]appliedRuleset),
+
+		config:   config,
+		rulesets: rulesets,
+		metrics:  newFirewallMetrics(metricLabels(config.Labels)),
+		runner:   execRunner{},
+		now:      time.Now,
+	}
+	h.lock.wait = h.metrics.lockWait
+	h.metrics.setMode(mode)
+	h.backend = nftBackend{h: h}
+	if config.AgentSocket != "" {
+		h.backend = agentBackend{socket: config.AgentSocket, timeout: config.AgentTimeout}
+	}
+	if config.Backend != nil {
+		h.backend = config.Backend
+	}
+	h.tasks = newTaskGroup(h.crashGuard)
+	h.logUnknownFeatures()
+	if config.OutcomeLogFile != "" {
+		h.outcomes = &outcomeLog{path: config.OutcomeLogFile}
+	}
+	if config.AuditDB != "" {
+		h.audit, err = audit.Open(config.AuditDB, config.AuditRetention)
+		if err != nil {
+			return nil, fmt.Errorf("could not open the audit store: %w", err)
+		}
+		h.startAuditWriter()
+	}
+	if config.DownstreamURL != "" {
+		h.downstream = client.New(config.DownstreamURL).WithInitiator(initiatorCascade).WithToken(config.DownstreamToken)
+	}
+	if config.SyslogFacility != "" {
+		h.syslog, err = newSyslogWriter(config.SyslogFacility, config.SyslogTag)
+		if errors.Is(err, errSyslogUnsupported) {
+			log.Warn("not sending transition outcomes to syslog", "error", err)
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	if config.StateFile != "" {
+		state, err := loadState(config.StateFile)
+		if errors.Is(err, errCorruptState) {
+			log.Warn("ignoring corrupt state file, starting from the defaults", "error", err)
+		} else if err != nil {
+			return nil, err
+		}
+		if state != nil {
+			if state.Crash != nil {
+				log.Warn("the previous run crashed", "time", state.Crash.Time, "mode", state.Crash.Mode, "reason", state.Crash.Reason)
+			}
+			h.generation = state.Generation
+			h.metrics.generation.Set(float64(h.generation))
+			if fm, err := ParseFirewallMode(state.Mode); err == nil && (fm == Production || fm == Lockdown) {
+				h.initialMode = fm
+			}
+		}
+	}
+	if config.MetricsRegisterer != nil {
+		reg := prometheus.WrapRegistererWith(metricLabels(config.Labels), config.MetricsRegisterer)
+		for _, c := range h.metrics.collectors() {
+			if err := reg.Register(c); err != nil {
+				return nil, fmt.Errorf("could not register metrics: %w", err)
+			}
+		}
+	}
+	return h, nil
 }
 
-func (h *FirewallHandler) handleStatus(w http.ResponseWriter, r *http.Request) {
-	h.lock.Lock()
-	defer h.lock.Unlock()
+const (
+	resultCompleted = "completed"
+	resultReverted  = "reverted"
+	resultFailed    = "failed" // Reverting failed too, the state is unknown
+	resultAborted   = "aborted"
+)
+
+// recordTransition records the outcome of the current transition to the
+// given target mode. Must be called with the lock held.
+func (h *FirewallHandler) recordTransition(to FirewallMode, result string) {
+	h.log.Info("transition "+result, "to", to, "mode", h.mode, "requested_by", h.transitionRequestedBy)
+	h.metrics.transitions.WithLabelValues(to.String(), result, h.transitionInitiator).Inc()
+	if result == resultReverted {
+		h.metrics.reverts.WithLabelValues(to.String()).Inc()
+	}
 
-	w.Write([]byte(h.mode.String()))
+	outcome := TransitionOutcome{
+		Time:        h.now().UTC(),
+		To:          to.String(),
+		Result:      result,
+		Mode:        h.mode.String(),
+		RequestedBy: h.transitionRequestedBy,
+		Generation:  h.generation,
+		Completion:  h.transitionCompletion,
+		Labels:      h.labels(),
+	}
+	h.transitionCompletion = ""
+	h.history = append(h.history, outcome)
+	if len(h.history) > historySize {
+		h.history = slices.Clone(h.history[len(h.history)-historySize:])
+	}
+	if h.outcomes != nil {
+		if err := h.outcomes.write(outcome); err != nil {
+			h.log.Error("could not write transition outcome", "path", h.outcomes.path, "error", err)
+		}
+	}
+	if h.syslog != nil {
+		h.writeSyslog(outcome)
+	}
+	h.writeAudit(outcome)
 }
 
-func (h *FirewallHandler) applyNFTables(fm FirewallMode) error {
-	if h.lock.TryLock() {
-		panic("applyNFTables but lock is not held!")
+// setMode changes the current mode. Must be called with the lock held.
+func (h *FirewallHandler) setMode(fm FirewallMode) {
+	h.durations.setMode(fm, h.now())
+	if fm != h.mode {
+		h.modeSince = h.now()
+	}
+	h.mode = fm
+	h.metrics.setMode(fm)
+	if fm != Maintenance {
+		h.leaseExpiry = time.Time{}
+	}
+	if fm != Production {
+		h.probationUntil = time.Time{}
+	} else if !h.heartbeatDeadline.IsZero() {
+		// Heartbeats missed before production don't count against it
+		h.heartbeatDeadline = h.now().Add(h.config.HeartbeatTimeout)
 	}
+	if fm != TransitionToMaintenance {
+		h.transitionToMaintenanceStart = nil
+	}
+	h.persistState()
+	h.subscribers.publish(h.status())
+}
+
+// DefaultNFTBinary is the nft binary run if FirewallConfig.NFTBinary is
+// empty.
+const DefaultNFTBinary = "/usr/sbin/nft"
+
+var (
+	ErrInvalidTransition = errors.New("invalid transition")
+	ErrTransitionFailed  = errors.New("could not execute transition")
+)
+
+// applyArgs returns the nft arguments to apply the rules of the given mode.
+func (h *FirewallHandler) applyArgs(fm FirewallMode) []string {
+	if fm == TransitionToMaintenance {
+		// Echo the added rules with their handles, so they can be removed precisely
+		return h.rulesets[fm].args("--echo", "--handle")
+	}
+	return h.rulesets[fm].args()
+}
 
+// applyNFTables applies the rules of the mode, with its hooks. Must be called
+// with the lock held.
+func (h *FirewallHandler) applyNFTables(fm FirewallMode) error {
+	return h.apply(fm, false)
+}
+
+// revertNFTables applies the rules of the mode to revert a failed transition.
+// Unlike applyNFTables, a failing pre-apply hook never aborts it. Must be
+// called with the lock held.
+func (h *FirewallHandler) revertNFTables(fm FirewallMode) error {
+	return h.apply(fm, true)
+}
+
+func (h *FirewallHandler) apply(fm FirewallMode, revert bool) error {
+	h.lock.assertHeld("applyNFTables")
+
+	if err := h.runPreApplyHook(fm); err != nil && !revert {
+		return err
+	}
+	h.snapshotRuleset(fm)
 	h.log.Info("applying nftables", "current_mode", h.mode, "apply_mode", fm)
-	var args []string
-	switch fm {
-	case Maintenance:
-		args = []string{"-f", "/etc/nftables-maintenance.conf"}
-	case Production:
-		args = []string{"-f", "/etc/nftables-production.conf"}
-	case TransitionToMaintenance:
-		args = []string{"-f", "/etc/nftables-transition.conf"}
-	default:
-		panic("invalid trusted firewall mode passed, refusing to continue")
+	// The transition rules stay in place until the next ruleset is applied,
+	// so a failed apply doesn't leave the node without them
+	leavingTransition := h.mode == TransitionToMaintenance && fm != TransitionToMaintenance
+
+	// Read right before applying, so the cached copy matches what nft reads
+	content, readErr := os.ReadFile(h.rulesets[fm].path)
+
+	// Waiting for a slot doesn't count as apply duration
+	release := h.config.ApplyLimiter.acquire()
+	start := time.Now()
+	var output []byte
+	err := h.takeFault()
+	if err == nil {
+		output, err = h.backend.Apply(context.Background(), h.mode, fm)
+	}
+	release()
+	h.lastApplyDurations[fm] = time.Since(start)
+	h.metrics.lastApplyDuration.WithLabelValues(fm.String()).Set(h.lastApplyDurations[fm].Seconds())
+	h.metrics.applyDuration.WithLabelValues(fm.String()).Observe(h.lastApplyDurations[fm].Seconds())
+	h.lastApply = applyResult{mode: fm, at: h.now(), err: err}
+	if err != nil {
+		reason := classifyApplyFailure(output, err)
+		h.metrics.applyErrors.WithLabelValues(fm.String(), reason).Inc()
+		h.log.With("output", output).With("error", err).With("reason", reason).Error("could not apply nftables configuration")
+		return &applyError{reason: reason, err: err}
 	}
 
-	output, err := exec.Command("/usr/sbin/nft", args...).CombinedOutput()
+	if leavingTransition {
+		h.removeTransitionRules()
+	}
+	h.generation++
+	h.metrics.generation.Set(float64(h.generation))
+	h.persistState()
+	if readErr == nil {
+		h.appliedRulesets[fm] = appliedRuleset{content: content, at: h.now()}
+	} else {
+		h.log.Warn("could not cache the applied ruleset", "mode", fm, "error", readErr)
+		delete(h.appliedRulesets, fm)
+	}
+
+	if fm == TransitionToMaintenance {
+		h.transitionHandles = h.recordTransitionRules(output)
+	}
+	if h.config.RejectTransitionsOnDrift {
+		h.recordExpectedRuleset()
+	}
+	h.runPostApplyHook(fm)
+	return nil
+}
+
+// validateNFTables checks the configuration for the given mode without
+// applying it. It doesn't need the lock, the rulesets are fixed on startup.
+func (h *FirewallHandler) validateNFTables(fm FirewallMode) error {
+	ctx := withWorkDir(context.Background(), h.rulesets[fm].workDir(h.config.WorkDir))
+	output, err := h.runner.Run(ctx, h.config.NFTBinary, h.rulesets[fm].args("-c")...)
 	if err != nil {
-		h.log.With("output", output).With("error", err).Error("could not apply nftables configuration")
+		return fmt.Errorf("%w: %w: %s", errValidationVetoed, err, bytes.TrimSpace(output))
 	}
+	return nil
+}
 
+// handleTransition runs a transition request.
+func (h *FirewallHandler) handleTransition(w http.ResponseWriter, r *http.Request, to FirewallMode, transition func(requestedBy string) error) {
+	if !h.runTransition(w, r, to, transition) {
+		return
+	}
+	h.lock.Lock()
+	draining := h.mode == TransitionToMaintenance
+	h.lock.Unlock()
+	if draining {
+		// Started, but only completes after TransitionDuration
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// runTransition starts a transition, or writes the error response if that
+// fails.
+func (h *FirewallHandler) runTransition(w http.ResponseWriter, r *http.Request, to FirewallMode, transition func(requestedBy string) error) bool {
+	key, idempotent := h.idempotencyKey(r, to)
+	if idempotent {
+		if res, ok := h.idempotency.get(key, h.now()); ok {
+			w.Header().Set(IdempotentReplayedHeader, "true")
+			if res.err != nil {
+				h.writeTransitionError(w, res.err)
+				return false
+			}
+			return true
+		}
+	}
+	err := h.startTransition(r, to, transition)
+	if idempotent {
+		h.rememberTransition(key, err)
+	}
+	if err != nil {
+		if errors.Is(err, ErrPreconditionFailed) {
+			h.lock.Lock()
+			w.Header().Set("ETag", h.stateETag())
+			h.lock.Unlock()
+		}
+		h.writeTransitionError(w, err)
+		return false
+	}
+	return true
+}
+
+// startTransition starts a transition once the quiet period, If-Match and
+// expected mode of the request allow it. If CoalesceTransitions is enabled,
+// identical concurrent requests share a single transition and its result.
+// Must be called without the lock held.
+func (h *FirewallHandler) startTransition(r *http.Request, to FirewallMode, transition func(requestedBy string) error) error {
+	run := func() error {
+		h.lock.Lock()
+		defer h.lock.Unlock()
+
+		if err := h.checkQuietPeriod(); err != nil {
+			return err
+		}
+		if err := h.checkIfMatch(r); err != nil {
+			return err
+		}
+		if err := h.checkExpectedMode(r); err != nil {
+			return err
+		}
+		h.requestInitiator = requestInitiator(r.Context())
+		defer func() { h.requestInitiator = "" }()
+		return transition(requestedBy(r.Context()))
+	}
+
+	var err error
+	if h.config.CoalesceTransitions {
+		var shared bool
+		key := to.String() + " " + r.Header.Get("If-Match")
+		if expected, ok := expectedMode(r.Context()); ok {
+			key += " " + expected.String()
+		}
+		shared, err = h.coalescer.Do(key, run)
+		if shared {
+			h.log.Info("coalesced transition request", "to", to, "requested_by", requestedBy(r.Context()), "error", err)
+		}
+	} else {
+		err = run()
+	}
 	return err
 }
 
+// handleMaintenance starts the transition to maintenance. With `?wait=true`,
+// it responds only once the transition completed, TransitionWaitTimeout
+// elapsed or the request is canceled, with the status at that point.
 func (h *FirewallHandler) handleMaintenance(w http.ResponseWriter, r *http.Request) {
+	wait := false
+	if v := r.URL.Query().Get("wait"); v != "" {
+		var err error
+		if wait, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, "invalid wait parameter: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if !wait {
+		h.handleTransition(w, r, Maintenance, h.transitionToMaintenance)
+		return
+	}
+
+	if !h.runTransition(w, r, Maintenance, h.transitionToMaintenance) {
+		return
+	}
 	h.lock.Lock()
-	defer h.lock.Unlock()
+	done := h.transitionDone
+	h.lock.Unlock()
 
-	if h.mode != Production {
-		http.Error(w, "invalid maintenance transition request not from production mode", http.StatusBadRequest)
+	deadline := time.Now().Add(h.config.TransitionWaitTimeout)
+	// Best effort, not supported by all response writers
+	_ = http.NewResponseController(w).SetWriteDeadline(deadline.Add(time.Second))
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	code := http.StatusOK
+	select {
+	case <-done:
+	case <-timer.C:
+		code = http.StatusAccepted
+	case <-r.Context().Done():
 		return
 	}
 
+	h.lock.Lock()
+	status := h.status()
+	h.lock.Unlock()
+	if code == http.StatusOK && status.Mode != Maintenance.String() {
+		code = http.StatusInternalServerError // Reverted
+	}
+	writeJSON(w, code, status)
+}
+
+// transitionToMaintenance applies the transition rules and schedules the
+// switch to maintenance after TransitionDuration. Must be called with the
+// lock held.
+func (h *FirewallHandler) transitionToMaintenance(requestedBy string) error {
+	log := h.log.With("to", Maintenance, "requested_by", requestedBy)
+	if !h.requestable(TransitionToMaintenance) {
+		log.Warn("rejecting transition", "mode", h.mode)
+		return h.rejectMode(Maintenance, Production)
+	}
+	if err := h.checkDwell(Maintenance); err != nil {
+		log.Warn("rejecting transition", "error", err)
+		return err
+	}
+	if err := h.guardDrift(); err != nil {
+		log.Warn("rejecting transition", "error", err)
+		return err
+	}
+
+	log.Info("starting transition")
+	return h.startMaintenance(requestedBy)
+}
+
+// forceMaintenance starts the transition to maintenance for safety drains,
+// such as a missed heartbeat. Unlike transitionToMaintenance, it skips the
+// guards of transition requests (dwell, cooldowns, drift and the quiet
+// period), which must not keep the node in production. Must be called with
+// the lock held.
+func (h *FirewallHandler) forceMaintenance(requestedBy string) error {
+	if !h.requestable(TransitionToMaintenance) {
+		return h.rejectMode(Maintenance, Production)
+	}
+	h.log.Warn("forcing transition", "to", Maintenance, "requested_by", requestedBy)
+	return h.startMaintenance(requestedBy)
+}
+
+// startMaintenance applies the transition rules of an allowed transition to
+// maintenance. Must be called with the lock held.
+func (h *FirewallHandler) startMaintenance(requestedBy string) error {
+	h.transitionRequestedBy = requestedBy
+	h.transitionInitiator = h.initiator(requestedBy)
 	err := h.applyNFTables(TransitionToMaintenance)
 	if err != nil {
-		err = h.applyNFTables(Production)
-		if err != nil {
+		if err := h.revertNFTables(Production); err != nil {
 			// TODO: handle this case
-			panic("irrecoverable state - could not revert nftables transition")
+			h.recordTransition(Maintenance, resultFailed)
+			h.fatal(errRevertTransitionFailed)
 		}
-		http.Error(w, "could not execute transition", http.StatusInternalServerError)
-		return
+		h.recordTransition(Maintenance, resultReverted)
+		return failedTransition(err)
 	}
 	// TODO: also drop existing established connections (once)
 
-	*h.transitionToMaintenanceStart = time.Now()
-	h.mode = TransitionToMaintenance
-
-	go func() {
-		time.Sleep(h.config.TransitionDuration)
-
-		h.lock.Lock()
-		defer h.lock.Unlock()
+	start := h.now()
+	h.transitionToMaintenanceStart = &start
+	h.setMode(TransitionToMaintenance)
 
-		if h.mode != TransitionToMaintenance {
-			panic("invalid transition state, refusing to continue")
+	h.transitionDone = make(chan struct{})
+	if h.config.TransitionDuration == 0 {
+		h.finishTransition()
+		return nil
+	}
+	timer := time.NewTimer(h.config.TransitionDuration)
+	stop := make(chan struct{})
+	h.transitionTimer, h.transitionStop = timer, stop
+	h.tasks.Go(func(ctx context.Context) {
+		var poll <-chan time.Time
+		if h.config.DrainPollInterval > 0 {
+			ticker := time.NewTicker(h.config.DrainPollInterval)
+			defer ticker.Stop()
+			poll = ticker.C
 		}
-		err := h.applyNFTables(Maintenance)
-		if err == nil {
-			// Everything OK!
-			h.mode = Maintenance
-			return
+		for {
+			select {
+			case <-timer.C:
+				h.completeTransition()
+				return
+			case <-poll:
+				if h.drained() && h.completeTransitionEarly() {
+					return
+				}
+			case <-stop:
+				return
+			case <-ctx.Done():
+				return
+			}
 		}
+	})
 
-		h.log.Error("failed to apply maintenance firewall rules", "error", err)
+	return nil
+}
 
-		// Try to revert back to production. If that also fails, panic - irrecoverable state.
-		err = h.applyNFTables(Production)
-		if err != nil {
-			h.log.Error("failed to apply revert to production after failed maintenance transition", "error", err)
+// stopTransitionTimer prevents the pending transition from completing on
+// its own. Returns false if it's already completing. Must be called with the
+// lock held.
+func (h *FirewallHandler) stopTransitionTimer() bool {
+	if !h.transitionTimer.Stop() {
+		return false
+	}
+	close(h.transitionStop)
+	return true
+}
 
-			// TODO: handle this case
-			panic("could not revert after failed transition attempt, refusing to continue")
-		}
+// completeTransition runs once TransitionDuration has elapsed.
+func (h *FirewallHandler) completeTransition() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
 
-		// Revert OK
-		h.mode = Production
-	}()
+	if h.mode != TransitionToMaintenance {
+		panic("invalid transition state, refusing to continue")
+	}
+	if h.config.DrainPollInterval > 0 {
+		h.transitionCompletion = completionTimedOut
+	}
+	h.finishTransition()
+}
 
-	w.WriteHeader(http.StatusOK)
+// finishTransition applies the maintenance rules, or reverts to production if
+// that fails. Must be called with the lock held.
+func (h *FirewallHandler) finishTransition() {
+	defer close(h.transitionDone)
+
+	err := h.applyNFTables(Maintenance)
+	if err == nil {
+		// Everything OK!
+		h.setMode(Maintenance)
+		h.startLease()
+		h.recordTransition(Maintenance, resultCompleted)
+		h.cascade()
+		return
+	}
+
+	h.log.Error("failed to apply maintenance firewall rules", "error", err)
+
+	// Try to revert back to production. If that also fails, it's fatal - irrecoverable state.
+	err = h.revertNFTables(Production)
+	if err != nil {
+		h.log.Error("failed to apply revert to production after failed maintenance transition", "error", err)
+
+		// TODO: handle this case
+		h.recordTransition(Maintenance, resultFailed)
+		h.fatal(errRevertMaintenanceFailed)
+	}
+
+	// Revert OK
+	h.setMode(Production)
+	h.recordTransition(Maintenance, resultReverted)
 }
 
-func (h *FirewallHandler) handleProduction(w http.ResponseWriter, r *http.Request) {
+// Close stops all background tasks, e.g. a pending transition, waits for
+// them to return and closes the channels of all subscribers. The handler must
+// not be used afterwards.
+func (h *FirewallHandler) Close() {
+	h.tasks.Stop()
+	h.subscribers.closeAll()
+	if h.syslog != nil {
+		h.syslog.Close()
+	}
+	if h.audit != nil {
+		h.audit.Close()
+	}
+}
+
+// EnterMaintenance drives the node into maintenance and waits for the
+// transition to complete. If ctx expires first, the remaining drain time is
+// skipped and the maintenance rules are applied immediately.
+func (h *FirewallHandler) EnterMaintenance(ctx context.Context) error {
 	h.lock.Lock()
-	defer h.lock.Unlock()
+	switch h.mode {
+	case Maintenance:
+		h.lock.Unlock()
+		return nil
+	case Lockdown:
+		// Stricter than maintenance already
+		h.lock.Unlock()
+		return nil
+	case Initializing:
+		// Nothing was applied yet, so there's no traffic to drain
+		defer h.lock.Unlock()
+		if err := h.applyNFTables(Maintenance); err != nil {
+			return failedTransition(err)
+		}
+		h.setMode(Maintenance)
+		return nil
+	case Production:
+		if err := h.forceMaintenance("shutdown"); err != nil {
+			h.lock.Unlock()
+			return err
+		}
+	}
+	done := h.transitionDone
+	h.lock.Unlock()
 
+	select {
+	case <-done:
+	case <-ctx.Done():
+		h.lock.Lock()
+		if h.mode == TransitionToMaintenance && h.stopTransitionTimer() {
+			h.log.Warn("deadline reached, completing maintenance transition early")
+			h.finishTransition()
+		}
+		h.lock.Unlock()
+		<-done
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
 	if h.mode != Maintenance {
-		http.Error(w, "invalid production transition request not from maintenance mode", http.StatusBadRequest)
-		return
+		return fmt.Errorf("%w: transition ended in %s mode", ErrTransitionFailed, h.mode)
 	}
+	return nil
+}
+
+func (h *FirewallHandler) handleProduction(w http.ResponseWriter, r *http.Request) {
+	h.handleTransition(w, r, Production, h.transitionToProduction)
+}
+
+// transitionToProduction applies the production rules. If that fails, the
+// maintenance rules are restored and the node stays in maintenance, with the
+// transition recorded as reverted and the request failing. Must be called
+// with the lock held.
+func (h *FirewallHandler) transitionToProduction(requestedBy string) error {
+	log := h.log.With("to", Production, "requested_by", requestedBy)
+	if !h.requestable(Production) {
+		log.Warn("rejecting transition", "mode", h.mode)
+		return h.rejectMode(Production, Maintenance)
+	}
+	if err := h.checkDwell(Production); err != nil {
+		log.Warn("rejecting transition", "error", err)
+		return err
+	}
+	if err := h.guardDrift(); err != nil {
+		log.Warn("rejecting transition", "error", err)
+		return err
+	}
+
+	log.Info("starting transition")
+	return h.startProduction(requestedBy)
+}
 
+// forceProduction returns to production when the firewall itself decides
+// to, such as on an expired maintenance lease. Like forceMaintenance, it
+// skips the guards of transition requests. Must be called with the lock
+// held.
+func (h *FirewallHandler) forceProduction(requestedBy string) error {
+	if !h.requestable(Production) {
+		return h.rejectMode(Production, Maintenance)
+	}
+	h.log.Warn("forcing transition", "to", Production, "requested_by", requestedBy)
+	return h.startProduction(requestedBy)
+}
+
+// startProduction applies the production rules of an allowed transition.
+// Must be called with the lock held.
+func (h *FirewallHandler) startProduction(requestedBy string) error {
+	h.transitionRequestedBy = requestedBy
+	h.transitionInitiator = h.initiator(requestedBy)
 	err := h.applyNFTables(Production)
 	if err != nil {
-		err := h.applyNFTables(Maintenance)
-		if err != nil {
-			panic("irrecoverable state")
+		if err := h.revertNFTables(Maintenance); err != nil {
+			h.recordTransition(Production, resultFailed)
+			h.fatal(errRevertProductionFailed)
 		}
+		h.recordTransition(Production, resultReverted)
+		return failedTransition(err)
 	}
 
 	// TODO: drop established connections
 
-	h.mode = Production
+	h.setMode(Production)
+	h.recordTransition(Production, resultCompleted)
+	h.startProductionProbe()
+	return nil
+}
 
-	w.WriteHeader(http.StatusOK)
+// writeTransitionError responds with the rejection of a transition, or with
+// 500 if it failed, both as ErrorResponse.
+func (h *FirewallHandler) writeTransitionError(w http.ResponseWriter, err error) {
+	code, rejected := rejectionCode(err)
+	if !rejected {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error(), Reason: failureReason(err)})
+		return
+	}
+
+	var retry interface{ retryAfter() string }
+	if errors.As(err, &retry) {
+		w.Header().Set("Retry-After", retry.retryAfter())
+	}
+	var status int
+	switch code {
+	case ReasonRequired:
+		status = http.StatusBadRequest
+	case WrongSourceMode, TransitionInProgress, DriftDetected, ModeMismatch:
+		status = http.StatusConflict
+	case PreconditionFailed:
+		status = http.StatusPreconditionFailed
+	case Cooldown:
+		status = http.StatusTooManyRequests
+	case NotReady, Degraded:
+		status = http.StatusServiceUnavailable
+	default:
+		status = http.StatusBadRequest
+	}
+	h.reject(w, status, code, err)
 }
 
 type FirewallMode uint32
@@ -151,8 +1120,20 @@ const (
 	Maintenance FirewallMode = iota
 	Production
 	TransitionToMaintenance
+	Initializing // Until the startup apply completed, see FirewallConfig.ApplyOnStartup
+	Lockdown     // Denies all but management traffic, only left by a reset
 )
 
+// ParseFirewallMode parses the string representation of a mode.
+func ParseFirewallMode(s string) (FirewallMode, error) {
+	for _, fm := range []FirewallMode{Maintenance, Production, TransitionToMaintenance, Lockdown} {
+		if fm.String() == s {
+			return fm, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown firewall mode %q", s)
+}
+
 func (fm FirewallMode) String() string {
 	switch fm {
 	case Maintenance:
@@ -161,6 +1142,10 @@ func (fm FirewallMode) String() string {
 		return "production"
 	case TransitionToMaintenance:
 		return "transition_to_maintenance"
+	case Initializing:
+		return "initializing"
+	case Lockdown:
+		return "lockdown"
 	default:
 		return "unknown"
 	}
@@ -0,0 +1,268 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegativeTransitionDuration(t *testing.T) {
+	_, err := NewFirewallHandler(slog.New(slog.NewTextHandler(io.Discard, nil)), FirewallConfig{TransitionDuration: -time.Second})
+	require.Error(t, err)
+}
+
+func TestDefaultTransitionDuration(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	h, err := NewFirewallHandler(log, FirewallConfig{})
+	require.NoError(t, err)
+	require.Equal(t, DefaultTransitionDuration, h.config.TransitionDuration)
+
+	h, err = NewFirewallHandler(log, FirewallConfig{ImmediateTransition: true})
+	require.NoError(t, err)
+	require.Zero(t, h.config.TransitionDuration)
+
+	_, err = NewFirewallHandler(log, FirewallConfig{ImmediateTransition: true, TransitionDuration: time.Minute})
+	require.Error(t, err)
+}
+
+func TestZeroTransitionDurationIsImmediate(t *testing.T) {
+	h := newTestHandler(t, FirewallConfig{TransitionDuration: 0}, nil)
+	h.mode = Production
+
+	rr := httptest.NewRecorder()
+	h.handleMaintenance(rr, httptest.NewRequest(http.MethodGet, "/firewall/maintenance", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	// Maintenance is applied before the response is written, no timer involved
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	require.Equal(t, Maintenance, h.mode)
+	require.Nil(t, h.transitionTimer)
+	require.Equal(t, []string{
+		"/usr/sbin/nft --echo --handle -f /etc/nftables-transition.conf",
+		"/usr/sbin/nft -f /etc/nftables-maintenance.conf",
+	}, testRunner(h).Calls())
+}
+
+func TestMaintenanceRecordsTransitionStart(t *testing.T) {
+	clock := newFakeClock()
+	h := newTestHandler(t, FirewallConfig{TransitionDuration: time.Hour}, clock)
+	h.mode = Production
+	t.Cleanup(h.Close)
+
+	rr := httptest.NewRecorder()
+	h.handleMaintenance(rr, httptest.NewRequest(http.MethodGet, "/firewall/maintenance", nil))
+	require.Equal(t, http.StatusAccepted, rr.Code)
+
+	status := getStatusJSON(t, h)
+	require.NotNil(t, status.TransitionStartedAt)
+	require.True(t, clock.Now().Equal(*status.TransitionStartedAt))
+
+	h.lock.Lock()
+	require.Equal(t, TransitionToMaintenance, h.mode)
+	require.NotNil(t, h.transitionToMaintenanceStart)
+	require.Equal(t, clock.Now(), *h.transitionToMaintenanceStart)
+	h.lock.Unlock()
+
+	// A reverted transition clears the start
+	h = newTestHandler(t, FirewallConfig{}, clock)
+	h.mode = Production
+	testRunner(h).Fail("/etc/nftables-maintenance.conf", errFake)
+	rr = httptest.NewRecorder()
+	h.handleMaintenance(rr, httptest.NewRequest(http.MethodGet, "/firewall/maintenance", nil))
+	status = getStatusJSON(t, h)
+	require.Equal(t, "production", status.Mode)
+	require.Nil(t, status.TransitionStartedAt)
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	require.Nil(t, h.transitionToMaintenanceStart)
+}
+
+func TestMaintenanceWait(t *testing.T) {
+	maintenance := func(h *FirewallHandler, ctx context.Context) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/firewall/maintenance?wait=true", nil).WithContext(ctx)
+		rr := httptest.NewRecorder()
+		h.handleMaintenance(rr, req)
+		return rr
+	}
+
+	t.Run("completed", func(t *testing.T) {
+		h := newTestHandler(t, FirewallConfig{TransitionDuration: 20 * time.Millisecond}, nil)
+		h.mode = Production
+
+		rr := maintenance(h, context.Background())
+		require.Equal(t, http.StatusOK, rr.Code)
+		var status Status
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &status))
+		require.Equal(t, "maintenance", status.Mode)
+	})
+
+	t.Run("reverted", func(t *testing.T) {
+		h := newTestHandler(t, FirewallConfig{TransitionDuration: 20 * time.Millisecond}, nil)
+		h.mode = Production
+		testRunner(h).Fail("/etc/nftables-maintenance.conf", errFake)
+
+		rr := maintenance(h, context.Background())
+		require.Equal(t, http.StatusInternalServerError, rr.Code)
+		require.Contains(t, rr.Body.String(), `"mode":"production"`)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		h := newTestHandler(t, FirewallConfig{TransitionDuration: time.Hour, TransitionWaitTimeout: 20 * time.Millisecond}, nil)
+		h.mode = Production
+		t.Cleanup(h.Close)
+
+		rr := maintenance(h, context.Background())
+		require.Equal(t, http.StatusAccepted, rr.Code)
+		require.Contains(t, rr.Body.String(), `"mode":"transition_to_maintenance"`)
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		h := newTestHandler(t, FirewallConfig{TransitionDuration: time.Hour}, nil)
+		h.mode = Production
+		t.Cleanup(h.Close)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		maintenance(h, ctx)
+		require.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		h := newTestHandler(t, FirewallConfig{}, nil)
+		rr := httptest.NewRecorder()
+		h.handleMaintenance(rr, httptest.NewRequest(http.MethodGet, "/firewall/maintenance?wait=maybe", nil))
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func TestTransitionStatusCodes(t *testing.T) {
+	tests := []struct {
+		name       string
+		configure  func(cfg *HTTPServerConfig)
+		setup      func(h *FirewallHandler)
+		method     string
+		path       string
+		body       string
+		token      string
+		wantStatus int
+	}{
+		{
+			name:       "production applied",
+			path:       "/firewall/production",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "maintenance completed",
+			setup:      func(h *FirewallHandler) { h.mode = Production },
+			path:       "/firewall/maintenance",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "maintenance started",
+			configure:  func(cfg *HTTPServerConfig) { cfg.Firewall.TransitionDuration = time.Hour },
+			setup:      func(h *FirewallHandler) { h.mode = Production },
+			path:       "/firewall/maintenance",
+			wantStatus: http.StatusAccepted,
+		},
+		{
+			name:       "maintenance started by mode",
+			configure:  func(cfg *HTTPServerConfig) { cfg.Firewall.TransitionDuration = time.Hour },
+			setup:      func(h *FirewallHandler) { h.mode = Production },
+			method:     http.MethodPost,
+			path:       "/firewall/transition",
+			body:       `{"mode": "maintenance"}`,
+			wantStatus: http.StatusAccepted,
+		},
+		{
+			name:       "malformed",
+			method:     http.MethodPost,
+			path:       "/firewall/transition",
+			body:       `{"mode": "nope"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "unauthorized",
+			configure:  func(cfg *HTTPServerConfig) { cfg.AuthTokens = map[string][]string{"token": nil} },
+			path:       "/firewall/production",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "forbidden",
+			configure:  func(cfg *HTTPServerConfig) { cfg.AuthTokens = map[string][]string{"token": {"maintenance"}} },
+			path:       "/firewall/production",
+			token:      "token",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "wrong source mode",
+			setup:      func(h *FirewallHandler) { h.mode = Production },
+			path:       "/firewall/production",
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "transition in progress",
+			setup:      func(h *FirewallHandler) { h.mode = TransitionToMaintenance },
+			path:       "/firewall/production",
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name: "cooldown",
+			configure: func(cfg *HTTPServerConfig) {
+				cfg.Firewall.MinDwell = map[FirewallMode]time.Duration{Maintenance: time.Hour}
+			},
+			setup:      func(h *FirewallHandler) { h.modeSince = h.now() },
+			path:       "/firewall/production",
+			wantStatus: http.StatusTooManyRequests,
+		},
+		{
+			name: "apply failed",
+			setup: func(h *FirewallHandler) {
+				h.mode = Production
+				testRunner(h).Fail("/etc/nftables-transition.conf", errFake)
+			},
+			path:       "/firewall/maintenance",
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name:       "degraded",
+			setup:      func(h *FirewallHandler) { h.mode, h.degraded = Initializing, true },
+			path:       "/firewall/production",
+			wantStatus: http.StatusServiceUnavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestServerConfig()
+			if tt.configure != nil {
+				tt.configure(cfg)
+			}
+			srv := newTestServer(t, cfg)
+			t.Cleanup(srv.handler.Close)
+			if tt.setup != nil {
+				tt.setup(srv.handler)
+			}
+
+			method := tt.method
+			if method == "" {
+				method = http.MethodPost
+			}
+			req := httptest.NewRequest(method, tt.path, strings.NewReader(tt.body))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rr := httptest.NewRecorder()
+			srv.getRouter().ServeHTTP(rr, req)
+			require.Equal(t, tt.wantStatus, rr.Code, rr.Body.String())
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package httpserver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"strconv"
+	"strings"
+)
+
+// ruleHandle identifies a single nftables rule added by us, so it can later
+// be deleted precisely instead of re-reading and rewriting the ruleset.
+type ruleHandle struct {
+	Family string
+	Table  string
+	Chain  string
+	Handle uint64
+
+	// TableHandle is the handle of the table when the rule was added. Rule
+	// handles are unique within a table, but restart when it's recreated.
+	TableHandle uint64
+}
+
+func (rh ruleHandle) table() string {
+	return rh.Family + " " + rh.Table
+}
+
+var nftFamilies = map[string]bool{
+	"ip": true, "ip6": true, "inet": true, "arp": true, "bridge": true, "netdev": true,
+}
+
+// parseRuleHandles extracts the handles of added rules from the output of
+// `nft --echo --handle`, e.g. `add rule inet filter input tcp dport 22 accept # handle 4`.
+func parseRuleHandles(output []byte) []ruleHandle {
+	var handles []ruleHandle
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		idx := strings.LastIndex(line, "# handle ")
+		if idx < 0 {
+			continue
+		}
+		handle, err := strconv.ParseUint(strings.TrimSpace(line[idx+len("# handle "):]), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		fields := strings.Fields(line[:idx])
+		if len(fields) < 4 || (fields[0] != "add" && fields[0] != "insert") || fields[1] != "rule" {
+			continue
+		}
+		family := "ip" // nft default if no family is given
+		if nftFamilies[fields[2]] {
+			family = fields[2]
+			fields = fields[1:]
+		}
+		if len(fields) < 4 {
+			continue
+		}
+		handles = append(handles, ruleHandle{Family: family, Table: fields[2], Chain: fields[3], Handle: handle})
+	}
+	return handles
+}
+
+// parseTableHandles extracts the handles of the tables from the output of
+// `nft --handle list tables`, e.g. `table inet filter # handle 3`, keyed by
+// family and name.
+func parseTableHandles(output []byte) map[string]uint64 {
+	tables := make(map[string]uint64)
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 6 || fields[0] != "table" || fields[3] != "#" || fields[4] != "handle" {
+			continue
+		}
+		handle, err := strconv.ParseUint(fields[5], 10, 64)
+		if err != nil {
+			continue
+		}
+		tables[fields[1]+" "+fields[2]] = handle
+	}
+	return tables
+}
+
+// recordTransitionRules returns the handles of the transition rules echoed
+// in the output of applying them, with the handles of their tables. Nothing
+// is recorded unless the backend deletes rules by handle. Must be called
+// with the lock held.
+func (h *FirewallHandler) recordTransitionRules(output []byte) []ruleHandle {
+	remover, ok := h.backend.(ruleRemover)
+	if !ok {
+		return nil
+	}
+	handles := h.rulesets[TransitionToMaintenance].format.parseHandles(output)
+	if len(handles) == 0 {
+		return nil
+	}
+	tables, err := remover.tableHandles(context.Background())
+	if err != nil {
+		h.log.Warn("could not list the tables of the transition rules, leaving them to the next ruleset", "error", err)
+		return nil
+	}
+	for i := range handles {
+		handles[i].TableHandle = tables[handles[i].table()]
+	}
+	return handles
+}
+
+// removeTransitionRules deletes the rules recorded when the transition
+// ruleset was applied, once the next ruleset was applied. Rules whose table
+// was recreated in the meantime are skipped, as their handles may now belong
+// to other rules. Rules which no longer exist are logged and skipped. Must be
+// called with the lock held.
+func (h *FirewallHandler) removeTransitionRules() {
+	handles := h.transitionHandles
+	h.transitionHandles = nil
+	remover, ok := h.backend.(ruleRemover)
+	if !ok || len(handles) == 0 {
+		return
+	}
+	tables, err := remover.tableHandles(context.Background())
+	if err != nil {
+		h.log.Warn("could not list the tables of the transition rules, not deleting them", "error", err)
+		return
+	}
+	for _, rh := range handles {
+		if th, ok := tables[rh.table()]; !ok || rh.TableHandle == 0 || th != rh.TableHandle {
+			h.log.Info("not deleting transition rule, its table was replaced", "handle", rh.Handle, "table", rh.Table, "chain", rh.Chain)
+			continue
+		}
+		if output, err := remover.deleteRule(context.Background(), rh); err != nil {
+			h.log.Warn("could not delete transition rule", "handle", rh.Handle, "table", rh.Table, "chain", rh.Chain, "output", output, "error", err)
+		}
+	}
+}
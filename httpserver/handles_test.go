@@ -0,0 +1,102 @@
+package httpserver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRuleHandles(t *testing.T) {
+	output := []byte(`add table inet drain
+add chain inet drain input { type filter hook input priority -10; policy accept; }
+add rule inet drain input ct state new tcp dport 8545 drop # handle 4
+insert rule filter input tcp dport 22 accept # handle 7
+add rule inet drain input # handle bogus
+`)
+	require.Equal(t, []ruleHandle{
+		{Family: "inet", Table: "drain", Chain: "input", Handle: 4},
+		{Family: "ip", Table: "filter", Chain: "input", Handle: 7},
+	}, parseRuleHandles(output))
+}
+
+func TestParseTableHandles(t *testing.T) {
+	output := []byte(`table inet filter # handle 3
+table ip nat # handle 12
+table inet drain
+`)
+	require.Equal(t, map[string]uint64{"inet filter": 3, "ip nat": 12}, parseTableHandles(output))
+}
+
+func TestTransitionRulesRemovedByHandle(t *testing.T) {
+	h := newTestHandler(t, FirewallConfig{}, nil)
+	runner := testRunner(h)
+	runner.Output("/etc/nftables-transition.conf", []byte("add rule inet drain input ct state new drop # handle 42\n"))
+	runner.Output("tables", []byte("table inet drain # handle 5\n"))
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	require.NoError(t, h.applyNFTables(TransitionToMaintenance))
+	require.Equal(t, []ruleHandle{{Family: "inet", Table: "drain", Chain: "input", Handle: 42, TableHandle: 5}}, h.transitionHandles)
+	h.setMode(TransitionToMaintenance)
+
+	require.NoError(t, h.applyNFTables(Maintenance))
+	require.Empty(t, h.transitionHandles)
+	require.Equal(t, []string{
+		"/usr/sbin/nft --echo --handle -f /etc/nftables-transition.conf",
+		"/usr/sbin/nft --handle list tables",
+		"/usr/sbin/nft -f /etc/nftables-maintenance.conf",
+		"/usr/sbin/nft --handle list tables",
+		"/usr/sbin/nft delete rule inet drain input handle 42",
+	}, runner.Calls())
+}
+
+func TestTransitionRulesKeptOnRecreatedTable(t *testing.T) {
+	h := newTestHandler(t, FirewallConfig{}, nil)
+	runner := testRunner(h)
+	runner.Output("/etc/nftables-transition.conf", []byte("add rule inet drain input ct state new drop # handle 42\n"))
+	runner.Output("tables", []byte("table inet drain # handle 5\n"))
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	require.NoError(t, h.applyNFTables(TransitionToMaintenance))
+	h.setMode(TransitionToMaintenance)
+
+	// The maintenance ruleset recreated the table, handle 42 may be reused
+	runner.Output("tables", []byte("table inet drain # handle 9\n"))
+	require.NoError(t, h.applyNFTables(Maintenance))
+	require.Empty(t, h.transitionHandles)
+	require.NotContains(t, runner.Calls(), "/usr/sbin/nft delete rule inet drain input handle 42")
+}
+
+func TestTransitionRulesLeftToCustomBackend(t *testing.T) {
+	backend := &fakeBackend{output: []byte("add rule inet drain input ct state new drop # handle 42\n")}
+	h := newTestHandler(t, FirewallConfig{Backend: backend}, nil)
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	require.NoError(t, h.applyNFTables(TransitionToMaintenance))
+	require.Empty(t, h.transitionHandles)
+	h.setMode(TransitionToMaintenance)
+	require.NoError(t, h.applyNFTables(Maintenance))
+	require.Empty(t, testRunner(h).Calls())
+}
+
+func TestTransitionRulesKeptOnApplyFailure(t *testing.T) {
+	h := newTestHandler(t, FirewallConfig{}, nil)
+	runner := testRunner(h)
+	runner.Output("/etc/nftables-transition.conf", []byte("add rule inet drain input ct state new drop # handle 42\n"))
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	require.NoError(t, h.applyNFTables(TransitionToMaintenance))
+	h.setMode(TransitionToMaintenance)
+
+	runner.Fail("/etc/nftables-maintenance.conf", errFake)
+	require.Error(t, h.applyNFTables(Maintenance))
+	require.Equal(t, []ruleHandle{{Family: "inet", Table: "drain", Chain: "input", Handle: 42}}, h.transitionHandles)
+	require.NotContains(t, runner.Calls(), "/usr/sbin/nft delete rule inet drain input handle 42")
+}
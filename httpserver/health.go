@@ -0,0 +1,218 @@
+package httpserver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+func (srv *Server) handleLivez(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok"))
+}
+
+// handleReadyz reports not-ready until the startup apply (if configured)
+// completed and the startup warm-up has elapsed, while the periodic config
+// check fails, if the selected backend is unavailable, and once shutdown has
+// begun.
+func (srv *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if err := srv.handler.readiness().backendErr; err != nil {
+		http.Error(w, "not ready: "+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if !srv.ready() {
+		http.Error(w, "not ready", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ready"))
+}
+
+// ready flips isReady once the startup apply completed and the startup
+// warm-up has elapsed.
+func (srv *Server) ready() bool {
+	state := srv.handler.readiness()
+	if srv.shuttingDown.Load() || state.configErr != nil || state.backendErr != nil {
+		return false
+	}
+	if srv.isReady.Load() {
+		return true
+	}
+	if state.initializing {
+		return false
+	}
+	if srv.readyAt.IsZero() || srv.now().Before(srv.readyAt) {
+		return false
+	}
+	if srv.isReady.CompareAndSwap(false, true) {
+		srv.log.Info("startup warm-up elapsed, ready")
+	}
+	return true
+}
+
+// readiness is the handler state the readiness depends on.
+type readiness struct {
+	initializing bool
+	configErr    error // Of the last config check
+	backendErr   error
+}
+
+// readiness returns the handler state the readiness depends on. If the lock
+// is held, e.g. during a slow apply, the last known state is returned rather
+// than waiting for it, or initializing if there is none yet.
+func (h *FirewallHandler) readiness() readiness {
+	if !h.lock.TryLock() {
+		if last := h.lastReadiness.Load(); last != nil {
+			return *last
+		}
+		return readiness{initializing: true}
+	}
+	defer h.lock.Unlock()
+	state := readiness{initializing: h.mode == Initializing, configErr: h.configCheckErr, backendErr: h.backendErr}
+	h.lastReadiness.Store(&state)
+	return state
+}
+
+// healthCacheTTL bounds how often the detailed health spawns nft.
+const healthCacheTTL = 5 * time.Second
+
+const (
+	HealthOK       = "ok"
+	HealthDegraded = "degraded"
+)
+
+// HealthCheck is the result of a single check of the detailed health.
+type HealthCheck struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// DetailedHealth aggregates all health signals. Status is degraded if any
+// check is.
+type DetailedHealth struct {
+	Status string                 `json:"status"`
+	Mode   string                 `json:"mode"`
+	Checks map[string]HealthCheck `json:"checks"`
+}
+
+// applyResult is the outcome of the last apply.
+type applyResult struct {
+	mode FirewallMode
+	at   time.Time
+	err  error
+}
+
+// nftHealth is the result of the checks which spawn nft.
+type nftHealth struct {
+	at    time.Time
+	nft   HealthCheck
+	drift HealthCheck
+}
+
+// healthCache caches the checks which spawn nft. It has its own lock, since
+// nft is run without holding the handler lock.
+type healthCache struct {
+	mu   sync.Mutex
+	last *nftHealth // Nil until first checked
+}
+
+func healthCheck(err error, okMessage string) HealthCheck {
+	if err != nil {
+		return HealthCheck{Status: HealthDegraded, Message: err.Error()}
+	}
+	return HealthCheck{Status: HealthOK, Message: okMessage}
+}
+
+// cachedNFTHealth pings nft and checks for drift against the expected
+// ruleset, at most once per healthCacheTTL. Must be called without the lock,
+// so that a hanging nft doesn't block transitions.
+func (h *FirewallHandler) cachedNFTHealth(expectedRuleset string, mode FirewallMode) nftHealth {
+	h.health.mu.Lock()
+	defer h.health.mu.Unlock()
+	if last := h.health.last; last != nil && h.now().Sub(last.at) < healthCacheTTL {
+		return *last
+	}
+
+	c := nftHealth{at: h.now()}
+	if output, err := h.runner.Run(context.Background(), h.config.NFTBinary, "list", "tables"); err != nil {
+		c.nft = healthCheck(fmt.Errorf("%w: %s", err, bytes.TrimSpace(output)), "")
+	} else {
+		c.nft = healthCheck(nil, "reachable")
+	}
+	if expectedRuleset == "" {
+		c.drift = healthCheck(nil, "drift detection disabled")
+	} else {
+		c.drift = healthCheck(h.compareRuleset(expectedRuleset, mode), "matches the last apply")
+	}
+	h.health.last = &c
+	return c
+}
+
+// detailedHealth returns all health signals, without readiness. It only
+// holds the lock to snapshot the state, the nft checks are run after
+// releasing it.
+func (h *FirewallHandler) detailedHealth() DetailedHealth {
+	checks := make(map[string]HealthCheck)
+
+	h.lock.Lock()
+	switch {
+	case h.degraded:
+		checks["mode"] = HealthCheck{Status: HealthDegraded, Message: h.mode.String() + ", the startup apply failed"}
+	case h.mode == Lockdown:
+		checks["mode"] = HealthCheck{Status: HealthDegraded, Message: "lockdown, reset to leave it"}
+	default:
+		checks["mode"] = healthCheck(nil, h.mode.String())
+	}
+
+	switch {
+	case h.lastApply.at.IsZero():
+		checks["last_apply"] = healthCheck(nil, "nothing applied yet")
+	case h.lastApply.err != nil:
+		checks["last_apply"] = healthCheck(fmt.Errorf("%s rules failed at %s: %w", h.lastApply.mode, h.lastApply.at.Format(time.RFC3339), h.lastApply.err), "")
+	default:
+		checks["last_apply"] = healthCheck(nil, fmt.Sprintf("%s rules applied at %s", h.lastApply.mode, h.lastApply.at.Format(time.RFC3339)))
+	}
+
+	checks["config"] = healthCheck(h.configCheckErr, "valid")
+
+	if h.mode == TransitionToMaintenance && h.transitionToMaintenanceStart != nil {
+		checks["transition"] = healthCheck(nil, "to maintenance since "+h.transitionToMaintenanceStart.Format(time.RFC3339))
+	} else {
+		checks["transition"] = healthCheck(nil, "none active")
+	}
+
+	mode, expectedRuleset := h.mode, h.expectedRuleset
+	h.lock.Unlock()
+
+	nft := h.cachedNFTHealth(expectedRuleset, mode)
+	checks["nft"] = nft.nft
+	checks["drift"] = nft.drift
+
+	return DetailedHealth{Mode: mode.String(), Checks: checks}
+}
+
+// handleDetailedHealth reports every health signal, for on-call. It always
+// responds with 200, degraded checks are reported in the body.
+func (srv *Server) handleDetailedHealth(w http.ResponseWriter, r *http.Request) {
+	ready := srv.ready()
+
+	health := srv.handler.detailedHealth()
+
+	if ready {
+		health.Checks["readiness"] = healthCheck(nil, "ready")
+	} else {
+		health.Checks["readiness"] = healthCheck(errors.New("not ready"), "")
+	}
+
+	health.Status = HealthOK
+	for _, check := range health.Checks {
+		if check.Status != HealthOK {
+			health.Status = HealthDegraded
+		}
+	}
+	writeJSON(w, http.StatusOK, health)
+}
@@ -0,0 +1,98 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetailedHealth(t *testing.T) {
+	srv := newTestServer(t, newTestServerConfig())
+	t.Cleanup(srv.handler.Close)
+	clock := newFakeClock()
+	srv.handler.now = clock.Now
+	router := srv.getRouter()
+	runner := testRunner(srv.handler)
+
+	get := func() DetailedHealth {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/firewall/health/detailed", nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+		var health DetailedHealth
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &health))
+		return health
+	}
+	pings := func() int {
+		return len(slices.DeleteFunc(runner.Calls(), func(c string) bool { return c != DefaultNFTBinary+" list tables" }))
+	}
+
+	health := get()
+	for _, name := range []string{"mode", "readiness", "last_apply", "nft", "config", "drift", "transition"} {
+		require.Contains(t, health.Checks, name)
+	}
+	require.Equal(t, HealthDegraded, health.Status)
+	require.Equal(t, HealthDegraded, health.Checks["readiness"].Status)
+	require.Equal(t, HealthOK, health.Checks["nft"].Status)
+	require.Equal(t, "maintenance", health.Mode)
+	require.Equal(t, 1, pings())
+
+	// nft results are cached
+	runner.Fail("tables", errFake)
+	runner.Fail("/etc/nftables-production.conf", errFake)
+	h := srv.handler
+	h.lock.Lock()
+	require.Error(t, h.applyNFTables(Production))
+	h.lock.Unlock()
+	health = get()
+	require.Equal(t, HealthOK, health.Checks["nft"].Status)
+	require.Equal(t, HealthDegraded, health.Checks["last_apply"].Status)
+	require.Equal(t, 1, pings())
+
+	clock.Advance(healthCacheTTL)
+	health = get()
+	require.Equal(t, HealthDegraded, health.Checks["nft"].Status)
+	require.Equal(t, 2, pings())
+}
+
+// blockingRunner blocks listing the tables until released.
+type blockingRunner struct {
+	*fakeRunner
+	started chan struct{}
+	release chan struct{}
+}
+
+func (r *blockingRunner) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	if slices.Equal(args, []string{"list", "tables"}) {
+		close(r.started)
+		<-r.release
+	}
+	return r.fakeRunner.Run(ctx, name, args...)
+}
+
+func TestDetailedHealthRunsNFTWithoutLock(t *testing.T) {
+	srv := newTestServer(t, newTestServerConfig())
+	t.Cleanup(srv.handler.Close)
+	h := srv.handler
+	runner := &blockingRunner{fakeRunner: testRunner(h), started: make(chan struct{}), release: make(chan struct{})}
+	h.runner = runner
+
+	done := make(chan DetailedHealth)
+	go func() { done <- h.detailedHealth() }()
+	<-runner.started
+
+	// A transition isn't blocked by a hanging nft
+	require.True(t, h.lock.lockTimeout(time.Second))
+	h.mode = Production
+	h.lock.Unlock()
+
+	close(runner.release)
+	health := <-done
+	require.Equal(t, "maintenance", health.Mode)
+	require.Equal(t, HealthOK, health.Checks["nft"].Status)
+}
@@ -0,0 +1,70 @@
+package httpserver
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// heartbeatCheckInterval is how often a missed heartbeat is looked for.
+const heartbeatCheckInterval = time.Second
+
+// Heartbeat is the response of the heartbeat endpoint.
+type Heartbeat struct {
+	Deadline time.Time `json:"deadline"`
+}
+
+// startHeartbeats starts the dead man's switch, if enabled. The first
+// heartbeat is due within HeartbeatTimeout from now. Must be called with the
+// lock held.
+func (h *FirewallHandler) startHeartbeats() {
+	if h.config.HeartbeatTimeout <= 0 {
+		return
+	}
+	h.heartbeatDeadline = h.now().Add(h.config.HeartbeatTimeout)
+	h.tasks.Go(h.watchHeartbeats)
+}
+
+// watchHeartbeats forces maintenance once a heartbeat was missed.
+func (h *FirewallHandler) watchHeartbeats(ctx context.Context) {
+	ticker := time.NewTicker(heartbeatCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.checkHeartbeat()
+		}
+	}
+}
+
+// checkHeartbeat forces maintenance if in production and the heartbeat
+// deadline passed, assuming the orchestrator lost control. The deadline is
+// re-armed whenever production is entered. Failed transitions are retried on
+// the next check.
+func (h *FirewallHandler) checkHeartbeat() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.mode != Production || h.heartbeatDeadline.IsZero() || h.now().Before(h.heartbeatDeadline) {
+		return
+	}
+	h.log.Warn("heartbeat missed, forcing maintenance", "deadline", h.heartbeatDeadline)
+	if err := h.forceMaintenance("dead-man-switch"); err != nil {
+		h.log.Error("could not force maintenance after a missed heartbeat", "error", err)
+	}
+}
+
+// handleHeartbeat resets the dead man's switch.
+func (h *FirewallHandler) handleHeartbeat(w http.ResponseWriter, r *http.Request) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.heartbeatDeadline.IsZero() {
+		http.Error(w, "dead man's switch is disabled", http.StatusConflict)
+		return
+	}
+	h.heartbeatDeadline = h.now().Add(h.config.HeartbeatTimeout)
+	writeJSON(w, http.StatusOK, Heartbeat{Deadline: h.heartbeatDeadline})
+}
@@ -0,0 +1,73 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeadMansSwitch(t *testing.T) {
+	clock := newFakeClock()
+	h := newTestHandler(t, FirewallConfig{HeartbeatTimeout: time.Minute}, clock)
+	t.Cleanup(h.Close)
+	h.mode = Production
+
+	heartbeat := func() int {
+		rr := httptest.NewRecorder()
+		h.handleHeartbeat(rr, httptest.NewRequest(http.MethodPost, "/firewall/heartbeat", nil))
+		return rr.Code
+	}
+	require.Equal(t, http.StatusConflict, heartbeat())
+	require.Nil(t, getStatusJSON(t, h).HeartbeatDeadline)
+
+	h.lock.Lock()
+	h.startHeartbeats()
+	h.lock.Unlock()
+	require.Equal(t, clock.Now().Add(time.Minute), *getStatusJSON(t, h).HeartbeatDeadline)
+
+	// A heartbeat resets the timer
+	clock.Advance(50 * time.Second)
+	h.checkHeartbeat()
+	require.Equal(t, http.StatusOK, heartbeat())
+	require.Equal(t, clock.Now().Add(time.Minute), *getStatusJSON(t, h).HeartbeatDeadline)
+	clock.Advance(50 * time.Second)
+	h.checkHeartbeat()
+	require.Equal(t, Production, h.mode)
+
+	// A missed heartbeat forces maintenance
+	clock.Advance(10 * time.Second)
+	h.checkHeartbeat()
+	require.Equal(t, Maintenance, h.mode)
+	require.Equal(t, "dead-man-switch", h.history[len(h.history)-1].RequestedBy)
+}
+
+func TestDeadMansSwitchForced(t *testing.T) {
+	clock := newFakeClock()
+	h := newTestHandler(t, FirewallConfig{
+		HeartbeatTimeout: time.Minute,
+		MinDwell:         map[FirewallMode]time.Duration{Production: time.Hour},
+	}, clock)
+	t.Cleanup(h.Close)
+
+	h.lock.Lock()
+	h.startHeartbeats()
+	h.lock.Unlock()
+
+	// Heartbeats stopped during maintenance don't count against production
+	clock.Advance(2 * time.Minute)
+	rr := httptest.NewRecorder()
+	h.handleProduction(rr, httptest.NewRequest(http.MethodPost, "/firewall/production", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Equal(t, clock.Now().Add(time.Minute), *getStatusJSON(t, h).HeartbeatDeadline)
+	h.checkHeartbeat()
+	require.Equal(t, Production, h.mode)
+
+	// A missed heartbeat forces maintenance before the dwell time elapsed
+	clock.Advance(time.Minute)
+	h.checkHeartbeat()
+	require.Equal(t, Maintenance, h.mode)
+	require.Equal(t, "dead-man-switch", h.history[len(h.history)-1].RequestedBy)
+}
@@ -0,0 +1,135 @@
+package httpserver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var errFake = errors.New("fake error")
+
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+// fakeRunner records the commands it is asked to run. Commands can be failed
+// by registering an error for any of their arguments (e.g. a config path).
+type fakeRunner struct {
+	delay time.Duration
+
+	mu        sync.Mutex
+	calls     []string
+	dirs      []string // Working directory of each call
+	fail      map[string]error
+	failTimes map[string]int // Remaining failures, unlimited if missing
+	output    map[string][]byte
+}
+
+func newFakeRunner() *fakeRunner {
+	return &fakeRunner{fail: make(map[string]error), failTimes: make(map[string]int), output: make(map[string][]byte)}
+}
+
+func (r *fakeRunner) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	time.Sleep(r.delay)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls = append(r.calls, strings.Join(append([]string{name}, args...), " "))
+	r.dirs = append(r.dirs, workDir(ctx))
+	for _, arg := range args {
+		if err, ok := r.fail[arg]; ok {
+			if n, limited := r.failTimes[arg]; limited {
+				if n <= 1 {
+					delete(r.fail, arg)
+					delete(r.failTimes, arg)
+				} else {
+					r.failTimes[arg] = n - 1
+				}
+			}
+			return []byte("fake failure"), err
+		}
+	}
+	for _, arg := range args {
+		if out, ok := r.output[arg]; ok {
+			return out, nil
+		}
+	}
+	return nil, nil
+}
+
+// Output sets the output of commands containing the given argument.
+func (r *fakeRunner) Output(arg string, out []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.output[arg] = out
+}
+
+func (r *fakeRunner) Fail(arg string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fail[arg] = err
+}
+
+// FailTimes fails the next n commands containing the given argument.
+func (r *fakeRunner) FailTimes(arg string, err error, n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fail[arg] = err
+	r.failTimes[arg] = n
+}
+
+func (r *fakeRunner) Calls() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.calls...)
+}
+
+func (r *fakeRunner) Dirs() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.dirs...)
+}
+
+// newTestHandler creates a handler with a fake runner. Transitions are
+// immediate unless the config has a transition duration.
+func newTestHandler(t *testing.T, cfg FirewallConfig, clock *fakeClock) *FirewallHandler {
+	t.Helper()
+	cfg.ImmediateTransition = cfg.TransitionDuration == 0
+	h, err := NewFirewallHandler(slog.New(slog.NewTextHandler(io.Discard, nil)), cfg)
+	require.NoError(t, err)
+	h.runner = newFakeRunner()
+	if clock != nil {
+		h.now = clock.Now
+		h.durations = newModeDurations(h.mode, clock.Now(), cfg.ModeDurationsRollover)
+	}
+	return h
+}
+
+func testRunner(h *FirewallHandler) *fakeRunner {
+	return h.runner.(*fakeRunner) //nolint:forcetypeassert
+}
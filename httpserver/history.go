@@ -0,0 +1,27 @@
+package httpserver
+
+import (
+	"net/http"
+	"slices"
+)
+
+// historySize is the number of transition outcomes kept in memory.
+const historySize = 100
+
+// History is the response of the history endpoint.
+type History struct {
+	Entries []TransitionOutcome `json:"entries"`
+}
+
+// handleHistory returns the most recent transition outcomes, oldest first.
+// Failed transitions which were rolled back have the result `reverted`.
+func (h *FirewallHandler) handleHistory(w http.ResponseWriter, r *http.Request) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	entries := slices.Clone(h.history)
+	if entries == nil {
+		entries = []TransitionOutcome{}
+	}
+	writeJSON(w, http.StatusOK, History{Entries: entries})
+}
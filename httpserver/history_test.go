@@ -0,0 +1,75 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func getHistory(t *testing.T, h *FirewallHandler) History {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	h.handleHistory(rr, httptest.NewRequest(http.MethodGet, "/firewall/history", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var history History
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &history))
+	return history
+}
+
+func TestRevertHistory(t *testing.T) {
+	h := newTestHandler(t, FirewallConfig{}, nil)
+	require.Empty(t, getHistory(t, h).Entries)
+
+	h.mode = Production
+	testRunner(h).Fail("/etc/nftables-maintenance.conf", errFake)
+	h.lock.Lock()
+	require.NoError(t, h.transitionToMaintenance("alice"))
+	h.lock.Unlock()
+	require.Equal(t, Production, h.mode)
+
+	require.InDelta(t, 1, testutil.ToFloat64(h.metrics.reverts.WithLabelValues("maintenance")), 0)
+	require.InDelta(t, 0, testutil.ToFloat64(h.metrics.reverts.WithLabelValues("production")), 0)
+
+	entries := getHistory(t, h).Entries
+	require.Len(t, entries, 1)
+	require.Equal(t, "maintenance", entries[0].To)
+	require.Equal(t, resultReverted, entries[0].Result)
+	require.Equal(t, "production", entries[0].Mode)
+	require.Equal(t, "alice", entries[0].RequestedBy)
+}
+
+func TestProductionApplyRevertedKeepsMaintenance(t *testing.T) {
+	h := newTestHandler(t, FirewallConfig{}, nil)
+	testRunner(h).Fail("/etc/nftables-production.conf", errFake)
+
+	rr := httptest.NewRecorder()
+	h.handleProduction(rr, httptest.NewRequest(http.MethodPost, "/firewall/production", nil))
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+	require.Equal(t, Maintenance, h.mode)
+	require.Equal(t, []string{
+		"/usr/sbin/nft -f /etc/nftables-production.conf",
+		"/usr/sbin/nft -f /etc/nftables-maintenance.conf",
+	}, testRunner(h).Calls())
+	require.InDelta(t, 1, testutil.ToFloat64(h.metrics.reverts.WithLabelValues("production")), 0)
+
+	entries := getHistory(t, h).Entries
+	require.Len(t, entries, 1)
+	require.Equal(t, "production", entries[0].To)
+	require.Equal(t, resultReverted, entries[0].Result)
+	require.Equal(t, "maintenance", entries[0].Mode)
+}
+
+func TestHistorySize(t *testing.T) {
+	h := newTestHandler(t, FirewallConfig{}, nil)
+	h.lock.Lock()
+	for range historySize + 5 {
+		h.recordTransition(Maintenance, resultCompleted)
+	}
+	h.lock.Unlock()
+	require.Len(t, getHistory(t, h).Entries, historySize)
+}
@@ -0,0 +1,54 @@
+package httpserver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const DefaultHookTimeout = 30 * time.Second
+
+var ErrPreApplyHookFailed = errors.New("pre-apply hook failed")
+
+// runPreApplyHook runs the pre-apply hook of the mode, if any. Its failure is
+// returned if AbortOnPreHookFailure is set, and only logged otherwise.
+func (h *FirewallHandler) runPreApplyHook(fm FirewallMode) error {
+	err := h.runHook("pre-apply", h.config.PreApplyHooks[fm], fm)
+	if err == nil || !h.config.AbortOnPreHookFailure {
+		return nil
+	}
+	return fmt.Errorf("%w: %w", ErrPreApplyHookFailed, err)
+}
+
+// runPostApplyHook runs the post-apply hook of the mode, if any. The rules
+// are applied already, so a failure is only logged.
+func (h *FirewallHandler) runPostApplyHook(fm FirewallMode) {
+	_ = h.runHook("post-apply", h.config.PostApplyHooks[fm], fm)
+}
+
+// runHook runs the command, if not empty, for up to HookTimeout.
+func (h *FirewallHandler) runHook(kind string, cmd []string, fm FirewallMode) error {
+	if len(cmd) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), h.config.HookTimeout)
+	defer cancel()
+	output, err := h.runner.Run(ctx, cmd[0], cmd[1:]...)
+	if err != nil {
+		h.log.Error(kind+" hook failed", "mode", fm, "output", output, "error", err)
+		return fmt.Errorf("%s of %s: %w: %s", cmd[0], fm, err, bytes.TrimSpace(output))
+	}
+	h.log.Info(kind+" hook completed", "mode", fm)
+	return nil
+}
+
+// hooksByName keys the hooks by mode name, for the effective config.
+func hooksByName(hooks map[FirewallMode][]string) map[string][]string {
+	res := make(map[string][]string, len(hooks))
+	for fm, cmd := range hooks {
+		res[fm.String()] = cmd
+	}
+	return res
+}
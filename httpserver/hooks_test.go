@@ -0,0 +1,72 @@
+package httpserver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyHooks(t *testing.T) {
+	hooksConfig := func(abort bool) FirewallConfig {
+		return FirewallConfig{
+			PreApplyHooks: map[FirewallMode][]string{
+				Production:  {"/usr/local/bin/pre-hook", "production"},
+				Maintenance: {"/usr/local/bin/pre-hook", "maintenance"},
+			},
+			PostApplyHooks: map[FirewallMode][]string{
+				Production: {"/usr/local/bin/post-hook", "production"},
+			},
+			AbortOnPreHookFailure: abort,
+		}
+	}
+	toProduction := func(h *FirewallHandler) error {
+		h.lock.Lock()
+		defer h.lock.Unlock()
+		return h.transitionToProduction("test")
+	}
+
+	t.Run("hooks of the applied mode", func(t *testing.T) {
+		h := newTestHandler(t, hooksConfig(true), nil)
+		require.NoError(t, toProduction(h))
+		require.Equal(t, []string{
+			"/usr/local/bin/pre-hook production",
+			"/usr/sbin/nft -f /etc/nftables-production.conf",
+			"/usr/local/bin/post-hook production",
+		}, testRunner(h).Calls())
+	})
+
+	t.Run("failing pre-apply hook aborts", func(t *testing.T) {
+		h := newTestHandler(t, hooksConfig(true), nil)
+		testRunner(h).Fail("production", errFake)
+		err := toProduction(h)
+		require.ErrorIs(t, err, ErrPreApplyHookFailed)
+		require.Equal(t, HookFailed, failureReason(err))
+		require.Equal(t, "maintenance", getStatusJSON(t, h).Mode)
+		require.NotContains(t, testRunner(h).Calls(), "/usr/sbin/nft -f /etc/nftables-production.conf")
+	})
+
+	t.Run("failing pre-apply hook is ignored without abort", func(t *testing.T) {
+		h := newTestHandler(t, hooksConfig(false), nil)
+		testRunner(h).Fail("production", errFake)
+		require.NoError(t, toProduction(h))
+		require.Equal(t, "production", getStatusJSON(t, h).Mode)
+	})
+
+	t.Run("failing pre-apply hook doesn't abort reverts", func(t *testing.T) {
+		h := newTestHandler(t, hooksConfig(true), nil)
+		h.mode = Production
+		testRunner(h).Fail("/etc/nftables-transition.conf", errFake)
+		testRunner(h).Fail("production", errFake)
+		h.lock.Lock()
+		err := h.transitionToMaintenance("test")
+		h.lock.Unlock()
+		require.ErrorIs(t, err, ErrTransitionFailed)
+		require.Equal(t, "production", getStatusJSON(t, h).Mode)
+		require.Equal(t, []string{
+			"/usr/sbin/nft --echo --handle -f /etc/nftables-transition.conf",
+			"/usr/local/bin/pre-hook production",
+			"/usr/sbin/nft -f /etc/nftables-production.conf",
+			"/usr/local/bin/post-hook production",
+		}, testRunner(h).Calls())
+	})
+}
@@ -0,0 +1,101 @@
+package httpserver
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// IdempotencyKeyHeader identifies retries of a transition request. While
+	// the key is remembered, a retry gets the result of the first request
+	// instead of starting another transition.
+	IdempotencyKeyHeader = "Idempotency-Key"
+
+	// IdempotentReplayedHeader is set to true on responses replayed for a
+	// remembered idempotency key.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+// idempotencyCache remembers the results of transitions by idempotency key
+// and target mode, until they expire.
+type idempotencyCache struct {
+	mu      sync.Mutex
+	results map[string]idempotentResult
+}
+
+type idempotentResult struct {
+	err     error
+	expires time.Time
+}
+
+// get returns the unexpired result stored for key.
+func (c *idempotencyCache) get(key string, now time.Time) (idempotentResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	res, ok := c.results[key]
+	if !ok || !now.Before(res.expires) {
+		return idempotentResult{}, false
+	}
+	return res, true
+}
+
+// put stores the result for key until expires, and returns the number of
+// stored keys.
+func (c *idempotencyCache) put(key string, err error, expires time.Time) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.results == nil {
+		c.results = make(map[string]idempotentResult)
+	}
+	c.results[key] = idempotentResult{err: err, expires: expires}
+	return len(c.results)
+}
+
+// sweep drops the expired results, and returns the number of stored keys.
+func (c *idempotencyCache) sweep(now time.Time) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, res := range c.results {
+		if !now.Before(res.expires) {
+			delete(c.results, key)
+		}
+	}
+	return len(c.results)
+}
+
+// idempotencyKey returns the cache key of a transition request to the given
+// mode, or false if idempotency keys are disabled or the request has none.
+func (h *FirewallHandler) idempotencyKey(r *http.Request, to FirewallMode) (string, bool) {
+	key := r.Header.Get(IdempotencyKeyHeader)
+	if h.config.IdempotencyKeyTTL <= 0 || key == "" {
+		return "", false
+	}
+	return to.String() + " " + key, true
+}
+
+// rememberTransition stores the result of a transition which was started.
+// Rejections aren't stored, so that a retry is checked again.
+func (h *FirewallHandler) rememberTransition(key string, err error) {
+	if _, rejected := rejectionCode(err); rejected {
+		return
+	}
+	n := h.idempotency.put(key, err, h.now().Add(h.config.IdempotencyKeyTTL))
+	h.metrics.idempotencyKeys.Set(float64(n))
+}
+
+// sweepIdempotencyKeys periodically drops expired idempotency keys, so that
+// keys which are never retried don't accumulate.
+func (h *FirewallHandler) sweepIdempotencyKeys(ctx context.Context) {
+	ticker := time.NewTicker(h.config.IdempotencyKeyTTL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.metrics.idempotencyKeys.Set(float64(h.idempotency.sweep(h.now())))
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdempotencyKey(t *testing.T) {
+	const production = "/usr/sbin/nft -f /etc/nftables-production.conf"
+	toProduction := func(h *FirewallHandler, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/firewall/production", nil)
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		rr := httptest.NewRecorder()
+		h.handleProduction(rr, req)
+		return rr
+	}
+
+	t.Run("replayed within the TTL", func(t *testing.T) {
+		clock := newFakeClock()
+		h := newTestHandler(t, FirewallConfig{IdempotencyKeyTTL: time.Minute}, clock)
+
+		rr := toProduction(h, "k1")
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Empty(t, rr.Header().Get(IdempotentReplayedHeader))
+
+		clock.Advance(30 * time.Second)
+		rr = toProduction(h, "k1")
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "true", rr.Header().Get(IdempotentReplayedHeader))
+		require.Equal(t, []string{production}, testRunner(h).Calls())
+
+		// A retry without the key, or with another one, is a new request
+		require.Equal(t, http.StatusConflict, toProduction(h, "").Code)
+		require.Equal(t, http.StatusConflict, toProduction(h, "k2").Code)
+		require.InDelta(t, 1, testutil.ToFloat64(h.metrics.idempotencyKeys), 0)
+	})
+
+	t.Run("failures are replayed", func(t *testing.T) {
+		h := newTestHandler(t, FirewallConfig{IdempotencyKeyTTL: time.Minute}, nil)
+		h.mode = Production
+		testRunner(h).Fail("/etc/nftables-transition.conf", errFake)
+		toMaintenance := func() *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, "/firewall/maintenance", nil)
+			req.Header.Set(IdempotencyKeyHeader, "k1")
+			rr := httptest.NewRecorder()
+			h.handleMaintenance(rr, req)
+			return rr
+		}
+
+		require.Equal(t, http.StatusInternalServerError, toMaintenance().Code)
+		calls := len(testRunner(h).Calls())
+		rr := toMaintenance()
+		require.Equal(t, http.StatusInternalServerError, rr.Code)
+		require.Equal(t, "true", rr.Header().Get(IdempotentReplayedHeader))
+		require.Len(t, testRunner(h).Calls(), calls)
+	})
+
+	t.Run("expired and swept after the TTL", func(t *testing.T) {
+		clock := newFakeClock()
+		h := newTestHandler(t, FirewallConfig{IdempotencyKeyTTL: time.Minute}, clock)
+
+		require.Equal(t, http.StatusOK, toProduction(h, "k1").Code)
+		clock.Advance(time.Minute)
+		rr := toProduction(h, "k1")
+		require.Equal(t, http.StatusConflict, rr.Code)
+		require.Empty(t, rr.Header().Get(IdempotentReplayedHeader))
+
+		require.Zero(t, h.idempotency.sweep(clock.Now()))
+	})
+
+	t.Run("background sweeper", func(t *testing.T) {
+		h := newTestHandler(t, FirewallConfig{IdempotencyKeyTTL: 20 * time.Millisecond}, nil)
+		t.Cleanup(h.Close)
+		require.Equal(t, http.StatusOK, toProduction(h, "k1").Code)
+		require.InDelta(t, 1, testutil.ToFloat64(h.metrics.idempotencyKeys), 0)
+
+		h.tasks.Go(h.sweepIdempotencyKeys)
+		require.Eventually(t, func() bool {
+			return testutil.ToFloat64(h.metrics.idempotencyKeys) == 0
+		}, time.Second, 5*time.Millisecond)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		h := newTestHandler(t, FirewallConfig{}, nil)
+		require.Equal(t, http.StatusOK, toProduction(h, "k1").Code)
+		require.Equal(t, http.StatusConflict, toProduction(h, "k1").Code)
+	})
+}
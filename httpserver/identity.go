@@ -0,0 +1,125 @@
+package httpserver
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"sync"
+)
+
+type requestedByKey struct{}
+
+// requestedBy returns who made the request: the identity set by a trusted
+// reverse proxy, or else the client address.
+func requestedBy(ctx context.Context) string {
+	if who, ok := ctx.Value(requestedByKey{}).(string); ok {
+		return who
+	}
+	return "unknown"
+}
+
+func parseCIDRs(cidrs []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", cidr, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func remoteAddr(r *http.Request) (netip.Addr, error) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	return addr.Unmap(), err
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// identify stores who made the request in the request context. The identity
+// header is only honored if the request comes from a trusted proxy.
+func (srv *Server) identify(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		who := r.RemoteAddr
+		if srv.cfg.IdentityHeader != "" {
+			if user := r.Header.Get(srv.cfg.IdentityHeader); user != "" {
+				addr, err := remoteAddr(r)
+				if err == nil && containsAddr(srv.trustedProxies, addr) {
+					who = user
+				} else {
+					srv.ignoreIdentity(r, addr)
+				}
+			}
+		}
+		ctx := context.WithValue(withInitiator(r), requestedByKey{}, who)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// maxUntrustedIdentitySources bounds the source addresses remembered to warn
+// about an untrusted identity header only once.
+const maxUntrustedIdentitySources = 1024
+
+// untrustedIdentitySources are the source addresses already warned about.
+type untrustedIdentitySources struct {
+	mu    sync.Mutex
+	addrs map[netip.Addr]bool
+}
+
+// first reports whether the address wasn't warned about yet, and remembers
+// it. Once full, no address is reported.
+func (s *untrustedIdentitySources) first(addr netip.Addr) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.addrs[addr] || len(s.addrs) >= maxUntrustedIdentitySources {
+		return false
+	}
+	if s.addrs == nil {
+		s.addrs = make(map[netip.Addr]bool)
+	}
+	s.addrs[addr] = true
+	return true
+}
+
+// ignoreIdentity counts an identity header from an untrusted address. It's
+// logged as a warning the first time per source address, and at debug level
+// after, so a misconfigured client can't flood the logs.
+func (srv *Server) ignoreIdentity(r *http.Request, addr netip.Addr) {
+	srv.handler.metrics.ignoredIdentities.Inc()
+	level := slog.LevelDebug
+	if srv.untrustedIdentities.first(addr) {
+		level = slog.LevelWarn
+	}
+	srv.log.Log(r.Context(), level, "ignoring identity header from untrusted address", "header", srv.cfg.IdentityHeader, "remote_addr", r.RemoteAddr)
+}
+
+// allowSources rejects requests from client addresses outside the prefixes
+// with 403. The group (read or control) is named in the error.
+func (srv *Server) allowSources(prefixes []netip.Prefix, group string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			addr, err := remoteAddr(r)
+			if err != nil || !containsAddr(prefixes, addr) {
+				srv.log.Warn("rejecting request from address not allowed", "group", group, "remote_addr", r.RemoteAddr, "path", r.URL.Path)
+				http.Error(w, fmt.Sprintf("forbidden: %s not allowed to access %s endpoints", r.RemoteAddr, group), http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package httpserver
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdentityFromTrustedProxy(t *testing.T) {
+	cfg := newTestServerConfig()
+	cfg.IdentityHeader = "X-Forwarded-User"
+	cfg.TrustedProxies = []string{"10.0.0.0/8"}
+	srv := newTestServer(t, cfg)
+
+	echo := srv.identify(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(requestedBy(r.Context())))
+	}))
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		user       string
+		want       string
+	}{
+		{"trusted proxy", "10.1.2.3:4567", "alice", "alice"},
+		{"untrusted proxy", "192.168.1.1:4567", "alice", "192.168.1.1:4567"},
+		{"trusted proxy without header", "10.1.2.3:4567", "", "10.1.2.3:4567"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/firewall/status", nil)
+		req.RemoteAddr = tt.remoteAddr
+		if tt.user != "" {
+			req.Header.Set("X-Forwarded-User", tt.user)
+		}
+		rr := httptest.NewRecorder()
+		echo.ServeHTTP(rr, req)
+		require.Equal(t, tt.want, rr.Body.String(), tt.name)
+	}
+}
+
+func TestUntrustedIdentityWarnedOnce(t *testing.T) {
+	var logs bytes.Buffer
+	cfg := newTestServerConfig()
+	cfg.Log = slog.New(slog.NewTextHandler(&logs, nil))
+	cfg.IdentityHeader = "X-Forwarded-User"
+	cfg.TrustedProxies = []string{"10.0.0.0/8"}
+	srv := newTestServer(t, cfg)
+	handler := srv.identify(http.NotFoundHandler())
+
+	for _, remoteAddr := range []string{"192.168.1.1:1000", "192.168.1.1:1001", "192.168.1.1:1002", "192.168.1.2:1000"} {
+		req := httptest.NewRequest(http.MethodGet, "/firewall/status", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-User", "mallory")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	require.Equal(t, 2, strings.Count(logs.String(), "ignoring identity header"))
+	require.InDelta(t, 4, testutil.ToFloat64(srv.handler.metrics.ignoredIdentities), 0)
+}
+
+func TestInvalidTrustedProxies(t *testing.T) {
+	cfg := newTestServerConfig()
+	cfg.TrustedProxies = []string{"not-a-cidr"}
+	_, err := New(cfg)
+	require.ErrorContains(t, err, "invalid trusted proxies")
+}
+
+func TestSourceAllowlists(t *testing.T) {
+	cfg := newTestServerConfig()
+	cfg.ReadAllowedCIDRs = []string{"10.0.0.0/8", "192.168.0.0/16"}
+	cfg.ControlAllowedCIDRs = []string{"192.168.0.0/16", "172.16.0.0/12"}
+	srv := newTestServer(t, cfg)
+	router := srv.getRouter()
+
+	serve := func(remoteAddr, path string) *httptest.ResponseRecorder {
+		method := http.MethodGet
+		if path == "/firewall/reapply" || path == "/firewall/production" {
+			method = http.MethodPost
+		}
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Monitoring may read, but not control
+	monitoring := "10.1.2.3:4567"
+	require.Equal(t, http.StatusOK, serve(monitoring, "/firewall/status").Code)
+	require.Equal(t, http.StatusOK, serve(monitoring, "/livez").Code)
+	rr := serve(monitoring, "/firewall/production")
+	require.Equal(t, http.StatusForbidden, rr.Code)
+	require.Contains(t, rr.Body.String(), "not allowed to access control endpoints")
+	require.Equal(t, "maintenance", getStatusJSON(t, srv.handler).Mode)
+
+	// Operators may do both
+	operator := "192.168.1.1:4567"
+	require.Equal(t, http.StatusOK, serve(operator, "/firewall/status").Code)
+	require.Equal(t, http.StatusOK, serve(operator, "/firewall/production").Code)
+
+	// Automation may control, but not read
+	automation := "172.16.0.1:4567"
+	require.Equal(t, http.StatusOK, serve(automation, "/firewall/reapply").Code)
+	rr = serve(automation, "/firewall/status")
+	require.Equal(t, http.StatusForbidden, rr.Code)
+	require.Contains(t, rr.Body.String(), "not allowed to access read endpoints")
+
+	// Everyone else is rejected
+	require.Equal(t, http.StatusForbidden, serve("8.8.8.8:4567", "/firewall/status").Code)
+	require.Equal(t, http.StatusForbidden, serve("8.8.8.8:4567", "/firewall/reapply").Code)
+}
+
+func TestControlOnlyAllowlist(t *testing.T) {
+	cfg := newTestServerConfig()
+	cfg.ControlAllowedCIDRs = []string{"192.168.0.0/16"}
+	srv := newTestServer(t, cfg)
+	router := srv.getRouter()
+
+	// Reads aren't restricted, the operator network may control but the
+	// monitoring network may not
+	for remoteAddr, wantControl := range map[string]int{
+		"10.1.2.3:4567":    http.StatusForbidden,
+		"192.168.1.1:4567": http.StatusOK,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/firewall/status", nil)
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code, remoteAddr)
+
+		req = httptest.NewRequest(http.MethodPost, "/firewall/reapply", nil)
+		req.RemoteAddr = remoteAddr
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		require.Equal(t, wantControl, rr.Code, remoteAddr)
+	}
+}
+
+func TestInvalidAllowlists(t *testing.T) {
+	cfg := newTestServerConfig()
+	cfg.ControlAllowedCIDRs = []string{"not-a-cidr"}
+	_, err := New(cfg)
+	require.ErrorContains(t, err, "invalid control allowlist")
+}
@@ -0,0 +1,68 @@
+package httpserver
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/flashbots/go-bob-firewall/client"
+)
+
+// Initiators of transitions, the values of the initiator label of
+// firewall_transitions_total. The set is fixed to bound the cardinality.
+const (
+	initiatorManual        = "manual"          // An API request, unless it declares otherwise
+	initiatorScheduled     = "scheduled"       // A declared scheduled request, or the lease expiry
+	initiatorCascade       = "cascade"         // The upstream controller of an ordered drain
+	initiatorSignal        = "signal"          // Shutdown on SIGTERM or SIGINT
+	initiatorDeadManSwitch = "dead_man_switch" // Missed heartbeats
+	initiatorSelfTest      = "self_test"       // A failed probation self-test or production probe
+)
+
+// requestInitiators may be declared by requests with client.InitiatorHeader.
+var requestInitiators = map[string]bool{
+	initiatorManual:    true,
+	initiatorScheduled: true,
+	initiatorCascade:   true,
+}
+
+// internalInitiators are the initiators of transitions started by the
+// controller itself, by requester.
+var internalInitiators = map[string]string{
+	"shutdown":         initiatorSignal,
+	"dead-man-switch":  initiatorDeadManSwitch,
+	"lease-expiry":     initiatorScheduled,
+	"probation":        initiatorSelfTest,
+	"production-probe": initiatorSelfTest,
+}
+
+type initiatorKey struct{}
+
+// withInitiator adds the initiator declared by the request to the context,
+// falling back to manual for missing or unknown values.
+func withInitiator(r *http.Request) context.Context {
+	initiator := r.Header.Get(client.InitiatorHeader)
+	if !requestInitiators[initiator] {
+		initiator = initiatorManual
+	}
+	return context.WithValue(r.Context(), initiatorKey{}, initiator)
+}
+
+// requestInitiator returns the initiator added by withInitiator, empty if
+// the context isn't of a request.
+func requestInitiator(ctx context.Context) string {
+	initiator, _ := ctx.Value(initiatorKey{}).(string)
+	return initiator
+}
+
+// initiator returns the initiator of a transition started by the requester:
+// the one declared by the request being handled, if any. Must be called with
+// the lock held.
+func (h *FirewallHandler) initiator(requestedBy string) string {
+	if h.requestInitiator != "" {
+		return h.requestInitiator
+	}
+	if initiator, ok := internalInitiators[requestedBy]; ok {
+		return initiator
+	}
+	return initiatorManual
+}
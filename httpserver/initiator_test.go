@@ -0,0 +1,48 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/flashbots/go-bob-firewall/client"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransitionInitiator(t *testing.T) {
+	// toProduction requests production, with the given initiator header if
+	// not empty, and returns the counted transitions by initiator
+	toProduction := func(t *testing.T, initiator string) map[string]float64 {
+		t.Helper()
+		srv := newTestServer(t, newTestServerConfig())
+		req := httptest.NewRequest(http.MethodPost, "/firewall/transition", strings.NewReader(`{"mode":"production"}`))
+		req.Header.Set("Content-Type", "application/json")
+		if initiator != "" {
+			req.Header.Set(client.InitiatorHeader, initiator)
+		}
+		rr := httptest.NewRecorder()
+		srv.getRouter().ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		counts := make(map[string]float64)
+		for _, initiator := range []string{initiatorManual, initiatorScheduled, initiatorCascade} {
+			counts[initiator] = testutil.ToFloat64(srv.handler.metrics.transitions.WithLabelValues("production", resultCompleted, initiator))
+		}
+		return counts
+	}
+
+	require.Equal(t, map[string]float64{"manual": 1, "scheduled": 0, "cascade": 0}, toProduction(t, ""))
+	require.Equal(t, map[string]float64{"manual": 0, "scheduled": 1, "cascade": 0}, toProduction(t, "scheduled"))
+	// Unknown initiators don't add label values
+	require.Equal(t, map[string]float64{"manual": 1, "scheduled": 0, "cascade": 0}, toProduction(t, "my-cron-job"))
+
+	t.Run("internal", func(t *testing.T) {
+		h := newTestHandler(t, FirewallConfig{}, nil)
+		h.lock.Lock()
+		defer h.lock.Unlock()
+		require.NoError(t, h.transitionToProduction("lease-expiry"))
+		require.InDelta(t, 1, testutil.ToFloat64(h.metrics.transitions.WithLabelValues("production", resultCompleted, initiatorScheduled)), 0)
+	})
+}
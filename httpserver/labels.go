@@ -0,0 +1,31 @@
+package httpserver
+
+import (
+	"maps"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// MetricLabelKeys are the keys of FirewallConfig.Labels which are added to
+// all metrics. Other labels are only surfaced in the status, history and
+// transition outcomes, to keep the metrics cardinality bounded.
+var MetricLabelKeys = []string{"datacenter", "region", "rack", "role"}
+
+// metricLabels returns the labels from MetricLabelKeys.
+func metricLabels(labels map[string]string) prometheus.Labels {
+	constLabels := make(prometheus.Labels)
+	for _, key := range MetricLabelKeys {
+		if value, ok := labels[key]; ok {
+			constLabels[key] = value
+		}
+	}
+	return constLabels
+}
+
+// labels returns a copy of the configured labels, nil if there are none.
+func (h *FirewallHandler) labels() map[string]string {
+	if len(h.config.Labels) == 0 {
+		return nil
+	}
+	return maps.Clone(h.config.Labels)
+}
@@ -0,0 +1,39 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLabels(t *testing.T) {
+	labels := map[string]string{"datacenter": "fra1", "rack": "a1", "owner": "infra"}
+	h := newTestHandler(t, FirewallConfig{Labels: labels}, nil)
+	sink := &fakeSyslog{}
+	h.syslog = sink
+	h.mode = Production
+
+	require.Equal(t, labels, getStatusJSON(t, h).Labels)
+
+	h.lock.Lock()
+	require.NoError(t, h.transitionToMaintenance("alice"))
+	h.lock.Unlock()
+
+	require.Equal(t, labels, h.history[0].Labels)
+	require.Len(t, sink.messages, 1)
+	var outcome TransitionOutcome
+	require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(sink.messages[0], "info: ")), &outcome))
+	require.Equal(t, labels, outcome.Labels)
+
+	// Only allowlisted labels are added to metrics
+	expected := `
+# HELP firewall_transition_reverts_total Failed transitions which were rolled back, by target mode of the failed transition
+# TYPE firewall_transition_reverts_total counter
+firewall_transition_reverts_total{datacenter="fra1",rack="a1",to="maintenance"} 0
+`
+	h.metrics.reverts.WithLabelValues("maintenance")
+	require.NoError(t, testutil.GatherAndCompare(h.metrics.registry, strings.NewReader(expected), "firewall_transition_reverts_total"))
+}
@@ -0,0 +1,86 @@
+package httpserver
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// leaseCheckInterval is how often an expired maintenance lease is looked for.
+const leaseCheckInterval = time.Second
+
+// Lease is the JSON representation of the maintenance lease.
+type Lease struct {
+	ExpiresAt        time.Time `json:"expires_at"`
+	RemainingSeconds float64   `json:"remaining_seconds"`
+}
+
+// startLease starts or renews the maintenance lease, if leases are enabled.
+// Must be called with the lock held.
+func (h *FirewallHandler) startLease() {
+	if h.config.MaintenanceLeaseTTL <= 0 {
+		return
+	}
+	h.leaseExpiry = h.now().Add(h.config.MaintenanceLeaseTTL)
+	if !h.leaseWatched {
+		h.leaseWatched = true
+		h.tasks.Go(h.watchLease)
+	}
+}
+
+// lease returns the current maintenance lease, if any. Must be called with
+// the lock held.
+func (h *FirewallHandler) lease() *Lease {
+	if h.leaseExpiry.IsZero() {
+		return nil
+	}
+	return &Lease{
+		ExpiresAt:        h.leaseExpiry,
+		RemainingSeconds: max(h.leaseExpiry.Sub(h.now()), 0).Seconds(),
+	}
+}
+
+// watchLease returns to production once the maintenance lease expired.
+func (h *FirewallHandler) watchLease(ctx context.Context) {
+	ticker := time.NewTicker(leaseCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.expireLease()
+		}
+	}
+}
+
+// expireLease forces production if the maintenance lease expired, so the
+// dwell time, cooldowns and drift guard can't keep the node in maintenance.
+// Failed transitions are retried on the next check.
+func (h *FirewallHandler) expireLease() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.mode != Maintenance || h.leaseExpiry.IsZero() || h.now().Before(h.leaseExpiry) {
+		return
+	}
+	h.log.Warn("maintenance lease expired, returning to production", "expired_at", h.leaseExpiry)
+	if err := h.forceProduction("lease-expiry"); err != nil {
+		h.log.Error("could not return to production after the maintenance lease expired", "error", err)
+	}
+}
+
+// handleRenewLease extends the maintenance lease by MaintenanceLeaseTTL from
+// now.
+func (h *FirewallHandler) handleRenewLease(w http.ResponseWriter, r *http.Request) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.mode != Maintenance || h.leaseExpiry.IsZero() {
+		http.Error(w, "no maintenance lease to renew", http.StatusConflict)
+		return
+	}
+	h.startLease()
+	h.log.Info("maintenance lease renewed", "expires_at", h.leaseExpiry, "requested_by", requestedBy(r.Context()))
+	writeJSON(w, http.StatusOK, h.lease())
+}
@@ -0,0 +1,86 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaintenanceLease(t *testing.T) {
+	clock := newFakeClock()
+	h := newTestHandler(t, FirewallConfig{MaintenanceLeaseTTL: time.Hour}, clock)
+	t.Cleanup(h.Close)
+	h.mode = Production
+
+	renew := func() int {
+		rr := httptest.NewRecorder()
+		h.handleRenewLease(rr, httptest.NewRequest(http.MethodPost, "/firewall/maintenance/renew", nil))
+		return rr.Code
+	}
+	require.Equal(t, http.StatusConflict, renew())
+	require.Nil(t, getStatusJSON(t, h).Lease)
+
+	h.lock.Lock()
+	require.NoError(t, h.transitionToMaintenance("test"))
+	h.lock.Unlock()
+	lease := getStatusJSON(t, h).Lease
+	require.NotNil(t, lease)
+	require.Equal(t, clock.Now().Add(time.Hour), lease.ExpiresAt)
+	require.InDelta(t, time.Hour.Seconds(), lease.RemainingSeconds, 0)
+
+	// Renewal extends the lease from now
+	clock.Advance(50 * time.Minute)
+	h.expireLease()
+	require.Equal(t, Maintenance, h.mode)
+	require.Equal(t, http.StatusOK, renew())
+	require.Equal(t, clock.Now().Add(time.Hour), getStatusJSON(t, h).Lease.ExpiresAt)
+
+	clock.Advance(59 * time.Minute)
+	h.expireLease()
+	require.Equal(t, Maintenance, h.mode)
+
+	// Expiry returns to production
+	clock.Advance(time.Minute)
+	h.expireLease()
+	require.Equal(t, Production, h.mode)
+	require.Nil(t, getStatusJSON(t, h).Lease)
+	require.Equal(t, http.StatusConflict, renew())
+	require.Equal(t, "lease-expiry", h.history[len(h.history)-1].RequestedBy)
+}
+
+func TestMaintenanceLeaseDisabled(t *testing.T) {
+	h := newTestHandler(t, FirewallConfig{}, nil)
+	h.mode = Production
+	h.lock.Lock()
+	require.NoError(t, h.transitionToMaintenance("test"))
+	h.lock.Unlock()
+	require.Equal(t, Maintenance, h.mode)
+	require.Nil(t, getStatusJSON(t, h).Lease)
+	require.False(t, h.leaseWatched)
+}
+
+func TestMaintenanceLeaseCooldown(t *testing.T) {
+	clock := newFakeClock()
+	h := newTestHandler(t, FirewallConfig{
+		MaintenanceLeaseTTL: time.Minute,
+		TransitionCooldowns: map[ModePair]time.Duration{{From: Maintenance, To: Production}: time.Hour},
+	}, clock)
+	t.Cleanup(h.Close)
+	h.mode = Production
+
+	h.lock.Lock()
+	require.NoError(t, h.transitionToMaintenance("test"))
+	h.lock.Unlock()
+
+	// The cooldown rejects requests, but not the expiry of the lease
+	rr := httptest.NewRecorder()
+	h.handleProduction(rr, httptest.NewRequest(http.MethodPost, "/firewall/production", nil))
+	require.Equal(t, http.StatusTooManyRequests, rr.Code)
+	clock.Advance(time.Minute)
+	h.expireLease()
+	require.Equal(t, Production, h.mode)
+	require.Equal(t, "lease-expiry", h.history[len(h.history)-1].RequestedBy)
+}
@@ -0,0 +1,36 @@
+package httpserver
+
+import "fmt"
+
+// ApplyLimiter bounds the applies running at once across all the handlers
+// sharing it, e.g. one handler per firewall zone in a single process, so a
+// large reconfiguration doesn't overwhelm netlink.
+type ApplyLimiter struct {
+	slots chan struct{}
+}
+
+// NewApplyLimiter returns a limiter allowing up to n concurrent applies.
+func NewApplyLimiter(n int) (*ApplyLimiter, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("invalid apply concurrency %d, must be positive", n)
+	}
+	return &ApplyLimiter{slots: make(chan struct{}, n)}, nil
+}
+
+// acquire waits for a free slot and returns the function to release it. A
+// nil limiter is unlimited.
+func (l *ApplyLimiter) acquire() func() {
+	if l == nil {
+		return func() {}
+	}
+	l.slots <- struct{}{}
+	return func() { <-l.slots }
+}
+
+// concurrency returns the maximum of concurrent applies, 0 if unlimited.
+func (l *ApplyLimiter) concurrency() int {
+	if l == nil {
+		return 0
+	}
+	return cap(l.slots)
+}
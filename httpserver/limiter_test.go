@@ -0,0 +1,64 @@
+package httpserver
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// concurrencyRunner records the maximum number of commands running at once.
+type concurrencyRunner struct {
+	running, peak *atomic.Int32
+}
+
+func (r concurrencyRunner) Run(context.Context, string, ...string) ([]byte, error) {
+	n := r.running.Add(1)
+	defer r.running.Add(-1)
+	for {
+		peak := r.peak.Load()
+		if n <= peak || r.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	return nil, nil
+}
+
+func TestApplyLimiter(t *testing.T) {
+	_, err := NewApplyLimiter(0)
+	require.Error(t, err)
+
+	run := func(t *testing.T, limiter *ApplyLimiter) int32 {
+		t.Helper()
+		var running, peak atomic.Int32
+		var wg sync.WaitGroup
+		// One handler per zone, sharing the limiter
+		for range 3 {
+			h := newTestHandler(t, FirewallConfig{ApplyLimiter: limiter}, nil)
+			h.runner = concurrencyRunner{running: &running, peak: &peak}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				h.lock.Lock()
+				defer h.lock.Unlock()
+				require.NoError(t, h.applyNFTables(Production))
+			}()
+		}
+		wg.Wait()
+		return peak.Load()
+	}
+
+	t.Run("limited", func(t *testing.T) {
+		limiter, err := NewApplyLimiter(1)
+		require.NoError(t, err)
+		require.EqualValues(t, 1, run(t, limiter))
+	})
+
+	t.Run("unlimited", func(t *testing.T) {
+		require.Greater(t, run(t, nil), int32(1))
+	})
+}
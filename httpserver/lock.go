@@ -0,0 +1,95 @@
+package httpserver
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// lockWaitBuckets range from 100µs to ~26s, lock waits are mostly short but
+// applies holding the lock can take long.
+var lockWaitBuckets = prometheus.ExponentialBuckets(0.0001, 4, 10)
+
+// timedMutex is a sync.Mutex recording how long Lock waited, e.g. for slow
+// applies blocking requests. It also tracks whether it's held, for
+// assertions.
+type timedMutex struct {
+	sync.Mutex
+	held atomic.Bool
+	wait prometheus.Observer // Optional
+}
+
+func (m *timedMutex) Lock() {
+	if m.TryLock() {
+		m.observe(0)
+		return
+	}
+	start := time.Now()
+	m.Mutex.Lock()
+	m.held.Store(true)
+	m.observe(time.Since(start))
+}
+
+// lockTimeout acquires the mutex, unless it's held by someone else for
+// longer than the timeout. Returns whether it was acquired. The wait is
+// handed off to a goroutine blocking in Lock, which releases the mutex right
+// away if the caller gave up in the meantime.
+func (m *timedMutex) lockTimeout(timeout time.Duration) bool {
+	if m.TryLock() {
+		m.observe(0)
+		return true
+	}
+	start := time.Now()
+	acquired := make(chan struct{})
+	abandoned := make(chan struct{})
+	go func() {
+		m.Mutex.Lock()
+		select {
+		case acquired <- struct{}{}:
+		case <-abandoned:
+			m.Mutex.Unlock()
+		}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-acquired:
+		m.held.Store(true)
+		m.observe(time.Since(start))
+		return true
+	case <-timer.C:
+		close(abandoned)
+		return false
+	}
+}
+
+func (m *timedMutex) TryLock() bool {
+	if !m.Mutex.TryLock() {
+		return false
+	}
+	m.held.Store(true)
+	return true
+}
+
+func (m *timedMutex) Unlock() {
+	m.held.Store(false)
+	m.Mutex.Unlock()
+}
+
+// assertHeld panics if the mutex isn't held, without acquiring it. It can't
+// tell which goroutine holds it, so it only catches callers forgetting the
+// lock altogether.
+func (m *timedMutex) assertHeld(caller string) {
+	if !m.held.Load() {
+		panic(caller + " but lock is not held!")
+	}
+}
+
+func (m *timedMutex) observe(d time.Duration) {
+	if m.wait != nil {
+		m.wait.Observe(d.Seconds())
+	}
+}
@@ -0,0 +1,90 @@
+package httpserver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockWaitMetric(t *testing.T) {
+	h := newTestHandler(t, FirewallConfig{}, nil)
+
+	// sample returns the number of recorded waits and their sum
+	sample := func() (uint64, float64) {
+		families, err := h.metrics.registry.Gather()
+		require.NoError(t, err)
+		for _, f := range families {
+			if f.GetName() == "firewall_lock_wait_seconds" {
+				hist := f.GetMetric()[0].GetHistogram()
+				return hist.GetSampleCount(), hist.GetSampleSum()
+			}
+		}
+		t.Fatal("firewall_lock_wait_seconds not found")
+		return 0, 0
+	}
+
+	h.lock.Lock()
+	h.lock.Unlock()
+	count, sum := sample()
+	require.Equal(t, uint64(1), count)
+	require.Zero(t, sum)
+
+	h.lock.Lock()
+	acquired := make(chan struct{})
+	go func() {
+		h.lock.Lock()
+		h.lock.Unlock()
+		close(acquired)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	h.lock.Unlock()
+	<-acquired
+
+	count, sum = sample()
+	require.Equal(t, uint64(3), count)
+	require.GreaterOrEqual(t, sum, 0.01)
+}
+
+func TestApplyRequiresLock(t *testing.T) {
+	h := newTestHandler(t, FirewallConfig{}, nil)
+
+	require.PanicsWithValue(t, "applyNFTables but lock is not held!", func() {
+		_ = h.applyNFTables(Production)
+	})
+	require.Empty(t, testRunner(h).Calls())
+	// The assertion must not take the lock
+	require.True(t, h.lock.TryLock())
+	h.lock.Unlock()
+
+	h.lock.Lock()
+	require.NotPanics(t, func() {
+		require.NoError(t, h.applyNFTables(Production))
+	})
+	h.lock.Unlock()
+}
+
+func TestLockTimeout(t *testing.T) {
+	var m timedMutex
+
+	m.Lock()
+	require.False(t, m.lockTimeout(10*time.Millisecond))
+	m.Unlock()
+	// The abandoned wait releases the mutex again
+	require.Eventually(t, func() bool {
+		if !m.TryLock() {
+			return false
+		}
+		m.Unlock()
+		return true
+	}, time.Second, time.Millisecond)
+
+	m.Lock()
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		m.Unlock()
+	}()
+	require.True(t, m.lockTimeout(time.Second))
+	m.assertHeld("test")
+	m.Unlock()
+}
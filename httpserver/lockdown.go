@@ -0,0 +1,74 @@
+package httpserver
+
+import (
+	"cmp"
+	"net/http"
+)
+
+// handleLockdown immediately applies the lockdown rules, which deny all but
+// management traffic, for security incident response. It bypasses the
+// normal transition flow, i.e. there is no drain and guards like the minimum
+// dwell time are not checked. Only /firewall/reset leaves lockdown.
+func (h *FirewallHandler) handleLockdown(w http.ResponseWriter, r *http.Request) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	requestedBy := requestedBy(r.Context())
+	if h.mode == Lockdown {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	transitioning := h.mode == TransitionToMaintenance
+	if transitioning && !h.stopTransitionTimer() {
+		http.Error(w, "maintenance transition is completing, retry", http.StatusConflict)
+		return
+	}
+
+	h.log.Error("LOCKDOWN requested, denying all non-management traffic", "mode", h.mode, "requested_by", requestedBy)
+	h.transitionRequestedBy = requestedBy
+	h.transitionInitiator = cmp.Or(requestInitiator(r.Context()), initiatorManual)
+	if err := h.applyNFTables(Lockdown); err != nil {
+		// nft applies atomically, the previous rules are still in place
+		h.log.Error("could not apply the lockdown rules", "error", err)
+		h.recordTransition(Lockdown, resultReverted)
+		if transitioning {
+			// The drain was interrupted, complete it right away
+			h.finishTransition()
+		}
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error(), Reason: failureReason(err)})
+		return
+	}
+	if transitioning {
+		close(h.transitionDone)
+	}
+	h.setMode(Lockdown)
+	h.recordTransition(Lockdown, resultCompleted)
+	h.log.Error("LOCKDOWN active", "requested_by", requestedBy)
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleReset leaves lockdown for maintenance, from where production can be
+// requested as usual.
+func (h *FirewallHandler) handleReset(w http.ResponseWriter, r *http.Request) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.mode != Lockdown {
+		http.Error(w, "not in lockdown", http.StatusConflict)
+		return
+	}
+
+	requestedBy := requestedBy(r.Context())
+	h.log.Warn("leaving lockdown for maintenance", "requested_by", requestedBy)
+	h.transitionRequestedBy = requestedBy
+	h.transitionInitiator = cmp.Or(requestInitiator(r.Context()), initiatorManual)
+	if err := h.applyNFTables(Maintenance); err != nil {
+		h.log.Error("could not leave lockdown, still locked down", "error", err)
+		h.recordTransition(Maintenance, resultReverted)
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error(), Reason: failureReason(err)})
+		return
+	}
+	h.setMode(Maintenance)
+	h.recordTransition(Maintenance, resultCompleted)
+	w.WriteHeader(http.StatusOK)
+}
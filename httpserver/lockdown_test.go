@@ -0,0 +1,66 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockdown(t *testing.T) {
+	post := func(handler http.HandlerFunc, path string) int {
+		rr := httptest.NewRecorder()
+		handler(rr, httptest.NewRequest(http.MethodPost, path, nil))
+		return rr.Code
+	}
+
+	t.Run("enter and reset", func(t *testing.T) {
+		h := newTestHandler(t, FirewallConfig{}, nil)
+		h.mode = Production
+		require.Equal(t, http.StatusConflict, post(h.handleReset, "/firewall/reset"))
+
+		require.Equal(t, http.StatusOK, post(h.handleLockdown, "/firewall/lockdown"))
+		require.Equal(t, "lockdown", getStatusJSON(t, h).Mode)
+		require.Contains(t, testRunner(h).Calls(), "/usr/sbin/nft -f /etc/nftables-lockdown.conf")
+		last := h.history[len(h.history)-1]
+		require.Equal(t, "lockdown", last.To)
+		require.Equal(t, resultCompleted, last.Result)
+
+		// Idempotent, and only a reset leaves lockdown
+		require.Equal(t, http.StatusOK, post(h.handleLockdown, "/firewall/lockdown"))
+		h.lock.Lock()
+		require.ErrorIs(t, h.transitionToProduction("test"), ErrInvalidTransition)
+		require.ErrorIs(t, h.transitionToMaintenance("test"), ErrInvalidTransition)
+		h.lock.Unlock()
+
+		require.Equal(t, http.StatusOK, post(h.handleReset, "/firewall/reset"))
+		require.Equal(t, Maintenance, h.mode)
+		h.lock.Lock()
+		require.NoError(t, h.transitionToProduction("test"))
+		h.lock.Unlock()
+	})
+
+	t.Run("during the maintenance transition", func(t *testing.T) {
+		h := newTestHandler(t, FirewallConfig{TransitionDuration: time.Hour}, nil)
+		t.Cleanup(h.Close)
+		h.mode = Production
+		h.lock.Lock()
+		require.NoError(t, h.transitionToMaintenance("test"))
+		done := h.transitionDone
+		h.lock.Unlock()
+
+		require.Equal(t, http.StatusOK, post(h.handleLockdown, "/firewall/lockdown"))
+		require.Equal(t, Lockdown, h.mode)
+		<-done
+	})
+
+	t.Run("failed apply", func(t *testing.T) {
+		h := newTestHandler(t, FirewallConfig{}, nil)
+		h.mode = Production
+		testRunner(h).Fail("/etc/nftables-lockdown.conf", errFake)
+		require.Equal(t, http.StatusInternalServerError, post(h.handleLockdown, "/firewall/lockdown"))
+		require.Equal(t, Production, h.mode)
+	})
+}
@@ -0,0 +1,106 @@
+package httpserver
+
+import (
+	"github.com/flashbots/go-bob-firewall/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// firewallMetrics are registered with a private registry, which backs the
+// stats, and with the metrics server if configured.
+type firewallMetrics struct {
+	registry *prometheus.Registry
+
+	mode              *prometheus.GaugeVec
+	lastApplyDuration *prometheus.GaugeVec
+	applyDuration     *prometheus.HistogramVec
+	generation        prometheus.Gauge
+	transitions       *prometheus.CounterVec
+	reverts           *prometheus.CounterVec
+	applyErrors       *prometheus.CounterVec
+	cascadeErrors     prometheus.Counter
+	lockWait          prometheus.Histogram
+	rejections        *prometheus.CounterVec
+	probeFailures     prometheus.Counter
+	ignoredIdentities prometheus.Counter
+	idempotencyKeys   prometheus.Gauge
+}
+
+// newFirewallMetrics creates the metrics, with the given labels added to all
+// of them.
+func newFirewallMetrics(constLabels prometheus.Labels) *firewallMetrics {
+	m := &firewallMetrics{
+		registry: prometheus.NewRegistry(),
+
+		mode: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "firewall_mode",
+			Help: "1 for the current mode, 0 for the others",
+		}, []string{"mode"}),
+		lastApplyDuration: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "firewall_last_apply_duration_seconds",
+			Help: "Duration of the most recent nftables apply, by applied mode",
+		}, []string{"mode"}),
+		applyDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "firewall_apply_duration_seconds",
+			Help:    "Duration of nftables applies, by applied mode",
+			Buckets: metrics.BucketsRequestDuration,
+		}, []string{"mode"}),
+		generation: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "firewall_apply_generation",
+			Help: "Number of successful nftables applies, persisted across restarts",
+		}),
+		transitions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "firewall_transitions_total",
+			Help: "Finished transitions, by target mode, result (completed, reverted, failed or aborted) and initiator (manual, scheduled, cascade, signal, dead_man_switch or self_test)",
+		}, []string{"to", "result", "initiator"}),
+		reverts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "firewall_transition_reverts_total",
+			Help: "Failed transitions which were rolled back, by target mode of the failed transition",
+		}, []string{"to"}),
+		applyErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "firewall_apply_errors_total",
+			Help: "Failed nftables applies, by applied mode and reason (config_parse, nft_lock, binary_missing, timeout, permission_denied or other)",
+		}, []string{"mode", "reason"}),
+		cascadeErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "firewall_cascade_errors_total",
+			Help: "Failed attempts to start the maintenance transition of the downstream controller",
+		}),
+		lockWait: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "firewall_lock_wait_seconds",
+			Help:    "Time spent waiting to acquire the handler lock, rising if slow applies block requests",
+			Buckets: lockWaitBuckets,
+		}),
+		rejections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "firewall_rejections_total",
+			Help: "Rejected transition and mutating requests, by rejection code",
+		}, []string{"code"}),
+		probeFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "firewall_production_probe_failures_total",
+			Help: "Failed runs of the probe after transitions to production",
+		}),
+		ignoredIdentities: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "firewall_untrusted_identity_headers_total",
+			Help: "Requests with an identity header from an address which isn't a trusted proxy, the header is ignored",
+		}),
+		idempotencyKeys: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "firewall_idempotency_keys",
+			Help: "Idempotency keys whose transition results are remembered, including expired keys not swept yet",
+		}),
+	}
+	prometheus.WrapRegistererWith(constLabels, m.registry).MustRegister(m.collectors()...)
+	return m
+}
+
+func (m *firewallMetrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{m.mode, m.lastApplyDuration, m.applyDuration, m.generation, m.transitions, m.reverts, m.applyErrors, m.cascadeErrors, m.lockWait, m.rejections, m.probeFailures, m.ignoredIdentities, m.idempotencyKeys}
+}
+
+// setMode sets the mode gauge of the given mode, and resets the others.
+func (m *firewallMetrics) setMode(current FirewallMode) {
+	for _, fm := range []FirewallMode{Initializing, Maintenance, TransitionToMaintenance, Production, Lockdown} {
+		value := 0.0
+		if fm == current {
+			value = 1
+		}
+		m.mode.WithLabelValues(fm.String()).Set(value)
+	}
+}
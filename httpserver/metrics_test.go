@@ -0,0 +1,64 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stretchr/testify/require"
+)
+
+// scrapeMetrics returns the metrics of the gatherer in the text format.
+func scrapeMetrics(t *testing.T, g prometheus.Gatherer) string {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	promhttp.HandlerFor(g, promhttp.HandlerOpts{}).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	return rr.Body.String()
+}
+
+func TestMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	cfg := newTestServerConfig()
+	cfg.Firewall.MetricsRegisterer = registry
+	srv := newTestServer(t, cfg)
+	t.Cleanup(srv.handler.Close)
+	router := srv.getRouter()
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(method, path, nil))
+		return rr
+	}
+
+	// Only served by the metrics server
+	require.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/metrics").Code)
+
+	body := scrapeMetrics(t, registry)
+	require.Contains(t, body, `firewall_mode{mode="maintenance"} 1`)
+	require.Contains(t, body, `firewall_mode{mode="production"} 0`)
+
+	require.Equal(t, http.StatusOK, serve(http.MethodPost, "/firewall/production").Code)
+	testRunner(srv.handler).Fail("/etc/nftables-maintenance.conf", errFake)
+	serve(http.MethodPost, "/firewall/maintenance")
+	require.Equal(t, "production", getStatusJSON(t, srv.handler).Mode)
+
+	body = scrapeMetrics(t, registry)
+	for _, sample := range []string{
+		`firewall_mode{mode="maintenance"} 0`,
+		`firewall_mode{mode="production"} 1`,
+		`firewall_mode{mode="transition_to_maintenance"} 0`,
+		`firewall_transitions_total{initiator="manual",result="completed",to="production"} 1`,
+		`firewall_transitions_total{initiator="manual",result="reverted",to="maintenance"} 1`,
+		`firewall_transition_reverts_total{to="maintenance"} 1`,
+		`firewall_apply_errors_total{mode="maintenance",reason="other"} 1`,
+		`firewall_apply_duration_seconds_count{mode="production"} 2`,
+	} {
+		require.Contains(t, body, sample)
+	}
+
+	// A second handler on the same registry is rejected
+	_, err := NewFirewallHandler(cfg.Log, FirewallConfig{ImmediateTransition: true, MetricsRegisterer: registry})
+	require.ErrorContains(t, err, "could not register metrics")
+}
@@ -0,0 +1,84 @@
+package httpserver
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// negotiateContentType picks the supported media type best matching the
+// Accept header. Supported types are in order of preference, the first one
+// is used if the client doesn't send an Accept header. Returns false if none
+// of the supported types is acceptable.
+func negotiateContentType(accept string, supported []string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return supported[0], true
+	}
+
+	type mediaRange struct {
+		mediaType string
+		q         float64
+	}
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mr := mediaRange{mediaType: strings.ToLower(strings.TrimSpace(params[0])), q: 1.0}
+		for _, param := range params[1:] {
+			k, v, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(k, "q") {
+				if q, err := strconv.ParseFloat(v, 64); err == nil {
+					mr.q = q
+				}
+			}
+		}
+		ranges = append(ranges, mr)
+	}
+
+	// Each supported type gets the quality of the most specific range matching
+	// it, so that e.g. `text/plain;q=0, */*` excludes text/plain.
+	best, bestQ := "", 0.0
+	for _, s := range supported {
+		q, specificity := 0.0, -1
+		for _, mr := range ranges {
+			if spec := mediaTypeSpecificity(mr.mediaType, s); spec > specificity {
+				q, specificity = mr.q, spec
+			}
+		}
+		if q > bestQ {
+			best, bestQ = s, q
+		}
+	}
+	return best, best != ""
+}
+
+// mediaTypeSpecificity returns how specifically the media range matches the
+// media type (2 for an exact match, 1 for type/*, 0 for */*), or -1 if it
+// doesn't match.
+func mediaTypeSpecificity(mediaRange, mediaType string) int {
+	switch {
+	case mediaRange == mediaType:
+		return 2
+	case mediaRange == "*/*":
+		return 0
+	}
+	if prefix, ok := strings.CutSuffix(mediaRange, "/*"); ok && strings.HasPrefix(mediaType, prefix+"/") {
+		return 1
+	}
+	return -1
+}
+
+// negotiate returns the content type to respond with. If no supported type
+// is acceptable, it either falls back to the first supported type, or in
+// strict mode responds with 406 Not Acceptable and returns false.
+func (h *FirewallHandler) negotiate(w http.ResponseWriter, r *http.Request, supported []string) (string, bool) {
+	contentType, ok := negotiateContentType(r.Header.Get("Accept"), supported)
+	if ok {
+		return contentType, true
+	}
+	if !h.config.StrictContentNegotiation {
+		return supported[0], true
+	}
+
+	http.Error(w, "not acceptable, supported types: "+strings.Join(supported, ", "), http.StatusNotAcceptable)
+	return "", false
+}
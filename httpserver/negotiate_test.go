@@ -0,0 +1,58 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiateContentType(t *testing.T) {
+	supported := []string{"text/plain", "application/json"}
+	tests := []struct {
+		accept string
+		want   string
+		ok     bool
+	}{
+		{"", "text/plain", true},
+		{"*/*", "text/plain", true},
+		{"application/json", "application/json", true},
+		{"text/*", "text/plain", true},
+		{"text/html, application/json;q=0.9", "application/json", true},
+		{"text/plain;q=0.5, application/json", "application/json", true},
+		{"text/plain;q=0, */*;q=0.1", "application/json", true},
+		{"text/html", "", false},
+		{"application/xml, image/*", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := negotiateContentType(tt.accept, supported)
+		require.Equal(t, tt.ok, ok, tt.accept)
+		require.Equal(t, tt.want, got, tt.accept)
+	}
+}
+
+func TestStatusContentNegotiation(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		h := newTestHandler(t, FirewallConfig{StrictContentNegotiation: strict}, nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/firewall/status", nil)
+		req.Header.Set("Accept", "application/xml")
+		rr := httptest.NewRecorder()
+		h.handleStatus(rr, req)
+
+		if strict {
+			require.Equal(t, http.StatusNotAcceptable, rr.Code)
+			require.Contains(t, rr.Body.String(), "text/plain")
+		} else {
+			require.Equal(t, http.StatusOK, rr.Code)
+			require.Equal(t, "maintenance", rr.Body.String())
+		}
+
+		req.Header.Set("Accept", "text/plain")
+		rr = httptest.NewRecorder()
+		h.handleStatus(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "maintenance", rr.Body.String())
+	}
+}
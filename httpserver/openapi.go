@@ -0,0 +1,175 @@
+package httpserver
+
+import (
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flashbots/go-bob-firewall/common"
+)
+
+// openAPISpec generates an OpenAPI 3 document from the route table.
+func openAPISpec(routes []route, rejectWhileNotReady bool) map[string]any {
+	paths := make(map[string]map[string]any)
+	for _, rt := range routes {
+		responses := rt.Responses
+		switch {
+		case rejectWhileNotReady && !rt.ServeWhenNotReady:
+			responses = append(responses[:len(responses):len(responses)], response{
+				Status: http.StatusServiceUnavailable, Description: "Not ready or shutting down, see Retry-After", ContentType: "text/plain",
+			})
+		case rt.Mutating && !rt.ServeWhenNotReady:
+			responses = append(responses[:len(responses):len(responses)], response{
+				Status: http.StatusServiceUnavailable, Description: "Shutting down, or the startup apply did not complete yet, see Retry-After", ContentType: "application/json", Body: ErrorResponse{},
+			})
+		case rt.Mutating:
+			responses = append(responses[:len(responses):len(responses)], response{
+				Status: http.StatusServiceUnavailable, Description: "Shutting down", ContentType: "application/json", Body: ErrorResponse{},
+			})
+		}
+		if rt.Mutating || rt.Sensitive {
+			responses = append(responses[:len(responses):len(responses)],
+				response{Status: http.StatusUnauthorized, Description: "Missing or unknown bearer token (if auth tokens are configured)", ContentType: "text/plain"},
+				response{Status: http.StatusForbidden, Description: "Source address or token scope not allowed (if configured)", ContentType: "text/plain"},
+			)
+		}
+		op := map[string]any{
+			"summary":   rt.Summary,
+			"responses": openAPIResponses(responses),
+		}
+		var params []map[string]any
+		for _, segment := range strings.Split(rt.Path, "/") {
+			if name, ok := strings.CutPrefix(segment, "{"); ok {
+				params = append(params, map[string]any{
+					"name":     strings.TrimSuffix(name, "}"),
+					"in":       "path",
+					"required": true,
+					"schema":   map[string]any{"type": "string"},
+				})
+			}
+		}
+		for _, q := range rt.Query {
+			params = append(params, map[string]any{
+				"name":        q.Name,
+				"in":          "query",
+				"description": q.Description,
+				"required":    q.Required,
+				"schema":      map[string]any{"type": "string"},
+			})
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+		if rt.RequestBody != nil {
+			contentTypes := rt.RequestContentTypes
+			if len(contentTypes) == 0 {
+				contentTypes = []string{"application/json"}
+			}
+			content := make(map[string]any, len(contentTypes))
+			for _, ct := range contentTypes {
+				content[ct] = map[string]any{"schema": jsonSchema(reflect.TypeOf(rt.RequestBody))}
+			}
+			op["requestBody"] = map[string]any{
+				"required": true,
+				"content":  content,
+			}
+		}
+
+		if paths[rt.Path] == nil {
+			paths[rt.Path] = make(map[string]any)
+		}
+		paths[rt.Path][strings.ToLower(rt.Method)] = op
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "go-bob-firewall",
+			"version": common.Version,
+		},
+		"paths": paths,
+	}
+}
+
+// openAPIResponses groups the responses by status code. Responses sharing a
+// status code are merged into one entry with multiple content types, and
+// their distinct descriptions joined.
+func openAPIResponses(responses []response) map[string]any {
+	res := make(map[string]any, len(responses))
+	for _, r := range responses {
+		code := strconv.Itoa(r.Status)
+		resp, ok := res[code].(map[string]any)
+		if !ok {
+			resp = map[string]any{"description": r.Description}
+			res[code] = resp
+		} else if description := resp["description"].(string); !slices.Contains(strings.Split(description, "; "), r.Description) {
+			resp["description"] = description + "; " + r.Description
+		}
+		if r.ContentType == "" {
+			continue
+		}
+
+		schema := map[string]any{"type": "string"}
+		if r.Body != nil {
+			schema = jsonSchema(reflect.TypeOf(r.Body))
+		}
+		content, ok := resp["content"].(map[string]any)
+		if !ok {
+			content = make(map[string]any)
+			resp["content"] = content
+		}
+		content[r.ContentType] = map[string]any{"schema": schema}
+	}
+	return res
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// jsonSchema derives a JSON schema from a Go type, following its json tags.
+func jsonSchema(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": jsonSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": jsonSchema(t.Elem())}
+	case reflect.Struct:
+		props := make(map[string]any)
+		for i := range t.NumField() {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if !f.IsExported() || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			props[name] = jsonSchema(f.Type)
+		}
+		return map[string]any{"type": "object", "properties": props}
+	default:
+		return map[string]any{}
+	}
+}
+
+func (srv *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, openAPISpec(srv.enabledRoutes(), srv.cfg.RejectWhileNotReady))
+}
@@ -0,0 +1,51 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// TransitionOutcome is a single line of the outcome log and entry of the
+// transition history.
+type TransitionOutcome struct {
+	Time        time.Time         `json:"time"`
+	To          string            `json:"to"`
+	Result      string            `json:"result"`
+	Mode        string            `json:"mode"`
+	RequestedBy string            `json:"requested_by"`
+	Generation  uint64            `json:"generation"`
+	Completion  string            `json:"completion,omitempty"` // Of maintenance transitions with early completion enabled, drained or timed_out
+	Labels      map[string]string `json:"labels,omitempty"`
+}
+
+// outcomeLog appends one JSON line per transition outcome to a file. The file
+// is opened for every line, so it can be rotated by external tooling at any
+// time, e.g. by logrotate.
+type outcomeLog struct {
+	path string
+	mu   sync.Mutex
+}
+
+func (l *outcomeLog) write(outcome TransitionOutcome) error {
+	line, err := json.Marshal(outcome)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	// A single write with O_APPEND, so lines are never interleaved
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
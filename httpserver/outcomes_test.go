@@ -0,0 +1,54 @@
+package httpserver
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func readOutcomes(t *testing.T, path string) []TransitionOutcome {
+	t.Helper()
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var outcomes []TransitionOutcome
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var outcome TransitionOutcome
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &outcome))
+		outcomes = append(outcomes, outcome)
+	}
+	require.NoError(t, scanner.Err())
+	return outcomes
+}
+
+func TestOutcomeLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outcomes.log")
+	clock := newFakeClock()
+	h := newTestHandler(t, FirewallConfig{OutcomeLogFile: path}, clock)
+	h.mode = Production
+
+	h.lock.Lock()
+	require.NoError(t, h.transitionToMaintenance("alice"))
+	require.NoError(t, h.transitionToProduction("bob"))
+	testRunner(h).Fail("/etc/nftables-transition.conf", errFake)
+	require.ErrorIs(t, h.transitionToMaintenance("carol"), ErrTransitionFailed)
+	h.lock.Unlock()
+
+	outcomes := readOutcomes(t, path)
+	require.Len(t, outcomes, 3)
+	require.Equal(t, TransitionOutcome{
+		Time: clock.Now().UTC(), To: "maintenance", Result: resultCompleted, Mode: "maintenance", RequestedBy: "alice", Generation: 2,
+	}, outcomes[0])
+	require.Equal(t, TransitionOutcome{
+		Time: clock.Now().UTC(), To: "production", Result: resultCompleted, Mode: "production", RequestedBy: "bob", Generation: 3,
+	}, outcomes[1])
+	require.Equal(t, TransitionOutcome{
+		Time: clock.Now().UTC(), To: "maintenance", Result: resultReverted, Mode: "production", RequestedBy: "carol", Generation: 4,
+	}, outcomes[2])
+}
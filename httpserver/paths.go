@@ -0,0 +1,38 @@
+package httpserver
+
+import (
+	"net/http"
+	"strings"
+)
+
+// redirectTrailingSlash redirects paths with a trailing slash to the path
+// without it. Unlike chi's RedirectSlashes, it responds with 308, so clients
+// repeat POST requests instead of switching to GET. The pprof index under
+// /debug/ needs its trailing slash.
+func redirectTrailingSlash(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path
+		if len(path) > 1 && strings.HasSuffix(path, "/") && !strings.HasPrefix(path, "/debug/") {
+			target := strings.TrimRight(path, "/")
+			if target == "" {
+				target = "/"
+			}
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusPermanentRedirect)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// caseInsensitivePaths lowercases the path before routing. All routes are
+// lowercase.
+func caseInsensitivePaths(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.URL.Path = strings.ToLower(r.URL.Path)
+		r.URL.RawPath = ""
+		next.ServeHTTP(w, r)
+	})
+}
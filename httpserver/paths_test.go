@@ -0,0 +1,59 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPathNormalization(t *testing.T) {
+	serve := func(cfg *HTTPServerConfig, method, path string) *httptest.ResponseRecorder {
+		srv := newTestServer(t, cfg)
+		rr := httptest.NewRecorder()
+		srv.getRouter().ServeHTTP(rr, httptest.NewRequest(method, path, nil))
+		return rr
+	}
+
+	t.Run("strict", func(t *testing.T) {
+		cfg := newTestServerConfig()
+		require.Equal(t, http.StatusNotFound, serve(cfg, http.MethodGet, "/firewall/status/").Code)
+		require.Equal(t, http.StatusNotFound, serve(cfg, http.MethodGet, "/Firewall/Status").Code)
+	})
+
+	t.Run("trailing slash", func(t *testing.T) {
+		cfg := newTestServerConfig()
+		cfg.RedirectTrailingSlash = true
+		rr := serve(cfg, http.MethodPost, "/firewall/transition/?wait=true")
+		require.Equal(t, http.StatusPermanentRedirect, rr.Code)
+		require.Equal(t, "/firewall/transition?wait=true", rr.Header().Get("Location"))
+		require.Equal(t, http.StatusOK, serve(cfg, http.MethodGet, "/firewall/status").Code)
+		require.Equal(t, http.StatusNotFound, serve(cfg, http.MethodGet, "/Firewall/Status").Code)
+	})
+
+	t.Run("case insensitive", func(t *testing.T) {
+		cfg := newTestServerConfig()
+		cfg.CaseInsensitivePaths = true
+		rr := serve(cfg, http.MethodGet, "/Firewall/Status")
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "maintenance", rr.Body.String())
+		require.Equal(t, http.StatusNotFound, serve(cfg, http.MethodGet, "/firewall/status/").Code)
+	})
+
+	t.Run("both", func(t *testing.T) {
+		cfg := newTestServerConfig()
+		cfg.CaseInsensitivePaths = true
+		cfg.RedirectTrailingSlash = true
+		rr := serve(cfg, http.MethodGet, "/FIREWALL/STATUS/")
+		require.Equal(t, http.StatusPermanentRedirect, rr.Code)
+		require.Equal(t, "/firewall/status", rr.Header().Get("Location"))
+	})
+
+	t.Run("pprof index", func(t *testing.T) {
+		cfg := newTestServerConfig()
+		cfg.RedirectTrailingSlash = true
+		cfg.EnablePprof = true
+		require.Equal(t, http.StatusOK, serve(cfg, http.MethodGet, "/debug/pprof/").Code)
+	})
+}
@@ -0,0 +1,75 @@
+package httpserver
+
+import (
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Ids of the pending actions.
+const (
+	pendingCompleteTransition = "complete-transition"
+	pendingLeaseExpiry        = "lease-expiry"
+)
+
+// PendingAction is an action scheduled to happen without a further request.
+type PendingAction struct {
+	ID          string    `json:"id"`
+	Description string    `json:"description"`
+	At          time.Time `json:"at"`
+	Cancelable  bool      `json:"cancelable"`
+}
+
+// pendingActions returns the scheduled actions, soonest first. Must be
+// called with the lock held.
+func (h *FirewallHandler) pendingActions() []PendingAction {
+	actions := []PendingAction{}
+	if h.mode == TransitionToMaintenance && h.transitionToMaintenanceStart != nil {
+		actions = append(actions, PendingAction{
+			ID:          pendingCompleteTransition,
+			Description: "apply the maintenance rules, completing the transition",
+			At:          h.transitionToMaintenanceStart.Add(h.config.TransitionDuration),
+		})
+	}
+	if h.mode == Maintenance && !h.leaseExpiry.IsZero() {
+		actions = append(actions, PendingAction{
+			ID:          pendingLeaseExpiry,
+			Description: "return to production unless the maintenance lease is renewed",
+			At:          h.leaseExpiry,
+			Cancelable:  true,
+		})
+	}
+	slices.SortFunc(actions, func(a, b PendingAction) int { return a.At.Compare(b.At) })
+	return actions
+}
+
+func (h *FirewallHandler) handlePending(w http.ResponseWriter, r *http.Request) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	writeJSON(w, http.StatusOK, h.pendingActions())
+}
+
+// handleCancelPending cancels a pending action. Canceling the lease expiry
+// keeps maintenance until a transition to production is requested.
+func (h *FirewallHandler) handleCancelPending(w http.ResponseWriter, r *http.Request) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	id := chi.URLParam(r, "id")
+	idx := slices.IndexFunc(h.pendingActions(), func(a PendingAction) bool { return a.ID == id })
+	if idx < 0 {
+		http.Error(w, "no pending action "+id, http.StatusNotFound)
+		return
+	}
+	if id != pendingLeaseExpiry {
+		http.Error(w, "pending action "+id+" can't be canceled", http.StatusConflict)
+		return
+	}
+
+	h.leaseExpiry = time.Time{}
+	h.log.Info("pending action canceled", "id", id, "requested_by", requestedBy(r.Context()))
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,71 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func getPending(t *testing.T, h *FirewallHandler) []PendingAction {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	h.handlePending(rr, httptest.NewRequest(http.MethodGet, "/firewall/pending", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var actions []PendingAction
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &actions))
+	return actions
+}
+
+func cancelPending(h *FirewallHandler, id string) int {
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", id)
+	req := httptest.NewRequest(http.MethodDelete, "/firewall/pending/"+id, nil)
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	rr := httptest.NewRecorder()
+	h.handleCancelPending(rr, req)
+	return rr.Code
+}
+
+func TestPendingActions(t *testing.T) {
+	clock := newFakeClock()
+	h := newTestHandler(t, FirewallConfig{TransitionDuration: time.Hour, MaintenanceLeaseTTL: 2 * time.Hour}, clock)
+	t.Cleanup(h.Close)
+	h.mode = Production
+	require.Empty(t, getPending(t, h))
+
+	h.lock.Lock()
+	require.NoError(t, h.transitionToMaintenance("test"))
+	h.lock.Unlock()
+	require.Equal(t, []PendingAction{{
+		ID:          pendingCompleteTransition,
+		Description: "apply the maintenance rules, completing the transition",
+		At:          clock.Now().Add(time.Hour),
+	}}, getPending(t, h))
+	require.Equal(t, http.StatusConflict, cancelPending(h, pendingCompleteTransition))
+
+	h.lock.Lock()
+	require.True(t, h.stopTransitionTimer())
+	h.finishTransition()
+	h.lock.Unlock()
+	actions := getPending(t, h)
+	require.Len(t, actions, 1)
+	require.Equal(t, pendingLeaseExpiry, actions[0].ID)
+	require.Equal(t, clock.Now().Add(2*time.Hour), actions[0].At)
+	require.True(t, actions[0].Cancelable)
+
+	// Canceling the auto-revert keeps maintenance
+	require.Equal(t, http.StatusNoContent, cancelPending(h, pendingLeaseExpiry))
+	require.Empty(t, getPending(t, h))
+	require.Equal(t, http.StatusNotFound, cancelPending(h, pendingLeaseExpiry))
+
+	clock.Advance(3 * time.Hour)
+	h.expireLease()
+	require.Equal(t, Maintenance, h.mode)
+}
@@ -0,0 +1,97 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// errCorruptState is returned by loadState if the state file is empty or
+// can't be parsed, e.g. after a crash in the middle of a write by an older
+// version.
+var errCorruptState = errors.New("corrupt state file")
+
+// persistedState is written to FirewallConfig.StateFile whenever the state
+// changes, so it survives restarts.
+type persistedState struct {
+	Mode       string       `json:"mode"`
+	Generation uint64       `json:"generation"`
+	Crash      *crashRecord `json:"crash,omitempty"` // Set if the process crashed
+}
+
+func loadState(path string) (*persistedState, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var state persistedState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("%w %s: %w", errCorruptState, path, err)
+	}
+	return &state, nil
+}
+
+// persistState writes the current state to the state file, if configured.
+// Must be called with the lock held.
+func (h *FirewallHandler) persistState() {
+	if h.config.StateFile == "" {
+		return
+	}
+
+	data, err := json.Marshal(persistedState{
+		Mode:       h.mode.String(),
+		Generation: h.generation,
+		Crash:      h.crash,
+	})
+	if err == nil {
+		err = writeFileAtomic(h.config.StateFile, data, 0o600)
+	}
+	if err != nil {
+		h.log.Error("could not persist state", "path", h.config.StateFile, "error", err)
+	}
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it
+// into place, so readers see either the old or the new contents, even if the
+// process crashes in between.
+func writeFileAtomic(path string, data []byte, perm fs.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp) // No-op after a successful rename
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp, perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	// Persist the rename itself
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
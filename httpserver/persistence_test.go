@@ -0,0 +1,91 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerationCounter(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	h := newTestHandler(t, FirewallConfig{StateFile: stateFile}, nil)
+	require.Equal(t, uint64(0), getStatusJSON(t, h).Generation)
+
+	rr := httptest.NewRecorder()
+	h.handleProduction(rr, httptest.NewRequest(http.MethodGet, "/firewall/production", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Equal(t, uint64(1), getStatusJSON(t, h).Generation)
+
+	// Re-applying the same mode also counts
+	rr = httptest.NewRecorder()
+	h.handleReapply(rr, httptest.NewRequest(http.MethodPost, "/firewall/reapply", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Equal(t, uint64(2), getStatusJSON(t, h).Generation)
+
+	// Failed applies don't
+	testRunner(h).Fail("/etc/nftables-production.conf", errFake)
+	rr = httptest.NewRecorder()
+	h.handleReapply(rr, httptest.NewRequest(http.MethodPost, "/firewall/reapply", nil))
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+	require.Equal(t, uint64(2), getStatusJSON(t, h).Generation)
+
+	require.Contains(t, scrapeMetrics(t, h.metrics.registry), "firewall_apply_generation 2")
+
+	// The counter survives a restart
+	h = newTestHandler(t, FirewallConfig{StateFile: stateFile}, nil)
+	require.Equal(t, uint64(2), getStatusJSON(t, h).Generation)
+
+	rr = httptest.NewRecorder()
+	h.handleProduction(rr, httptest.NewRequest(http.MethodGet, "/firewall/production", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Equal(t, uint64(3), getStatusJSON(t, h).Generation)
+}
+
+func TestCorruptStateFile(t *testing.T) {
+	for name, content := range map[string]string{
+		"empty":     "",
+		"truncated": `{"mode":"production","genera`,
+		"garbage":   "\x00\x00\x00",
+	} {
+		t.Run(name, func(t *testing.T) {
+			stateFile := filepath.Join(t.TempDir(), "state.json")
+			require.NoError(t, os.WriteFile(stateFile, []byte(content), 0o600))
+
+			h := newTestHandler(t, FirewallConfig{StateFile: stateFile}, nil)
+			require.Equal(t, Maintenance, h.mode)
+			require.Equal(t, uint64(0), getStatusJSON(t, h).Generation)
+
+			// The next write replaces the corrupt file
+			h.lock.Lock()
+			h.setMode(Maintenance)
+			h.lock.Unlock()
+			state, err := loadState(stateFile)
+			require.NoError(t, err)
+			require.Equal(t, "maintenance", state.Mode)
+		})
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	require.NoError(t, writeFileAtomic(path, []byte("one"), 0o600))
+	require.NoError(t, writeFileAtomic(path, []byte("two"), 0o600))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "two", string(data))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	// No temporary files are left behind
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
@@ -0,0 +1,85 @@
+package httpserver
+
+import (
+	"net/http"
+	"slices"
+)
+
+// Policy is the response of the policy endpoint: every guard currently
+// affecting transitions of this node, so operators can tell why one would
+// be rejected before trying. Tokens are never included, only their scopes.
+type Policy struct {
+	Mode                        string             `json:"mode"`
+	Initializing                bool               `json:"initializing"` // The startup apply didn't complete yet
+	Degraded                    bool               `json:"degraded"`     // The startup apply failed for good
+	Ready                       bool               `json:"ready"`
+	ShuttingDown                bool               `json:"shutting_down"`
+	QuietPeriodRemainingSeconds float64            `json:"quiet_period_remaining_seconds"`
+	AuthRequired                bool               `json:"auth_required"`
+	AuthTokenScopes             [][]string         `json:"auth_token_scopes"` // Modes each token may trigger, empty for all
+	ReadAllowedCIDRs            []string           `json:"read_allowed_cidrs"`
+	ControlAllowedCIDRs         []string           `json:"control_allowed_cidrs"`
+	MinDwellSeconds             map[string]float64 `json:"min_dwell_seconds"`
+	TransitionCooldownSeconds   map[string]float64 `json:"transition_cooldown_seconds"`
+	RejectTransitionsOnDrift    bool               `json:"reject_transitions_on_drift"`
+	Holds                       []string           `json:"holds"` // Reserved, nothing holds transitions yet
+	Transitions                 []CanTransition    `json:"transitions"`
+	EnabledOperations           []RouteInfo        `json:"enabled_operations"` // Mutating routes, depending on the enabled features
+}
+
+func (srv *Server) handlePolicy(w http.ResponseWriter, r *http.Request) {
+	h := srv.handler
+	policy := Policy{
+		Ready:                     srv.ready(),
+		ShuttingDown:              srv.shuttingDown.Load(),
+		AuthRequired:              len(srv.authTokens) > 0,
+		AuthTokenScopes:           [][]string{},
+		ReadAllowedCIDRs:          nonNil(srv.cfg.ReadAllowedCIDRs),
+		ControlAllowedCIDRs:       nonNil(srv.cfg.ControlAllowedCIDRs),
+		MinDwellSeconds:           durationsToSeconds(h.config.MinDwell),
+		TransitionCooldownSeconds: cooldownsToSeconds(h.config.TransitionCooldowns),
+		RejectTransitionsOnDrift:  h.config.RejectTransitionsOnDrift,
+		Holds:                     []string{},
+		EnabledOperations:         []RouteInfo{},
+	}
+	for _, token := range srv.authTokens {
+		policy.AuthTokenScopes = append(policy.AuthTokenScopes, nonNil(token.modes))
+	}
+	// Sorted, as the tokens are configured as a map
+	slices.SortFunc(policy.AuthTokenScopes, slices.Compare)
+	for _, rt := range srv.enabledRoutes() {
+		if rt.Mutating {
+			policy.EnabledOperations = append(policy.EnabledOperations, RouteInfo{Method: rt.Method, Path: rt.Path})
+		}
+	}
+
+	h.lock.Lock()
+	policy.Mode = h.mode.String()
+	policy.Initializing = h.mode == Initializing && !h.degraded
+	policy.Degraded = h.degraded
+	if !h.quietUntil.IsZero() {
+		policy.QuietPeriodRemainingSeconds = max(h.quietUntil.Sub(h.now()), 0).Seconds()
+	}
+	for _, to := range []FirewallMode{Maintenance, Production} {
+		plan := h.planTransition(to)
+		policy.Transitions = append(policy.Transitions, CanTransition{
+			From:                  plan.From,
+			To:                    plan.To,
+			Allowed:               plan.Allowed,
+			Reason:                plan.Reason,
+			DwellRemainingSeconds: h.dwellRemaining(to).Seconds(),
+		})
+	}
+	h.lock.Unlock()
+
+	writeJSON(w, http.StatusOK, policy)
+}
+
+// nonNil returns s, or an empty slice if nil, so it's encoded as [] rather
+// than null.
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
@@ -0,0 +1,82 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicy(t *testing.T) {
+	get := func(t *testing.T, srv *Server) Policy {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		srv.getRouter().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/firewall/policy", nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.NotContains(t, rr.Body.String(), "secret-token")
+		var policy Policy
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &policy))
+		return policy
+	}
+
+	t.Run("defaults", func(t *testing.T) {
+		policy := get(t, newTestServer(t, newTestServerConfig()))
+		require.Equal(t, "maintenance", policy.Mode)
+		require.False(t, policy.AuthRequired)
+		require.Empty(t, policy.AuthTokenScopes)
+		require.Empty(t, policy.ControlAllowedCIDRs)
+		require.Empty(t, policy.Holds)
+		require.Equal(t, []CanTransition{
+			{From: "maintenance", To: "maintenance", Reason: "maintenance transition request not from production mode"},
+			{From: "maintenance", To: "production", Allowed: true},
+		}, policy.Transitions)
+		require.Contains(t, policy.EnabledOperations, RouteInfo{Method: http.MethodPost, Path: "/firewall/transition"})
+		require.NotContains(t, policy.EnabledOperations, RouteInfo{Method: http.MethodGet, Path: "/firewall/status"})
+	})
+
+	t.Run("configured", func(t *testing.T) {
+		clock := newFakeClock()
+		cfg := newTestServerConfig()
+		cfg.AuthTokens = map[string][]string{"secret-token": {"maintenance"}, "secret-token-2": nil}
+		cfg.ReadAllowedCIDRs = []string{"192.0.2.0/24"} // Of httptest requests
+		cfg.ControlAllowedCIDRs = []string{"10.1.0.0/16"}
+		cfg.Firewall.MinDwell = map[FirewallMode]time.Duration{Production: time.Minute}
+		cfg.Firewall.TransitionCooldowns = map[ModePair]time.Duration{{From: Production, To: Maintenance}: 5 * time.Minute}
+		cfg.Firewall.RejectTransitionsOnDrift = true
+		cfg.Firewall.QuietPeriod = time.Hour
+		srv := newTestServer(t, cfg)
+		srv.handler.now = clock.Now
+		srv.handler.mode, srv.handler.modeSince = Production, clock.Now()
+		srv.handler.startQuietPeriod()
+		clock.Advance(time.Minute)
+
+		policy := get(t, srv)
+		require.True(t, policy.AuthRequired)
+		require.Equal(t, [][]string{{}, {"maintenance"}}, policy.AuthTokenScopes)
+		require.Equal(t, []string{"192.0.2.0/24"}, policy.ReadAllowedCIDRs)
+		require.Equal(t, []string{"10.1.0.0/16"}, policy.ControlAllowedCIDRs)
+		require.Equal(t, map[string]float64{"production": 60}, policy.MinDwellSeconds)
+		require.Equal(t, map[string]float64{"production->maintenance": 300}, policy.TransitionCooldownSeconds)
+		require.True(t, policy.RejectTransitionsOnDrift)
+		require.InDelta(t, 3540, policy.QuietPeriodRemainingSeconds, 0)
+		require.False(t, policy.Transitions[0].Allowed)
+		require.Contains(t, policy.Transitions[0].Reason, "minimum dwell time not elapsed")
+		require.InDelta(t, 240, policy.Transitions[0].DwellRemainingSeconds, 0)
+	})
+
+	t.Run("initializing", func(t *testing.T) {
+		srv := newTestServer(t, newTestServerConfig())
+		srv.handler.mode = Initializing
+		policy := get(t, srv)
+		require.True(t, policy.Initializing)
+		require.False(t, policy.Ready)
+
+		srv.handler.degraded = true
+		policy = get(t, srv)
+		require.False(t, policy.Initializing)
+		require.True(t, policy.Degraded)
+	})
+}
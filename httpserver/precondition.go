@@ -0,0 +1,83 @@
+package httpserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrPreconditionFailed = errors.New("state does not match If-Match")
+	ErrModeMismatch       = errors.New("current mode does not match the expected mode")
+)
+
+type expectedModeKey struct{}
+
+// modeMismatchError is a transition rejected as the current mode isn't the
+// expected one.
+type modeMismatchError struct {
+	expected, current FirewallMode
+}
+
+func (e *modeMismatchError) Error() string {
+	return fmt.Sprintf("%s: expected %s, current mode is %s", ErrModeMismatch, e.expected, e.current)
+}
+
+func (e *modeMismatchError) Unwrap() error {
+	return ErrModeMismatch
+}
+
+// withExpectedMode stores the mode a transition request expects to be
+// current, see checkExpectedMode.
+func withExpectedMode(r *http.Request, fm FirewallMode) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), expectedModeKey{}, fm))
+}
+
+// expectedMode returns the mode the request expects to be current, or false
+// if it doesn't expect any.
+func expectedMode(ctx context.Context) (FirewallMode, bool) {
+	fm, ok := ctx.Value(expectedModeKey{}).(FirewallMode)
+	return fm, ok
+}
+
+// stateETag identifies the current state. It changes on every mode change
+// and every apply, as the generation is incremented. Must be called with the
+// lock held.
+func (h *FirewallHandler) stateETag() string {
+	sum := sha256.Sum256([]byte(h.mode.String() + "/" + strconv.FormatUint(h.generation, 10)))
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// checkIfMatch implements optimistic concurrency for transitions: if the
+// request has an If-Match header, one of its ETags must match the current
+// state. Must be called with the lock held.
+func (h *FirewallHandler) checkIfMatch(r *http.Request) error {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		return nil
+	}
+	current := h.stateETag()
+	for _, etag := range strings.Split(ifMatch, ",") {
+		etag = strings.TrimSpace(etag)
+		if etag == "*" || etag == current {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w, current ETag is %s", ErrPreconditionFailed, current)
+}
+
+// checkExpectedMode closes the race between reading the status and acting on
+// it: if the request expects a current mode, it must be the live one. Must be
+// called with the lock held.
+func (h *FirewallHandler) checkExpectedMode(r *http.Request) error {
+	expected, ok := expectedMode(r.Context())
+	if !ok || h.mode == expected {
+		return nil
+	}
+	return &modeMismatchError{expected: expected, current: h.mode}
+}
@@ -0,0 +1,61 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func getETag(t *testing.T, h *FirewallHandler) string {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	h.handleStatus(rr, httptest.NewRequest(http.MethodGet, "/firewall/status", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	etag := rr.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+	return etag
+}
+
+func TestIfMatch(t *testing.T) {
+	h := newTestHandler(t, FirewallConfig{}, nil)
+	etag := getETag(t, h)
+	require.Equal(t, etag, getETag(t, h))
+
+	production := func(ifMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/firewall/production", nil)
+		req.Header.Set("If-Match", ifMatch)
+		rr := httptest.NewRecorder()
+		h.handleProduction(rr, req)
+		return rr
+	}
+
+	// Mismatch
+	rr := production(`"0000000000000000"`)
+	require.Equal(t, http.StatusPreconditionFailed, rr.Code)
+	require.Equal(t, etag, rr.Header().Get("ETag"))
+	require.Equal(t, Maintenance, h.mode)
+	require.Empty(t, testRunner(h).Calls())
+
+	// Match, among others
+	rr = production(`"0000000000000000", ` + etag)
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Equal(t, Production, h.mode)
+
+	// The state changed, so the old ETag is stale
+	newETag := getETag(t, h)
+	require.NotEqual(t, etag, newETag)
+	req := httptest.NewRequest(http.MethodGet, "/firewall/maintenance", nil)
+	req.Header.Set("If-Match", etag)
+	rr = httptest.NewRecorder()
+	h.handleMaintenance(rr, req)
+	require.Equal(t, http.StatusPreconditionFailed, rr.Code)
+	require.Equal(t, Production, h.mode)
+
+	// Re-applying the same mode changes the ETag too
+	rr = httptest.NewRecorder()
+	h.handleReapply(rr, httptest.NewRequest(http.MethodPost, "/firewall/reapply", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.NotEqual(t, newETag, getETag(t, h))
+}
@@ -0,0 +1,55 @@
+package httpserver
+
+import (
+	"context"
+	"time"
+)
+
+const DefaultProbationCheckInterval = 5 * time.Second
+
+// probationEnabled reports whether production restored on startup is on
+// probation.
+func (h *FirewallHandler) probationEnabled() bool {
+	return h.config.ProbationWindow > 0 && len(h.config.ProbationSelfTest) > 0
+}
+
+// runProbation runs the self-test every ProbationCheckInterval until the
+// probation window ends. If it fails, maintenance is forced, regardless of
+// the dwell time and drift guards.
+func (h *FirewallHandler) runProbation(ctx context.Context) {
+	for {
+		h.lock.Lock()
+		until := h.probationUntil
+		mode := h.mode
+		h.lock.Unlock()
+		if until.IsZero() || mode != Production {
+			return
+		}
+
+		cmd := h.config.ProbationSelfTest
+		if output, err := h.runner.Run(ctx, cmd[0], cmd[1:]...); err != nil {
+			h.log.Error("self-test failed during probation, reverting to maintenance", "output", output, "error", err)
+			h.lock.Lock()
+			h.probationUntil = time.Time{}
+			if err := h.forceMaintenance("probation"); err != nil {
+				h.log.Error("could not revert to maintenance after the failed self-test", "error", err)
+			}
+			h.lock.Unlock()
+			return
+		}
+
+		if !h.now().Before(until) {
+			h.lock.Lock()
+			h.probationUntil = time.Time{}
+			h.lock.Unlock()
+			h.log.Info("probation passed")
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(h.config.ProbationCheckInterval):
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package httpserver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	DefaultProductionProbeTimeout  = 10 * time.Second
+	DefaultProductionProbeInterval = 2 * time.Second
+)
+
+// productionProbeEnabled reports whether a production probe is configured,
+// a command or a URL.
+func (h *FirewallHandler) productionProbeEnabled() bool {
+	return len(h.config.ProductionProbe) > 0 || h.config.ProductionProbeURL != ""
+}
+
+// startProductionProbe runs the production probe in the background, if
+// configured. Must be called with the lock held, right after production was
+// entered.
+func (h *FirewallHandler) startProductionProbe() {
+	if !h.productionProbeEnabled() {
+		return
+	}
+	generation := h.generation
+	h.tasks.Go(func(ctx context.Context) {
+		h.runProductionProbe(ctx, generation)
+	})
+}
+
+// runProductionProbe runs the probe once, or with ProductionProbeWindow,
+// every ProductionProbeInterval until it passes or the window elapsed. If it
+// doesn't pass, the failure is logged and counted, and with
+// RevertOnProbeFailure the firewall transitions to maintenance, unless the
+// rules were applied again in the meantime.
+func (h *FirewallHandler) runProductionProbe(ctx context.Context, generation uint64) {
+	deadline := time.Now().Add(h.config.ProductionProbeWindow)
+	var output []byte
+	var err error
+	for {
+		if output, err = h.probeProduction(ctx); err == nil {
+			h.log.Info("production probe passed")
+			return
+		}
+		if time.Now().Add(h.config.ProductionProbeInterval).After(deadline) {
+			break
+		}
+		h.log.Debug("production probe did not pass yet", "output", output, "error", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(h.config.ProductionProbeInterval):
+		}
+	}
+
+	h.metrics.probeFailures.Inc()
+	if !h.config.RevertOnProbeFailure {
+		h.log.Error("production probe failed", "output", output, "error", err)
+		return
+	}
+
+	h.log.Error("production probe failed, reverting to maintenance", "output", output, "error", err)
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.mode != Production || h.generation != generation {
+		h.log.Warn("not reverting after the failed production probe, the rules changed since", "mode", h.mode)
+		return
+	}
+	if err := h.forceMaintenance("production-probe"); err != nil {
+		h.log.Error("could not revert to maintenance after the failed production probe", "error", err)
+	}
+}
+
+// probeProduction runs the probe command, or requests the probe URL, which
+// must respond with a 2xx status, for up to ProductionProbeTimeout.
+func (h *FirewallHandler) probeProduction(ctx context.Context) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, h.config.ProductionProbeTimeout)
+	defer cancel()
+	if cmd := h.config.ProductionProbe; len(cmd) > 0 {
+		return h.runner.Run(ctx, cmd[0], cmd[1:]...)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.config.ProductionProbeURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return body, fmt.Errorf("unexpected status %d of %s", resp.StatusCode, h.config.ProductionProbeURL)
+	}
+	return body, nil
+}
@@ -0,0 +1,124 @@
+package httpserver
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProductionProbe(t *testing.T) {
+	probe := []string{"/usr/bin/curl", "-fsS", "http://127.0.0.1:8080/ready"}
+
+	t.Run("failure is counted", func(t *testing.T) {
+		h := newTestHandler(t, FirewallConfig{ProductionProbe: probe}, nil)
+		testRunner(h).Fail("http://127.0.0.1:8080/ready", errFake)
+
+		h.lock.Lock()
+		require.NoError(t, h.transitionToProduction("test"))
+		h.lock.Unlock()
+		h.tasks.Stop()
+
+		require.Contains(t, testRunner(h).Calls(), "/usr/bin/curl -fsS http://127.0.0.1:8080/ready")
+		require.InDelta(t, 1, testutil.ToFloat64(h.metrics.probeFailures), 0)
+		require.Equal(t, "production", getStatusJSON(t, h).Mode)
+	})
+
+	t.Run("failure reverts to maintenance", func(t *testing.T) {
+		h := newTestHandler(t, FirewallConfig{ProductionProbe: probe, RevertOnProbeFailure: true}, nil)
+		testRunner(h).Fail("http://127.0.0.1:8080/ready", errFake)
+
+		h.lock.Lock()
+		require.NoError(t, h.transitionToProduction("test"))
+		h.lock.Unlock()
+
+		require.Eventually(t, func() bool {
+			return getStatusJSON(t, h).Mode != "production"
+		}, time.Second, time.Millisecond)
+		h.lock.Lock()
+		defer h.lock.Unlock()
+		require.Equal(t, "production-probe", h.transitionRequestedBy)
+	})
+
+	t.Run("success keeps production", func(t *testing.T) {
+		h := newTestHandler(t, FirewallConfig{ProductionProbe: probe, RevertOnProbeFailure: true}, nil)
+
+		h.lock.Lock()
+		require.NoError(t, h.transitionToProduction("test"))
+		h.lock.Unlock()
+		h.tasks.Stop()
+
+		require.Contains(t, testRunner(h).Calls(), "/usr/bin/curl -fsS http://127.0.0.1:8080/ready")
+		require.InDelta(t, 0, testutil.ToFloat64(h.metrics.probeFailures), 0)
+		require.Equal(t, "production", getStatusJSON(t, h).Mode)
+	})
+}
+
+func TestProductionProbeWindow(t *testing.T) {
+	t.Run("passing within the window", func(t *testing.T) {
+		var requests atomic.Int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if requests.Add(1) < 3 {
+				http.Error(w, "warming up", http.StatusServiceUnavailable)
+			}
+		}))
+		defer ts.Close()
+		h := newTestHandler(t, FirewallConfig{
+			ProductionProbeURL:      ts.URL,
+			ProductionProbeWindow:   time.Second,
+			ProductionProbeInterval: time.Millisecond,
+			RevertOnProbeFailure:    true,
+		}, nil)
+
+		h.lock.Lock()
+		require.NoError(t, h.transitionToProduction("test"))
+		h.lock.Unlock()
+		require.Eventually(t, func() bool { return h.tasks.running.Load() == 0 }, time.Second, time.Millisecond)
+
+		require.EqualValues(t, 3, requests.Load())
+		require.InDelta(t, 0, testutil.ToFloat64(h.metrics.probeFailures), 0)
+		require.Equal(t, "production", getStatusJSON(t, h).Mode)
+	})
+
+	t.Run("not passing reverts to maintenance", func(t *testing.T) {
+		var requests atomic.Int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+			http.Error(w, "warming up", http.StatusServiceUnavailable)
+		}))
+		defer ts.Close()
+		h := newTestHandler(t, FirewallConfig{
+			ProductionProbeURL:      ts.URL,
+			ProductionProbeWindow:   50 * time.Millisecond,
+			ProductionProbeInterval: 5 * time.Millisecond,
+			RevertOnProbeFailure:    true,
+		}, nil)
+
+		h.lock.Lock()
+		require.NoError(t, h.transitionToProduction("test"))
+		h.lock.Unlock()
+
+		require.Eventually(t, func() bool {
+			return getStatusJSON(t, h).Mode != "production"
+		}, time.Second, time.Millisecond)
+		require.Greater(t, requests.Load(), int32(1))
+		require.InDelta(t, 1, testutil.ToFloat64(h.metrics.probeFailures), 0)
+		h.lock.Lock()
+		defer h.lock.Unlock()
+		require.Equal(t, "production-probe", h.transitionRequestedBy)
+	})
+
+	t.Run("command and URL", func(t *testing.T) {
+		_, err := NewFirewallHandler(slog.New(slog.NewTextHandler(io.Discard, nil)), FirewallConfig{
+			ProductionProbe:    []string{"/bin/true"},
+			ProductionProbeURL: "http://127.0.0.1/ready",
+		})
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,51 @@
+package httpserver
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+var ErrQuietPeriod = errors.New("transitions are not accepted during the startup quiet period")
+
+// quietPeriodError is returned if a transition is requested during the quiet
+// period after startup.
+type quietPeriodError struct {
+	remaining time.Duration
+}
+
+func (e *quietPeriodError) Error() string {
+	return fmt.Sprintf("%s, %s remaining", ErrQuietPeriod, e.remaining.Round(time.Second))
+}
+
+func (e *quietPeriodError) Unwrap() error {
+	return ErrQuietPeriod
+}
+
+// retryAfter returns the remaining quiet period in whole seconds, rounded up.
+func (e *quietPeriodError) retryAfter() string {
+	return strconv.Itoa(int(math.Ceil(e.remaining.Seconds())))
+}
+
+// startQuietPeriod starts the quiet period, if enabled. Must be called with
+// the lock held.
+func (h *FirewallHandler) startQuietPeriod() {
+	if h.config.QuietPeriod > 0 {
+		h.quietUntil = h.now().Add(h.config.QuietPeriod)
+	}
+}
+
+// checkQuietPeriod rejects transition requests until the quiet period
+// elapsed. Internal transitions, e.g. on shutdown, are not affected. Must be
+// called with the lock held.
+func (h *FirewallHandler) checkQuietPeriod() error {
+	if h.quietUntil.IsZero() {
+		return nil
+	}
+	if remaining := h.quietUntil.Sub(h.now()); remaining > 0 {
+		return &rejectionError{code: NotReady, err: &quietPeriodError{remaining: remaining}}
+	}
+	return nil
+}
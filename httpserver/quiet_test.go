@@ -0,0 +1,37 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuietPeriod(t *testing.T) {
+	clock := newFakeClock()
+	h := newTestHandler(t, FirewallConfig{QuietPeriod: time.Minute}, clock)
+	h.lock.Lock()
+	h.startQuietPeriod()
+	h.lock.Unlock()
+
+	transition := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		h.handleProduction(rr, httptest.NewRequest(http.MethodGet, "/firewall/production", nil))
+		return rr
+	}
+
+	clock.Advance(30 * time.Second)
+	rr := transition()
+	require.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	require.Equal(t, "30", rr.Header().Get("Retry-After"))
+	require.Contains(t, rr.Body.String(), `"code":"not_ready"`)
+	require.Equal(t, Maintenance, h.mode)
+	require.Equal(t, clock.Now().Add(30*time.Second), *getStatusJSON(t, h).QuietUntil)
+
+	clock.Advance(30 * time.Second)
+	require.Equal(t, http.StatusOK, transition().Code)
+	require.Equal(t, Production, h.mode)
+	require.Nil(t, getStatusJSON(t, h).QuietUntil)
+}
@@ -0,0 +1,57 @@
+package httpserver
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+)
+
+var errInternal = errors.New("internal error")
+
+// fatalPanicExitCode is the exit code after a fatal failure in a handler,
+// the same as of an unrecovered panic.
+const fatalPanicExitCode = 2
+
+// recoverPanics responds with 500 if the handler panics, and logs the panic
+// with the request, instead of leaving the client with a dropped connection.
+// Fatal failures exit the process instead, since net/http would recover
+// their panic too and serve on.
+func (srv *Server) recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler { //nolint:errorlint
+				// Deliberately aborted, e.g. by the response controller
+				panic(v)
+			}
+			if p, ok := v.(fatalPanic); ok {
+				// The rules in place are unknown, serving on would hide that
+				srv.log.Error("exiting after a fatal failure", "error", p.err, "method", r.Method, "path", r.URL.Path,
+					"stack", string(debug.Stack()))
+				exitFunc(fatalPanicExitCode)
+				panic(v)
+			}
+			srv.log.Error("handler panicked", "panic", v, "method", r.Method, "path", r.URL.Path,
+				"remote_addr", r.RemoteAddr, "requested_by", requestedBy(r.Context()), "stack", string(debug.Stack()))
+			writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: errInternal.Error()})
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rejectMalformedQuery responds with 400 if the query string can't be
+// parsed, e.g. because of an invalid escape, rather than handlers silently
+// ignoring the malformed parameters.
+func rejectMalformedQuery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := url.ParseQuery(r.URL.RawQuery); err != nil {
+			http.Error(w, "malformed query: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
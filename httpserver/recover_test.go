@@ -0,0 +1,119 @@
+package httpserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecoverPanics(t *testing.T) {
+	var logs bytes.Buffer
+	cfg := newTestServerConfig()
+	cfg.Log = slog.New(slog.NewTextHandler(&logs, nil))
+	srv := newTestServer(t, cfg)
+	router := srv.getRouter()
+	// Panic on one path, like a buggy handler, and serve the routes otherwise
+	srv.srv.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/panic" {
+			srv.httpLogger(srv.recoverPanics(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+				panic("boom")
+			}))).ServeHTTP(w, r)
+			return
+		}
+		router.ServeHTTP(w, r)
+	})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go srv.srv.Serve(ln) //nolint:errcheck
+	defer srv.srv.Close()
+	base := "http://" + ln.Addr().String()
+
+	resp, err := http.Get(base + "/panic")
+	require.NoError(t, err)
+	var body ErrorResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	resp.Body.Close()
+	require.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	require.Equal(t, "internal error", body.Error)
+	require.Contains(t, logs.String(), "handler panicked")
+	require.Contains(t, logs.String(), "path=/panic")
+
+	// Still serving
+	resp, err = http.Get(base + "/firewall/status")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestRecoverPanicsFatal(t *testing.T) {
+	srv := newTestServer(t, newTestServerConfig())
+	handler := srv.recoverPanics(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic(fatalPanic{errRevertTransitionFailed})
+	}))
+	defer func(exit func(int)) { exitFunc = exit }(exitFunc)
+	exitCode := 0
+	exitFunc = func(code int) { exitCode = code }
+	require.PanicsWithValue(t, fatalPanic{errRevertTransitionFailed}, func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+	require.Equal(t, fatalPanicExitCode, exitCode)
+}
+
+func TestMalformedRequests(t *testing.T) {
+	srv := newTestServer(t, newTestServerConfig())
+	router := srv.getRouter()
+
+	t.Run("bad query encoding", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/firewall/can-transition?to=%zz", nil))
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Contains(t, rr.Body.String(), "malformed query")
+	})
+
+	srv.srv.Handler = router
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go srv.srv.Serve(ln) //nolint:errcheck
+	defer srv.srv.Close()
+
+	// raw sends the request as is, the client would refuse to send it
+	raw := func(t *testing.T, request string) int {
+		t.Helper()
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+		_, err = conn.Write([]byte(request))
+		require.NoError(t, err)
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	t.Run("invalid method token", func(t *testing.T) {
+		require.Equal(t, http.StatusBadRequest, raw(t, "G(T /firewall/status HTTP/1.1\r\nHost: test\r\n\r\n"))
+	})
+
+	t.Run("unknown method", func(t *testing.T) {
+		require.Equal(t, http.StatusMethodNotAllowed, raw(t, "PATCH /firewall/status HTTP/1.1\r\nHost: test\r\n\r\n"))
+	})
+
+	t.Run("oversized headers", func(t *testing.T) {
+		// net/http allows some slack on top of the limit
+		header := fmt.Sprintf("X-Large: %s\r\n", strings.Repeat("a", 2*DefaultMaxHeaderBytes))
+		require.Equal(t, http.StatusRequestHeaderFieldsTooLarge, raw(t, "GET /firewall/status HTTP/1.1\r\nHost: test\r\n"+header+"\r\n"))
+	})
+
+	t.Run("invalid path escape", func(t *testing.T) {
+		require.Equal(t, http.StatusBadRequest, raw(t, "GET /firewall/%zz HTTP/1.1\r\nHost: test\r\n\r\n"))
+	})
+}
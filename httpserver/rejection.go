@@ -0,0 +1,98 @@
+package httpserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// RejectionCode classifies why a transition request was rejected, so
+// automation can branch on it rather than on error messages.
+type RejectionCode string
+
+const (
+	WrongSourceMode      RejectionCode = "wrong_source_mode"      // The transition isn't allowed from the current mode
+	Degraded             RejectionCode = "degraded"               // The startup apply failed for good
+	TransitionInProgress RejectionCode = "transition_in_progress" // The maintenance transition is still draining
+	Cooldown             RejectionCode = "cooldown"               // The minimum dwell time of the current mode didn't elapse
+	DriftDetected        RejectionCode = "drift_detected"         // The live ruleset drifted from the last apply
+	ReasonRequired       RejectionCode = "reason_required"        // Reserved, no transition requires a reason yet
+	NotReady             RejectionCode = "not_ready"              // Still starting up, or shutting down
+	PreconditionFailed   RejectionCode = "precondition_failed"    // The state doesn't match If-Match
+	ModeMismatch         RejectionCode = "mode_mismatch"          // The current mode isn't the expected_current_mode of the request
+)
+
+// ErrorResponse is the JSON error response of rejected and failed
+// transitions. Code is set for rejections, Reason if there is one, and
+// CurrentMode for mode mismatches.
+type ErrorResponse struct {
+	Error       string        `json:"error"`
+	Code        RejectionCode `json:"code,omitempty"`
+	Reason      FailureReason `json:"reason,omitempty"`
+	CurrentMode string        `json:"current_mode,omitempty"`
+}
+
+// rejectionError is a rejected transition with its code.
+type rejectionError struct {
+	code RejectionCode
+	err  error
+}
+
+func (e *rejectionError) Error() string {
+	return e.err.Error()
+}
+
+func (e *rejectionError) Unwrap() error {
+	return e.err
+}
+
+// rejectMode rejects a transition to the given mode, which is only
+// requestable from the given one, telling apart why. Must be called with the
+// lock held.
+func (h *FirewallHandler) rejectMode(to, from FirewallMode) error {
+	code := WrongSourceMode
+	switch {
+	case h.degraded:
+		code = Degraded
+	case h.mode == Initializing:
+		code = NotReady
+	case h.mode == TransitionToMaintenance:
+		code = TransitionInProgress
+	}
+	return &rejectionError{
+		code: code,
+		err:  fmt.Errorf("%w: %s transition request not from %s mode", ErrInvalidTransition, to, from),
+	}
+}
+
+// rejectionCode returns the code of a rejected transition, or false if err
+// isn't a rejection, e.g. a failed apply.
+func rejectionCode(err error) (RejectionCode, bool) {
+	var rejection *rejectionError
+	switch {
+	case errors.As(err, &rejection):
+		return rejection.code, true
+	case errors.Is(err, ErrInvalidTransition):
+		return WrongSourceMode, true
+	case errors.Is(err, ErrDwellNotElapsed):
+		return Cooldown, true
+	case errors.Is(err, ErrDriftDetected):
+		return DriftDetected, true
+	case errors.Is(err, ErrPreconditionFailed):
+		return PreconditionFailed, true
+	case errors.Is(err, ErrModeMismatch):
+		return ModeMismatch, true
+	}
+	return "", false
+}
+
+// reject writes a rejection and counts it.
+func (h *FirewallHandler) reject(w http.ResponseWriter, status int, code RejectionCode, err error) {
+	h.metrics.rejections.WithLabelValues(string(code)).Inc()
+	resp := ErrorResponse{Error: err.Error(), Code: code, Reason: failureReason(err)}
+	var mismatch *modeMismatchError
+	if errors.As(err, &mismatch) {
+		resp.CurrentMode = mismatch.current.String()
+	}
+	writeJSON(w, status, resp)
+}
@@ -0,0 +1,115 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRejectionCodes(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        FirewallConfig
+		setup      func(h *FirewallHandler)
+		to         FirewallMode
+		ifMatch    string
+		wantStatus int
+		wantCode   RejectionCode
+	}{
+		{
+			name:       "wrong source mode",
+			setup:      func(h *FirewallHandler) { h.mode = Production },
+			to:         Production,
+			wantStatus: http.StatusConflict,
+			wantCode:   WrongSourceMode,
+		},
+		{
+			name:       "degraded",
+			setup:      func(h *FirewallHandler) { h.mode, h.degraded = Initializing, true },
+			to:         Production,
+			wantStatus: http.StatusServiceUnavailable,
+			wantCode:   Degraded,
+		},
+		{
+			name:       "startup apply pending",
+			setup:      func(h *FirewallHandler) { h.mode = Initializing },
+			to:         Maintenance,
+			wantStatus: http.StatusServiceUnavailable,
+			wantCode:   NotReady,
+		},
+		{
+			name:       "transition in progress",
+			setup:      func(h *FirewallHandler) { h.mode = TransitionToMaintenance },
+			to:         Production,
+			wantStatus: http.StatusConflict,
+			wantCode:   TransitionInProgress,
+		},
+		{
+			name:       "cooldown",
+			cfg:        FirewallConfig{MinDwell: map[FirewallMode]time.Duration{Maintenance: time.Hour}},
+			setup:      func(h *FirewallHandler) { h.modeSince = h.now() },
+			to:         Production,
+			wantStatus: http.StatusTooManyRequests,
+			wantCode:   Cooldown,
+		},
+		{
+			name:       "drift detected",
+			cfg:        FirewallConfig{RejectTransitionsOnDrift: true},
+			setup:      func(h *FirewallHandler) { h.expectedRuleset = "before" },
+			to:         Production,
+			wantStatus: http.StatusConflict,
+			wantCode:   DriftDetected,
+		},
+		{
+			name:       "precondition failed",
+			to:         Production,
+			ifMatch:    `"stale"`,
+			wantStatus: http.StatusPreconditionFailed,
+			wantCode:   PreconditionFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, tt.cfg, newFakeClock())
+			if tt.setup != nil {
+				tt.setup(h)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/firewall/transition", nil)
+			if tt.ifMatch != "" {
+				req.Header.Set("If-Match", tt.ifMatch)
+			}
+			rr := httptest.NewRecorder()
+			transition := h.transitionToProduction
+			if tt.to == Maintenance {
+				transition = h.transitionToMaintenance
+			}
+			h.handleTransition(rr, req, tt.to, transition)
+
+			require.Equal(t, tt.wantStatus, rr.Code)
+			require.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+			var rejection ErrorResponse
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &rejection))
+			require.Equal(t, tt.wantCode, rejection.Code)
+			require.NotEmpty(t, rejection.Error)
+			require.InDelta(t, 1, testutil.ToFloat64(h.metrics.rejections.WithLabelValues(string(tt.wantCode))), 0)
+		})
+	}
+}
+
+func TestRejectionCodeWhileShuttingDown(t *testing.T) {
+	srv := newTestServer(t, newTestServerConfig())
+	srv.shuttingDown.Store(true)
+
+	rr := httptest.NewRecorder()
+	srv.getRouter().ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/firewall/transition", nil))
+	require.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	var rejection ErrorResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &rejection))
+	require.Equal(t, NotReady, rejection.Code)
+}
@@ -0,0 +1,526 @@
+package httpserver
+
+import (
+	"cmp"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// route describes an API endpoint. The route table is the single source for
+// both the router and the OpenAPI spec.
+type route struct {
+	Method   string
+	Path     string
+	Summary  string
+	Handler  http.HandlerFunc
+	Feature  string // Optional - experimental feature the route is gated behind
+	Mutating bool   // Rejected with 503 once shutdown has begun
+	Debug    bool   // Only served if HTTPServerConfig.Debug is set
+	// Sensitive read-only routes are guarded like control routes, e.g. by
+	// HTTPServerConfig.ControlAllowedCIDRs.
+	Sensitive bool
+	// ServeWhenNotReady exempts the route from
+	// HTTPServerConfig.RejectWhileNotReady, e.g. health checks, and mutating
+	// routes from the rejection until the startup apply completed.
+	ServeWhenNotReady bool
+	// Scope is the mode the route triggers, which scoped auth tokens must be
+	// allowed to. Optional - routes taking the mode from the request check it
+	// themselves.
+	Scope string
+	// Streaming responses are long-lived and not request-logged, the request
+	// logger can't flush.
+	Streaming bool
+
+	Query       []queryParam
+	RequestBody any // Optional - zero value of the JSON request body type
+	// RequestContentTypes of the request body. Optional - defaults to
+	// application/json.
+	RequestContentTypes []string
+	Responses           []response
+}
+
+type queryParam struct {
+	Name        string
+	Description string
+	Required    bool
+}
+
+type response struct {
+	Status      int
+	Description string
+	ContentType string // Optional - no body if empty
+	Body        any    // Optional - zero value of the JSON response body type
+}
+
+// enabledRoutes returns the routes which are not behind a disabled
+// experimental feature or debug mode.
+func (srv *Server) enabledRoutes() []route {
+	var res []route
+	for _, rt := range srv.routes() {
+		if rt.Feature != "" && !srv.handler.featureEnabled(rt.Feature) {
+			continue
+		}
+		if rt.Debug && !srv.cfg.Debug {
+			continue
+		}
+		res = append(res, rt)
+	}
+	return res
+}
+
+// RouteInfo is a single entry of the routes endpoint.
+type RouteInfo struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+}
+
+// handleRoutes lists the routes registered on the router, which depend on the
+// enabled features and debug options.
+func (srv *Server) handleRoutes(w http.ResponseWriter, r *http.Request) {
+	routes := []RouteInfo{}
+	err := chi.Walk(srv.router, func(method, path string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		routes = append(routes, RouteInfo{Method: method, Path: path})
+		return nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	slices.SortFunc(routes, func(a, b RouteInfo) int {
+		return cmp.Or(strings.Compare(a.Path, b.Path), strings.Compare(a.Method, b.Method))
+	})
+	writeJSON(w, http.StatusOK, routes)
+}
+
+func (srv *Server) routes() []route {
+	h := srv.handler
+	return []route{
+		{
+			Method:  http.MethodGet,
+			Path:    "/firewall/status",
+			Summary: "Current firewall mode",
+			Handler: h.handleStatus,
+			Responses: []response{
+				{Status: http.StatusOK, Description: "Current mode, also in X-Firewall-Mode, with the ETag of the current state", ContentType: "text/plain"},
+				{Status: http.StatusOK, Description: "Current state (with Accept: application/json)", ContentType: "application/json", Body: Status{}},
+				{Status: http.StatusOK, Description: "Status page for browsers (with Accept: text/html)", ContentType: "text/html"},
+				{Status: http.StatusNotAcceptable, Description: "No acceptable content type (strict negotiation only)", ContentType: "text/plain"},
+				{Status: http.StatusServiceUnavailable, Description: "State read timed out, e.g. during a slow apply", ContentType: "text/plain"},
+			},
+		},
+		{
+			Method:  http.MethodHead,
+			Path:    "/firewall/status",
+			Summary: "Current firewall mode in the X-Firewall-Mode header, without a body",
+			Handler: h.handleStatus,
+			Responses: []response{
+				{Status: http.StatusOK, Description: "Current mode in X-Firewall-Mode, with the ETag of the current state"},
+				{Status: http.StatusServiceUnavailable, Description: "State read timed out, e.g. during a slow apply"},
+			},
+		},
+		{
+			Method:    http.MethodGet,
+			Path:      "/firewall/events",
+			Summary:   "Stream the status on every mode change as server-sent events, ending with a shutdown event",
+			Handler:   srv.handleEvents,
+			Streaming: true,
+			Responses: []response{
+				{Status: http.StatusOK, Description: "Status events with the Status as JSON data, then a shutdown event with an ErrorResponse", ContentType: "text/event-stream"},
+				{Status: http.StatusServiceUnavailable, Description: "Shutting down", ContentType: "application/json", Body: ErrorResponse{}},
+			},
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/firewall/maintenance",
+			Scope:    "maintenance",
+			Summary:  "Start the transition from production to maintenance",
+			Handler:  h.handleMaintenance,
+			Mutating: true,
+			Query: []queryParam{
+				{Name: "wait", Description: "Respond only once the transition completed (or timed out), with the status"},
+			},
+			Responses: []response{
+				{Status: http.StatusOK, Description: "Transition completed (without transition duration)"},
+				{Status: http.StatusAccepted, Description: "Transition started, completes after the transition duration"},
+				{Status: http.StatusOK, Description: "Transition completed (with wait=true)", ContentType: "application/json", Body: Status{}},
+				{Status: http.StatusAccepted, Description: "Transition still in progress after the wait timeout (with wait=true)", ContentType: "application/json", Body: Status{}},
+				{Status: http.StatusConflict, Description: "Not in production mode", ContentType: "application/json", Body: ErrorResponse{}},
+				{Status: http.StatusConflict, Description: "Live ruleset drifted (if drift rejection is enabled)", ContentType: "application/json", Body: ErrorResponse{}},
+				{Status: http.StatusPreconditionFailed, Description: "If-Match does not match the ETag of the current state", ContentType: "application/json", Body: ErrorResponse{}},
+				{Status: http.StatusTooManyRequests, Description: "Minimum dwell time of the current mode, or cooldown of the transition, not elapsed, see Retry-After", ContentType: "application/json", Body: ErrorResponse{}},
+				{Status: http.StatusServiceUnavailable, Description: "Startup quiet period or startup apply not over, see Retry-After, or degraded after the startup apply failed", ContentType: "application/json", Body: ErrorResponse{}},
+				{Status: http.StatusInternalServerError, Description: "Could not apply the transition rules", ContentType: "application/json", Body: ErrorResponse{}},
+				{Status: http.StatusInternalServerError, Description: "Transition reverted (with wait=true)", ContentType: "application/json", Body: Status{}},
+			},
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/firewall/abort",
+			Scope:    "production",
+			Summary:  "Abort the transition to maintenance before it completes, restoring production",
+			Handler:  h.handleAbort,
+			Mutating: true,
+			Responses: []response{
+				{Status: http.StatusOK, Description: "Transition aborted, production rules applied"},
+				{Status: http.StatusConflict, Description: "No transition in progress, or it's completing", ContentType: "text/plain"},
+				{Status: http.StatusInternalServerError, Description: "Could not apply the production rules, the transition completed instead", ContentType: "application/json", Body: ErrorResponse{}},
+			},
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/firewall/maintenance/renew",
+			Summary:  "Renew the maintenance lease",
+			Handler:  h.handleRenewLease,
+			Mutating: true,
+			Responses: []response{
+				{Status: http.StatusOK, Description: "Lease renewed", ContentType: "application/json", Body: Lease{}},
+				{Status: http.StatusConflict, Description: "Not in maintenance, or leases are disabled", ContentType: "text/plain"},
+			},
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/firewall/heartbeat",
+			Summary:  "Reset the dead man's switch",
+			Handler:  h.handleHeartbeat,
+			Mutating: true,
+			Responses: []response{
+				{Status: http.StatusOK, Description: "Next heartbeat deadline", ContentType: "application/json", Body: Heartbeat{}},
+				{Status: http.StatusConflict, Description: "Dead man's switch is disabled", ContentType: "text/plain"},
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/firewall/pending",
+			Summary: "Actions scheduled to happen without a further request, soonest first",
+			Handler: h.handlePending,
+			Responses: []response{
+				{Status: http.StatusOK, Description: "Pending actions", ContentType: "application/json", Body: []PendingAction{}},
+			},
+		},
+		{
+			Method:   http.MethodDelete,
+			Path:     "/firewall/pending/{id}",
+			Summary:  "Cancel a pending action",
+			Handler:  h.handleCancelPending,
+			Mutating: true,
+			Responses: []response{
+				{Status: http.StatusNoContent, Description: "Action canceled"},
+				{Status: http.StatusNotFound, Description: "No such pending action", ContentType: "text/plain"},
+				{Status: http.StatusConflict, Description: "Action can't be canceled", ContentType: "text/plain"},
+			},
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/firewall/production",
+			Scope:    "production",
+			Summary:  "Transition from maintenance to production",
+			Handler:  h.handleProduction,
+			Mutating: true,
+			Responses: []response{
+				{Status: http.StatusOK, Description: "Production rules applied"},
+				{Status: http.StatusConflict, Description: "Not in maintenance mode, or the maintenance transition is still in progress", ContentType: "application/json", Body: ErrorResponse{}},
+				{Status: http.StatusConflict, Description: "Live ruleset drifted (if drift rejection is enabled)", ContentType: "application/json", Body: ErrorResponse{}},
+				{Status: http.StatusPreconditionFailed, Description: "If-Match does not match the ETag of the current state", ContentType: "application/json", Body: ErrorResponse{}},
+				{Status: http.StatusTooManyRequests, Description: "Minimum dwell time of the current mode, or cooldown of the transition, not elapsed, see Retry-After", ContentType: "application/json", Body: ErrorResponse{}},
+				{Status: http.StatusServiceUnavailable, Description: "Startup quiet period or startup apply not over, see Retry-After, or degraded after the startup apply failed", ContentType: "application/json", Body: ErrorResponse{}},
+				{Status: http.StatusInternalServerError, Description: "Could not apply the production rules", ContentType: "application/json", Body: ErrorResponse{}},
+			},
+		},
+		{
+			Method:      http.MethodPost,
+			Path:        "/firewall/transition",
+			Summary:     "Start the transition to the mode in the body, maintenance or production",
+			Handler:     h.handleTransitionRequest,
+			Mutating:    true,
+			RequestBody: TransitionRequest{},
+			Responses: []response{
+				{Status: http.StatusOK, Description: "Production rules applied, or maintenance transition completed (without transition duration)"},
+				{Status: http.StatusAccepted, Description: "Maintenance transition started, completes after the transition duration"},
+				{Status: http.StatusBadRequest, Description: "Malformed request", ContentType: "text/plain"},
+				{Status: http.StatusConflict, Description: "Not in the mode to transition from, or a transition is still in progress", ContentType: "application/json", Body: ErrorResponse{}},
+				{Status: http.StatusConflict, Description: "Current mode is not expected_current_mode, see current_mode", ContentType: "application/json", Body: ErrorResponse{}},
+				{Status: http.StatusConflict, Description: "Live ruleset drifted (if drift rejection is enabled)", ContentType: "application/json", Body: ErrorResponse{}},
+				{Status: http.StatusPreconditionFailed, Description: "If-Match does not match the ETag of the current state", ContentType: "application/json", Body: ErrorResponse{}},
+				{Status: http.StatusTooManyRequests, Description: "Minimum dwell time of the current mode, or cooldown of the transition, not elapsed, see Retry-After", ContentType: "application/json", Body: ErrorResponse{}},
+				{Status: http.StatusServiceUnavailable, Description: "Startup quiet period or startup apply not over, see Retry-After, or degraded after the startup apply failed", ContentType: "application/json", Body: ErrorResponse{}},
+				{Status: http.StatusRequestEntityTooLarge, Description: "Request body too large", ContentType: "text/plain"},
+				{Status: http.StatusInternalServerError, Description: "Could not apply the rules", ContentType: "application/json", Body: ErrorResponse{}},
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/firewall/statemachine",
+			Summary: "States, transitions and guards of the firewall state machine",
+			Handler: h.handleStateMachine,
+			Query: []queryParam{
+				{Name: "format", Description: "json (default) or dot for Graphviz"},
+			},
+			Responses: []response{
+				{Status: http.StatusOK, Description: "State machine", ContentType: "application/json", Body: StateMachine{}},
+				{Status: http.StatusOK, Description: "State machine with format=dot", ContentType: "text/vnd.graphviz"},
+				{Status: http.StatusBadRequest, Description: "Invalid format", ContentType: "text/plain"},
+			},
+		},
+		{
+			Method:    http.MethodGet,
+			Path:      "/firewall/applied",
+			Summary:   "Ruleset last applied for a mode, as read from its config file at the time",
+			Handler:   h.handleApplied,
+			Sensitive: true,
+			Query: []queryParam{
+				{Name: "mode", Description: "maintenance, production or transition_to_maintenance", Required: true},
+			},
+			Responses: []response{
+				{Status: http.StatusOK, Description: "Applied ruleset, with its apply time as Last-Modified", ContentType: "text/plain"},
+				{Status: http.StatusBadRequest, Description: "Invalid mode", ContentType: "text/plain"},
+				{Status: http.StatusNotFound, Description: "Not applied yet by this process", ContentType: "text/plain"},
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/firewall/can-transition",
+			Summary: "Whether a transition would currently be allowed",
+			Handler: h.handleCanTransition,
+			Query: []queryParam{
+				{Name: "to", Description: "Target mode, maintenance or production", Required: true},
+			},
+			Responses: []response{
+				{Status: http.StatusOK, Description: "Whether the transition is allowed, and the remaining dwell time", ContentType: "application/json", Body: CanTransition{}},
+				{Status: http.StatusBadRequest, Description: "Invalid target mode", ContentType: "text/plain"},
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/firewall/what-if",
+			Summary: "Plan a transition without applying anything",
+			Handler: h.handleWhatIf,
+			Query: []queryParam{
+				{Name: "to", Description: "Target mode, maintenance or production", Required: true},
+			},
+			Responses: []response{
+				{Status: http.StatusOK, Description: "Planned steps", ContentType: "application/json", Body: WhatIfPlan{}},
+				{Status: http.StatusBadRequest, Description: "Invalid target mode", ContentType: "text/plain"},
+			},
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/firewall/lockdown",
+			Scope:    "lockdown",
+			Summary:  "Immediately deny all but management traffic, bypassing the transition flow",
+			Handler:  h.handleLockdown,
+			Mutating: true,
+			// An emergency measure, served before the startup apply completed
+			ServeWhenNotReady: true,
+			Responses: []response{
+				{Status: http.StatusOK, Description: "Lockdown active"},
+				{Status: http.StatusConflict, Description: "The maintenance transition is completing, retry", ContentType: "text/plain"},
+				{Status: http.StatusInternalServerError, Description: "Could not apply the lockdown rules", ContentType: "application/json", Body: ErrorResponse{}},
+			},
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/firewall/reset",
+			Scope:    "lockdown",
+			Summary:  "Leave lockdown for maintenance",
+			Handler:  h.handleReset,
+			Mutating: true,
+			Responses: []response{
+				{Status: http.StatusOK, Description: "Lockdown left, in maintenance"},
+				{Status: http.StatusConflict, Description: "Not in lockdown", ContentType: "text/plain"},
+				{Status: http.StatusInternalServerError, Description: "Could not apply the maintenance rules", ContentType: "application/json", Body: ErrorResponse{}},
+			},
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/firewall/reapply",
+			Summary:  "Re-apply the rules of the current mode",
+			Handler:  h.handleReapply,
+			Mutating: true,
+			Responses: []response{
+				{Status: http.StatusOK, Description: "Rules re-applied"},
+				{Status: http.StatusConflict, Description: "A transition is in progress", ContentType: "text/plain"},
+				{Status: http.StatusInternalServerError, Description: "Could not apply the rules", ContentType: "text/plain"},
+			},
+		},
+		{
+			Method:              http.MethodPost,
+			Path:                "/firewall/validate",
+			Summary:             "Check an uploaded ruleset with nft -c, without applying it",
+			Handler:             h.handleValidate,
+			Sensitive:           true,
+			RequestBody:         "",
+			RequestContentTypes: []string{"text/plain", "application/json"},
+			Responses: []response{
+				{Status: http.StatusOK, Description: "Valid ruleset", ContentType: "application/json", Body: ValidateResult{}},
+				{Status: http.StatusBadRequest, Description: "Empty or unreadable ruleset, or with include statements", ContentType: "text/plain"},
+				{Status: http.StatusRequestEntityTooLarge, Description: "Ruleset larger than 1 MiB", ContentType: "text/plain"},
+				{Status: http.StatusUnprocessableEntity, Description: "Invalid ruleset, with the nft errors", ContentType: "application/json", Body: ValidateResult{}},
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/firewall/mode-durations",
+			Summary: "Cumulative time spent in each mode",
+			Handler: h.handleModeDurations,
+			Responses: []response{
+				{Status: http.StatusOK, Description: "Mode durations", ContentType: "application/json", Body: ModeDurations{}},
+			},
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/firewall/mode-durations/reset",
+			Summary:  "Close the current mode durations period",
+			Handler:  h.handleModeDurationsReset,
+			Mutating: true,
+			Responses: []response{
+				{Status: http.StatusOK, Description: "Mode durations after the reset", ContentType: "application/json", Body: ModeDurations{}},
+			},
+		},
+		{
+			Method:      http.MethodPost,
+			Path:        "/firewall/batch",
+			Summary:     "Run a sequence of operations",
+			Handler:     h.handleBatch,
+			Mutating:    true,
+			Feature:     "batch",
+			RequestBody: BatchRequest{},
+			Responses: []response{
+				{Status: http.StatusOK, Description: "All operations succeeded", ContentType: "application/json", Body: BatchResponse{}},
+				{Status: http.StatusMultiStatus, Description: "At least one operation failed", ContentType: "application/json", Body: BatchResponse{}},
+				{Status: http.StatusBadRequest, Description: "Invalid batch request", ContentType: "text/plain"},
+			},
+		},
+		{
+			Method:    http.MethodGet,
+			Path:      "/firewall/history",
+			Summary:   "Most recent transition outcomes, oldest first",
+			Handler:   h.handleHistory,
+			Sensitive: true, // Includes who requested the transitions
+			Responses: []response{
+				{Status: http.StatusOK, Description: "Completed, reverted, failed and aborted transitions", ContentType: "application/json", Body: History{}},
+			},
+		},
+		{
+			Method:    http.MethodGet,
+			Path:      "/firewall/audit",
+			Summary:   "Transition outcomes from the audit store, oldest first",
+			Handler:   h.handleAudit,
+			Sensitive: true, // Includes who requested the transitions
+			Query: []queryParam{
+				{Name: "since", Description: "Only outcomes at or after this time, RFC 3339"},
+				{Name: "limit", Description: "Maximum number of outcomes, 1 to 1000, 100 by default"},
+			},
+			Responses: []response{
+				{Status: http.StatusOK, Description: "Completed, reverted, failed and aborted transitions", ContentType: "application/json", Body: AuditLog{}},
+				{Status: http.StatusBadRequest, Description: "Invalid since or limit", ContentType: "text/plain"},
+				{Status: http.StatusConflict, Description: "Audit store is disabled", ContentType: "text/plain"},
+				{Status: http.StatusInternalServerError, Description: "Could not query the audit store", ContentType: "text/plain"},
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/firewall/stats",
+			Summary: "Snapshot of the operational metrics as JSON",
+			Handler: h.handleStats,
+			Responses: []response{
+				{Status: http.StatusOK, Description: "Transition, apply and mode duration stats", ContentType: "application/json", Body: Stats{}},
+			},
+		},
+		{
+			Method:            http.MethodGet,
+			Path:              "/livez",
+			Summary:           "Liveness probe",
+			Handler:           srv.handleLivez,
+			ServeWhenNotReady: true,
+			Responses: []response{
+				{Status: http.StatusOK, Description: "Alive", ContentType: "text/plain"},
+			},
+		},
+		{
+			Method:            http.MethodGet,
+			Path:              "/readyz",
+			Summary:           "Readiness probe, not ready during the startup apply and warm-up",
+			Handler:           srv.handleReadyz,
+			ServeWhenNotReady: true,
+			Responses: []response{
+				{Status: http.StatusOK, Description: "Ready", ContentType: "text/plain"},
+				{Status: http.StatusServiceUnavailable, Description: "Not ready, with the reason if the selected backend is unavailable", ContentType: "text/plain"},
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/firewall/health/detailed",
+			Summary: "All health signals with a status each, cached briefly",
+			Handler: srv.handleDetailedHealth,
+			Responses: []response{
+				{Status: http.StatusOK, Description: "Health summary, degraded checks included", ContentType: "application/json", Body: DetailedHealth{}},
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/firewall/version",
+			Summary: "Versions of the server, nft and the kernel",
+			Handler: h.handleVersion,
+			Responses: []response{
+				{Status: http.StatusOK, Description: "Versions detected on startup", ContentType: "application/json", Body: Versions{}},
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/firewall/config",
+			Summary: "Configuration in effect, without secrets",
+			Handler: h.handleConfig,
+			// Includes the hook and probe commands and internal paths
+			Sensitive: true,
+			Responses: []response{
+				{Status: http.StatusOK, Description: "Effective configuration and versions", ContentType: "application/json", Body: EffectiveConfig{}},
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/firewall/policy",
+			Summary: "Guards currently affecting transitions, without secrets",
+			Handler: srv.handlePolicy,
+			Responses: []response{
+				{Status: http.StatusOK, Description: "Auth, allowed CIDRs, dwell times, cooldowns, startup state and whether each transition is allowed", ContentType: "application/json", Body: Policy{}},
+			},
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/firewall/fault",
+			Summary:  "Inject a one-shot fault into the next apply (debug only)",
+			Handler:  h.handleFault,
+			Mutating: true,
+			Debug:    true,
+			Query: []queryParam{
+				{Name: "type", Description: "apply_fail, timeout or revert_fail (the revert fails too, which is fatal)", Required: true},
+			},
+			Responses: []response{
+				{Status: http.StatusNoContent, Description: "Fault injected"},
+				{Status: http.StatusBadRequest, Description: "Invalid fault type", ContentType: "text/plain"},
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/firewall/routes",
+			Summary: "Routes registered on the router (debug only)",
+			Handler: srv.handleRoutes,
+			Debug:   true,
+			Responses: []response{
+				{Status: http.StatusOK, Description: "Methods and paths of all registered routes", ContentType: "application/json", Body: []RouteInfo{}},
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/firewall/openapi.json",
+			Summary: "OpenAPI description of this API",
+			Handler: srv.handleOpenAPI,
+			Responses: []response{
+				{Status: http.StatusOK, Description: "OpenAPI 3 document", ContentType: "application/json"},
+			},
+		},
+	}
+}
@@ -0,0 +1,146 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+var ErrUnknownRulesetFormat = errors.New("unknown ruleset format")
+
+// DefaultConfigPaths are the ruleset files used for modes without a
+// configured path.
+var DefaultConfigPaths = map[FirewallMode]string{
+	Maintenance:             "/etc/nftables-maintenance.conf",
+	Production:              "/etc/nftables-production.conf",
+	TransitionToMaintenance: "/etc/nftables-transition.conf",
+	Lockdown:                "/etc/nftables-lockdown.conf",
+}
+
+// rulesetFormat describes how nft applies a ruleset file of a given format.
+type rulesetFormat struct {
+	flags []string // Passed to nft in addition to `-f <path>`
+
+	// parseHandles extracts the handles of added rules from the output of
+	// applying the ruleset with `--echo --handle`.
+	parseHandles func(output []byte) []ruleHandle
+}
+
+// rulesetFormats maps config file extensions to their format.
+var rulesetFormats = map[string]rulesetFormat{
+	".conf": {parseHandles: parseRuleHandles},
+	".nft":  {parseHandles: parseRuleHandles},
+	".json": {flags: []string{"-j"}, parseHandles: parseJSONRuleHandles},
+}
+
+// ruleset is a config file together with the format it's applied as.
+type ruleset struct {
+	path   string
+	format rulesetFormat
+}
+
+func newRuleset(path string) (ruleset, error) {
+	format, ok := rulesetFormats[filepath.Ext(path)]
+	if !ok {
+		exts := make([]string, 0, len(rulesetFormats))
+		for ext := range rulesetFormats {
+			exts = append(exts, ext)
+		}
+		slices.Sort(exts)
+		return ruleset{}, fmt.Errorf("%w: %s, expected one of %s", ErrUnknownRulesetFormat, path, strings.Join(exts, ", "))
+	}
+	return ruleset{path: path, format: format}, nil
+}
+
+// newRulesets resolves the ruleset of every mode, falling back to
+// DefaultConfigPaths.
+func newRulesets(paths map[FirewallMode]string) (map[FirewallMode]ruleset, error) {
+	rulesets := make(map[FirewallMode]ruleset, len(DefaultConfigPaths))
+	for fm, path := range DefaultConfigPaths {
+		if p, ok := paths[fm]; ok && p != "" {
+			path = p
+		}
+		// Relative paths would be resolved from the working directory of
+		// nft, see ruleset.workDir
+		if !filepath.IsAbs(path) {
+			return nil, fmt.Errorf("invalid %s config: %s is not an absolute path", fm, path)
+		}
+		rs, err := newRuleset(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s config: %w", fm, err)
+		}
+		rulesets[fm] = rs
+	}
+	return rulesets, nil
+}
+
+// requireFiles checks that nft and the ruleset files of all modes exist.
+func requireFiles(nft string, rulesets map[FirewallMode]ruleset) error {
+	if _, err := os.Stat(nft); err != nil {
+		return fmt.Errorf("invalid nft binary: %w", err)
+	}
+	modes := make([]FirewallMode, 0, len(rulesets))
+	for fm := range rulesets {
+		modes = append(modes, fm)
+	}
+	slices.Sort(modes)
+	for _, fm := range modes {
+		if _, err := os.Stat(rulesets[fm].path); err != nil {
+			return fmt.Errorf("invalid %s config: %w", fm, err)
+		}
+	}
+	return nil
+}
+
+// args returns the nft arguments to apply the ruleset, preceded by extra.
+func (rs ruleset) args(extra ...string) []string {
+	args := append(slices.Clone(extra), rs.format.flags...)
+	return append(args, "-f", rs.path)
+}
+
+// parseJSONRuleHandles extracts the handles of added rules from the JSON
+// output of `nft -j --echo --handle`.
+func parseJSONRuleHandles(output []byte) []ruleHandle {
+	type jsonRule struct {
+		Family string `json:"family"`
+		Table  string `json:"table"`
+		Chain  string `json:"chain"`
+		Handle uint64 `json:"handle"`
+	}
+	var doc struct {
+		Nftables []map[string]map[string]json.RawMessage `json:"nftables"`
+	}
+	if err := json.Unmarshal(output, &doc); err != nil {
+		return nil
+	}
+
+	var handles []ruleHandle
+	for _, cmd := range doc.Nftables {
+		for _, verb := range []string{"add", "insert"} {
+			raw, ok := cmd[verb]["rule"]
+			if !ok {
+				continue
+			}
+			var rule jsonRule
+			if err := json.Unmarshal(raw, &rule); err != nil || rule.Handle == 0 {
+				continue
+			}
+			handles = append(handles, ruleHandle{Family: rule.Family, Table: rule.Table, Chain: rule.Chain, Handle: rule.Handle})
+		}
+	}
+	return handles
+}
+
+// workDir returns the working directory nft is run in for the ruleset, so
+// relative includes resolve predictably: the configured one, or else the
+// directory of the ruleset.
+func (rs ruleset) workDir(configured string) string {
+	if configured != "" {
+		return configured
+	}
+	return filepath.Dir(rs.path)
+}
@@ -0,0 +1,163 @@
+package httpserver
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRulesetFormats(t *testing.T) {
+	t.Run("conf", func(t *testing.T) {
+		rs, err := newRuleset("/etc/nftables-production.conf")
+		require.NoError(t, err)
+		require.Equal(t, []string{"-f", "/etc/nftables-production.conf"}, rs.args())
+		require.Equal(t, []string{"-c", "-f", "/etc/nftables-production.conf"}, rs.args("-c"))
+	})
+
+	t.Run("json", func(t *testing.T) {
+		rs, err := newRuleset("/etc/nftables-production.json")
+		require.NoError(t, err)
+		require.Equal(t, []string{"-j", "-f", "/etc/nftables-production.json"}, rs.args())
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		_, err := newRuleset("/etc/nftables-production.yaml")
+		require.ErrorIs(t, err, ErrUnknownRulesetFormat)
+		require.ErrorContains(t, err, "expected one of .conf, .json, .nft")
+
+		_, err = NewFirewallHandler(nil, FirewallConfig{ConfigPaths: map[FirewallMode]string{Production: "/etc/rules"}})
+		require.ErrorIs(t, err, ErrUnknownRulesetFormat)
+	})
+}
+
+func TestJSONRulesetTransition(t *testing.T) {
+	h := newTestHandler(t, FirewallConfig{
+		TransitionDuration: 0,
+		ConfigPaths: map[FirewallMode]string{
+			Maintenance:             "/etc/fw/maintenance.json",
+			TransitionToMaintenance: "/etc/fw/transition.json",
+		},
+	}, nil)
+	h.mode = Production
+	testRunner(h).Output("/etc/fw/transition.json", []byte(`{"nftables": [
+		{"metainfo": {"version": "1.0.9"}},
+		{"add": {"rule": {"family": "inet", "table": "filter", "chain": "input", "handle": 7, "expr": []}}},
+		{"insert": {"rule": {"family": "inet", "table": "filter", "chain": "input", "handle": 8, "expr": []}}}
+	]}`))
+	testRunner(h).Output("tables", []byte("table inet filter # handle 3\n"))
+
+	h.lock.Lock()
+	require.NoError(t, h.transitionToMaintenance("test"))
+	h.lock.Unlock()
+
+	require.Equal(t, Maintenance, h.mode)
+	require.Equal(t, []string{
+		"/usr/sbin/nft --echo --handle -j -f /etc/fw/transition.json",
+		"/usr/sbin/nft --handle list tables",
+		"/usr/sbin/nft -j -f /etc/fw/maintenance.json",
+		"/usr/sbin/nft --handle list tables",
+		"/usr/sbin/nft delete rule inet filter input handle 7",
+		"/usr/sbin/nft delete rule inet filter input handle 8",
+	}, testRunner(h).Calls())
+}
+
+func TestRulesetWorkDir(t *testing.T) {
+	dir := t.TempDir()
+	productionPath := filepath.Join(dir, "production.conf")
+
+	t.Run("defaults to the ruleset directory", func(t *testing.T) {
+		h := newTestHandler(t, FirewallConfig{ConfigPaths: map[FirewallMode]string{Production: productionPath}}, nil)
+		h.lock.Lock()
+		require.NoError(t, h.transitionToProduction("test"))
+		h.lock.Unlock()
+		require.Equal(t, []string{dir}, testRunner(h).Dirs())
+	})
+
+	t.Run("configured", func(t *testing.T) {
+		h := newTestHandler(t, FirewallConfig{ConfigPaths: map[FirewallMode]string{Production: productionPath}, WorkDir: "/etc/nftables.d"}, nil)
+		h.lock.Lock()
+		require.NoError(t, h.validateNFTables(Production))
+		h.lock.Unlock()
+		require.Equal(t, []string{"/etc/nftables.d"}, testRunner(h).Dirs())
+	})
+
+	t.Run("relative includes resolve from it", func(t *testing.T) {
+		includes := filepath.Join(dir, "includes")
+		require.NoError(t, os.Mkdir(includes, 0o700))
+		require.NoError(t, os.WriteFile(filepath.Join(includes, "sets.nft"), []byte("define allowed = { 10.0.0.0/8 }\n"), 0o600))
+
+		// What nft does for `include "sets.nft"`
+		out, err := execRunner{}.Run(withWorkDir(context.Background(), includes), "cat", "sets.nft")
+		require.NoError(t, err)
+		require.Equal(t, "define allowed = { 10.0.0.0/8 }\n", string(out))
+	})
+}
+
+func TestNFTBinary(t *testing.T) {
+	h := newTestHandler(t, FirewallConfig{NFTBinary: "/opt/nftables/bin/nft"}, nil)
+	h.lock.Lock()
+	require.NoError(t, h.transitionToProduction("test"))
+	h.lock.Unlock()
+	require.Equal(t, []string{"/opt/nftables/bin/nft -f /etc/nftables-production.conf"}, testRunner(h).Calls())
+	require.Equal(t, "/opt/nftables/bin/nft", h.effectiveConfig().NFTBinary)
+}
+
+func TestRequireConfigFiles(t *testing.T) {
+	dir := t.TempDir()
+	nft := filepath.Join(dir, "nft")
+	paths := make(map[FirewallMode]string)
+	for fm := range DefaultConfigPaths {
+		paths[fm] = filepath.Join(dir, fm.String()+".conf")
+	}
+	cfg := func() FirewallConfig {
+		return FirewallConfig{NFTBinary: nft, ConfigPaths: paths, RequireConfigFiles: true}
+	}
+
+	_, err := NewFirewallHandler(nil, cfg())
+	require.ErrorContains(t, err, "invalid nft binary")
+	require.NoError(t, os.WriteFile(nft, nil, 0o700))
+
+	_, err = NewFirewallHandler(nil, cfg())
+	require.ErrorIs(t, err, os.ErrNotExist)
+	require.ErrorContains(t, err, "invalid maintenance config")
+	for _, path := range paths {
+		require.NoError(t, os.WriteFile(path, nil, 0o600))
+	}
+
+	_, err = NewFirewallHandler(slog.New(slog.NewTextHandler(io.Discard, nil)), cfg())
+	require.NoError(t, err)
+
+	// Not checked unless required
+	_, err = NewFirewallHandler(slog.New(slog.NewTextHandler(io.Discard, nil)), FirewallConfig{NFTBinary: filepath.Join(dir, "missing")})
+	require.NoError(t, err)
+}
+
+func TestRelativePaths(t *testing.T) {
+	_, err := NewFirewallHandler(nil, FirewallConfig{ConfigPaths: map[FirewallMode]string{Production: "rules/production.conf"}})
+	require.ErrorContains(t, err, "not an absolute path")
+
+	_, err = NewFirewallHandler(nil, FirewallConfig{NFTBinary: "nft"})
+	require.ErrorContains(t, err, "not an absolute path")
+}
+
+func TestNFTBinaryScript(t *testing.T) {
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "calls")
+	nft := filepath.Join(dir, "nft")
+	require.NoError(t, os.WriteFile(nft, []byte("#!/bin/sh\necho \"$@\" >> "+calls+"\n"), 0o700))
+
+	h := newTestHandler(t, FirewallConfig{NFTBinary: nft}, nil)
+	h.runner = execRunner{}
+	h.lock.Lock()
+	require.NoError(t, h.transitionToProduction("test"))
+	h.lock.Unlock()
+
+	out, err := os.ReadFile(calls)
+	require.NoError(t, err)
+	require.Equal(t, "-f /etc/nftables-production.conf\n", string(out))
+}
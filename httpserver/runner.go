@@ -0,0 +1,33 @@
+package httpserver
+
+import (
+	"context"
+	"os/exec"
+)
+
+// CommandRunner runs an external command and returns its combined output.
+// It allows the nft invocations to be replaced in tests.
+type CommandRunner interface {
+	Run(ctx context.Context, name string, args ...string) ([]byte, error)
+}
+
+type workDirKey struct{}
+
+// withWorkDir sets the working directory of commands run with the context.
+func withWorkDir(ctx context.Context, dir string) context.Context {
+	return context.WithValue(ctx, workDirKey{}, dir)
+}
+
+// workDir returns the working directory set by withWorkDir, empty if none.
+func workDir(ctx context.Context) string {
+	dir, _ := ctx.Value(workDirKey{}).(string)
+	return dir
+}
+
+type execRunner struct{}
+
+func (execRunner) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = workDir(ctx)
+	return cmd.CombinedOutput()
+}
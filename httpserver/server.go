@@ -3,15 +3,56 @@ package httpserver
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log/slog"
+	"math"
+	"net"
 	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
 	"time"
 
 	"github.com/flashbots/go-utils/httplogger"
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 	"go.uber.org/atomic"
 )
 
+// DefaultResponseHeaders are set on every response unless overridden. The
+// state changes at any time, so responses must not be cached.
+var DefaultResponseHeaders = map[string]string{
+	"X-Content-Type-Options": "nosniff",
+	"Cache-Control":          "no-store",
+}
+
+const (
+	DefaultIdleTimeout        = 120 * time.Second
+	DefaultReadHeaderTimeout  = 10 * time.Second
+	DefaultTCPKeepAlive       = 30 * time.Second
+	DefaultMaxHeaderBytes     = 64 << 10
+	DefaultNotReadyRetryAfter = 5 * time.Second
+)
+
+var (
+	errNotReady     = errors.New("not ready")
+	errShuttingDown = errors.New("shutting down")
+)
+
+// Reasons of a shutdown, see ShutdownSignal for signals. The reason is logged
+// and sent in the final event of the event streams, to tell planned shutdowns
+// from crashes.
+const (
+	ShutdownExplicit        = "explicit"
+	ShutdownContextCanceled = "context_canceled"
+)
+
+// ShutdownSignal is the shutdown reason for a received signal, e.g.
+// "signal terminated".
+func ShutdownSignal(sig os.Signal) string {
+	return "signal " + sig.String()
+}
+
 type HTTPServerConfig struct {
 	ListenAddr string
 	Log        *slog.Logger
@@ -20,31 +61,164 @@ type HTTPServerConfig struct {
 	GracefulShutdownDuration time.Duration
 	ReadTimeout              time.Duration
 	WriteTimeout             time.Duration
+
+	// Defaults are used for the following if unset
+	IdleTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	TCPKeepAlive      time.Duration // Negative disables TCP keep-alive
+	MaxHeaderBytes    int           // Larger request headers are rejected with 431
+
+	// IdentityHeader names a header carrying the authenticated user, set by a
+	// reverse proxy (e.g. X-Forwarded-User). It is only honored for requests
+	// from TrustedProxies, otherwise the client address is used for auditing.
+	IdentityHeader string
+	TrustedProxies []string // CIDRs
+
+	// ReadAllowedCIDRs and ControlAllowedCIDRs restrict the client addresses
+	// of read-only (e.g. status and health) and control (e.g. transition, or
+	// sensitive reads like the applied rulesets) endpoints. Other clients are
+	// rejected with 403. Optional - all clients are allowed if empty.
+	ReadAllowedCIDRs    []string
+	ControlAllowedCIDRs []string
+
+	// StartupWarmupDuration keeps /readyz reporting not-ready for this long
+	// after the listener is up, so dependent systems don't route to a freshly
+	// started instance right away. Optional - zero is ready immediately.
+	StartupWarmupDuration time.Duration
+
+	// ResponseHeaders are set on every response, on top of
+	// DefaultResponseHeaders. An empty value removes a default header.
+	ResponseHeaders map[string]string
+
+	// RejectWhileNotReady responds with 503 and Retry-After to all requests
+	// except health checks while /readyz reports not ready, i.e.
+	// during the startup apply and warm-up and once shutdown has begun.
+	// NotReadyRetryAfter is used for Retry-After. Optional -
+	// DefaultNotReadyRetryAfter is used if zero.
+	RejectWhileNotReady bool
+	NotReadyRetryAfter  time.Duration
+
+	// RedirectTrailingSlash redirects paths with a trailing slash to the
+	// route without it, and CaseInsensitivePaths matches routes regardless of
+	// case, for proxies normalizing paths. Both are disabled by default, i.e.
+	// such paths are not found.
+	RedirectTrailingSlash bool
+	CaseInsensitivePaths  bool
+
+	// AuthTokens requires one of the bearer tokens for control (mutating and
+	// sensitive) endpoints, responding with 401 otherwise. Each token maps to
+	// the modes it may trigger (maintenance, production or lockdown, which
+	// covers the reset too), others are rejected with 403. An empty list
+	// allows all. Optional - no authentication if empty.
+	AuthTokens map[string][]string
+	// AuthToken is a bearer token allowed to trigger all modes, in addition
+	// to AuthTokens. Optional.
+	AuthToken string
+	// ProtectStatus requires a token for /firewall/status too, if
+	// authentication is enabled. Public by default.
+	ProtectStatus bool
+
+	EnablePprof bool // Serve net/http/pprof under /debug/pprof
+	Debug       bool // Serve debug endpoints, e.g. /firewall/routes
+
+	Firewall FirewallConfig
 }
 
 type Server struct {
 	cfg     *HTTPServerConfig
 	isReady atomic.Bool
-	log     *slog.Logger
+	// shuttingDown is set at the start of Shutdown, from then on mutating
+	// requests are rejected so they can't race the shutdown.
+	shuttingDown atomic.Bool
+	log          *slog.Logger
 
 	srv     *http.Server
+	router  chi.Routes
 	handler *FirewallHandler
+	tasks   *taskGroup
+	now     func() time.Time
+	readyAt time.Time    // Set by RunInBackground
+	conns   atomic.Int64 // Open connections, reported if force-closed on shutdown
+	streams *eventStreams
+
+	trustedProxies []netip.Prefix
+	readAllowed    []netip.Prefix
+	controlAllowed []netip.Prefix
+	authTokens     []authToken
+
+	untrustedIdentities untrustedIdentitySources // Warned about once
 }
 
 func New(cfg *HTTPServerConfig) (srv *Server, err error) {
+	if cfg.IdleTimeout == 0 {
+		cfg.IdleTimeout = DefaultIdleTimeout
+	}
+	if cfg.NotReadyRetryAfter == 0 {
+		cfg.NotReadyRetryAfter = DefaultNotReadyRetryAfter
+	}
+	if cfg.ReadHeaderTimeout == 0 {
+		cfg.ReadHeaderTimeout = DefaultReadHeaderTimeout
+	}
+	if cfg.TCPKeepAlive == 0 {
+		cfg.TCPKeepAlive = DefaultTCPKeepAlive
+	}
+	if cfg.MaxHeaderBytes == 0 {
+		cfg.MaxHeaderBytes = DefaultMaxHeaderBytes
+	}
+
+	trustedProxies, err := parseCIDRs(cfg.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trusted proxies: %w", err)
+	}
+	readAllowed, err := parseCIDRs(cfg.ReadAllowedCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid read allowlist: %w", err)
+	}
+	controlAllowed, err := parseCIDRs(cfg.ControlAllowedCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid control allowlist: %w", err)
+	}
+
+	authTokens, err := parseAuthTokens(cfg.AuthTokens)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.AuthToken != "" {
+		if _, ok := cfg.AuthTokens[cfg.AuthToken]; ok {
+			return nil, errors.New("invalid auth token: also configured as a scoped auth token")
+		}
+		authTokens = append(authTokens, authToken{token: []byte(cfg.AuthToken)})
+	}
+
+	handler, err := NewFirewallHandler(cfg.Log, cfg.Firewall)
+	if err != nil {
+		return nil, err
+	}
+
 	srv = &Server{
 		cfg:     cfg,
 		log:     cfg.Log,
 		srv:     nil,
-		handler: NewFirewallHandler(cfg.Log, FirewallConfig{TransitionDuration: 5 * time.Minute}),
+		handler: handler,
+		tasks:   newTaskGroup(handler.crashGuard),
+		now:     time.Now,
+		streams: newEventStreams(),
+
+		trustedProxies: trustedProxies,
+		readAllowed:    readAllowed,
+		controlAllowed: controlAllowed,
+		authTokens:     authTokens,
 	}
-	srv.isReady.Swap(true)
 
 	srv.srv = &http.Server{
-		Addr:         cfg.ListenAddr,
-		Handler:      srv.getRouter(),
-		ReadTimeout:  cfg.ReadTimeout,
-		WriteTimeout: cfg.WriteTimeout,
+		Addr:              cfg.ListenAddr,
+		Handler:           srv.getRouter(),
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+		ConnState:         srv.trackConn,
 	}
 
 	return srv, nil
@@ -53,35 +227,192 @@ func New(cfg *HTTPServerConfig) (srv *Server, err error) {
 func (srv *Server) getRouter() http.Handler {
 	mux := chi.NewRouter()
 
+	mux.Use(srv.setResponseHeaders)
+	if srv.cfg.CaseInsensitivePaths {
+		mux.Use(caseInsensitivePaths)
+	}
+	if srv.cfg.RedirectTrailingSlash {
+		mux.Use(redirectTrailingSlash)
+	}
+
 	// Never serve at `/` (root) path
-	mux.With(srv.httpLogger).Get("/firewall/status", srv.handler.handleStatus)
-	mux.With(srv.httpLogger).Get("/firewall/maintenance", srv.handler.handleMaintenance)
-	mux.With(srv.httpLogger).Get("/firewall/production", srv.handler.handleProduction)
+	for _, rt := range srv.enabledRoutes() {
+		r := mux.With(srv.httpLogger, srv.identify, srv.recoverPanics, rejectMalformedQuery)
+		if rt.Streaming {
+			r = mux.With(srv.identify, srv.recoverPanics, rejectMalformedQuery)
+		}
+		control := rt.Mutating || rt.Sensitive
+		if control && len(srv.controlAllowed) > 0 {
+			r = r.With(srv.allowSources(srv.controlAllowed, "control"))
+		} else if !control && len(srv.readAllowed) > 0 {
+			r = r.With(srv.allowSources(srv.readAllowed, "read"))
+		}
+		protectedStatus := srv.cfg.ProtectStatus && rt.Path == "/firewall/status"
+		if (control || protectedStatus) && len(srv.authTokens) > 0 {
+			r = r.With(srv.authenticate(rt.Scope))
+		} else if rt.Path == "/firewall/status" && len(srv.authTokens) > 0 {
+			// The status page offers transitions to authenticated clients
+			r = r.With(srv.identifyToken)
+		}
+		if rt.Mutating {
+			r = r.With(srv.rejectWhileShuttingDown)
+		}
+		if rt.Mutating && !rt.ServeWhenNotReady {
+			r = r.With(srv.rejectWhileInitializing)
+		}
+		if srv.cfg.RejectWhileNotReady && !rt.ServeWhenNotReady {
+			r = r.With(srv.rejectWhileNotReady)
+		}
+		r.Method(rt.Method, rt.Path, rt.Handler)
+	}
+	if srv.cfg.EnablePprof {
+		// Guarded like sensitive routes, profiles expose the process memory
+		r := mux.With(srv.identify, srv.recoverPanics)
+		if len(srv.controlAllowed) > 0 {
+			r = r.With(srv.allowSources(srv.controlAllowed, "control"))
+		}
+		if len(srv.authTokens) > 0 {
+			r = r.With(srv.authenticate(""))
+		}
+		r.Mount("/debug", middleware.Profiler())
+	}
 
+	srv.router = mux
 	return mux
 }
 
+func (srv *Server) setResponseHeaders(next http.Handler) http.Handler {
+	headers := make(map[string]string, len(DefaultResponseHeaders)+len(srv.cfg.ResponseHeaders))
+	for _, h := range []map[string]string{DefaultResponseHeaders, srv.cfg.ResponseHeaders} {
+		for name, value := range h {
+			headers[http.CanonicalHeaderKey(name)] = value
+		}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for name, value := range headers {
+			if value != "" {
+				w.Header().Set(name, value)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (srv *Server) httpLogger(next http.Handler) http.Handler {
 	return httplogger.LoggingMiddlewareSlog(srv.log, next)
 }
 
 func (srv *Server) RunInBackground() {
+	srv.readyAt = srv.now().Add(srv.cfg.StartupWarmupDuration)
+	srv.tasks.Go(srv.handler.Initialize)
+
 	// api
-	go func() {
+	srv.tasks.Go(func(context.Context) {
 		srv.log.Info("Starting HTTP server", "listenAddress", srv.cfg.ListenAddr)
-		if err := srv.srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		lc := net.ListenConfig{KeepAlive: srv.cfg.TCPKeepAlive}
+		ln, err := lc.Listen(context.Background(), "tcp", srv.cfg.ListenAddr)
+		if err != nil {
+			srv.log.Error("HTTP server failed to listen", "err", err)
+			return
+		}
+		if err := srv.srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			srv.log.Error("HTTP server failed", "err", err)
 		}
-	}()
+	})
 }
 
-func (srv *Server) Shutdown() {
-	// api
+// Run serves until the context is done, then shuts down.
+func (srv *Server) Run(ctx context.Context) {
+	srv.RunInBackground()
+	<-ctx.Done()
+	srv.log.Info("Context done", "cause", context.Cause(ctx))
+	srv.Shutdown(ShutdownContextCanceled)
+}
+
+// rejectWhileNotReady responds with 503 while not ready.
+func (srv *Server) rejectWhileNotReady(next http.Handler) http.Handler {
+	retryAfter := strconv.Itoa(int(math.Ceil(srv.cfg.NotReadyRetryAfter.Seconds())))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !srv.ready() {
+			w.Header().Set("Retry-After", retryAfter)
+			srv.handler.reject(w, http.StatusServiceUnavailable, NotReady, errNotReady)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rejectWhileShuttingDown responds with 503 once shutdown has begun.
+func (srv *Server) rejectWhileShuttingDown(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if srv.shuttingDown.Load() {
+			srv.handler.reject(w, http.StatusServiceUnavailable, NotReady, errShuttingDown)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rejectWhileInitializing responds with 503 until the startup apply
+// completed, with Retry-After estimating when.
+func (srv *Server) rejectWhileInitializing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := srv.handler.checkInitializing(); err != nil {
+			srv.handler.writeTransitionError(w, err)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// trackConn counts the open connections.
+func (srv *Server) trackConn(_ net.Conn, state http.ConnState) {
+	switch state { //nolint:exhaustive
+	case http.StateNew:
+		srv.conns.Inc()
+	case http.StateHijacked, http.StateClosed:
+		srv.conns.Dec()
+	}
+}
+
+// Shutdown gracefully stops the server, force-closing connections still open
+// after GracefulShutdownDuration. Event streams are ended with a shutdown
+// event first, within the same bound.
+func (srv *Server) Shutdown(reason string) {
+	if reason == "" {
+		reason = ShutdownExplicit
+	}
+	srv.shuttingDown.Store(true)
+	srv.log.Info("Shutting down", "reason", reason)
+
+	if srv.cfg.Firewall.MaintenanceOnShutdown {
+		srv.log.Info("Transitioning to maintenance before shutdown")
+		ctx, cancel := context.WithTimeout(context.Background(), srv.cfg.GracefulShutdownDuration)
+		if err := srv.handler.EnterMaintenance(ctx); err != nil {
+			srv.log.Error("Maintenance transition on shutdown failed", "err", err)
+		}
+		cancel()
+	}
+
+	// api, after ending the event streams, which never become idle
 	ctx, cancel := context.WithTimeout(context.Background(), srv.cfg.GracefulShutdownDuration)
 	defer cancel()
+	if err := srv.streams.drain(ctx, reason); err != nil {
+		srv.log.Error("Event streams did not end in time", "err", err)
+	}
 	if err := srv.srv.Shutdown(ctx); err != nil {
-		srv.log.Error("Graceful HTTP server shutdown failed", "err", err)
+		// Don't hang on stuck connections, so the process can exit
+		srv.log.Error("Graceful HTTP server shutdown failed, force-closing connections", "err", err, "connections", srv.conns.Load())
+		if err := srv.srv.Close(); err != nil {
+			srv.log.Error("Force-closing the HTTP server failed", "err", err)
+		}
 	} else {
 		srv.log.Info("HTTP server gracefully stopped")
 	}
+
+	// Background tasks must not outlive the server, e.g. a pending transition
+	// completing after shutdown.
+	srv.tasks.Stop()
+	srv.handler.Close()
+	srv.log.Info("Shutdown complete", "reason", reason)
 }
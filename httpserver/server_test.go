@@ -0,0 +1,487 @@
+package httpserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServerConfig() *HTTPServerConfig {
+	return &HTTPServerConfig{
+		ListenAddr: "127.0.0.1:0",
+		Log:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+
+		GracefulShutdownDuration: time.Second,
+		ReadTimeout:              time.Second,
+		WriteTimeout:             time.Second,
+	}
+}
+
+// newTestServer creates a server with a fake runner. Transitions are
+// immediate unless the config has a transition duration.
+func newTestServer(t *testing.T, cfg *HTTPServerConfig) *Server {
+	t.Helper()
+	cfg.Firewall.ImmediateTransition = cfg.Firewall.TransitionDuration == 0
+	srv, err := New(cfg)
+	require.NoError(t, err)
+	srv.handler.runner = newFakeRunner()
+	return srv
+}
+
+func TestServerTimeouts(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		srv, err := New(newTestServerConfig())
+		require.NoError(t, err)
+		require.Equal(t, DefaultIdleTimeout, srv.srv.IdleTimeout)
+		require.Equal(t, DefaultReadHeaderTimeout, srv.srv.ReadHeaderTimeout)
+		require.Equal(t, DefaultTCPKeepAlive, srv.cfg.TCPKeepAlive)
+		require.Equal(t, DefaultMaxHeaderBytes, srv.srv.MaxHeaderBytes)
+	})
+
+	t.Run("configured", func(t *testing.T) {
+		cfg := newTestServerConfig()
+		cfg.IdleTimeout = 7 * time.Second
+		cfg.ReadHeaderTimeout = 3 * time.Second
+		cfg.TCPKeepAlive = -1
+
+		srv, err := New(cfg)
+		require.NoError(t, err)
+		require.Equal(t, time.Second, srv.srv.ReadTimeout)
+		require.Equal(t, time.Second, srv.srv.WriteTimeout)
+		require.Equal(t, 7*time.Second, srv.srv.IdleTimeout)
+		require.Equal(t, 3*time.Second, srv.srv.ReadHeaderTimeout)
+		require.Equal(t, time.Duration(-1), srv.cfg.TCPKeepAlive)
+	})
+}
+
+func TestOpenAPISpec(t *testing.T) {
+	cfg := newTestServerConfig()
+	cfg.Firewall.ExperimentalFeatures = map[string]bool{"batch": true}
+	cfg.Debug = true
+	srv := newTestServer(t, cfg)
+
+	rr := httptest.NewRecorder()
+	srv.getRouter().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/firewall/openapi.json", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var spec struct {
+		OpenAPI string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &spec))
+	require.Equal(t, "3.0.3", spec.OpenAPI)
+
+	for _, rt := range srv.routes() {
+		require.Contains(t, spec.Paths, rt.Path)
+		require.Contains(t, spec.Paths[rt.Path], strings.ToLower(rt.Method))
+	}
+	require.Contains(t, spec.Paths, "/firewall/status")
+	require.Contains(t, spec.Paths["/firewall/batch"], "post")
+	require.Contains(t, string(spec.Paths["/firewall/batch"]["post"]), `"continue_on_error"`)
+	for _, status := range []string{`"202"`, `"401"`, `"403"`, `"409"`, `"429"`, `"500"`, `"503"`} {
+		require.Contains(t, string(spec.Paths["/firewall/maintenance"]["post"]), status)
+	}
+}
+
+func TestOpenAPIMergedResponses(t *testing.T) {
+	res := openAPIResponses([]response{
+		{Status: http.StatusBadRequest, Description: "Invalid wait parameter", ContentType: "text/plain"},
+		{Status: http.StatusBadRequest, Description: "Reason required", ContentType: "application/json", Body: ErrorResponse{}},
+		{Status: http.StatusBadRequest, Description: "Invalid wait parameter", ContentType: "text/plain"},
+		{Status: http.StatusOK, Description: "Started"},
+	})
+	badRequest := res["400"].(map[string]any)
+	require.Equal(t, "Invalid wait parameter; Reason required", badRequest["description"])
+	require.Len(t, badRequest["content"], 2)
+	require.Equal(t, "Started", res["200"].(map[string]any)["description"])
+}
+
+func TestMaintenanceOnShutdown(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		srv := newTestServer(t, newTestServerConfig())
+		srv.handler.mode = Production
+
+		srv.Shutdown(ShutdownExplicit)
+		require.Equal(t, Production, srv.handler.mode)
+		require.Empty(t, testRunner(srv.handler).Calls())
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		cfg := newTestServerConfig()
+		cfg.Firewall.MaintenanceOnShutdown = true
+		cfg.Firewall.TransitionDuration = 10 * time.Millisecond
+		srv := newTestServer(t, cfg)
+		srv.handler.mode = Production
+
+		srv.Shutdown(ShutdownExplicit)
+		require.Equal(t, Maintenance, srv.handler.mode)
+		require.Equal(t, []string{
+			"/usr/sbin/nft --echo --handle -f /etc/nftables-transition.conf",
+			"/usr/sbin/nft -f /etc/nftables-maintenance.conf",
+		}, testRunner(srv.handler).Calls())
+	})
+
+	t.Run("bounded by graceful shutdown duration", func(t *testing.T) {
+		cfg := newTestServerConfig()
+		cfg.Firewall.MaintenanceOnShutdown = true
+		cfg.Firewall.TransitionDuration = time.Hour
+		cfg.GracefulShutdownDuration = 10 * time.Millisecond
+		srv := newTestServer(t, cfg)
+		srv.handler.mode = Production
+
+		srv.Shutdown(ShutdownExplicit)
+		require.Equal(t, Maintenance, srv.handler.mode)
+	})
+}
+
+func TestExperimentalFeatureFlag(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		cfg := newTestServerConfig()
+		cfg.Firewall.ExperimentalFeatures = map[string]bool{"batch": enabled, "typo": true}
+		srv := newTestServer(t, cfg)
+		router := srv.getRouter()
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/firewall/batch", strings.NewReader(`{"operations": [{"op": "status"}]}`)))
+		if enabled {
+			require.Equal(t, http.StatusOK, rr.Code)
+		} else {
+			require.Equal(t, http.StatusNotFound, rr.Code)
+		}
+
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/firewall/openapi.json", nil))
+		require.Equal(t, enabled, strings.Contains(rr.Body.String(), "/firewall/batch"))
+	}
+}
+
+func TestShutdownAwaitsBackgroundTasks(t *testing.T) {
+	cfg := newTestServerConfig()
+	cfg.ListenAddr = "127.0.0.1:0"
+	cfg.Firewall.TransitionDuration = 50 * time.Millisecond
+	srv := newTestServer(t, cfg)
+	srv.handler.mode = Production
+
+	srv.RunInBackground()
+	srv.handler.lock.Lock()
+	require.NoError(t, srv.handler.transitionToMaintenance("test"))
+	srv.handler.lock.Unlock()
+	require.EqualValues(t, 1, srv.handler.tasks.running.Load())
+	require.Eventually(t, func() bool { return srv.tasks.running.Load() == 1 }, time.Second, time.Millisecond) // Only the listener is left
+
+	srv.Shutdown(ShutdownExplicit)
+	require.Zero(t, srv.tasks.running.Load())
+	require.Zero(t, srv.handler.tasks.running.Load())
+
+	// The pending transition must not complete after shutdown.
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, TransitionToMaintenance, srv.handler.mode)
+	require.NotContains(t, testRunner(srv.handler).Calls(), "/usr/sbin/nft -f /etc/nftables-maintenance.conf")
+}
+
+// lockedBuffer is a bytes.Buffer safe for concurrent logging.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestShutdownReason(t *testing.T) {
+	t.Run("signal", func(t *testing.T) {
+		var logs lockedBuffer
+		cfg := newTestServerConfig()
+		cfg.Log = slog.New(slog.NewTextHandler(&logs, nil))
+		srv := newTestServer(t, cfg)
+
+		srv.Shutdown(ShutdownSignal(syscall.SIGTERM))
+		require.Contains(t, logs.String(), `msg="Shutdown complete" reason="signal terminated"`)
+	})
+
+	t.Run("context canceled", func(t *testing.T) {
+		var logs lockedBuffer
+		cfg := newTestServerConfig()
+		cfg.Log = slog.New(slog.NewTextHandler(&logs, nil))
+		srv := newTestServer(t, cfg)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			srv.Run(ctx)
+			close(done)
+		}()
+		cancel()
+		<-done
+		require.Contains(t, logs.String(), `msg="Shutting down" reason=context_canceled`)
+		require.Contains(t, logs.String(), `msg="Shutdown complete" reason=context_canceled`)
+	})
+
+	t.Run("default", func(t *testing.T) {
+		var logs lockedBuffer
+		cfg := newTestServerConfig()
+		cfg.Log = slog.New(slog.NewTextHandler(&logs, nil))
+		srv := newTestServer(t, cfg)
+
+		srv.Shutdown("")
+		require.Contains(t, logs.String(), `msg="Shutdown complete" reason=explicit`)
+	})
+}
+
+func TestShutdownForceClosesHungConnections(t *testing.T) {
+	cfg := newTestServerConfig()
+	cfg.GracefulShutdownDuration = 50 * time.Millisecond
+	srv := newTestServer(t, cfg)
+
+	hung := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	srv.srv.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(hung)
+		<-release
+	})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go srv.srv.Serve(ln) //nolint:errcheck
+
+	requestErr := make(chan error, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String() + "/")
+		if err == nil {
+			resp.Body.Close()
+		}
+		requestErr <- err
+	}()
+	<-hung
+	require.EqualValues(t, 1, srv.conns.Load())
+
+	done := make(chan struct{})
+	go func() {
+		srv.Shutdown(ShutdownExplicit)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown hung on the open connection")
+	}
+	require.Error(t, <-requestErr)
+}
+
+func TestStartupWarmup(t *testing.T) {
+	readyz := func(srv *Server) int {
+		rr := httptest.NewRecorder()
+		srv.handleReadyz(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return rr.Code
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		cfg := newTestServerConfig()
+		cfg.ListenAddr = "127.0.0.1:0"
+		srv := newTestServer(t, cfg)
+		require.Equal(t, http.StatusServiceUnavailable, readyz(srv))
+
+		srv.RunInBackground()
+		defer srv.Shutdown(ShutdownExplicit)
+		require.Equal(t, http.StatusOK, readyz(srv))
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		cfg := newTestServerConfig()
+		cfg.ListenAddr = "127.0.0.1:0"
+		cfg.StartupWarmupDuration = time.Minute
+		srv := newTestServer(t, cfg)
+		clock := newFakeClock()
+		srv.now = clock.Now
+
+		srv.RunInBackground()
+		defer srv.Shutdown(ShutdownExplicit)
+		require.Equal(t, http.StatusServiceUnavailable, readyz(srv))
+
+		clock.Advance(59 * time.Second)
+		require.Equal(t, http.StatusServiceUnavailable, readyz(srv))
+		require.False(t, srv.isReady.Load())
+
+		clock.Advance(time.Second)
+		require.Equal(t, http.StatusOK, readyz(srv))
+		require.True(t, srv.isReady.Load())
+	})
+}
+
+func TestRejectWhileNotReady(t *testing.T) {
+	cfg := newTestServerConfig()
+	cfg.ListenAddr = "127.0.0.1:0"
+	cfg.StartupWarmupDuration = time.Minute
+	cfg.RejectWhileNotReady = true
+	srv := newTestServer(t, cfg)
+	clock := newFakeClock()
+	srv.now = clock.Now
+	router := srv.getRouter()
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(method, path, nil))
+		return rr
+	}
+	get := func(path string) *httptest.ResponseRecorder {
+		return serve(http.MethodGet, path)
+	}
+
+	srv.RunInBackground()
+	for _, rt := range []struct{ method, path string }{
+		{http.MethodGet, "/firewall/status"},
+		{http.MethodPost, "/firewall/maintenance"},
+		{http.MethodPost, "/firewall/production"},
+	} {
+		rr := serve(rt.method, rt.path)
+		require.Equal(t, http.StatusServiceUnavailable, rr.Code, rt.path)
+		require.Equal(t, "5", rr.Header().Get("Retry-After"), rt.path)
+	}
+	require.Equal(t, "maintenance", getStatusJSON(t, srv.handler).Mode)
+	require.Equal(t, http.StatusOK, get("/livez").Code)
+	require.Equal(t, http.StatusServiceUnavailable, get("/readyz").Code)
+
+	clock.Advance(time.Minute)
+	require.Equal(t, http.StatusOK, get("/firewall/status").Code)
+	require.Equal(t, http.StatusOK, serve(http.MethodPost, "/firewall/production").Code)
+
+	// Not ready again once shutdown has begun
+	srv.Shutdown(ShutdownExplicit)
+	require.Equal(t, http.StatusServiceUnavailable, get("/firewall/status").Code)
+	require.Equal(t, http.StatusServiceUnavailable, get("/readyz").Code)
+	require.Equal(t, "production", getStatusJSON(t, srv.handler).Mode)
+}
+
+func TestRejectTransitionsDuringShutdown(t *testing.T) {
+	cfg := newTestServerConfig()
+	cfg.Firewall.MaintenanceOnShutdown = true
+	cfg.Firewall.TransitionDuration = 100 * time.Millisecond
+	srv := newTestServer(t, cfg)
+	srv.handler.mode = Production
+
+	done := make(chan struct{})
+	go func() {
+		srv.Shutdown(ShutdownExplicit)
+		close(done)
+	}()
+	require.Eventually(t, srv.shuttingDown.Load, time.Second, time.Millisecond)
+
+	rr := httptest.NewRecorder()
+	srv.srv.Handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/firewall/production", nil))
+	require.Equal(t, http.StatusServiceUnavailable, rr.Code)
+
+	rr = httptest.NewRecorder()
+	srv.srv.Handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/firewall/status", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	<-done
+	require.Equal(t, Maintenance, srv.handler.mode)
+}
+
+func TestResponseHeaders(t *testing.T) {
+	cfg := newTestServerConfig()
+	cfg.ResponseHeaders = map[string]string{
+		"x-frame-options":        "DENY",
+		"X-Content-Type-Options": "",
+	}
+	srv := newTestServer(t, cfg)
+
+	for _, path := range []string{"/firewall/status", "/firewall/history", "/not-found"} {
+		rr := httptest.NewRecorder()
+		srv.srv.Handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		require.Equal(t, "no-store", rr.Header().Get("Cache-Control"), path)
+		require.Equal(t, "DENY", rr.Header().Get("X-Frame-Options"), path)
+	}
+
+	// http.Error always sets nosniff, so check removal on a successful response
+	rr := httptest.NewRecorder()
+	srv.srv.Handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/firewall/status", nil))
+	require.Empty(t, rr.Header().Values("X-Content-Type-Options"))
+
+	srv = newTestServer(t, newTestServerConfig())
+	rr = httptest.NewRecorder()
+	srv.srv.Handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/firewall/status", nil))
+	require.Equal(t, "nosniff", rr.Header().Get("X-Content-Type-Options"))
+}
+
+func TestRoutesEndpoint(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		srv := newTestServer(t, newTestServerConfig())
+		rr := httptest.NewRecorder()
+		srv.srv.Handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/firewall/routes", nil))
+		require.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		cfg := newTestServerConfig()
+		cfg.Debug = true
+		srv := newTestServer(t, cfg)
+		rr := httptest.NewRecorder()
+		srv.srv.Handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/firewall/routes", nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var routes []RouteInfo
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &routes))
+		require.Contains(t, routes, RouteInfo{Method: http.MethodGet, Path: "/firewall/status"})
+		require.Contains(t, routes, RouteInfo{Method: http.MethodGet, Path: "/firewall/routes"})
+		require.Contains(t, routes, RouteInfo{Method: http.MethodPost, Path: "/firewall/reapply"})
+
+		// Neither pprof nor experimental features are enabled
+		for _, rt := range routes {
+			require.NotEqual(t, "/firewall/batch", rt.Path)
+			require.False(t, strings.HasPrefix(rt.Path, "/debug/"), rt.Path)
+		}
+	})
+
+	t.Run("pprof", func(t *testing.T) {
+		cfg := newTestServerConfig()
+		cfg.Debug = true
+		cfg.EnablePprof = true
+		srv := newTestServer(t, cfg)
+		rr := httptest.NewRecorder()
+		srv.srv.Handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/firewall/routes", nil))
+		require.Contains(t, rr.Body.String(), `"path":"/debug/pprof/profile"`)
+	})
+}
+
+func TestTransitionsRequirePost(t *testing.T) {
+	srv := newTestServer(t, newTestServerConfig())
+	t.Cleanup(srv.handler.Close)
+	srv.handler.mode = Production
+	router := srv.getRouter()
+
+	for _, path := range []string{"/firewall/maintenance", "/firewall/production"} {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		require.Equal(t, http.StatusMethodNotAllowed, rr.Code, path)
+		require.Equal(t, http.MethodPost, rr.Header().Get("Allow"), path)
+	}
+	require.Equal(t, "production", getStatusJSON(t, srv.handler).Mode)
+	require.Empty(t, testRunner(srv.handler).Calls())
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/firewall/maintenance", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Equal(t, "maintenance", getStatusJSON(t, srv.handler).Mode)
+}
@@ -0,0 +1,65 @@
+package httpserver
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const DefaultSnapshotRetention = 20
+
+const (
+	snapshotPrefix = "ruleset-"
+	snapshotSuffix = ".nft"
+)
+
+// snapshotRuleset saves the live ruleset (`nft list ruleset`) before applying
+// the rules of the given mode, if enabled, and removes the oldest snapshots
+// beyond SnapshotRetention. A failed snapshot is only logged, it never blocks
+// an apply. Must be called with the lock held.
+func (h *FirewallHandler) snapshotRuleset(fm FirewallMode) {
+	if h.config.SnapshotDir == "" {
+		return
+	}
+
+	output, err := h.runner.Run(context.Background(), h.config.NFTBinary, "list", "ruleset")
+	if err != nil {
+		h.log.Warn("could not snapshot the ruleset", "mode", fm, "error", err, "output", output)
+		return
+	}
+	// Sorts chronologically, the generation keeps names unique
+	name := fmt.Sprintf("%s%s-%d-%s%s", snapshotPrefix, h.now().UTC().Format("20060102T150405.000000000Z"), h.generation, fm, snapshotSuffix)
+	path := filepath.Join(h.config.SnapshotDir, name)
+	if err := writeFileAtomic(path, output, 0o600); err != nil {
+		h.log.Warn("could not snapshot the ruleset", "mode", fm, "path", path, "error", err)
+		return
+	}
+	h.log.Info("saved ruleset snapshot", "mode", fm, "path", path)
+	h.pruneSnapshots()
+}
+
+// pruneSnapshots removes the oldest snapshots beyond SnapshotRetention.
+func (h *FirewallHandler) pruneSnapshots() {
+	entries, err := os.ReadDir(h.config.SnapshotDir)
+	if err != nil {
+		h.log.Warn("could not list ruleset snapshots", "dir", h.config.SnapshotDir, "error", err)
+		return
+	}
+	var snapshots []string
+	for _, entry := range entries {
+		if name := entry.Name(); entry.Type().IsRegular() && strings.HasPrefix(name, snapshotPrefix) && strings.HasSuffix(name, snapshotSuffix) {
+			snapshots = append(snapshots, name)
+		}
+	}
+	slices.Sort(snapshots)
+	for len(snapshots) > h.config.SnapshotRetention {
+		path := filepath.Join(h.config.SnapshotDir, snapshots[0])
+		if err := os.Remove(path); err != nil {
+			h.log.Warn("could not remove ruleset snapshot", "path", path, "error", err)
+		}
+		snapshots = snapshots[1:]
+	}
+}
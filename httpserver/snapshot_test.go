@@ -0,0 +1,70 @@
+package httpserver
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotRuleset(t *testing.T) {
+	t.Run("before apply", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "snapshots")
+		h := newTestHandler(t, FirewallConfig{SnapshotDir: dir}, newFakeClock())
+		testRunner(h).Output("ruleset", []byte("table inet before {}\n"))
+		// The snapshot is kept even if the apply fails
+		testRunner(h).Fail("/etc/nftables-production.conf", errFake)
+
+		h.lock.Lock()
+		require.Error(t, h.applyNFTables(Production))
+		h.lock.Unlock()
+
+		require.Equal(t, []string{
+			"/usr/sbin/nft list ruleset",
+			"/usr/sbin/nft -f /etc/nftables-production.conf",
+		}, testRunner(h).Calls())
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		require.Equal(t, "ruleset-20240101T000000.000000000Z-0-production.nft", entries[0].Name())
+		content, err := os.ReadFile(filepath.Join(dir, entries[0].Name()))
+		require.NoError(t, err)
+		require.Equal(t, "table inet before {}\n", string(content))
+	})
+
+	t.Run("retention", func(t *testing.T) {
+		dir := t.TempDir()
+		clock := newFakeClock()
+		h := newTestHandler(t, FirewallConfig{SnapshotDir: dir, SnapshotRetention: 2}, clock)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "unrelated"), nil, 0o600))
+
+		h.lock.Lock()
+		for _, fm := range []FirewallMode{Production, Maintenance, Production} {
+			require.NoError(t, h.applyNFTables(fm))
+			clock.Advance(time.Second)
+		}
+		h.lock.Unlock()
+
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		names := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		require.Equal(t, []string{
+			"ruleset-20240101T000001.000000000Z-1-maintenance.nft",
+			"ruleset-20240101T000002.000000000Z-2-production.nft",
+			"unrelated",
+		}, names)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		h := newTestHandler(t, FirewallConfig{}, nil)
+		h.lock.Lock()
+		require.NoError(t, h.applyNFTables(Production))
+		h.lock.Unlock()
+		require.Equal(t, []string{"/usr/sbin/nft -f /etc/nftables-production.conf"}, testRunner(h).Calls())
+	})
+}
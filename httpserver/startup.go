@@ -0,0 +1,137 @@
+package httpserver
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultStartupApplyRetries = 5
+	DefaultStartupApplyBackoff = time.Second
+	maxStartupApplyBackoff     = 30 * time.Second
+)
+
+// Initialize detects the nft and kernel versions, validates the backends,
+// starts the periodic config check, the ruleset watcher, the quiet period and
+// the dead man's switch if configured, and runs the startup apply if the mode
+// is Initializing. Failed applies are retried with exponential backoff, up to
+// StartupApplyRetries times, before giving up and marking the handler as
+// degraded. Restored production is put on probation if configured.
+func (h *FirewallHandler) Initialize(ctx context.Context) {
+	h.refreshVersions(ctx)
+	h.validateBackends(ctx)
+	if h.config.ConfigCheckInterval > 0 {
+		h.tasks.Go(h.watchConfig)
+	}
+	if h.config.IdempotencyKeyTTL > 0 {
+		h.tasks.Go(h.sweepIdempotencyKeys)
+	}
+	if h.config.WatchRulesets {
+		h.tasks.Go(h.watchRulesets)
+	}
+	h.lock.Lock()
+	h.startQuietPeriod()
+	h.startHeartbeats()
+	h.lock.Unlock()
+
+	backoff := h.config.StartupApplyBackoff
+	for attempt := 0; ; attempt++ {
+		h.lock.Lock()
+		err := h.startupApply()
+		h.lock.Unlock()
+		if err == nil {
+			h.runProbation(ctx)
+			return
+		}
+
+		if attempt >= h.config.StartupApplyRetries {
+			h.log.Error("startup apply failed, giving up", "mode", h.initialMode, "attempts", attempt+1, "error", err)
+			h.lock.Lock()
+			h.degraded = true
+			h.lock.Unlock()
+			return
+		}
+		h.log.Warn("startup apply failed, retrying", "mode", h.initialMode, "attempt", attempt+1, "retry_in", backoff, "error", err)
+		h.lock.Lock()
+		h.startupRetryAt = h.now().Add(backoff)
+		h.lock.Unlock()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		h.lock.Lock()
+		h.startupRetryAt = time.Time{}
+		h.lock.Unlock()
+		backoff = min(2*backoff, maxStartupApplyBackoff)
+	}
+}
+
+// startupApply applies the rules of the initial mode and adopts it. Must be
+// called with the lock held.
+func (h *FirewallHandler) startupApply() error {
+	if h.mode != Initializing {
+		return nil
+	}
+	if err := h.applyNFTables(h.initialMode); err != nil {
+		return err
+	}
+	h.setMode(h.initialMode)
+	h.log.Info("startup apply completed", "mode", h.mode)
+	if h.mode == Production && h.probationEnabled() {
+		h.probationUntil = h.now().Add(h.config.ProbationWindow)
+		h.log.Info("production is on probation", "until", h.probationUntil)
+	}
+	return nil
+}
+
+// startupApplyHint is the assumed duration of the startup apply before any
+// apply was measured, and the Retry-After once the startup apply gave up.
+const startupApplyHint = 5 * time.Second
+
+var errInitializing = errors.New("initializing, the startup apply did not complete yet")
+
+// initializingError is returned for mutating requests before the startup
+// apply completed.
+type initializingError struct {
+	remaining time.Duration // Estimated
+}
+
+func (e *initializingError) Error() string {
+	return errInitializing.Error()
+}
+
+func (e *initializingError) Unwrap() error {
+	return errInitializing
+}
+
+// retryAfter returns the estimated time until the startup apply completes in
+// whole seconds, rounded up.
+func (e *initializingError) retryAfter() string {
+	return strconv.Itoa(int(math.Ceil(e.remaining.Seconds())))
+}
+
+// checkInitializing rejects requests until the startup apply completed, with
+// an estimate of when that happens: the time until the next attempt, if the
+// last one failed, and the duration of an apply.
+func (h *FirewallHandler) checkInitializing() error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.mode != Initializing {
+		return nil
+	}
+	if h.degraded {
+		return &rejectionError{code: NotReady, err: &initializingError{remaining: startupApplyHint}}
+	}
+	remaining := startupApplyHint
+	if d := h.lastApplyDurations[h.initialMode]; d > 0 {
+		remaining = d
+	}
+	if !h.startupRetryAt.IsZero() {
+		remaining += max(h.startupRetryAt.Sub(h.now()), 0)
+	}
+	return &rejectionError{code: NotReady, err: &initializingError{remaining: remaining}}
+}
@@ -0,0 +1,266 @@
+package httpserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyOnStartup(t *testing.T) {
+	cfg := newTestServerConfig()
+	cfg.ListenAddr = "127.0.0.1:0"
+	cfg.Firewall.ApplyOnStartup = true
+	srv := newTestServer(t, cfg)
+
+	readyz := func() int {
+		rr := httptest.NewRecorder()
+		srv.handleReadyz(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return rr.Code
+	}
+
+	require.Equal(t, "initializing", getStatusJSON(t, srv.handler).Mode)
+	require.Equal(t, http.StatusServiceUnavailable, readyz())
+
+	srv.RunInBackground()
+	defer srv.Shutdown(ShutdownExplicit)
+
+	require.Eventually(t, func() bool { return readyz() == http.StatusOK }, time.Second, 5*time.Millisecond)
+	require.Equal(t, "maintenance", getStatusJSON(t, srv.handler).Mode)
+	require.Equal(t, []string{
+		"/usr/sbin/nft --version",
+		"/usr/sbin/nft list tables",
+		"/usr/sbin/nft -f /etc/nftables-maintenance.conf",
+	}, testRunner(srv.handler).Calls())
+}
+
+func TestApplyOnStartupRestoresMode(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	h := newTestHandler(t, FirewallConfig{StateFile: stateFile}, nil)
+	h.lock.Lock()
+	require.NoError(t, h.transitionToProduction("test"))
+	h.lock.Unlock()
+
+	h = newTestHandler(t, FirewallConfig{StateFile: stateFile, ApplyOnStartup: true}, nil)
+	require.Equal(t, "initializing", getStatusJSON(t, h).Mode)
+
+	// Transitions are rejected until the startup apply completed
+	h.lock.Lock()
+	require.ErrorIs(t, h.transitionToMaintenance("test"), ErrInvalidTransition)
+	h.lock.Unlock()
+
+	h.Initialize(context.Background())
+	require.Equal(t, "production", getStatusJSON(t, h).Mode)
+	require.Equal(t, []string{
+		"/usr/sbin/nft --version",
+		"/usr/sbin/nft list tables",
+		"/usr/sbin/nft -f /etc/nftables-production.conf",
+	}, testRunner(h).Calls())
+}
+
+func TestStartupApplyRetry(t *testing.T) {
+	t.Run("succeeds on retry", func(t *testing.T) {
+		h := newTestHandler(t, FirewallConfig{ApplyOnStartup: true, StartupApplyBackoff: time.Millisecond}, nil)
+		testRunner(h).FailTimes("/etc/nftables-maintenance.conf", errFake, 2)
+
+		h.Initialize(context.Background())
+		status := getStatusJSON(t, h)
+		require.Equal(t, "maintenance", status.Mode)
+		require.False(t, status.Degraded)
+		require.Equal(t, []string{
+			"/usr/sbin/nft --version",
+			"/usr/sbin/nft list tables",
+			"/usr/sbin/nft -f /etc/nftables-maintenance.conf",
+			"/usr/sbin/nft -f /etc/nftables-maintenance.conf",
+			"/usr/sbin/nft -f /etc/nftables-maintenance.conf",
+		}, testRunner(h).Calls())
+	})
+
+	t.Run("gives up", func(t *testing.T) {
+		h := newTestHandler(t, FirewallConfig{ApplyOnStartup: true, StartupApplyRetries: 2, StartupApplyBackoff: time.Millisecond}, nil)
+		testRunner(h).Fail("/etc/nftables-maintenance.conf", errFake)
+
+		h.Initialize(context.Background())
+		status := getStatusJSON(t, h)
+		require.Equal(t, "initializing", status.Mode)
+		require.True(t, status.Degraded)
+		require.Len(t, testRunner(h).Calls(), 5)
+	})
+
+	t.Run("retries disabled", func(t *testing.T) {
+		h := newTestHandler(t, FirewallConfig{ApplyOnStartup: true, StartupApplyRetries: -1}, nil)
+		testRunner(h).Fail("/etc/nftables-maintenance.conf", errFake)
+
+		h.Initialize(context.Background())
+		require.True(t, getStatusJSON(t, h).Degraded)
+		require.Len(t, testRunner(h).Calls(), 3)
+	})
+}
+
+func TestRejectWhileInitializing(t *testing.T) {
+	cfg := newTestServerConfig()
+	cfg.Firewall.ApplyOnStartup = true
+	cfg.Firewall.StartupApplyBackoff = time.Minute
+	srv := newTestServer(t, cfg)
+	clock := newFakeClock()
+	srv.handler.now = clock.Now
+	router := srv.getRouter()
+	post := func(path, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Before the first attempt
+	rr := post("/firewall/transition", `{"mode":"production"}`)
+	require.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	require.Equal(t, "5", rr.Header().Get("Retry-After"))
+	require.Contains(t, rr.Body.String(), `"code":"not_ready"`)
+
+	// Waiting for the retry of the failed first attempt
+	testRunner(srv.handler).FailTimes("/etc/nftables-maintenance.conf", errFake, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		srv.handler.Initialize(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	require.Eventually(t, func() bool {
+		return post("/firewall/heartbeat", "").Header().Get("Retry-After") == "61"
+	}, time.Second, time.Millisecond)
+
+	// Emergencies are served regardless
+	require.Equal(t, http.StatusOK, post("/firewall/lockdown", "").Code)
+	require.Equal(t, http.StatusOK, post("/firewall/reset", "").Code)
+	require.Equal(t, http.StatusOK, post("/firewall/transition", `{"mode":"production"}`).Code)
+}
+
+func TestConfigCheckReadiness(t *testing.T) {
+	cfg := newTestServerConfig()
+	cfg.ListenAddr = "127.0.0.1:0"
+	cfg.Firewall.ConfigCheckInterval = time.Hour
+	srv := newTestServer(t, cfg)
+	srv.RunInBackground()
+	defer srv.Shutdown(ShutdownExplicit)
+
+	readyz := func() int {
+		rr := httptest.NewRecorder()
+		srv.handleReadyz(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return rr.Code
+	}
+	require.Equal(t, http.StatusOK, readyz())
+
+	// A bad config was pushed, it's only fixed after the first check
+	h := srv.handler
+	testRunner(h).FailTimes("-c", errFake, 1)
+	h.checkConfig(context.Background())
+	require.Equal(t, http.StatusServiceUnavailable, readyz())
+	require.Equal(t, errFake.Error(), getStatusJSON(t, h).ConfigError)
+	require.Contains(t, testRunner(h).Calls(), "/usr/sbin/nft -c -f /etc/nftables-maintenance.conf")
+
+	h.checkConfig(context.Background())
+	require.Equal(t, http.StatusOK, readyz())
+	require.Empty(t, getStatusJSON(t, h).ConfigError)
+}
+
+func TestReadinessWhileLocked(t *testing.T) {
+	cfg := newTestServerConfig()
+	cfg.ListenAddr = "127.0.0.1:0"
+	srv := newTestServer(t, cfg)
+
+	readyz := func() int {
+		rr := httptest.NewRecorder()
+		srv.handleReadyz(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return rr.Code
+	}
+
+	srv.RunInBackground()
+	defer srv.Shutdown(ShutdownExplicit)
+	require.Equal(t, http.StatusOK, readyz())
+
+	// The last known state is served while the lock is held, e.g. by a slow
+	// apply, instead of blocking
+	h := srv.handler
+	h.lock.Lock()
+	h.configCheckErr = errFake
+	require.Equal(t, http.StatusOK, readyz())
+	h.lock.Unlock()
+	require.Equal(t, http.StatusServiceUnavailable, readyz())
+}
+
+func TestProductionProbation(t *testing.T) {
+	// newProbationHandler returns a handler restoring production on startup
+	newProbationHandler := func(t *testing.T, clock *fakeClock) *FirewallHandler {
+		t.Helper()
+		cfg := FirewallConfig{StateFile: filepath.Join(t.TempDir(), "state.json")}
+		h := newTestHandler(t, cfg, nil)
+		h.lock.Lock()
+		require.NoError(t, h.transitionToProduction("test"))
+		h.lock.Unlock()
+
+		cfg.ApplyOnStartup = true
+		cfg.ProbationWindow = time.Hour
+		cfg.ProbationSelfTest = []string{"/usr/local/bin/self-test", "--quick"}
+		cfg.ProbationCheckInterval = time.Millisecond
+		return newTestHandler(t, cfg, clock)
+	}
+
+	t.Run("failing self-test reverts to maintenance", func(t *testing.T) {
+		h := newProbationHandler(t, nil)
+		testRunner(h).FailTimes("--quick", errFake, 1)
+
+		h.Initialize(context.Background())
+		status := getStatusJSON(t, h)
+		require.Equal(t, "maintenance", status.Mode)
+		require.Nil(t, status.ProbationUntil)
+		require.Equal(t, "probation", h.history[len(h.history)-1].RequestedBy)
+	})
+
+	t.Run("failing self-test reverts despite the dwell time", func(t *testing.T) {
+		h := newProbationHandler(t, nil)
+		h.config.MinDwell = map[FirewallMode]time.Duration{Production: time.Hour}
+		testRunner(h).FailTimes("--quick", errFake, 1)
+
+		h.Initialize(context.Background())
+		require.Equal(t, "maintenance", getStatusJSON(t, h).Mode)
+		require.Equal(t, "probation", h.history[len(h.history)-1].RequestedBy)
+	})
+
+	t.Run("ends after the window", func(t *testing.T) {
+		clock := newFakeClock()
+		h := newProbationHandler(t, clock)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			h.Initialize(ctx)
+			close(done)
+		}()
+		defer func() {
+			cancel()
+			<-done
+		}()
+
+		require.Eventually(t, func() bool {
+			return getStatusJSON(t, h).ProbationUntil != nil
+		}, time.Second, time.Millisecond)
+		clock.Advance(time.Hour)
+		require.Eventually(t, func() bool {
+			return getStatusJSON(t, h).ProbationUntil == nil
+		}, time.Second, time.Millisecond)
+
+		require.Equal(t, "production", getStatusJSON(t, h).Mode)
+		require.Contains(t, testRunner(h).Calls(), "/usr/local/bin/self-test --quick")
+	})
+}
@@ -0,0 +1,115 @@
+package httpserver
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// stateTransition is an edge of the state machine.
+type stateTransition struct {
+	From FirewallMode
+	To   FirewallMode
+	// Requestable edges are taken by transitionToMaintenance and
+	// transitionToProduction, the others only internally.
+	Requestable bool
+	Triggers    []string
+	Guards      []string // Checked before requestable edges are taken
+}
+
+// requestGuards are checked by transitionToMaintenance and
+// transitionToProduction.
+var requestGuards = []string{"if_match", "expected_mode", "min_dwell", "drift"}
+
+// transitionTable is the single source of the allowed mode changes, used by
+// the transitions and the statemachine endpoint.
+var transitionTable = []stateTransition{
+	{From: Initializing, To: Maintenance, Triggers: []string{"startup_apply", "shutdown"}},
+	{From: Initializing, To: Production, Triggers: []string{"startup_apply"}},
+	{From: Production, To: TransitionToMaintenance, Requestable: true, Triggers: []string{"request", "shutdown", "probation_failed"}, Guards: requestGuards},
+	{From: TransitionToMaintenance, To: Maintenance, Triggers: []string{"transition_duration_elapsed", "shutdown_deadline"}},
+	{From: TransitionToMaintenance, To: Production, Triggers: []string{"maintenance_apply_failed", "abort"}},
+	{From: Maintenance, To: Production, Requestable: true, Triggers: []string{"request", "lease_expiry"}, Guards: requestGuards},
+	{From: Initializing, To: Lockdown, Triggers: []string{"startup_apply", "lockdown"}},
+	{From: Maintenance, To: Lockdown, Triggers: []string{"lockdown"}},
+	{From: TransitionToMaintenance, To: Lockdown, Triggers: []string{"lockdown"}},
+	{From: Production, To: Lockdown, Triggers: []string{"lockdown"}},
+	{From: Lockdown, To: Maintenance, Triggers: []string{"reset"}},
+}
+
+// requestable reports whether the transition table allows requesting the
+// change from the current mode to the given one. Must be called with the
+// lock held.
+func (h *FirewallHandler) requestable(to FirewallMode) bool {
+	return slices.ContainsFunc(transitionTable, func(t stateTransition) bool {
+		return t.Requestable && t.From == h.mode && t.To == to
+	})
+}
+
+// StateMachine is the JSON representation of the transition table.
+type StateMachine struct {
+	States      []string                 `json:"states"`
+	Transitions []StateMachineTransition `json:"transitions"`
+}
+
+type StateMachineTransition struct {
+	From        string   `json:"from"`
+	To          string   `json:"to"`
+	Requestable bool     `json:"requestable"`
+	Triggers    []string `json:"triggers"`
+	Guards      []string `json:"guards,omitempty"`
+}
+
+func stateMachine() StateMachine {
+	sm := StateMachine{
+		States: []string{Initializing.String(), Maintenance.String(), TransitionToMaintenance.String(), Production.String(), Lockdown.String()},
+	}
+	for _, t := range transitionTable {
+		sm.Transitions = append(sm.Transitions, StateMachineTransition{
+			From:        t.From.String(),
+			To:          t.To.String(),
+			Requestable: t.Requestable,
+			Triggers:    t.Triggers,
+			Guards:      t.Guards,
+		})
+	}
+	return sm
+}
+
+// dot renders the state machine in the Graphviz DOT format.
+func (sm StateMachine) dot() string {
+	var b strings.Builder
+	b.WriteString("digraph firewall {\n")
+	for _, state := range sm.States {
+		fmt.Fprintf(&b, "  %q;\n", state)
+	}
+	for _, t := range sm.Transitions {
+		label := strings.Join(t.Triggers, ", ")
+		if len(t.Guards) > 0 {
+			label += " [" + strings.Join(t.Guards, ", ") + "]"
+		}
+		style := "dashed"
+		if t.Requestable {
+			style = "solid"
+		}
+		fmt.Fprintf(&b, "  %q -> %q [label=%q, style=%s];\n", t.From, t.To, label, style)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// handleStateMachine describes the states and transitions, as JSON or with
+// format=dot in the Graphviz DOT format.
+func (h *FirewallHandler) handleStateMachine(w http.ResponseWriter, r *http.Request) {
+	sm := stateMachine()
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "json":
+		writeJSON(w, http.StatusOK, sm)
+	case "dot":
+		w.Header().Set("Content-Type", "text/vnd.graphviz; charset=utf-8")
+		w.Write([]byte(sm.dot()))
+	default:
+		http.Error(w, fmt.Sprintf("invalid format %q, expected json or dot", format), http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,49 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateMachine(t *testing.T) {
+	h := newTestHandler(t, FirewallConfig{}, nil)
+	get := func(query string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		h.handleStateMachine(rr, httptest.NewRequest(http.MethodGet, "/firewall/statemachine"+query, nil))
+		return rr
+	}
+
+	rr := get("")
+	require.Equal(t, http.StatusOK, rr.Code)
+	var sm StateMachine
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &sm))
+	require.ElementsMatch(t, []string{"initializing", "maintenance", "transition_to_maintenance", "production", "lockdown"}, sm.States)
+
+	edges := make(map[string]bool)
+	for _, tr := range sm.Transitions {
+		edges[tr.From+" -> "+tr.To] = tr.Requestable
+	}
+	require.Equal(t, map[string]bool{
+		"initializing -> maintenance":              false,
+		"initializing -> production":               false,
+		"production -> transition_to_maintenance":  true,
+		"transition_to_maintenance -> maintenance": false,
+		"transition_to_maintenance -> production":  false,
+		"initializing -> lockdown":                 false,
+		"maintenance -> lockdown":                  false,
+		"transition_to_maintenance -> lockdown":    false,
+		"production -> lockdown":                   false,
+		"lockdown -> maintenance":                  false,
+		"maintenance -> production":                true,
+	}, edges)
+
+	rr = get("?format=dot")
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Contains(t, rr.Body.String(), `"maintenance" -> "production" [label="request, lease_expiry [if_match, expected_mode, min_dwell, drift]", style=solid];`)
+
+	require.Equal(t, http.StatusBadRequest, get("?format=svg").Code)
+}
@@ -0,0 +1,93 @@
+package httpserver
+
+import (
+	"net/http"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Stats is an in-process snapshot of the operational metrics, for
+// environments without Prometheus. It is computed from the same collectors
+// that are served by the metrics server.
+type Stats struct {
+	// Transitions counts finished transitions by target mode and result
+	Transitions map[string]map[string]uint64 `json:"transitions"`
+	Reverts     uint64                       `json:"reverts"`
+
+	Applies              map[string]ApplyStats `json:"applies"`
+	ModeDurationsSeconds map[string]float64    `json:"mode_durations_seconds"`
+}
+
+type ApplyStats struct {
+	Count                  uint64  `json:"count"`
+	AverageDurationSeconds float64 `json:"average_duration_seconds"`
+	LastDurationSeconds    float64 `json:"last_duration_seconds"`
+}
+
+// stats must be called with the lock held.
+func (h *FirewallHandler) stats() (Stats, error) {
+	families, err := h.metrics.registry.Gather()
+	if err != nil {
+		return Stats{}, err
+	}
+	byName := make(map[string]*dto.MetricFamily, len(families))
+	for _, mf := range families {
+		byName[mf.GetName()] = mf
+	}
+
+	stats := Stats{
+		Transitions:          make(map[string]map[string]uint64),
+		Applies:              make(map[string]ApplyStats),
+		ModeDurationsSeconds: h.durations.snapshot(h.now()).Current.Durations,
+	}
+
+	for _, m := range byName["firewall_transitions_total"].GetMetric() {
+		to, result := labelValue(m, "to"), labelValue(m, "result")
+		if stats.Transitions[to] == nil {
+			stats.Transitions[to] = make(map[string]uint64)
+		}
+		count := uint64(m.GetCounter().GetValue())
+		stats.Transitions[to][result] += count // Summed over the initiators
+		if result == resultReverted {
+			stats.Reverts += count
+		}
+	}
+
+	for _, m := range byName["firewall_apply_duration_seconds"].GetMetric() {
+		hist := m.GetHistogram()
+		apply := ApplyStats{Count: hist.GetSampleCount()}
+		if apply.Count > 0 {
+			apply.AverageDurationSeconds = hist.GetSampleSum() / float64(apply.Count)
+		}
+		stats.Applies[labelValue(m, "mode")] = apply
+	}
+	for _, m := range byName["firewall_last_apply_duration_seconds"].GetMetric() {
+		mode := labelValue(m, "mode")
+		apply := stats.Applies[mode]
+		apply.LastDurationSeconds = m.GetGauge().GetValue()
+		stats.Applies[mode] = apply
+	}
+
+	return stats, nil
+}
+
+func labelValue(m *dto.Metric, name string) string {
+	for _, l := range m.GetLabel() {
+		if l.GetName() == name {
+			return l.GetValue()
+		}
+	}
+	return ""
+}
+
+func (h *FirewallHandler) handleStats(w http.ResponseWriter, r *http.Request) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	stats, err := h.stats()
+	if err != nil {
+		http.Error(w, "could not gather stats: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
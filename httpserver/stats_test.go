@@ -0,0 +1,52 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats(t *testing.T) {
+	clock := newFakeClock()
+	h := newTestHandler(t, FirewallConfig{TransitionDuration: 0}, clock)
+	runner := testRunner(h)
+
+	transition := func(path string, handler http.HandlerFunc) int {
+		clock.Advance(time.Minute)
+		rr := httptest.NewRecorder()
+		handler(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		return rr.Code
+	}
+
+	require.Equal(t, http.StatusOK, transition("/firewall/production", h.handleProduction))
+	require.Equal(t, http.StatusOK, transition("/firewall/maintenance", h.handleMaintenance))
+	require.Equal(t, http.StatusOK, transition("/firewall/production", h.handleProduction))
+
+	// Maintenance rules fail to apply, the transition reverts to production
+	runner.Fail("/etc/nftables-maintenance.conf", errFake)
+	require.Equal(t, http.StatusOK, transition("/firewall/maintenance", h.handleMaintenance))
+	clock.Advance(time.Minute)
+
+	rr := httptest.NewRecorder()
+	h.handleStats(rr, httptest.NewRequest(http.MethodGet, "/firewall/stats", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var stats Stats
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &stats))
+	require.Equal(t, map[string]map[string]uint64{
+		"production":  {"completed": 2},
+		"maintenance": {"completed": 1, "reverted": 1},
+	}, stats.Transitions)
+	require.Equal(t, uint64(1), stats.Reverts)
+
+	require.Equal(t, uint64(3), stats.Applies["production"].Count)
+	require.Equal(t, uint64(2), stats.Applies["maintenance"].Count)
+	require.Equal(t, uint64(2), stats.Applies["transition_to_maintenance"].Count)
+
+	require.InDelta(t, (2 * time.Minute).Seconds(), stats.ModeDurationsSeconds["maintenance"], 0)
+	require.InDelta(t, (3 * time.Minute).Seconds(), stats.ModeDurationsSeconds["production"], 0)
+}
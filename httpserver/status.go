@@ -0,0 +1,144 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/flashbots/go-bob-firewall/client"
+)
+
+// ModeHeader carries the current mode on every status response, so HEAD
+// requests can read it without a body.
+const ModeHeader = "X-Firewall-Mode"
+
+// Status is the JSON representation of the firewall state.
+type Status struct {
+	Mode               string             `json:"mode"`
+	Generation         uint64             `json:"generation"`
+	LastApplyDurations map[string]float64 `json:"last_apply_duration_seconds"`
+	// Degraded is set if the startup apply failed for good, the rules in
+	// place are unknown.
+	Degraded bool `json:"degraded,omitempty"`
+	// Lease is the maintenance lease, if leases are enabled and the mode is
+	// maintenance.
+	Lease *Lease `json:"lease,omitempty"`
+	// ConfigError is set while the periodic config check fails.
+	ConfigError string `json:"config_error,omitempty"`
+	// ProbationUntil is set while production restored on startup is on
+	// probation.
+	ProbationUntil *time.Time `json:"probation_until,omitempty"`
+	// HeartbeatDeadline is when the dead man's switch forces maintenance
+	// without a heartbeat, if enabled.
+	HeartbeatDeadline *time.Time `json:"heartbeat_deadline,omitempty"`
+	// Transitioning is set while the transition to maintenance is in
+	// progress. TransitionStartedAt is when it started, and
+	// TransitionRemainingSeconds the time until it completes, at the latest
+	// (it may complete early once drained).
+	Transitioning              bool       `json:"transitioning"`
+	TransitionStartedAt        *time.Time `json:"transition_started_at,omitempty"`
+	TransitionRemainingSeconds *float64   `json:"transition_remaining_seconds,omitempty"`
+	// TransitionDurationSeconds is the configured duration of the transition
+	// to maintenance.
+	TransitionDurationSeconds float64 `json:"transition_duration_seconds"`
+	// QuietUntil is the end of the startup quiet period, while it lasts.
+	QuietUntil *time.Time `json:"quiet_until,omitempty"`
+	// Labels is the metadata of the node from FirewallConfig.Labels.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// status returns a snapshot of the current state. Must be called with the
+// lock held.
+func (h *FirewallHandler) status() Status {
+	status := Status{
+		Mode:               h.mode.String(),
+		Generation:         h.generation,
+		LastApplyDurations: durationsToSeconds(h.lastApplyDurations),
+		Degraded:           h.degraded,
+		Lease:              h.lease(),
+		Labels:             h.labels(),
+
+		TransitionDurationSeconds: h.config.TransitionDuration.Seconds(),
+	}
+	if h.configCheckErr != nil {
+		status.ConfigError = h.configCheckErr.Error()
+	}
+	if !h.probationUntil.IsZero() {
+		until := h.probationUntil
+		status.ProbationUntil = &until
+	}
+	if h.mode == TransitionToMaintenance && h.transitionToMaintenanceStart != nil {
+		start := *h.transitionToMaintenanceStart
+		remaining := max(start.Add(h.config.TransitionDuration).Sub(h.now()), 0).Seconds()
+		status.Transitioning = true
+		status.TransitionStartedAt = &start
+		status.TransitionRemainingSeconds = &remaining
+	}
+	if h.now().Before(h.quietUntil) {
+		until := h.quietUntil
+		status.QuietUntil = &until
+	}
+	if !h.heartbeatDeadline.IsZero() {
+		deadline := h.heartbeatDeadline
+		status.HeartbeatDeadline = &deadline
+	}
+	return status
+}
+
+// HTML is last, so it's only served if preferred, e.g. by browsers.
+var statusContentTypes = []string{"text/plain", "application/json", "text/html"}
+
+func (h *FirewallHandler) handleStatus(w http.ResponseWriter, r *http.Request) {
+	head := r.Method == http.MethodHead
+	contentType, ok := "", true
+	if !head {
+		contentType, ok = h.negotiate(w, r, statusContentTypes)
+	}
+	if !ok {
+		return
+	}
+
+	if !h.lock.lockTimeout(h.config.StatusTimeout) {
+		http.Error(w, "state read timed out", http.StatusServiceUnavailable)
+		return
+	}
+	defer h.lock.Unlock()
+
+	w.Header().Set("ETag", h.stateETag())
+	w.Header().Set(ModeHeader, h.mode.String())
+	if head {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	switch contentType {
+	case "application/json":
+		h.writeStatusJSON(w, h.status())
+		return
+	case "text/html":
+		h.writeStatusHTML(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(h.mode.String()))
+}
+
+// writeStatusJSON writes the status, signed if a signing key is configured.
+func (h *FirewallHandler) writeStatusJSON(w http.ResponseWriter, status Status) {
+	if len(h.config.StatusSigningKey) == 0 {
+		writeJSON(w, http.StatusOK, status)
+		return
+	}
+
+	body, err := json.Marshal(status)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	signature, timestamp := client.SignStatus(h.config.StatusSigningKey, body, h.now())
+	w.Header().Set(client.StatusSignatureHeader, signature)
+	w.Header().Set(client.StatusTimestampHeader, timestamp)
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
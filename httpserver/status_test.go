@@ -0,0 +1,213 @@
+package httpserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/flashbots/go-bob-firewall/client"
+	"github.com/stretchr/testify/require"
+)
+
+func getStatusJSON(t *testing.T, h *FirewallHandler) Status {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/firewall/status", nil)
+	req.Header.Set("Accept", "application/json")
+	rr := httptest.NewRecorder()
+	h.handleStatus(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+	var status Status
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &status))
+	return status
+}
+
+func TestStatusJSON(t *testing.T) {
+	h := newTestHandler(t, FirewallConfig{}, nil)
+	status := getStatusJSON(t, h)
+	require.Equal(t, "maintenance", status.Mode)
+	require.Empty(t, status.LastApplyDurations)
+}
+
+func TestStatusTransitionTiming(t *testing.T) {
+	clock := newFakeClock()
+	h := newTestHandler(t, FirewallConfig{TransitionDuration: time.Minute}, clock)
+	t.Cleanup(h.Close)
+	h.mode = Production
+
+	status := getStatusJSON(t, h)
+	require.False(t, status.Transitioning)
+	require.Nil(t, status.TransitionStartedAt)
+	require.Nil(t, status.TransitionRemainingSeconds)
+	require.InDelta(t, 60, status.TransitionDurationSeconds, 0)
+
+	rr := httptest.NewRecorder()
+	h.handleMaintenance(rr, httptest.NewRequest(http.MethodPost, "/firewall/maintenance", nil))
+	require.Equal(t, http.StatusAccepted, rr.Code)
+	start := clock.Now()
+	clock.Advance(20 * time.Second)
+
+	status = getStatusJSON(t, h)
+	require.True(t, status.Transitioning)
+	require.True(t, start.Equal(*status.TransitionStartedAt))
+	require.InDelta(t, 40, *status.TransitionRemainingSeconds, 0)
+
+	// Plain text stays the default
+	rr = httptest.NewRecorder()
+	h.handleStatus(rr, httptest.NewRequest(http.MethodGet, "/firewall/status", nil))
+	require.Equal(t, "transition_to_maintenance", rr.Body.String())
+}
+
+func TestLastApplyDuration(t *testing.T) {
+	h := newTestHandler(t, FirewallConfig{}, nil)
+	testRunner(h).delay = 20 * time.Millisecond
+
+	rr := httptest.NewRecorder()
+	h.handleProduction(rr, httptest.NewRequest(http.MethodGet, "/firewall/production", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	status := getStatusJSON(t, h)
+	require.Equal(t, "production", status.Mode)
+	require.Len(t, status.LastApplyDurations, 1)
+	require.GreaterOrEqual(t, status.LastApplyDurations["production"], 0.02)
+
+	require.Contains(t, scrapeMetrics(t, h.metrics.registry), `firewall_last_apply_duration_seconds{mode="production"}`)
+}
+
+func TestStatusSignature(t *testing.T) {
+	key := []byte("secret")
+	h := newTestHandler(t, FirewallConfig{StatusSigningKey: key}, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/firewall/status", nil)
+	req.Header.Set("Accept", "application/json")
+	rr := httptest.NewRecorder()
+	h.handleStatus(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	signature := rr.Header().Get(client.StatusSignatureHeader)
+	timestamp := rr.Header().Get(client.StatusTimestampHeader)
+	require.NoError(t, client.VerifyStatus(key, rr.Body.Bytes(), timestamp, signature, 0))
+
+	tampered := bytes.Replace(rr.Body.Bytes(), []byte("maintenance"), []byte("production"), 1)
+	require.ErrorIs(t, client.VerifyStatus(key, tampered, timestamp, signature, 0), client.ErrInvalidSignature)
+
+	// Unsigned without a key
+	h = newTestHandler(t, FirewallConfig{}, nil)
+	rr = httptest.NewRecorder()
+	h.handleStatus(rr, req)
+	require.Empty(t, rr.Header().Get(client.StatusSignatureHeader))
+	require.Empty(t, rr.Header().Get(client.StatusTimestampHeader))
+}
+
+func TestStatusTimeout(t *testing.T) {
+	h := newTestHandler(t, FirewallConfig{StatusTimeout: 200 * time.Millisecond}, nil)
+
+	h.lock.Lock()
+	start := time.Now()
+	rr := httptest.NewRecorder()
+	h.handleStatus(rr, httptest.NewRequest(http.MethodGet, "/firewall/status", nil))
+	h.lock.Unlock()
+
+	require.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	require.Equal(t, "state read timed out\n", rr.Body.String())
+	require.Less(t, time.Since(start), time.Second)
+
+	// Waits for a lock released within the timeout
+	h.lock.Lock()
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		h.lock.Unlock()
+	}()
+	rr = httptest.NewRecorder()
+	h.handleStatus(rr, httptest.NewRequest(http.MethodGet, "/firewall/status", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestStatusHTML(t *testing.T) {
+	clock := newFakeClock()
+	h := newTestHandler(t, FirewallConfig{TransitionDuration: time.Minute}, clock)
+	get := func(accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/firewall/status", nil)
+		req.Header.Set("Accept", accept)
+		rr := httptest.NewRecorder()
+		h.handleStatus(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+		return rr
+	}
+
+	browser := "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+	rr := get(browser)
+	require.Equal(t, "text/html; charset=utf-8", rr.Header().Get("Content-Type"))
+	require.Contains(t, rr.Body.String(), "<h1>Firewall mode: maintenance</h1>")
+	require.Contains(t, rr.Body.String(), `<button onclick="transition('production')">`)
+	require.NotContains(t, rr.Body.String(), `transition('maintenance')`)
+
+	h.mode = Production
+	h.lock.Lock()
+	require.NoError(t, h.transitionToMaintenance("test"))
+	h.lock.Unlock()
+	clock.Advance(15 * time.Second)
+	rr = get(browser)
+	require.Contains(t, rr.Body.String(), `<progress value="0.25" max="1"></progress> 45s remaining`)
+	require.NotContains(t, rr.Body.String(), "<button")
+
+	// Machine clients are unaffected
+	require.Equal(t, "transition_to_maintenance", get("*/*").Body.String())
+	require.Equal(t, "application/json", get("application/json").Header().Get("Content-Type"))
+}
+
+func TestStatusHTMLAuth(t *testing.T) {
+	cfg := newTestServerConfig()
+	cfg.AuthTokens = map[string][]string{
+		"drain-token": {"maintenance"},
+		"admin-token": nil,
+	}
+	router := newTestServer(t, cfg).getRouter()
+	get := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/firewall/status", nil)
+		req.Header.Set("Accept", "text/html")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+		return rr
+	}
+
+	// Without a token with the scope, the page offers no transitions
+	for _, token := range []string{"", "wrong", "drain-token"} {
+		rr := get(token)
+		require.NotContains(t, rr.Body.String(), "<button", token)
+		require.Contains(t, rr.Body.String(), `const token = "";`, token)
+	}
+
+	rr := get("admin-token")
+	require.Contains(t, rr.Body.String(), `<button onclick="transition('production')">`)
+	require.Contains(t, rr.Body.String(), `const token = "admin-token";`)
+	require.Equal(t, "no-store", rr.Header().Get("Cache-Control"))
+}
+
+func TestStatusHead(t *testing.T) {
+	srv := newTestServer(t, newTestServerConfig())
+	router := srv.getRouter()
+	srv.handler.lock.Lock()
+	require.NoError(t, srv.handler.transitionToProduction("test"))
+	srv.handler.lock.Unlock()
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodHead, "/firewall/status", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Equal(t, "production", rr.Header().Get(ModeHeader))
+	require.Empty(t, rr.Body.Bytes())
+
+	get := httptest.NewRecorder()
+	router.ServeHTTP(get, httptest.NewRequest(http.MethodGet, "/firewall/status", nil))
+	require.Equal(t, "production", get.Body.String())
+	require.Equal(t, get.Header().Get(ModeHeader), rr.Header().Get(ModeHeader))
+	require.Equal(t, get.Header().Get("ETag"), rr.Header().Get("ETag"))
+}
@@ -0,0 +1,74 @@
+package httpserver
+
+import (
+	"html/template"
+	"net/http"
+	"time"
+)
+
+// statusPage is a minimal ops UI, served by the status endpoint to browsers.
+var statusPage = template.Must(template.New("status").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Firewall: {{.Mode}}</title>
+<style>body { font-family: sans-serif; margin: 2em; } progress { width: 20em; }</style>
+</head>
+<body>
+<h1>Firewall mode: {{.Mode}}</h1>
+<p>Generation {{.Generation}}</p>
+{{- if .Progress}}
+<p><progress value="{{.Progress}}" max="1"></progress> {{.Remaining}} remaining</p>
+{{- end}}
+{{- range .Actions}}
+<button onclick="transition('{{.}}')">Transition to {{.}}</button>
+{{- end}}
+<script>
+const token = {{.Token}};
+function transition(mode) {
+  const headers = {"Content-Type": "application/json"};
+  if (token) headers["Authorization"] = "Bearer " + token;
+  fetch("/firewall/transition", {method: "POST", headers: headers, body: JSON.stringify({mode: mode})})
+    .then(async (res) => { if (!res.ok) alert(await res.text()); location.reload(); });
+}
+</script>
+</body>
+</html>
+`))
+
+type statusPageData struct {
+	Mode       string
+	Generation uint64
+	Progress   float64 // Of the transition to maintenance, zero if there is none
+	Remaining  time.Duration
+	Actions    []string // Transitions which can be requested
+	Token      string   // Sent with transition requests, empty if auth is disabled
+}
+
+// writeStatusHTML writes the status page. Transitions are only offered if the
+// request may trigger them: with auth enabled, it must carry a token with
+// their scope, which the page then sends with them. Must be called with the
+// lock held.
+func (h *FirewallHandler) writeStatusHTML(w http.ResponseWriter, r *http.Request) {
+	data := statusPageData{Mode: h.mode.String(), Generation: h.generation}
+	if h.mode == TransitionToMaintenance && h.transitionToMaintenanceStart != nil && h.config.TransitionDuration > 0 {
+		elapsed := h.now().Sub(*h.transitionToMaintenanceStart)
+		data.Progress = min(elapsed.Seconds()/h.config.TransitionDuration.Seconds(), 1)
+		data.Remaining = max(h.config.TransitionDuration-elapsed, 0).Round(time.Second)
+	}
+	for _, to := range []FirewallMode{Maintenance, Production} {
+		token, ok := requestToken(r.Context(), to)
+		if ok && h.planTransition(to).Allowed {
+			data.Actions = append(data.Actions, to.String())
+			data.Token = token
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if data.Token != "" {
+		w.Header().Set("Cache-Control", "no-store")
+	}
+	if err := statusPage.Execute(w, data); err != nil {
+		h.log.Error("could not render the status page", "error", err)
+	}
+}
@@ -0,0 +1,68 @@
+package httpserver
+
+import "sync"
+
+// subscriberBuffer is the number of status snapshots buffered per
+// subscriber. If a subscriber falls behind, the oldest snapshots are dropped.
+const subscriberBuffer = 16
+
+type subscribers struct {
+	mu   sync.Mutex
+	subs map[chan Status]struct{}
+}
+
+// Subscribe returns a channel receiving a status snapshot on every mode
+// change, and a function to unsubscribe which closes the channel. Slow
+// subscribers miss the oldest snapshots rather than blocking transitions.
+func (h *FirewallHandler) Subscribe() (<-chan Status, func()) {
+	ch := make(chan Status, subscriberBuffer)
+	h.subscribers.mu.Lock()
+	if h.subscribers.subs == nil {
+		h.subscribers.subs = make(map[chan Status]struct{})
+	}
+	h.subscribers.subs[ch] = struct{}{}
+	h.subscribers.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.subscribers.mu.Lock()
+			defer h.subscribers.mu.Unlock()
+			if _, ok := h.subscribers.subs[ch]; ok { // Not closed by Close already
+				delete(h.subscribers.subs, ch)
+				close(ch)
+			}
+		})
+	}
+}
+
+// publish sends the status to all subscribers, dropping their oldest
+// snapshot if their buffer is full.
+func (s *subscribers) publish(status Status) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.subs {
+		select {
+		case ch <- status:
+			continue
+		default:
+		}
+		// Only publish sends, with the lock held, so there's room after
+		// dropping the oldest snapshot
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- status
+	}
+}
+
+// closeAll closes the channels of all subscribers.
+func (s *subscribers) closeAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.subs {
+		close(ch)
+	}
+	s.subs = nil
+}
@@ -0,0 +1,58 @@
+package httpserver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscribe(t *testing.T) {
+	h := newTestHandler(t, FirewallConfig{}, nil)
+	h.mode = Production
+	ch, unsubscribe := h.Subscribe()
+
+	h.lock.Lock()
+	require.NoError(t, h.transitionToMaintenance("test"))
+	h.lock.Unlock()
+
+	require.Equal(t, "transition_to_maintenance", (<-ch).Mode)
+	require.Equal(t, "maintenance", (<-ch).Mode)
+
+	unsubscribe()
+	unsubscribe() // No-op
+	_, ok := <-ch
+	require.False(t, ok)
+
+	h.lock.Lock()
+	require.NoError(t, h.transitionToProduction("test"))
+	h.lock.Unlock()
+}
+
+func TestSubscribeDropsOldest(t *testing.T) {
+	h := newTestHandler(t, FirewallConfig{}, nil)
+	ch, unsubscribe := h.Subscribe()
+	defer unsubscribe()
+
+	h.lock.Lock()
+	for range subscriberBuffer + 3 {
+		h.generation++
+		h.setMode(Maintenance)
+	}
+	h.lock.Unlock()
+
+	require.Len(t, ch, subscriberBuffer)
+	require.Equal(t, uint64(4), (<-ch).Generation)
+	for range subscriberBuffer - 2 {
+		<-ch
+	}
+	require.Equal(t, uint64(subscriberBuffer+3), (<-ch).Generation)
+}
+
+func TestSubscribeClose(t *testing.T) {
+	h := newTestHandler(t, FirewallConfig{}, nil)
+	ch, unsubscribe := h.Subscribe()
+	h.Close()
+	_, ok := <-ch
+	require.False(t, ok)
+	unsubscribe() // Must not close the channel again
+}
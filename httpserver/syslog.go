@@ -0,0 +1,35 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+const DefaultSyslogTag = "bob-firewall"
+
+var errSyslogUnsupported = errors.New("syslog is not supported on this platform")
+
+// syslogWriter is the subset of *syslog.Writer used for transition events.
+type syslogWriter interface {
+	Info(m string) error
+	Warning(m string) error
+	Close() error
+}
+
+// writeSyslog sends a transition outcome to syslog as JSON, with warning
+// severity if the transition didn't complete.
+func (h *FirewallHandler) writeSyslog(outcome TransitionOutcome) {
+	msg, err := json.Marshal(outcome)
+	if err != nil {
+		h.log.Error("could not encode transition outcome for syslog", "error", err)
+		return
+	}
+	if outcome.Result == resultCompleted {
+		err = h.syslog.Info(string(msg))
+	} else {
+		err = h.syslog.Warning(string(msg))
+	}
+	if err != nil {
+		h.log.Error("could not write transition outcome to syslog", "error", err)
+	}
+}
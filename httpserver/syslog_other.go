@@ -0,0 +1,7 @@
+//go:build windows || plan9
+
+package httpserver
+
+func newSyslogWriter(facility, tag string) (syslogWriter, error) {
+	return nil, errSyslogUnsupported
+}
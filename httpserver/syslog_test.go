@@ -0,0 +1,62 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSyslog struct {
+	mu       sync.Mutex
+	messages []string // Prefixed with the severity
+	closed   bool
+}
+
+func (s *fakeSyslog) Info(m string) error    { return s.write("info: " + m) }
+func (s *fakeSyslog) Warning(m string) error { return s.write("warning: " + m) }
+
+func (s *fakeSyslog) write(m string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, m)
+	return nil
+}
+
+func (s *fakeSyslog) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestSyslogEvents(t *testing.T) {
+	h := newTestHandler(t, FirewallConfig{}, nil)
+	sink := &fakeSyslog{}
+	h.syslog = sink
+	h.mode = Production
+
+	h.lock.Lock()
+	require.NoError(t, h.transitionToMaintenance("alice"))
+	require.NoError(t, h.transitionToProduction("bob"))
+	testRunner(h).Fail("/etc/nftables-transition.conf", errFake)
+	require.ErrorIs(t, h.transitionToMaintenance("carol"), ErrTransitionFailed)
+	h.lock.Unlock()
+
+	require.Len(t, sink.messages, 3)
+	for i, prefix := range []string{"info: ", "info: ", "warning: "} {
+		require.Contains(t, sink.messages[i], prefix)
+	}
+	var outcome TransitionOutcome
+	require.NoError(t, json.Unmarshal([]byte(sink.messages[2][len("warning: "):]), &outcome))
+	require.Equal(t, "maintenance", outcome.To)
+	require.Equal(t, resultReverted, outcome.Result)
+	require.Equal(t, "carol", outcome.RequestedBy)
+
+	h.Close()
+	require.True(t, sink.closed)
+}
+
+func TestSyslogUnknownFacility(t *testing.T) {
+	_, err := NewFirewallHandler(nil, FirewallConfig{SyslogFacility: "nope"})
+	require.Error(t, err)
+}
@@ -0,0 +1,43 @@
+package httpserver
+
+import (
+	"context"
+	"sync"
+
+	"go.uber.org/atomic"
+)
+
+// taskGroup tracks background goroutines, so they can be canceled and
+// awaited on shutdown instead of outliving it.
+type taskGroup struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	running atomic.Int64
+	guard   func() // Optional - deferred in every task, e.g. to record crashes
+}
+
+func newTaskGroup(guard func()) *taskGroup {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &taskGroup{ctx: ctx, cancel: cancel, guard: guard}
+}
+
+// Go runs f in a new goroutine. The context passed to f is canceled by Stop.
+func (g *taskGroup) Go(f func(ctx context.Context)) {
+	g.wg.Add(1)
+	g.running.Inc()
+	go func() {
+		defer g.wg.Done()
+		defer g.running.Dec()
+		if g.guard != nil {
+			defer g.guard()
+		}
+		f(g.ctx)
+	}()
+}
+
+// Stop cancels all tasks and waits for them to return.
+func (g *taskGroup) Stop() {
+	g.cancel()
+	g.wg.Wait()
+}
@@ -0,0 +1,83 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const maxTransitionBodyBytes = 4 * 1024
+
+var errTrailingData = errors.New("unexpected data after the request")
+
+// TransitionRequest is the body of the transition endpoint. If
+// ExpectedCurrentMode is set, the transition is only started if that's the
+// current mode, else rejected with 409 and the current mode.
+type TransitionRequest struct {
+	Mode                string `json:"mode"`
+	ExpectedCurrentMode string `json:"expected_current_mode,omitempty"`
+}
+
+// decodeStrict decodes a single JSON object from the request body into v.
+// Unknown fields are rejected, to catch typos, as is anything after the
+// object.
+func decodeStrict(body io.Reader, v any) error {
+	dec := json.NewDecoder(body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	// A second value, or garbage, after the request is most likely a client
+	// bug, e.g. two concatenated requests
+	if err := dec.Decode(new(json.RawMessage)); !errors.Is(err, io.EOF) {
+		if err == nil {
+			return errTrailingData
+		}
+		return err
+	}
+	return nil
+}
+
+// handleTransitionRequest starts the transition to the mode in the JSON body,
+// like the maintenance and production endpoints. Unknown fields are rejected,
+// to catch typos, as is anything after the JSON object.
+func (h *FirewallHandler) handleTransitionRequest(w http.ResponseWriter, r *http.Request) {
+	var req TransitionRequest
+	if err := decodeStrict(http.MaxBytesReader(w, r.Body, maxTransitionBodyBytes), &req); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, "transition request too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "invalid transition request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fm, err := ParseFirewallMode(req.Mode)
+	if err != nil {
+		http.Error(w, "invalid transition request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.ExpectedCurrentMode != "" {
+		expected, err := ParseFirewallMode(req.ExpectedCurrentMode)
+		if err != nil {
+			http.Error(w, "invalid transition request: expected current mode: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		r = withExpectedMode(r, expected)
+	}
+	if !scopeAllows(r.Context(), fm) {
+		writeForbiddenScope(w, fm)
+		return
+	}
+	switch fm {
+	case Maintenance:
+		h.handleTransition(w, r, Maintenance, h.transitionToMaintenance)
+	case Production:
+		h.handleTransition(w, r, Production, h.transitionToProduction)
+	default:
+		http.Error(w, fmt.Sprintf("invalid transition request: cannot transition to %s", fm), http.StatusBadRequest)
+	}
+}
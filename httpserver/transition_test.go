@@ -0,0 +1,95 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransitionRequest(t *testing.T) {
+	post := func(h *FirewallHandler, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		h.handleTransitionRequest(rr, httptest.NewRequest(http.MethodPost, "/firewall/transition", strings.NewReader(body)))
+		return rr
+	}
+
+	t.Run("transitions", func(t *testing.T) {
+		h := newTestHandler(t, FirewallConfig{}, nil)
+		require.Equal(t, http.StatusOK, post(h, `{"mode": "production"}`).Code)
+		require.Equal(t, "production", getStatusJSON(t, h).Mode)
+		require.Equal(t, http.StatusOK, post(h, `{"mode": "maintenance"}`+"\n").Code)
+		require.Equal(t, "maintenance", getStatusJSON(t, h).Mode)
+	})
+
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{name: "malformed", body: `{"mode": `, wantCode: http.StatusBadRequest, wantBody: "invalid transition request: unexpected EOF"},
+		{name: "trailing object", body: `{"mode": "production"}{"mode": "maintenance"}`, wantCode: http.StatusBadRequest, wantBody: "unexpected data after the request"},
+		{name: "trailing garbage", body: `{"mode": "production"} nope`, wantCode: http.StatusBadRequest, wantBody: "invalid transition request: invalid character"},
+		{name: "unknown field", body: `{"mod": "production"}`, wantCode: http.StatusBadRequest, wantBody: `unknown field "mod"`},
+		{name: "invalid mode", body: `{"mode": "off"}`, wantCode: http.StatusBadRequest, wantBody: "invalid transition request"},
+		{name: "transition mode", body: `{"mode": "transition_to_maintenance"}`, wantCode: http.StatusBadRequest, wantBody: "cannot transition to"},
+		{name: "oversized", body: `{"mode": "` + strings.Repeat("x", maxTransitionBodyBytes) + `"}`, wantCode: http.StatusRequestEntityTooLarge, wantBody: "too large"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, FirewallConfig{}, nil)
+			rr := post(h, tt.body)
+			require.Equal(t, tt.wantCode, rr.Code)
+			require.Contains(t, rr.Body.String(), tt.wantBody)
+			require.Equal(t, "maintenance", getStatusJSON(t, h).Mode)
+			require.Empty(t, testRunner(h).Calls())
+		})
+	}
+}
+
+func TestTransitionExpectedCurrentMode(t *testing.T) {
+	post := func(h *FirewallHandler, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		h.handleTransitionRequest(rr, httptest.NewRequest(http.MethodPost, "/firewall/transition", strings.NewReader(body)))
+		return rr
+	}
+
+	t.Run("matching", func(t *testing.T) {
+		h := newTestHandler(t, FirewallConfig{}, nil)
+		rr := post(h, `{"mode": "production", "expected_current_mode": "maintenance"}`)
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "production", getStatusJSON(t, h).Mode)
+	})
+
+	t.Run("mismatching", func(t *testing.T) {
+		h := newTestHandler(t, FirewallConfig{}, nil)
+		h.mode = Lockdown
+		rr := post(h, `{"mode": "production", "expected_current_mode": "maintenance"}`)
+		require.Equal(t, http.StatusConflict, rr.Code)
+		var rejection ErrorResponse
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &rejection))
+		require.Equal(t, ModeMismatch, rejection.Code)
+		require.Equal(t, "lockdown", rejection.CurrentMode)
+		require.Equal(t, "current mode does not match the expected mode: expected maintenance, current mode is lockdown", rejection.Error)
+		require.Empty(t, testRunner(h).Calls())
+	})
+
+	t.Run("checked before the source mode", func(t *testing.T) {
+		h := newTestHandler(t, FirewallConfig{}, nil)
+		rr := post(h, `{"mode": "maintenance", "expected_current_mode": "production"}`)
+		require.Equal(t, http.StatusConflict, rr.Code)
+		require.Contains(t, rr.Body.String(), `"current_mode":"maintenance"`)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		h := newTestHandler(t, FirewallConfig{}, nil)
+		rr := post(h, `{"mode": "production", "expected_current_mode": "off"}`)
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Contains(t, rr.Body.String(), "expected current mode")
+		require.Empty(t, testRunner(h).Calls())
+	})
+}
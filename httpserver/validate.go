@@ -0,0 +1,109 @@
+package httpserver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const maxValidateBodyBytes = 1024 * 1024
+
+// includeStatement matches nft include statements. nft runs as root, so an
+// uploaded ruleset could include any file and have it quoted in the errors.
+var includeStatement = regexp.MustCompile(`\binclude\b`)
+
+// ValidateResult is the response of the validate endpoint.
+type ValidateResult struct {
+	Valid  bool   `json:"valid"`
+	Output string `json:"output,omitempty"`
+}
+
+// handleValidate checks an uploaded ruleset with `nft -c` without applying
+// it. The ruleset is an nft script, or nft JSON if sent as application/json.
+func (h *FirewallHandler) handleValidate(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxValidateBodyBytes))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, "ruleset too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "could not read ruleset: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		http.Error(w, "empty ruleset", http.StatusBadRequest)
+		return
+	}
+	if includeStatement.Match(body) {
+		http.Error(w, "include statements are not allowed in uploaded rulesets", http.StatusBadRequest)
+		return
+	}
+
+	ext := ".nft"
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+		ext = ".json"
+	}
+	result, err := h.validateRuleset(r.Context(), body, ext)
+	if err != nil {
+		h.log.Error("could not validate uploaded ruleset", "error", err)
+		http.Error(w, "could not validate ruleset", http.StatusInternalServerError)
+		return
+	}
+
+	status := http.StatusOK
+	if !result.Valid {
+		status = http.StatusUnprocessableEntity
+	}
+	writeJSON(w, status, result)
+}
+
+// validateRuleset writes the ruleset to a temporary file with the given
+// extension and checks it with nft. An error is only returned if the check
+// could not be run at all.
+func (h *FirewallHandler) validateRuleset(ctx context.Context, ruleset []byte, ext string) (ValidateResult, error) {
+	f, err := os.CreateTemp("", "nftables-validate-*"+ext)
+	if err != nil {
+		return ValidateResult{}, err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(ruleset); err != nil {
+		f.Close()
+		return ValidateResult{}, err
+	}
+	if err := f.Close(); err != nil {
+		return ValidateResult{}, err
+	}
+
+	rs, err := newRuleset(f.Name())
+	if err != nil {
+		return ValidateResult{}, err
+	}
+	// An empty directory, so nothing resolves relative to it either
+	dir, err := os.MkdirTemp("", "nftables-validate-*")
+	if err != nil {
+		return ValidateResult{}, err
+	}
+	defer os.Remove(dir)
+	output, err := h.runner.Run(withWorkDir(ctx, dir), h.config.NFTBinary, rs.args("-c")...)
+	return ValidateResult{Valid: err == nil, Output: validateMessages(output, f.Name())}, nil
+}
+
+// validateMessages returns only the error and warning lines of the nft
+// output, without the quoted ruleset lines and markers, and with the path of
+// the temporary file replaced.
+func validateMessages(output []byte, path string) string {
+	var lines []string
+	for _, line := range strings.Split(string(output), "\n") {
+		if strings.Contains(line, "Error:") || strings.Contains(line, "Warning:") {
+			lines = append(lines, strings.ReplaceAll(strings.TrimSpace(line), path, "ruleset"))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,92 @@
+package httpserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// nftCheckRunner fakes `nft -c -f <path>`, rejecting rulesets which contain
+// the word "invalid".
+type nftCheckRunner struct {
+	args []string
+}
+
+func (r *nftCheckRunner) Run(_ context.Context, _ string, args ...string) ([]byte, error) {
+	r.args = args
+	data, err := os.ReadFile(args[len(args)-1])
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Contains(data, []byte("invalid")) {
+		return []byte(args[len(args)-1] + ":1:21-27: Error: syntax error, unexpected string\n" + string(data) + "                    ^^^^^^^\n"), errFake
+	}
+	return nil, nil
+}
+
+func postValidate(h *FirewallHandler, contentType, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/firewall/validate", strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	rr := httptest.NewRecorder()
+	h.handleValidate(rr, req)
+	return rr
+}
+
+func TestValidateUpload(t *testing.T) {
+	h := newTestHandler(t, FirewallConfig{}, nil)
+	runner := &nftCheckRunner{}
+	h.runner = runner
+
+	t.Run("valid", func(t *testing.T) {
+		rr := postValidate(h, "text/plain", "table inet filter {}\n")
+		require.Equal(t, http.StatusOK, rr.Code)
+		var res ValidateResult
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &res))
+		require.True(t, res.Valid)
+
+		require.Equal(t, []string{"-c", "-f"}, runner.args[:2])
+		require.True(t, strings.HasSuffix(runner.args[2], ".nft"))
+		require.NoFileExists(t, runner.args[2])
+	})
+
+	t.Run("valid json", func(t *testing.T) {
+		rr := postValidate(h, "application/json; charset=utf-8", `{"nftables": []}`)
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, []string{"-c", "-j", "-f"}, runner.args[:3])
+		require.True(t, strings.HasSuffix(runner.args[3], ".json"))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		rr := postValidate(h, "text/plain", "table inet filter { invalid }\n")
+		require.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		var res ValidateResult
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &res))
+		require.False(t, res.Valid)
+		// Without the quoted ruleset
+		require.Equal(t, "ruleset:1:21-27: Error: syntax error, unexpected string", res.Output)
+	})
+
+	t.Run("include", func(t *testing.T) {
+		runner.args = nil
+		rr := postValidate(h, "text/plain", "table inet filter {}\ninclude \"/etc/shadow\"\n")
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Nil(t, runner.args)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		rr := postValidate(h, "text/plain", " \n")
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		rr := postValidate(h, "text/plain", strings.Repeat("#", maxValidateBodyBytes+1))
+		require.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+	})
+}
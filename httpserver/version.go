@@ -0,0 +1,67 @@
+package httpserver
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/flashbots/go-bob-firewall/common"
+)
+
+// kernelReleasePath is read for the kernel version, like `uname -r`.
+var kernelReleasePath = "/proc/sys/kernel/osrelease"
+
+// Versions identifies the software involved in applying rules, to correlate
+// apply failures with specific nft and kernel combinations.
+type Versions struct {
+	Server string `json:"server"`
+	NFT    string `json:"nft"`
+	Kernel string `json:"kernel"`
+}
+
+// detectVersions queries the nft and kernel versions. Versions which can't be
+// determined are reported as "unknown".
+func (h *FirewallHandler) detectVersions(ctx context.Context) Versions {
+	v := Versions{Server: common.Version, NFT: "unknown", Kernel: "unknown"}
+
+	if output, err := h.runner.Run(ctx, h.config.NFTBinary, "--version"); err != nil {
+		h.log.Warn("could not determine the nft version", "output", output, "error", err)
+	} else if s := string(bytes.TrimSpace(output)); s != "" {
+		v.NFT = s
+	}
+
+	if data, err := os.ReadFile(kernelReleasePath); err != nil {
+		h.log.Warn("could not determine the kernel version", "error", err)
+	} else if s := strings.TrimSpace(string(data)); s != "" {
+		v.Kernel = s
+	}
+	return v
+}
+
+// refreshVersions updates the cached versions. Called on startup.
+func (h *FirewallHandler) refreshVersions(ctx context.Context) {
+	v := h.detectVersions(ctx)
+	h.lock.Lock()
+	h.versions = &v
+	h.lock.Unlock()
+	h.log.Info("detected versions", "nft", v.NFT, "kernel", v.Kernel)
+}
+
+// cachedVersions returns the versions detected on startup, detecting them now
+// if that didn't happen yet.
+func (h *FirewallHandler) cachedVersions(ctx context.Context) Versions {
+	h.lock.Lock()
+	v := h.versions
+	h.lock.Unlock()
+	if v == nil {
+		h.refreshVersions(ctx)
+		return h.cachedVersions(ctx)
+	}
+	return *v
+}
+
+func (h *FirewallHandler) handleVersion(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.cachedVersions(r.Context()))
+}
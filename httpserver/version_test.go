@@ -0,0 +1,58 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersions(t *testing.T) {
+	release := filepath.Join(t.TempDir(), "osrelease")
+	require.NoError(t, os.WriteFile(release, []byte("6.8.0-45-generic\n"), 0o600))
+	defer func(path string) { kernelReleasePath = path }(kernelReleasePath)
+	kernelReleasePath = release
+
+	h := newTestHandler(t, FirewallConfig{}, nil)
+	testRunner(h).Output("--version", []byte("nftables v1.0.9 (Old Doc Yak #3)\n"))
+	h.Initialize(context.Background())
+
+	rr := httptest.NewRecorder()
+	h.handleVersion(rr, httptest.NewRequest(http.MethodGet, "/firewall/version", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	var versions Versions
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &versions))
+	require.Equal(t, "nftables v1.0.9 (Old Doc Yak #3)", versions.NFT)
+	require.Equal(t, "6.8.0-45-generic", versions.Kernel)
+
+	rr = httptest.NewRecorder()
+	h.handleConfig(rr, httptest.NewRequest(http.MethodGet, "/firewall/config", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	var cfg EffectiveConfig
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &cfg))
+	require.Equal(t, versions, cfg.Versions)
+	require.Equal(t, "/etc/nftables-production.conf", cfg.ConfigPaths["production"])
+
+	// Cached, nft is only queried once for its version
+	require.Equal(t, []string{"/usr/sbin/nft --version", "/usr/sbin/nft list tables"}, testRunner(h).Calls())
+}
+
+func TestVersionsUnknown(t *testing.T) {
+	defer func(path string) { kernelReleasePath = path }(kernelReleasePath)
+	kernelReleasePath = filepath.Join(t.TempDir(), "missing")
+
+	h := newTestHandler(t, FirewallConfig{}, nil)
+	testRunner(h).Fail("--version", errFake)
+
+	rr := httptest.NewRecorder()
+	h.handleVersion(rr, httptest.NewRequest(http.MethodGet, "/firewall/version", nil))
+	var versions Versions
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &versions))
+	require.Equal(t, "unknown", versions.NFT)
+	require.Equal(t, "unknown", versions.Kernel)
+}
@@ -0,0 +1,97 @@
+package httpserver
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const DefaultWatchDebounce = time.Second
+
+// watchRulesets re-applies the ruleset of the current mode when its file
+// changes. Changes are debounced, so partial writes aren't applied.
+// Directories are watched rather than files, to pick up files replaced by
+// renames, e.g. by editors.
+func (h *FirewallHandler) watchRulesets(ctx context.Context) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		h.log.Error("could not watch the ruleset files", "error", err)
+		return
+	}
+	defer watcher.Close()
+
+	paths := make(map[string]struct{}, len(h.rulesets))
+	for _, rs := range h.rulesets {
+		paths[filepath.Clean(rs.path)] = struct{}{}
+	}
+	watched := make(map[string]struct{})
+	for path := range paths {
+		dir := filepath.Dir(path)
+		if _, ok := watched[dir]; ok {
+			continue
+		}
+		if err := watcher.Add(dir); err != nil {
+			h.log.Error("could not watch the ruleset directory", "dir", dir, "error", err)
+			continue
+		}
+		watched[dir] = struct{}{}
+	}
+
+	changed := make(map[string]struct{})
+	var debounce <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			path := filepath.Clean(event.Name)
+			if _, ok := paths[path]; !ok || !event.Has(fsnotify.Write|fsnotify.Create|fsnotify.Rename) {
+				continue
+			}
+			changed[path] = struct{}{}
+			debounce = time.After(h.config.WatchDebounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			h.log.Warn("ruleset watcher error", "error", err)
+		case <-debounce:
+			debounce = nil
+			h.reloadRuleset(changed)
+			clear(changed)
+		}
+	}
+}
+
+// reloadRuleset re-applies the rules of the current mode if their file is
+// among the changed ones. The new ruleset is checked first, so an invalid
+// file keeps the current rules in place.
+func (h *FirewallHandler) reloadRuleset(changed map[string]struct{}) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	fm := h.mode
+	if fm != Maintenance && fm != Production && fm != Lockdown {
+		return
+	}
+	path := h.rulesets[fm].path
+	if _, ok := changed[filepath.Clean(path)]; !ok {
+		return
+	}
+
+	h.log.Info("ruleset file changed, reloading", "mode", fm, "path", path)
+	if err := h.validateNFTables(fm); err != nil {
+		h.log.Error("not reloading the invalid ruleset, keeping the current rules", "mode", fm, "path", path, "error", err)
+		return
+	}
+	if err := h.applyNFTables(fm); err != nil {
+		h.log.Error("could not reload the ruleset", "mode", fm, "path", path, "error", err)
+		return
+	}
+	h.log.Info("reloaded the ruleset", "mode", fm, "path", path)
+}
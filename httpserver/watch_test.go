@@ -0,0 +1,46 @@
+package httpserver
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchRulesets(t *testing.T) {
+	dir := t.TempDir()
+	productionPath := filepath.Join(dir, "production.conf")
+	require.NoError(t, os.WriteFile(productionPath, []byte("table inet filter { }\n"), 0o600))
+	h := newTestHandler(t, FirewallConfig{
+		ConfigPaths:   map[FirewallMode]string{Production: productionPath},
+		WatchRulesets: true,
+		WatchDebounce: 10 * time.Millisecond,
+	}, nil)
+	t.Cleanup(h.Close)
+	h.mode = Production
+	runner := testRunner(h)
+
+	applies := func() int {
+		return len(slices.DeleteFunc(runner.Calls(), func(c string) bool { return c != DefaultNFTBinary+" -f "+productionPath }))
+	}
+
+	h.tasks.Go(h.watchRulesets)
+	// Rewritten until picked up, the watcher starts asynchronously
+	require.Eventually(t, func() bool {
+		require.NoError(t, os.WriteFile(productionPath, []byte("table inet filter { chain input { } }\n"), 0o600))
+		return applies() > 0
+	}, 5*time.Second, 50*time.Millisecond)
+	require.Contains(t, runner.Calls(), DefaultNFTBinary+" -c -f "+productionPath)
+	require.Equal(t, Production, h.mode)
+
+	// Invalid rulesets are not applied
+	runner.Fail("-c", errors.New("syntax error"))
+	before := applies()
+	require.NoError(t, os.WriteFile(productionPath, []byte("table inet filter {\n"), 0o600))
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, before, applies())
+}
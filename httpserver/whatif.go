@@ -0,0 +1,146 @@
+package httpserver
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// WhatIfPlan describes what a transition would do, without doing it.
+type WhatIfPlan struct {
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason,omitempty"`
+
+	Steps                    []WhatIfStep `json:"steps"`
+	EstimatedDurationSeconds float64      `json:"estimated_duration_seconds"`
+
+	// Established connections are currently never dropped, only new ones are
+	// affected by the applied rules.
+	DropsEstablishedConnections bool `json:"drops_established_connections"`
+}
+
+// WhatIfStep is a single step of a planned transition. For apply steps, the
+// duration is estimated from the last apply of the same mode.
+type WhatIfStep struct {
+	Action          string  `json:"action"`
+	Description     string  `json:"description"`
+	Command         string  `json:"command,omitempty"`
+	DurationSeconds float64 `json:"duration_seconds,omitempty"`
+}
+
+// applyPlanner is implemented by backends which can describe how they would
+// apply the rules of a mode, e.g. with the command they would run.
+type applyPlanner interface {
+	planApply(from, to FirewallMode) WhatIfStep
+}
+
+func (b nftBackend) planApply(_, to FirewallMode) WhatIfStep {
+	return WhatIfStep{
+		Description: "apply the " + to.String() + " rules with nft",
+		Command:     strings.Join(append([]string{b.h.config.NFTBinary}, b.h.applyArgs(to)...), " "),
+	}
+}
+
+func (b agentBackend) planApply(from, to FirewallMode) WhatIfStep {
+	description := "ask the agent at " + b.socket + " to apply the " + to.String() + " rules"
+	if from == TransitionToMaintenance {
+		description += " and remove the transition rules"
+	}
+	return WhatIfStep{Description: description}
+}
+
+// applyStep returns the step applying the rules of mode `to` with the active
+// backend. Must be called with the lock held.
+func (h *FirewallHandler) applyStep(from, to FirewallMode) WhatIfStep {
+	step := WhatIfStep{Description: "apply the " + to.String() + " rules with the " + h.backend.Name() + " backend"}
+	if planner, ok := h.backend.(applyPlanner); ok {
+		step = planner.planApply(from, to)
+	}
+	step.Action = "apply"
+	step.DurationSeconds = h.lastApplyDurations[to].Seconds()
+	return step
+}
+
+// planTransition returns the steps a transition to the given mode would
+// take. Must be called with the lock held.
+func (h *FirewallHandler) planTransition(to FirewallMode) WhatIfPlan {
+	plan := WhatIfPlan{From: h.mode.String(), To: to.String(), Allowed: true}
+
+	var steps []WhatIfStep
+	if h.config.RejectTransitionsOnDrift {
+		steps = append(steps, WhatIfStep{
+			Action:      "check_drift",
+			Description: "reject the transition if the live ruleset drifted since the last apply",
+		})
+	}
+
+	switch to {
+	case Maintenance:
+		if !h.requestable(TransitionToMaintenance) {
+			plan.Allowed = false
+			plan.Reason = "maintenance transition request not from production mode"
+		}
+		steps = append(steps, h.applyStep(Production, TransitionToMaintenance))
+		switch {
+		case h.config.TransitionDuration > 0 && h.config.DrainPollInterval > 0:
+			steps = append(steps, WhatIfStep{
+				Action:          "wait",
+				Description:     fmt.Sprintf("drain connections until at most %d are tracked by conntrack, at most for the transition duration", h.config.DrainThreshold),
+				DurationSeconds: h.config.TransitionDuration.Seconds(),
+			})
+		case h.config.TransitionDuration > 0:
+			steps = append(steps, WhatIfStep{
+				Action:          "wait",
+				Description:     "drain connections for the transition duration",
+				DurationSeconds: h.config.TransitionDuration.Seconds(),
+			})
+		}
+		steps = append(steps, h.applyStep(TransitionToMaintenance, Maintenance))
+		if _, ok := h.backend.(ruleRemover); ok {
+			steps = append(steps, WhatIfStep{
+				Action:      "remove_transition_rules",
+				Description: "delete the transition rules by the handles echoed when they were applied, unless their table was recreated",
+			})
+		}
+		steps = append(steps, WhatIfStep{
+			Action:      "revert_on_failure",
+			Description: "re-apply the production rules if applying maintenance fails",
+		})
+	case Production:
+		if !h.requestable(Production) {
+			plan.Allowed = false
+			plan.Reason = "production transition request not from maintenance mode"
+		}
+		steps = append(steps, h.applyStep(Maintenance, Production))
+		steps = append(steps, WhatIfStep{
+			Action:      "revert_on_failure",
+			Description: "re-apply the maintenance rules if applying production fails",
+		})
+	}
+
+	if err := h.checkDwell(to); err != nil && plan.Allowed {
+		plan.Allowed = false
+		plan.Reason = err.Error()
+	}
+
+	plan.Steps = steps
+	for _, step := range steps {
+		plan.EstimatedDurationSeconds += step.DurationSeconds
+	}
+	return plan
+}
+
+func (h *FirewallHandler) handleWhatIf(w http.ResponseWriter, r *http.Request) {
+	to, err := ParseFirewallMode(r.URL.Query().Get("to"))
+	if err != nil || (to != Maintenance && to != Production) {
+		http.Error(w, fmt.Sprintf("invalid target mode %q, expected maintenance or production", r.URL.Query().Get("to")), http.StatusBadRequest)
+		return
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	writeJSON(w, http.StatusOK, h.planTransition(to))
+}
@@ -0,0 +1,101 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func getWhatIf(t *testing.T, h *FirewallHandler, to string) (int, WhatIfPlan) {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	h.handleWhatIf(rr, httptest.NewRequest(http.MethodGet, "/firewall/what-if?to="+to, nil))
+
+	var plan WhatIfPlan
+	if rr.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &plan))
+	}
+	return rr.Code, plan
+}
+
+func whatIfActions(plan WhatIfPlan) []string {
+	actions := make([]string, 0, len(plan.Steps))
+	for _, step := range plan.Steps {
+		actions = append(actions, step.Action)
+	}
+	return actions
+}
+
+func TestWhatIfMaintenance(t *testing.T) {
+	h := newTestHandler(t, FirewallConfig{TransitionDuration: 5 * time.Minute, RejectTransitionsOnDrift: true}, nil)
+	h.mode = Production
+
+	code, plan := getWhatIf(t, h, "maintenance")
+	require.Equal(t, http.StatusOK, code)
+	require.True(t, plan.Allowed)
+	require.Equal(t, "production", plan.From)
+
+	require.Equal(t, []string{"check_drift", "apply", "wait", "apply", "remove_transition_rules", "revert_on_failure"}, whatIfActions(plan))
+	require.Equal(t, "/usr/sbin/nft --echo --handle -f /etc/nftables-transition.conf", plan.Steps[1].Command)
+	require.InDelta(t, 300, plan.Steps[2].DurationSeconds, 0)
+	require.Equal(t, "/usr/sbin/nft -f /etc/nftables-maintenance.conf", plan.Steps[3].Command)
+	require.InDelta(t, 300, plan.EstimatedDurationSeconds, 0)
+
+	// Nothing was executed
+	require.Empty(t, testRunner(h).Calls())
+	require.Equal(t, Production, h.mode)
+}
+
+func TestWhatIfProduction(t *testing.T) {
+	h := newTestHandler(t, FirewallConfig{TransitionDuration: 0}, nil)
+	h.lastApplyDurations[Production] = 2 * time.Second
+
+	code, plan := getWhatIf(t, h, "production")
+	require.Equal(t, http.StatusOK, code)
+	require.True(t, plan.Allowed)
+	require.Len(t, plan.Steps, 2)
+	require.InDelta(t, 2, plan.EstimatedDurationSeconds, 0)
+
+	// Not allowed from maintenance, no wait step with zero transition duration
+	code, plan = getWhatIf(t, h, "maintenance")
+	require.Equal(t, http.StatusOK, code)
+	require.False(t, plan.Allowed)
+	require.Contains(t, plan.Reason, "not from production mode")
+	for _, step := range plan.Steps {
+		require.NotEqual(t, "wait", step.Action)
+	}
+
+	code, _ = getWhatIf(t, h, "transition_to_maintenance")
+	require.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestWhatIfBackend(t *testing.T) {
+	t.Run("agent", func(t *testing.T) {
+		h := newTestHandler(t, FirewallConfig{AgentSocket: "/run/agent.sock", TransitionDuration: time.Minute}, nil)
+		h.mode = Production
+		_, plan := getWhatIf(t, h, "maintenance")
+		require.Equal(t, []string{"apply", "wait", "apply", "revert_on_failure"}, whatIfActions(plan))
+		require.Empty(t, plan.Steps[0].Command)
+		require.Equal(t, "ask the agent at /run/agent.sock to apply the maintenance rules and remove the transition rules", plan.Steps[2].Description)
+	})
+
+	t.Run("custom", func(t *testing.T) {
+		h := newTestHandler(t, FirewallConfig{Backend: &fakeBackend{}}, nil)
+		_, plan := getWhatIf(t, h, "production")
+		require.Empty(t, plan.Steps[0].Command)
+		require.Equal(t, "apply the production rules with the fake backend", plan.Steps[0].Description)
+	})
+
+	t.Run("drain until idle", func(t *testing.T) {
+		h := newTestHandler(t, FirewallConfig{TransitionDuration: time.Minute, DrainPollInterval: time.Second, DrainThreshold: 3}, nil)
+		h.mode = Production
+		_, plan := getWhatIf(t, h, "maintenance")
+		require.Equal(t, "wait", plan.Steps[1].Action)
+		require.Contains(t, plan.Steps[1].Description, "until at most 3 are tracked by conntrack")
+		require.InDelta(t, 60, plan.Steps[1].DurationSeconds, 0)
+	})
+}
@@ -87,6 +87,12 @@ func (ms *MetricsServer) Shutdown(ctx context.Context) error {
 	return ms.server.Shutdown(ctx)
 }
 
+// Registerer returns the registry of the server, for Prometheus collectors
+// to be served along with the OpenTelemetry metrics.
+func (ms *MetricsServer) Registerer() prometheus.Registerer {
+	return ms.registry
+}
+
 // Float64Histogram returns a float64 histogram with given name and
 // parameters.
 //